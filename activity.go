@@ -0,0 +1,48 @@
+package traefik_cloud_saver
+
+import (
+	"fmt"
+)
+
+// ActivityMetric is a Prometheus metric family, in addition to the request counter, which counts as
+// activity for a service.  A service is only idle when its requests and all of its activity
+// metrics are below their thresholds.
+type ActivityMetric struct {
+	Name      string  `json:"name"`                // e.g. traefik_service_open_connections
+	Threshold float64 `json:"threshold,omitempty"` // activity at or above this keeps the service up
+	Gauge     bool    `json:"gauge,omitempty"`     // compare the current value rather than the per minute increase
+}
+
+// activityFamilies returns the metric families the collector must track, and whether each is a
+// gauge
+func activityFamilies(activityMetrics map[string][]ActivityMetric) (map[string]bool, error) {
+	families := make(map[string]bool)
+	for serviceName, metrics := range activityMetrics {
+		for _, metric := range metrics {
+			if gauge, ok := families[metric.Name]; ok && gauge != metric.Gauge {
+				return nil, fmt.Errorf("activity metric %s for service %s is configured as both a gauge and a counter", metric.Name, serviceName)
+			}
+			families[metric.Name] = metric.Gauge
+		}
+	}
+	return families, nil
+}
+
+// activeMetric returns a description of the first activity metric keeping one of the traefik
+// services sharing a cloud service up, or an empty string if they're all below their thresholds.
+// Activity is weighted the same way as the request rate, open TCP connections always count.
+func (p *CloudSaver) activeMetric(members []*instanceMember) string {
+	if open := p.tcpConnections(members); open != "" {
+		return open
+	}
+	for _, member := range members {
+		weight := p.serviceWeight(member.serviceName)
+		for _, metric := range p.activityMetrics[stripProvider(member.serviceName)] {
+			value := member.rate.Activity[metric.Name] * weight
+			if value >= metric.Threshold {
+				return fmt.Sprintf("%s %s %.2f >= %.2f", member.serviceName, metric.Name, value, metric.Threshold)
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+)
+
+func TestActivityMetrics(t *testing.T) {
+	connections := []ActivityMetric{{Name: "traefik_service_open_connections", Threshold: 1, Gauge: true}}
+
+	tests := []struct {
+		name      string
+		activity  map[string][]ActivityMetric
+		weights   map[string]float64
+		metrics   string
+		wantScale int32
+	}{
+		{
+			name:     "no requests and no connections is idle",
+			activity: map[string][]ActivityMetric{"app": connections},
+			metrics: `
+traefik_service_requests_total{service="app@docker"} 0
+traefik_service_open_connections{service="app@docker",entrypoint="web"} 0
+`,
+			wantScale: 0,
+		},
+		{
+			name:     "open connections keep an instance without requests up",
+			activity: map[string][]ActivityMetric{"app": connections},
+			metrics: `
+traefik_service_requests_total{service="app@docker"} 0
+traefik_service_open_connections{service="app@docker",entrypoint="web"} 1
+traefik_service_open_connections{service="app@docker",entrypoint="websecure"} 2
+`,
+			wantScale: 1,
+		},
+		{
+			name:     "requests keep an instance without connections up",
+			activity: map[string][]ActivityMetric{"app": connections},
+			metrics: `
+traefik_service_requests_total{service="app@docker"} 10
+traefik_service_open_connections{service="app@docker",entrypoint="web"} 0
+`,
+			wantScale: 1,
+		},
+		{
+			name:     "connections only count for services configured to use them",
+			activity: nil,
+			metrics: `
+traefik_service_requests_total{service="app@docker"} 0
+traefik_service_open_connections{service="app@docker",entrypoint="web"} 5
+`,
+			wantScale: 0,
+		},
+		{
+			name:     "activity is weighted like requests",
+			activity: map[string][]ActivityMetric{"app": connections},
+			weights:  map[string]float64{"app": 0.1},
+			metrics: `
+traefik_service_requests_total{service="app@docker"} 0
+traefik_service_open_connections{service="app@docker",entrypoint="web"} 5
+`,
+			wantScale: 0,
+		},
+		{
+			name: "counter activity is a per minute increase",
+			activity: map[string][]ActivityMetric{"app": {
+				{Name: "traefik_service_requests_bytes_total", Threshold: 1000},
+			}},
+			metrics: `
+traefik_service_requests_total{service="app@docker"} 0
+traefik_service_requests_bytes_total{service="app@docker",method="GET"} 4096
+`,
+			wantScale: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			backend.addService("app@docker", "app@docker")
+			backend.setMetrics(tt.metrics, "")
+
+			saver, cloud := newTestSaver(t, backend, map[string]int32{"app": 1}, func(c *Config) {
+				c.WindowSize = "1m"
+				c.ActivityMetrics = tt.activity
+				c.ServiceWeights = tt.weights
+			})
+
+			if _, err := saver.generateConfiguration(context.Background()); err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+
+			if scale := currentScale(t, cloud, "app"); scale != tt.wantScale {
+				t.Errorf("expected app scale %d, got %d", tt.wantScale, scale)
+			}
+		})
+	}
+}
+
+func TestActivityMetricsConfig(t *testing.T) {
+	config := CreateConfig()
+	config.testMode = true
+	config.ActivityMetrics = map[string][]ActivityMetric{
+		"app": {{Name: "traefik_service_open_connections", Threshold: 1, Gauge: true}},
+		"api": {{Name: "traefik_service_open_connections", Threshold: 1}},
+	}
+	if _, err := New(context.Background(), config, "test"); err == nil {
+		t.Error("expected an error for a metric configured as both a gauge and a counter")
+	}
+
+	for name, metric := range map[string]ActivityMetric{
+		"missing name":       {Threshold: 1},
+		"negative threshold": {Name: "traefik_service_open_connections", Threshold: -1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := CreateConfig()
+			config.testMode = true
+			config.ActivityMetrics = map[string][]ActivityMetric{"app": {metric}}
+			if err := config.Validate(); err == nil {
+				t.Error("expected Validate() to reject the activity metric")
+			}
+		})
+	}
+}
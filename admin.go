@@ -0,0 +1,156 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// wakePath is the admin endpoint scaling a service up on demand, followed by the service name
+const wakePath = "/wake/"
+
+// startAdmin serves the admin endpoints on adminAddress, if set.  They aren't authenticated, so
+// the address should only be reachable by Traefik and trusted probes.
+func (p *CloudSaver) startAdmin() error {
+	if p.adminAddress == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", p.adminAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s for admin requests: %w", p.adminAddress, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(wakePath, p.serveWake)
+	p.adminServer = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	p.adminListener = listener
+
+	go func() {
+		if err := p.adminServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			common.LogProvider("traefik-cloud-saver", "[ERROR]: admin server stopped: %v", err)
+		}
+	}()
+
+	common.LogProvider("traefik-cloud-saver", "Serving wake up requests on %s%s{service}", listener.Addr(), wakePath)
+	return nil
+}
+
+// serveWake handles POST /wake/{service}, where service is a traefik service, with or without its
+// @provider, or a cloud service name
+func (p *CloudSaver) serveWake(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, wakePath)
+	if name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	status, message := p.wake(r.Context(), name)
+	http.Error(w, message, status)
+}
+
+// wake scales a cloud service up on request, without waiting for the next window, and returns the
+// HTTP status and message to answer with.  Once the checks pass the request is accepted right away
+// and the scale up runs in the background, since starting an instance can take minutes.  It runs
+// on the provider's context rather than the request's, so it outlives a caller giving up on the
+// response but not the provider.  The service's latch is cleared, since the request is the traffic
+// it was waiting on.  The sleeping router stays in place until the next window drops it.
+func (p *CloudSaver) wake(ctx context.Context, name string) (int, string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ctx.Err() != nil {
+		return http.StatusServiceUnavailable, "cloud saver is stopping"
+	}
+
+	cloudServiceName := p.getCloudServiceName(name)
+	if !p.managedServices[cloudServiceName] {
+		return http.StatusNotFound, fmt.Sprintf("service %s is not managed by cloud saver", name)
+	}
+	if p.waking[cloudServiceName] {
+		return http.StatusAccepted, fmt.Sprintf("service %s is already starting", cloudServiceName)
+	}
+
+	// decisions are counted against the traefik services sleeping on the cloud service
+	members := p.sleepingMembers(cloudServiceName, name)
+	decide := func(action, reason string) {
+		for _, member := range members {
+			p.decide(member, action, reason)
+		}
+	}
+
+	if scale, err := p.cloudService.GetCurrentScale(ctx, cloudServiceName); err == nil && scale > 0 {
+		return http.StatusOK, fmt.Sprintf("service %s is already running", cloudServiceName)
+	}
+	delete(p.latches, cloudServiceName)
+
+	if p.inCooldown(cloudServiceName, actionScaleUp) {
+		decide(actionKeep, reasonCooldown)
+		return http.StatusConflict, fmt.Sprintf("service %s is in cooldown", cloudServiceName)
+	}
+	if unhealthy := p.unhealthyDependency(ctx, cloudServiceName); unhealthy != "" {
+		decide(actionKeep, reasonDependency)
+		return http.StatusConflict, fmt.Sprintf("service %s not scaled up, %s", cloudServiceName, unhealthy)
+	}
+	if p.skipDryRun(actionScaleUp, cloudServiceName, "(%s), requested", strings.Join(members, ", ")) {
+		decide(actionKeep, reasonDryRun)
+		return http.StatusAccepted, fmt.Sprintf("dry run, service %s not scaled up", cloudServiceName)
+	}
+
+	common.LogProvider("traefik-cloud-saver", "Wake up requested for service %s (%s), scaling it up", cloudServiceName, strings.Join(members, ", "))
+	p.waking[cloudServiceName] = true
+	p.wakes.Add(1)
+	go p.finishWake(p.ctx, cloudServiceName, members)
+	return http.StatusAccepted, fmt.Sprintf("service %s is starting", cloudServiceName)
+}
+
+// finishWake scales up a cloud service whose wake request was accepted.  The lock is only taken
+// once the provider is done, so the windows and the state readers aren't held up meanwhile.
+func (p *CloudSaver) finishWake(ctx context.Context, cloudServiceName string, members []string) {
+	defer p.wakes.Done()
+	err := p.withScaleLock(ctx, cloudServiceName, func() error {
+		return p.scaleUpToTarget(ctx, cloudServiceName)
+	})
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.waking, cloudServiceName)
+	p.trackQuarantine(cloudServiceName, err)
+	decide := func(action, reason string) {
+		for _, member := range members {
+			p.decide(member, action, reason)
+		}
+	}
+
+	switch {
+	case err == nil:
+		p.recordScaleUp(cloudServiceName)
+		decide(actionScaleUp, reasonWakeRequest)
+		p.notify(cloudServiceName, actionScaleUp, reasonWakeRequest, 0, 0)
+	case errors.Is(err, common.ErrNotEligible):
+		common.LogProvider("traefik-cloud-saver", "Not scaling up service %s on request: %v", cloudServiceName, err)
+		decide(actionKeep, reasonInstancePolicy)
+	case errors.Is(err, common.ErrQuarantined):
+		decide(actionKeep, reasonQuarantined)
+	case p.ctx.Err() != nil:
+		common.LogProvider("traefik-cloud-saver", "Wake up of service %s cancelled, the provider is stopping", cloudServiceName)
+		decide(actionKeep, reasonWakeRequest)
+	case errors.Is(err, errLockHeld):
+		common.LogProvider("traefik-cloud-saver", "Not scaling up service %s on request: another replica holds its lock", cloudServiceName)
+		decide(actionKeep, reasonLocked)
+	default:
+		common.LogProvider("traefik-cloud-saver", "[ERROR]: failed to scale up service %s on request, err: %s", cloudServiceName, err)
+		decide(actionScaleUp, reasonError)
+	}
+}
@@ -0,0 +1,195 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/mock"
+)
+
+func TestWakeRequest(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"idle": 1}, func(c *Config) {
+		c.AdminAddr = "127.0.0.1:0"
+	})
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, svc, "idle"); scale != 0 {
+		t.Fatalf("expected idle to be scaled down, got scale %d", scale)
+	}
+	if _, ok := saver.latches["idle"]; !ok {
+		t.Fatal("expected idle to be latched after its scale down")
+	}
+
+	if err := saver.startAdmin(); err != nil {
+		t.Fatalf("startAdmin() failed: %v", err)
+	}
+	defer saver.adminServer.Close()
+	wake := func(method, name string) int {
+		t.Helper()
+		req, err := http.NewRequest(method, "http://"+saver.adminListener.Addr().String()+wakePath+name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, name, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := wake(http.MethodGet, "idle@docker"); status != http.StatusMethodNotAllowed {
+		t.Errorf("GET returned %d, want %d", status, http.StatusMethodNotAllowed)
+	}
+	if status := wake(http.MethodPost, "unknown@docker"); status != http.StatusNotFound {
+		t.Errorf("unknown service returned %d, want %d", status, http.StatusNotFound)
+	}
+
+	if status := wake(http.MethodPost, "idle@docker"); status != http.StatusAccepted {
+		t.Fatalf("wake returned %d, want %d", status, http.StatusAccepted)
+	}
+	saver.wakes.Wait()
+	if scale := currentScale(t, svc, "idle"); scale != 1 {
+		t.Errorf("expected idle to be scaled up on request, got scale %d", scale)
+	}
+	if _, ok := saver.latches["idle"]; ok {
+		t.Error("expected the wake up to clear the latch")
+	}
+	if got := saver.decisions.count("idle@docker", actionScaleUp, reasonWakeRequest); got != 1 {
+		t.Errorf("expected 1 wake request decision, got %d", got)
+	}
+
+	// the cloud service name works too, and a running service is left alone
+	if status := wake(http.MethodPost, "idle"); status != http.StatusOK {
+		t.Errorf("waking a running service returned %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestWakeRequestCooldown(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"idle": 1}, func(c *Config) {
+		c.CooldownPeriod = "1h"
+	})
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	saver.serveWake(recorder, httptest.NewRequest(http.MethodPost, wakePath+"idle@docker", nil))
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("wake in cooldown returned %d, want %d", recorder.Code, http.StatusConflict)
+	}
+	if scale := currentScale(t, svc, "idle"); scale != 0 {
+		t.Errorf("expected the cooldown to keep idle down, got scale %d", scale)
+	}
+	if got := saver.decisions.count("idle@docker", actionKeep, reasonCooldown); got != 1 {
+		t.Errorf("expected 1 cooldown decision, got %d", got)
+	}
+}
+
+// slowService blocks its scale ups until released or cancelled, like a provider starting an
+// instance
+type slowService struct {
+	*mock.Service
+	release chan struct{}
+}
+
+func (s *slowService) ScaleTo(ctx context.Context, serviceName string, target int32) error {
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.Service.ScaleTo(ctx, serviceName, target)
+}
+
+func TestWakeRequestDoesNotBlock(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"idle": 1}, nil)
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	slow := &slowService{Service: svc, release: make(chan struct{})}
+	saver.cloudService = slow
+
+	wake := func() int {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		saver.serveWake(recorder, httptest.NewRequest(http.MethodPost, wakePath+"idle@docker", nil))
+		return recorder.Code
+	}
+	if status := wake(); status != http.StatusAccepted {
+		t.Fatalf("wake returned %d, want %d", status, http.StatusAccepted)
+	}
+	// the scale up is still running, the state and a second request are answered meanwhile
+	if state := saver.State(); len(state.Sleeping) != 1 {
+		t.Errorf("expected idle to still be reported sleeping, got %v", state.Sleeping)
+	}
+	if status := wake(); status != http.StatusAccepted {
+		t.Errorf("second wake returned %d, want %d", status, http.StatusAccepted)
+	}
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if got := saver.decisions.count("idle@docker", actionKeep, reasonWakeRequest); got != 1 {
+		t.Errorf("expected the window to leave idle to the wake up, got %d decisions", got)
+	}
+
+	close(slow.release)
+	saver.wakes.Wait()
+	if scale := currentScale(t, svc, "idle"); scale != 1 {
+		t.Errorf("expected idle to be scaled up on request, got scale %d", scale)
+	}
+	if got := saver.decisions.count("idle@docker", actionScaleUp, reasonWakeRequest); got != 1 {
+		t.Errorf("expected 1 wake request decision, got %d", got)
+	}
+}
+
+func TestStopCancelsWakeRequests(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"idle": 1}, nil)
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	saver.cloudService = &slowService{Service: svc, release: make(chan struct{})}
+
+	wake := func() int {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		saver.serveWake(recorder, httptest.NewRequest(http.MethodPost, wakePath+"idle@docker", nil))
+		return recorder.Code
+	}
+	if status := wake(); status != http.StatusAccepted {
+		t.Fatalf("wake returned %d, want %d", status, http.StatusAccepted)
+	}
+
+	// the scale up never finishes by itself, Stop cancels it and waits for it to be done
+	if err := saver.Stop(); err != nil {
+		t.Fatalf("Stop() failed: %v", err)
+	}
+	if state := saver.State(); len(state.Sleeping) != 1 {
+		t.Errorf("expected idle to stay asleep, got %v", state.Sleeping)
+	}
+	if got := saver.decisions.count("idle@docker", actionScaleUp, reasonError); got != 0 {
+		t.Errorf("expected the cancelled wake up not to count as an error, got %d", got)
+	}
+	if status := wake(); status != http.StatusServiceUnavailable {
+		t.Errorf("wake after Stop returned %d, want %d", status, http.StatusServiceUnavailable)
+	}
+}
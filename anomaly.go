@@ -0,0 +1,103 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+	"github.com/traefik/genconf/dynamic"
+)
+
+// minServicesForIdenticalRates is the number of services that must report the exact same
+// (non-zero) rate before we consider the metrics suspicious.  With fewer services an identical
+// rate is plausible, with more it usually means the data is stale or synthetic.
+const minServicesForIdenticalRates = 3
+
+// detectAnomaly checks the scraped rates for signs that the metrics data can't be trusted.
+// It returns a human readable reason, or an empty string if the data looks sane.
+func (p *CloudSaver) detectAnomaly(rates map[string]*ServiceRate) string {
+	// services we were tracking have all disappeared from the metrics
+	if len(rates) == 0 && p.lastServiceCount > 0 {
+		return fmt.Sprintf("service count dropped from %d to 0", p.lastServiceCount)
+	}
+
+	// every service reports exactly the same rate.  All zero is normal (everything idle),
+	// so only identical non-zero rates are treated as suspicious.
+	if len(rates) >= minServicesForIdenticalRates {
+		var first float64
+		identical := true
+		i := 0
+		for _, rate := range rates {
+			if i == 0 {
+				first = rate.PerMin
+			} else if rate.PerMin != first {
+				identical = false
+				break
+			}
+			i++
+		}
+		if identical && first != 0 {
+			return fmt.Sprintf("all %d services report an identical rate of %.2f req/min", len(rates), first)
+		}
+	}
+
+	return ""
+}
+
+// failOpen makes sure every managed service is scaled up.  It's used when the metrics look bad,
+// since shutting instances down based on bad data is far worse than leaving them running.  Only
+// the services actually running again stop being shadowed, the configuration keeps the rest.
+func (p *CloudSaver) failOpen(ctx context.Context, reason string) (*dynamic.JSONPayload, error) {
+	common.LogProvider("traefik-cloud-saver", "[ALERT]: metrics anomaly detected (%s), failing open and scaling up all managed services", reason)
+
+	running := make(map[string]bool)
+	for cloudServiceName := range p.managedServices {
+		if p.waking[cloudServiceName] {
+			continue
+		}
+		members := p.sleepingMembers(cloudServiceName, cloudServiceName)
+		decide := func(action, reason string) {
+			for _, member := range members {
+				p.decide(member, action, reason)
+			}
+		}
+
+		scale, err := p.cloudService.GetCurrentScale(ctx, cloudServiceName)
+		if err == nil && scale > 0 {
+			running[cloudServiceName] = true
+			continue
+		}
+
+		if p.skipDryRun(actionScaleUp, cloudServiceName, "(failing open)") {
+			decide(actionKeep, reasonDryRun)
+			continue
+		}
+		if err := p.scaleUp(ctx, cloudServiceName); err != nil {
+			if errors.Is(err, common.ErrQuarantined) {
+				decide(actionKeep, reasonQuarantined)
+				continue
+			}
+			common.LogProvider("traefik-cloud-saver", "[ERROR]: failed to scale up service %s while failing open, err: %s", cloudServiceName, err)
+			decide(actionScaleUp, reasonError)
+			continue
+		}
+		running[cloudServiceName] = true
+		decide(actionScaleUp, reasonAnomaly)
+		p.notify(cloudServiceName, actionScaleUp, reasonAnomaly, 0, 0)
+		common.LogProvider("traefik-cloud-saver", "Scaled up service %s (fail open)", cloudServiceName)
+	}
+
+	// stop shadowing the routers of the services running again
+	for serviceName, svc := range p.sleeping {
+		if running[svc.cloudName] {
+			delete(p.sleeping, serviceName)
+		}
+	}
+	configuration, err := p.buildConfiguration(ctx, p.sleeping)
+	if err != nil {
+		p.summary.errors++
+		return nil, err
+	}
+	return configuration, nil
+}
@@ -0,0 +1,218 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/mock"
+)
+
+func TestFailOpenOnAnomaly(t *testing.T) {
+	initialMetrics := `
+traefik_service_requests_total{service="svc1@docker"} 10
+traefik_service_requests_total{service="svc2@docker"} 20
+traefik_service_requests_total{service="svc3@docker"} 30
+`
+	tests := []struct {
+		name        string
+		metrics     string
+		contentType string
+	}{
+		{
+			name:        "metrics endpoint returns html",
+			metrics:     "<html><body>Please log in</body></html>",
+			contentType: "text/html; charset=utf-8",
+		},
+		{
+			name:    "html without content type",
+			metrics: "<!DOCTYPE html>\n<html></html>",
+		},
+		{
+			name:    "all services disappear",
+			metrics: "# no metrics\n",
+		},
+		{
+			name: "all rates identical",
+			metrics: `
+traefik_service_requests_total{service="svc1@docker"} 110
+traefik_service_requests_total{service="svc2@docker"} 120
+traefik_service_requests_total{service="svc3@docker"} 130
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			backend.addService("svc1@docker", "r1@docker")
+			backend.addService("svc2@docker", "r2@docker")
+			backend.addService("svc3@docker", "r3@docker")
+			backend.setMetrics(initialMetrics, "")
+
+			saver, cloud := newTestSaver(t, backend, map[string]int32{"svc1": 1, "svc2": 1, "svc3": 1}, func(c *Config) {
+				c.FailOpenOnAnomaly = true
+			})
+
+			// first window registers the managed services, all above threshold
+			if _, err := saver.generateConfiguration(context.Background()); err != nil {
+				t.Fatalf("first generateConfiguration() failed: %v", err)
+			}
+
+			// pretend the instances were stopped in the meantime
+			cloud.SetScale("svc1", 0)
+			cloud.SetScale("svc2", 0)
+			cloud.SetScale("svc3", 0)
+
+			time.Sleep(10 * time.Millisecond)
+			backend.setMetrics(tt.metrics, tt.contentType)
+
+			if _, err := saver.generateConfiguration(context.Background()); err != nil {
+				t.Fatalf("generateConfiguration() should fail open, not error: %v", err)
+			}
+
+			for _, svc := range []string{"svc1", "svc2", "svc3"} {
+				if scale := currentScale(t, cloud, svc); scale != 1 {
+					t.Errorf("expected %s to be scaled up to 1, got %d", svc, scale)
+				}
+			}
+		})
+	}
+}
+
+func TestFailOpenDisabled(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.setMetrics("<html></html>", "text/html")
+
+	saver, _ := newTestSaver(t, backend, map[string]int32{"svc1": 1}, nil)
+
+	if _, err := saver.generateConfiguration(context.Background()); err == nil {
+		t.Error("expected an error for html metrics when failOpenOnAnomaly is disabled")
+	}
+}
+
+func TestDetectAnomaly(t *testing.T) {
+	tests := []struct {
+		name             string
+		lastServiceCount int
+		rates            map[string]*ServiceRate
+		wantAnomaly      bool
+	}{
+		{
+			name:             "no services on first run",
+			lastServiceCount: 0,
+			rates:            map[string]*ServiceRate{},
+			wantAnomaly:      false,
+		},
+		{
+			name:             "services dropped to zero",
+			lastServiceCount: 2,
+			rates:            map[string]*ServiceRate{},
+			wantAnomaly:      true,
+		},
+		{
+			name:             "all idle is not an anomaly",
+			lastServiceCount: 3,
+			rates: map[string]*ServiceRate{
+				"a": {PerMin: 0}, "b": {PerMin: 0}, "c": {PerMin: 0},
+			},
+			wantAnomaly: false,
+		},
+		{
+			name:             "identical non-zero rates",
+			lastServiceCount: 3,
+			rates: map[string]*ServiceRate{
+				"a": {PerMin: 4.2}, "b": {PerMin: 4.2}, "c": {PerMin: 4.2},
+			},
+			wantAnomaly: true,
+		},
+		{
+			name:             "two identical rates are plausible",
+			lastServiceCount: 2,
+			rates: map[string]*ServiceRate{
+				"a": {PerMin: 4.2}, "b": {PerMin: 4.2},
+			},
+			wantAnomaly: false,
+		},
+		{
+			name:             "different rates",
+			lastServiceCount: 3,
+			rates: map[string]*ServiceRate{
+				"a": {PerMin: 1}, "b": {PerMin: 2}, "c": {PerMin: 3},
+			},
+			wantAnomaly: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saver := &CloudSaver{lastServiceCount: tt.lastServiceCount}
+			reason := saver.detectAnomaly(tt.rates)
+			if (reason != "") != tt.wantAnomaly {
+				t.Errorf("detectAnomaly() = %q, wantAnomaly %v", reason, tt.wantAnomaly)
+			}
+		})
+	}
+}
+
+// failingService fails the scale ups of one service
+type failingService struct {
+	*mock.Service
+	failing string
+}
+
+func (s *failingService) ScaleTo(ctx context.Context, serviceName string, target int32) error {
+	if serviceName == s.failing {
+		return errors.New("quota exceeded")
+	}
+	return s.Service.ScaleTo(ctx, serviceName, target)
+}
+
+func TestFailOpenKeepsFailedServicesAsleep(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.addService("broken@docker", "broken@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="idle@docker"} 0
+traefik_service_requests_total{service="broken@docker"} 0
+`, "")
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"idle": 1, "broken": 1}, func(c *Config) {
+		c.ScrapeFailurePolicy = scrapeFailureFailOpen
+	})
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("first generateConfiguration() failed: %v", err)
+	}
+	if len(saver.sleeping) != 2 {
+		t.Fatalf("expected both services to be sleeping, got %v", saver.sleeping)
+	}
+
+	saver.cloudService = &failingService{Service: svc, failing: "broken"}
+	saver.metricsCollector.metricsURL = brokenMetricsURL(t)
+	configuration, err := saver.generateConfiguration(context.Background())
+	if err != nil {
+		t.Fatalf("generateConfiguration() should fail open, not error: %v", err)
+	}
+
+	if scale := currentScale(t, svc, "idle"); scale != 1 {
+		t.Errorf("expected idle to be scaled up, got %d", scale)
+	}
+	if _, ok := saver.sleeping["idle@docker"]; ok {
+		t.Error("expected idle to no longer be sleeping")
+	}
+	if _, ok := saver.sleeping["broken@docker"]; !ok {
+		t.Error("expected broken to still be sleeping after its scale up failed")
+	}
+	if _, ok := configuration.HTTP.Routers[configPrefix+"broken"]; !ok {
+		t.Errorf("expected broken to keep its sleeping router, got %v", configuration.HTTP.Routers)
+	}
+
+	// decisions are made against the traefik services
+	if got := saver.decisions.count("idle@docker", actionScaleUp, reasonAnomaly); got != 1 {
+		t.Errorf("expected 1 fail open decision for idle@docker, got %d", got)
+	}
+	if got := saver.decisions.count("broken@docker", actionScaleUp, reasonError); got != 1 {
+		t.Errorf("expected 1 error decision for broken@docker, got %d", got)
+	}
+}
@@ -0,0 +1,39 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultAPITimeout bounds every request to the Traefik API, so a hung API can't hold up a window
+const defaultAPITimeout = 10 * time.Second
+
+// parseAPITimeout returns the timeout of requests to the Traefik API, defaultAPITimeout when unset
+func parseAPITimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultAPITimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("api timeout must be a positive duration, got %q", value)
+	}
+	return timeout, nil
+}
+
+// apiGet fetches a path of the Traefik API, e.g. /http/routers, with the shared client and the API
+// credentials.  Cancelling ctx, e.g. by stopping the provider, cancels the request.
+func (p *CloudSaver) apiGet(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.apiURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	p.apiAuth.apply(req)
+
+	client := p.apiClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
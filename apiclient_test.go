@@ -0,0 +1,128 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAPIAuth(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("web@docker", "web@docker")
+
+	// the API is only served with credentials, like a protected dashboard
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, basic := r.BasicAuth()
+		if r.Header.Get("Authorization") != "Bearer s3cret" && !(basic && user == "admin" && password == "s3cret") {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		backend.server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer api.Close()
+
+	tests := []struct {
+		name    string
+		auth    *MetricsAuth
+		wantErr bool
+	}{
+		{name: "no credentials", wantErr: true},
+		{name: "bearer token", auth: &MetricsAuth{BearerToken: "s3cret"}},
+		{name: "basic auth", auth: &MetricsAuth{Username: "admin", Password: "s3cret"}},
+		{name: "wrong password", auth: &MetricsAuth{Username: "admin", Password: "guess"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saver, _ := newTestSaver(t, backend, nil, func(c *Config) {
+				c.APIAuth = tt.auth
+			})
+			saver.apiURL = api.URL + "/api"
+
+			routers, err := saver.getRoutersFromAPI(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getRoutersFromAPI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && routers["web@docker"] == nil {
+				t.Errorf("expected router web@docker, got %v", routers)
+			}
+
+			routerNames, _, err := saver.getRoutersForService(context.Background(), "web@docker")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getRoutersForService() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (len(routerNames) != 1 || routerNames[0] != "web@docker") {
+				t.Errorf("getRoutersForService() = %v, want web@docker", routerNames)
+			}
+		})
+	}
+}
+
+func TestAPIAuthValidation(t *testing.T) {
+	config := CreateConfig()
+	config.WindowSize = "1s"
+	config.testMode = true
+	config.APIAuth = &MetricsAuth{BearerToken: "t", Username: "u"}
+	if _, err := New(context.Background(), config, "test"); err == nil {
+		t.Error("expected an error for both a bearer token and basic auth")
+	}
+}
+
+func TestAPITimeout(t *testing.T) {
+	// a hung API only answers once the request is given up on
+	api := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer api.Close()
+
+	tests := []struct {
+		name    string
+		timeout string
+		ctx     func() (context.Context, context.CancelFunc)
+	}{
+		{
+			name:    "client timeout",
+			timeout: "50ms",
+			ctx:     func() (context.Context, context.CancelFunc) { return context.Background(), func() {} },
+		},
+		{
+			name: "provider context cancelled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 50*time.Millisecond)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saver, _ := newTestSaver(t, newTestBackend(t), nil, func(c *Config) {
+				c.APITimeout = tt.timeout
+			})
+			saver.apiURL = api.URL + "/api"
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			start := time.Now()
+			if _, err := saver.getRoutersFromAPI(ctx); err == nil {
+				t.Fatal("expected an error from a hung API")
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("expected the request to be given up on quickly, took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestAPITimeoutValidation(t *testing.T) {
+	for _, timeout := range []string{"soon", "0s", "-1s"} {
+		config := CreateConfig()
+		config.WindowSize = "1s"
+		config.testMode = true
+		config.APITimeout = timeout
+		if _, err := New(context.Background(), config, "test"); err == nil {
+			t.Errorf("expected an error for api timeout %q", timeout)
+		}
+	}
+}
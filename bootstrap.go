@@ -0,0 +1,143 @@
+package traefik_cloud_saver
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// BootstrapConfig runs the plugin observation only for a while, to recommend traffic thresholds
+// from the rates it sees rather than have new users guess one
+type BootstrapConfig struct {
+	Duration   string  `json:"duration"`             // how long to only observe, e.g. "24h"
+	Percentile float64 `json:"percentile,omitempty"` // percentile of a service's observed rates recommended as its threshold, default 10
+}
+
+// defaultBootstrapPercentile recommends a threshold most of the observed windows are above
+const defaultBootstrapPercentile = 10
+
+// minRecommendedThreshold keeps a service that's mostly idle eligible for scale down, a threshold
+// of 0 would never scale anything down
+const minRecommendedThreshold = 1.0
+
+// observe records the rates of a window while bootstrapping
+func (mc *MetricsCollector) observe(rates map[string]*ServiceRate) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.observed == nil {
+		mc.observed = make(map[string][]float64)
+	}
+	for serviceName, rate := range rates {
+		if isGeneratedService(serviceName) {
+			continue
+		}
+		mc.observed[serviceName] = append(mc.observed[serviceName], rate.PerMin)
+	}
+}
+
+// recommendThresholds returns a traffic threshold for each observed service, the given percentile
+// of its observed rates but at least minRecommendedThreshold
+func (mc *MetricsCollector) recommendThresholds(percentile float64) map[string]float64 {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	recommended := make(map[string]float64, len(mc.observed))
+	for serviceName, observed := range mc.observed {
+		recommended[serviceName] = math.Max(percentileOf(observed, percentile), minRecommendedThreshold)
+	}
+	return recommended
+}
+
+// percentileOf returns the nearest-rank percentile of the values
+func percentileOf(values []float64, percentile float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// parseBootstrap returns how long to observe for and the percentile to recommend, or a zero
+// duration if bootstrapping isn't configured
+func parseBootstrap(config *BootstrapConfig) (time.Duration, float64, error) {
+	if config == nil {
+		return 0, 0, nil
+	}
+	duration, err := time.ParseDuration(config.Duration)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid bootstrap duration: %w", err)
+	}
+	if duration <= 0 {
+		return 0, 0, fmt.Errorf("bootstrap duration must be positive, got %v", duration)
+	}
+
+	percentile := config.Percentile
+	if percentile == 0 {
+		percentile = defaultBootstrapPercentile
+	}
+	if percentile < 0 || percentile > 100 {
+		return 0, 0, fmt.Errorf("bootstrap percentile must be between 0 and 100, got %v", percentile)
+	}
+	return duration, percentile, nil
+}
+
+// bootstrapping reports whether the plugin is still only observing.  While it is the window's
+// rates are recorded and every service is kept; the first window after it ends logs the
+// recommended thresholds and decides as usual.
+func (p *CloudSaver) bootstrapping(rates map[string]*ServiceRate) bool {
+	if p.bootstrapUntil.IsZero() {
+		return false
+	}
+
+	if p.clock.Now().Before(p.bootstrapUntil) {
+		p.metricsCollector.observe(rates)
+		for serviceName := range rates {
+			if !isGeneratedService(serviceName) {
+				p.decide(serviceName, actionKeep, reasonBootstrap)
+			}
+		}
+		common.DebugLog("traefik-cloud-saver", "bootstrapping, observing %d services until %v", len(rates), p.bootstrapUntil)
+		return true
+	}
+
+	p.logRecommendations()
+	p.bootstrapUntil = time.Time{}
+	return false
+}
+
+// logRecommendations logs the recommended threshold of each observed service, and the lowest of
+// them as a global trafficThreshold which won't scale any service down in its usual lows
+func (p *CloudSaver) logRecommendations() {
+	recommended := p.metricsCollector.recommendThresholds(p.bootstrapPercentile)
+	if len(recommended) == 0 {
+		common.LogProvider("traefik-cloud-saver", "[WARNING] bootstrap finished without observing any services, no thresholds to recommend")
+		return
+	}
+
+	names := make([]string, 0, len(recommended))
+	for serviceName := range recommended {
+		names = append(names, serviceName)
+	}
+	sort.Strings(names)
+
+	lowest := math.Inf(1)
+	for _, serviceName := range names {
+		threshold := recommended[serviceName]
+		observed := p.metricsCollector.observed[serviceName]
+		common.LogProvider("traefik-cloud-saver", "bootstrap: recommended threshold for %s is %.2f req/min (p%v of %d windows, median %.2f)",
+			serviceName, threshold, p.bootstrapPercentile, len(observed), percentileOf(observed, 50))
+		lowest = math.Min(lowest, threshold)
+	}
+	common.LogProvider("traefik-cloud-saver", "bootstrap: recommended trafficThreshold is %.2f req/min (currently %.2f)", lowest, p.trafficThreshold)
+}
@@ -0,0 +1,95 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRecommendThresholds(t *testing.T) {
+	mc := NewMetricsCollector("http://localhost")
+
+	// a busy service with a quiet night, and one that's idle most of the time
+	busy := []float64{120, 110, 130, 8, 10, 125, 140, 115, 12, 135}
+	idle := []float64{0, 0, 0, 0, 3, 0, 0, 0, 0, 0}
+	for i := range busy {
+		mc.observe(map[string]*ServiceRate{
+			"busy@docker":           {PerMin: busy[i]},
+			"idle@docker":           {PerMin: idle[i]},
+			configPrefix + "sleepy": {PerMin: 0},
+		})
+	}
+
+	recommended := mc.recommendThresholds(10)
+	if len(recommended) != 2 {
+		t.Fatalf("expected recommendations for 2 services, got %v", recommended)
+	}
+	if got := recommended["busy@docker"]; got != 8 {
+		t.Errorf("busy recommendation = %v, want the 10th percentile 8", got)
+	}
+	if got := recommended["idle@docker"]; got != minRecommendedThreshold {
+		t.Errorf("idle recommendation = %v, want the minimum %v", got, minRecommendedThreshold)
+	}
+
+	if got := mc.recommendThresholds(50)["busy@docker"]; got != 115 {
+		t.Errorf("busy median recommendation = %v, want 115", got)
+	}
+}
+
+func TestBootstrapOnlyObserves(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+	saver, cloud := newTestSaver(t, backend, map[string]int32{"idle": 1}, func(c *Config) {
+		c.Bootstrap = &BootstrapConfig{Duration: "1h"}
+	})
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, cloud, "idle"); scale != 1 {
+		t.Errorf("expected nothing to be scaled down while bootstrapping, got %d", scale)
+	}
+	if len(saver.metricsCollector.observed["idle@docker"]) != 1 {
+		t.Errorf("expected the window to be observed, got %v", saver.metricsCollector.observed)
+	}
+
+	// once bootstrapping is over the plugin decides as usual
+	saver.bootstrapUntil = time.Now().Add(-time.Second)
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if !saver.bootstrapUntil.IsZero() {
+		t.Error("expected bootstrapping to have finished")
+	}
+	if scale := currentScale(t, cloud, "idle"); scale != 0 {
+		t.Errorf("expected idle to be scaled down after bootstrapping, got %d", scale)
+	}
+}
+
+func TestParseBootstrap(t *testing.T) {
+	tests := []struct {
+		config  *BootstrapConfig
+		wantErr bool
+	}{
+		{config: &BootstrapConfig{Duration: "24h"}},
+		{config: &BootstrapConfig{Duration: "24h", Percentile: 25}},
+		{config: &BootstrapConfig{Duration: "soon"}, wantErr: true},
+		{config: &BootstrapConfig{Duration: "0s"}, wantErr: true},
+		{config: &BootstrapConfig{Duration: "1h", Percentile: 120}, wantErr: true},
+	}
+	for _, tt := range tests {
+		duration, percentile, err := parseBootstrap(tt.config)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseBootstrap(%+v) error = %v, wantErr %v", tt.config, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if duration <= 0 || percentile <= 0 {
+			t.Errorf("parseBootstrap(%+v) = %v, %v", tt.config, duration, percentile)
+		}
+	}
+}
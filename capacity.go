@@ -0,0 +1,35 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+)
+
+// hasCapacity reports whether the instances of a cloud service left running after scaling it
+// down by one can take its current traffic, each at most its configured instance capacity.
+// Scaling the last instance down always leaves enough, that's a decision on the threshold alone.
+func (p *CloudSaver) hasCapacity(ctx context.Context, cloudServiceName string, members []*instanceMember) (bool, string) {
+	capacity, ok := p.instanceCapacity[cloudServiceName]
+	if !ok || capacity <= 0 {
+		return true, ""
+	}
+
+	scale, err := p.cloudService.GetCurrentScale(ctx, cloudServiceName)
+	if err != nil {
+		// without the scale there's no telling how many instances would be left
+		return false, fmt.Sprintf("unable to check capacity: %v", err)
+	}
+	remaining := scale - 1
+	if remaining <= 0 {
+		return true, ""
+	}
+
+	total := 0.0
+	for _, member := range members {
+		total += member.rate.PerMin
+	}
+	if perInstance := total / float64(remaining); perInstance > capacity {
+		return false, fmt.Sprintf("%d remaining instances would each take %.2f req/min, above their capacity of %.2f", remaining, perInstance, capacity)
+	}
+	return true, ""
+}
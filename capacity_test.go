@@ -0,0 +1,62 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInstanceCapacity(t *testing.T) {
+	tests := []struct {
+		name      string
+		scale     int32
+		capacity  float64
+		wantScale int32
+	}{
+		{name: "no capacity configured", scale: 3, wantScale: 2},
+		{name: "remaining instances have room", scale: 3, capacity: 50, wantScale: 2},
+		{name: "remaining instances would be overloaded", scale: 3, capacity: 40, wantScale: 3},
+		{name: "last instance", scale: 1, capacity: 10, wantScale: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// orders and billing share the pool, 90 req/min between them
+			backend := newTestBackend(t)
+			backend.addService("orders@docker", "orders@docker")
+			backend.addService("billing@docker", "billing@docker")
+			backend.setMetrics(`
+traefik_service_requests_total{service="orders@docker"} 60
+traefik_service_requests_total{service="billing@docker"} 30
+`, "")
+
+			saver, svc := newTestSaver(t, backend, map[string]int32{"pool": tt.scale}, func(c *Config) {
+				c.TrafficThreshold = 100
+				c.ServiceInstances = map[string]string{"orders": "pool", "billing": "pool"}
+				if tt.capacity > 0 {
+					c.InstanceCapacity = map[string]float64{"pool": tt.capacity}
+				}
+			})
+			if _, err := saver.generateConfiguration(context.Background()); err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+
+			if scale := currentScale(t, svc, "pool"); scale != tt.wantScale {
+				t.Errorf("expected pool at scale %d, got %d", tt.wantScale, scale)
+			}
+			skipped := tt.wantScale == tt.scale
+			for _, name := range []string{"orders@docker", "billing@docker"} {
+				if got := saver.decisions.count(name, actionKeep, reasonCapacity) == 1; got != skipped {
+					t.Errorf("capacity decision for %s = %v, want %v", name, got, skipped)
+				}
+			}
+		})
+	}
+}
+
+func TestInstanceCapacityValidation(t *testing.T) {
+	config := CreateConfig()
+	config.InstanceCapacity = map[string]float64{"pool": -1}
+	if err := config.Validate(); err == nil {
+		t.Error("expected an error for a negative instance capacity")
+	}
+}
@@ -0,0 +1,46 @@
+package traefik_cloud_saver
+
+import (
+	"time"
+)
+
+// Clock is the plugin's source of time.  Tests substitute one they control, to drive windows and
+// grace periods without waiting on the wall clock.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks on C, like a time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// realClock is the wall clock
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{ticker: time.NewTicker(d)}
+}
+
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t *realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t *realTicker) Stop() {
+	t.ticker.Stop()
+}
+
+// since returns the time elapsed on the clock since t
+func since(clock Clock, t time.Time) time.Duration {
+	return clock.Now().Sub(t)
+}
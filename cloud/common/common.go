@@ -1,18 +1,46 @@
 package common
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"time"
 )
 
 var (
 	debugEnabled bool
 )
 
+// ErrUnsupported is returned by a cloud service for an operation its provider can't perform, e.g.
+// GetCurrentScale for a provider with no way of reporting the scale of a service
+var ErrUnsupported = errors.New("operation not supported by the cloud provider")
+
+// ErrNotEligible is returned by a cloud service for a resource its configuration excludes from
+// scaling, e.g. an instance of a machine type that isn't allowed
+var ErrNotEligible = errors.New("resource is not eligible for scaling")
+
+// ErrTransitioning is returned by a cloud service for a scale action it won't take while the
+// resource is changing state, e.g. stopping an instance which is still starting.  The action can
+// be retried once the resource settles.
+var ErrTransitioning = errors.New("resource is changing state")
+
+// ErrQuarantined is returned by a cloud service for a resource it has quarantined, e.g. an
+// instance stuck stopping.  Scale actions on it are refused until the resource recovers.
+var ErrQuarantined = errors.New("resource is quarantined")
+
+// Spot instance policies on scale up
+const (
+	SpotPolicyStart = "start"
+	SpotPolicySkip  = "skip"
+)
+
 // CredentialsConfig contains authentication details
 type CredentialsConfig struct {
 	Type   string `json:"type,omitempty"`
 	Secret string `json:"secret,omitempty"` // Generic secret field
+	// ReloadInterval re-reads a credentials file periodically, e.g. "1h".  Files are also re-read
+	// whenever the current key is rejected.
+	ReloadInterval string `json:"reloadInterval,omitempty"`
 }
 
 // CloudServiceConfig 
@@ -22,15 +50,39 @@ type CloudServiceConfig struct {
 	ResourceTags map[string]string  `json:"resourceTags,omitempty"`
 	Credentials  *CredentialsConfig `json:"credentials,omitempty"`
 	Endpoint     string             `json:"endpoint,omitempty"`
+	TLS          *TLSConfig         `json:"tls,omitempty"` // TLS settings for a private/proxied Endpoint
 	// GCP specific fields
 	ServiceAccount string `json:"serviceAccount,omitempty"`
 	ProjectID      string `json:"projectID,omitempty"`
 	Zone           string `json:"zone,omitempty"`
+	// ResourceType is what's scaled, "instance" (default) or "cloudRun" services.  Cloud Run
+	// services are scaled by their min instances and need a region but no zone.
+	ResourceType string `json:"resourceType,omitempty"`
+	// DiscoveryZones bounds which zones are scanned when discovering instances by resourceTags,
+	// only zone is scanned when empty
+	DiscoveryZones []string `json:"discoveryZones,omitempty"`
+	// MaxStopDuration is how long an instance may stay STOPPING before it's quarantined, default 10m
+	MaxStopDuration string `json:"maxStopDuration,omitempty"`
+	// StartVerifyAttempts is how many times a started instance is checked for RUNNING while it's
+	// still coming up, default 5
+	StartVerifyAttempts int `json:"startVerifyAttempts,omitempty"`
+	// MachineTypes limits scaling to instances of these machine types, e.g. ["e2-small"].  Other
+	// instances are left alone, every machine type is scaled when empty.
+	MachineTypes []string `json:"machineTypes,omitempty"`
+	// SpotPolicy is what scale up does with a stopped spot or preemptible instance, which GCP may
+	// also have stopped on its own: "start" (default) starts it like any other, "skip" leaves it
+	// stopped
+	SpotPolicy string `json:"spotPolicy,omitempty"`
 
 	// Mock-specific fields
 	InitialScale map[string]int32 `json:"initialScale,omitempty"`
 	FailAfter    int              `json:"failAfter,omitempty"`
 	ResetAfter   string           `json:"resetAfter,omitempty"`
+	// RecoverScale makes resetAfter simulate a targeted recovery, scaling only the listed
+	// services up to the given scale instead of resetting everything to initialScale
+	RecoverScale map[string]int32 `json:"recoverScale,omitempty"`
+	// Labels are the labels reported for each mock service, keyed by service name
+	Labels map[string]map[string]string `json:"labels,omitempty"`
 }
 
 func SetDebug(enabled bool) {
@@ -59,12 +111,26 @@ func (c *CloudServiceConfig) Validate() error {
 		if c.ProjectID == "" {
 			return fmt.Errorf("projectID is required")
 		}
-		if c.Zone == "" {
+		if c.Zone == "" && c.ResourceType != "cloudRun" {
 			return fmt.Errorf("zone is required")
 		}
+		if len(c.MachineTypes) > 0 && c.ResourceType == "cloudRun" {
+			return fmt.Errorf("machineTypes only applies to instances")
+		}
+		switch c.SpotPolicy {
+		case "", SpotPolicyStart, SpotPolicySkip:
+		default:
+			return fmt.Errorf("invalid spotPolicy %q, expected %s or %s", c.SpotPolicy, SpotPolicyStart, SpotPolicySkip)
+		}
+		if c.SpotPolicy != "" && c.ResourceType == "cloudRun" {
+			return fmt.Errorf("spotPolicy only applies to instances")
+		}
 	case "mock":
-		if c.InitialScale == nil {
-			return fmt.Errorf("initialScale is required")
+		// without an initial scale the mock simply starts out knowing no services
+		if c.ResetAfter != "" {
+			if _, err := time.ParseDuration(c.ResetAfter); err != nil {
+				return fmt.Errorf("invalid resetAfter: %w", err)
+			}
 		}
 	default:
 		return fmt.Errorf("invalid type: %s", c.Type)
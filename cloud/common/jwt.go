@@ -1,7 +1,12 @@
 package common
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -9,23 +14,85 @@ import (
 
 // JWTSigner handles JWT token creation and signing
 type JWTSigner struct {
-	privateKey *rsa.PrivateKey
-	method     *jwt.SigningMethodRSA
+	privateKey crypto.PrivateKey
+	method     jwt.SigningMethod
 }
 
-// NewJWTSigner creates a new JWT signer from a PEM-encoded private key
+// NewJWTSigner creates a new JWT signer from a PEM-encoded RSA or EC private key.  The signing
+// method follows the key: RS256 for RSA, ES256/ES384/ES512 for EC depending on the curve.
 func NewJWTSigner(privateKeyPEM string) (*JWTSigner, error) {
-	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKeyPEM))
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse private key: no PEM block found")
+	}
+
+	privateKey, err := parsePrivateKey(block)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse private key: %w", err)
 	}
 
+	method, err := signingMethod(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
 	return &JWTSigner{
 		privateKey: privateKey,
-		method:     jwt.SigningMethodRS256,
+		method:     method,
 	}, nil
 }
 
+// parsePrivateKey parses the key in a PEM block.  The encoding the block type implies is tried
+// first, but the header isn't always accurate (e.g. PKCS8 bytes labelled "RSA PRIVATE KEY"), so
+// the other encodings are tried before giving up.
+func parsePrivateKey(block *pem.Block) (crypto.PrivateKey, error) {
+	pkcs1 := func(der []byte) (crypto.PrivateKey, error) { return x509.ParsePKCS1PrivateKey(der) }
+	sec1 := func(der []byte) (crypto.PrivateKey, error) { return x509.ParseECPrivateKey(der) }
+	pkcs8 := func(der []byte) (crypto.PrivateKey, error) { return x509.ParsePKCS8PrivateKey(der) }
+
+	var parsers []func([]byte) (crypto.PrivateKey, error)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsers = append(parsers, pkcs1, pkcs8, sec1)
+	case "EC PRIVATE KEY":
+		parsers = append(parsers, sec1, pkcs8, pkcs1)
+	default:
+		parsers = append(parsers, pkcs8, pkcs1, sec1)
+	}
+
+	var firstErr error
+	for _, parse := range parsers {
+		key, err := parse(block.Bytes)
+		if err == nil {
+			return key, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, fmt.Errorf("%q block is not a PKCS1, PKCS8 or SEC1 private key: %w", block.Type, firstErr)
+}
+
+// signingMethod returns the JWT signing method for a private key
+func signingMethod(privateKey crypto.PrivateKey) (jwt.SigningMethod, error) {
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512, nil
+		}
+		return nil, fmt.Errorf("unsupported EC curve %s", key.Curve.Params().Name)
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+}
+
 // SignClaims creates and signs a JWT with the provided claims
 func (s *JWTSigner) SignClaims(claims map[string]interface{}) (string, error) {
 
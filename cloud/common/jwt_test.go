@@ -1,7 +1,16 @@
 package common
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
 	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 func TestJWTSigner(t *testing.T) {
@@ -55,3 +64,112 @@ G80WFPQ8buzddXhgsyQRDLjm
 		t.Error("SignClaims() returned empty token")
 	}
 }
+
+func TestJWTSignerEC(t *testing.T) {
+	tests := []struct {
+		name       string
+		curve      elliptic.Curve
+		pkcs8      bool
+		wantMethod string
+	}{
+		{name: "P-256 SEC1", curve: elliptic.P256(), wantMethod: "ES256"},
+		{name: "P-256 PKCS8", curve: elliptic.P256(), pkcs8: true, wantMethod: "ES256"},
+		{name: "P-384 SEC1", curve: elliptic.P384(), wantMethod: "ES384"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ecdsa.GenerateKey(tt.curve, rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var block *pem.Block
+			if tt.pkcs8 {
+				der, err := x509.MarshalPKCS8PrivateKey(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+			} else {
+				der, err := x509.MarshalECPrivateKey(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+			}
+
+			signer, err := NewJWTSigner(string(pem.EncodeToMemory(block)))
+			if err != nil {
+				t.Fatalf("NewJWTSigner() error = %v", err)
+			}
+
+			signed, err := signer.SignClaims(map[string]interface{}{"sub": "1234567890"})
+			if err != nil {
+				t.Fatalf("SignClaims() error = %v", err)
+			}
+
+			token, err := jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+				return &key.PublicKey, nil
+			}, jwt.WithValidMethods([]string{tt.wantMethod}))
+			if err != nil {
+				t.Fatalf("signed token doesn't verify: %v", err)
+			}
+			if sub, _ := token.Claims.GetSubject(); sub != "1234567890" {
+				t.Errorf("subject = %q, want 1234567890", sub)
+			}
+		})
+	}
+}
+
+func TestJWTSignerInvalidKey(t *testing.T) {
+	if _, err := NewJWTSigner("not a pem"); err == nil {
+		t.Error("NewJWTSigner() should fail without a PEM block")
+	}
+}
+
+func TestJWTSignerRSAEncodings(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1 := x509.MarshalPKCS1PrivateKey(key)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		block *pem.Block
+	}{
+		{name: "PKCS1", block: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: pkcs1}},
+		{name: "PKCS8", block: &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}},
+		{name: "PKCS8 labelled as PKCS1", block: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: pkcs8}},
+		{name: "PKCS1 labelled as PKCS8", block: &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := NewJWTSigner(string(pem.EncodeToMemory(tt.block)))
+			if err != nil {
+				t.Fatalf("NewJWTSigner() error = %v", err)
+			}
+
+			signed, err := signer.SignClaims(map[string]interface{}{"sub": "1234567890"})
+			if err != nil {
+				t.Fatalf("SignClaims() error = %v", err)
+			}
+			if _, err := jwt.Parse(signed, func(token *jwt.Token) (interface{}, error) {
+				return &key.PublicKey, nil
+			}, jwt.WithValidMethods([]string{"RS256"})); err != nil {
+				t.Errorf("signed token doesn't verify: %v", err)
+			}
+		})
+	}
+
+	garbage := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte("not a key")})
+	if _, err := NewJWTSigner(string(garbage)); err == nil || !strings.Contains(err.Error(), "not a PKCS1, PKCS8 or SEC1 private key") {
+		t.Errorf("NewJWTSigner() error = %v, want a clear error when every encoding fails", err)
+	}
+}
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTLSConfig_ClientConfig(t *testing.T) {
+	dir := t.TempDir()
+	badCA := filepath.Join(dir, "bad-ca.pem")
+	if err := os.WriteFile(badCA, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		config  *TLSConfig
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "nil config", config: nil, wantNil: true},
+		{name: "insecure only", config: &TLSConfig{InsecureSkipVerify: true}},
+		{name: "missing CA file", config: &TLSConfig{CA: filepath.Join(dir, "missing.pem")}, wantErr: true},
+		{name: "CA file without certificates", config: &TLSConfig{CA: badCA}, wantErr: true},
+		{name: "cert without key", config: &TLSConfig{Cert: "client.pem"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.ClientConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ClientConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("ClientConfig() = %v, wantNil %v", got, tt.wantNil)
+			}
+			if got != nil && got.InsecureSkipVerify != tt.config.InsecureSkipVerify {
+				t.Errorf("InsecureSkipVerify = %v, want %v", got.InsecureSkipVerify, tt.config.InsecureSkipVerify)
+			}
+		})
+	}
+}
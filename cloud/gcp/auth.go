@@ -3,6 +3,7 @@ package gcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -32,6 +33,25 @@ type Credentials struct {
 	ProjectID    string `json:"project_id"`
 }
 
+// TokenSource provides bearer tokens for the compute API
+type TokenSource interface {
+	GetToken(ctx context.Context) (string, error)
+}
+
+// StaticTokenSource always returns the same pre-fetched bearer token.  It skips the JWT signing
+// path entirely, which is useful for tests and for proxies that inject their own credentials.
+type StaticTokenSource struct {
+	Token string
+}
+
+// GetToken returns the static token
+func (s *StaticTokenSource) GetToken(_ context.Context) (string, error) {
+	if s == nil || s.Token == "" {
+		return "", fmt.Errorf("static token is empty")
+	}
+	return s.Token, nil
+}
+
 type TokenManager struct {
 	credentials  *Credentials
 	currentToken *TokenResponse
@@ -39,28 +59,92 @@ type TokenManager struct {
 	mu           sync.Mutex
 	client       *http.Client
 	signer       *common.JWTSigner
+
+	// credentials file re-read when the key is rejected, or every reloadInterval if set
+	credentialsFile string
+	reloadInterval  time.Duration
+	loadedAt        time.Time
+
+	// tokens come from the metadata server rather than a signed key when set
+	metadataURL string
+}
+
+type TokenManagerOption func(*TokenManager)
+
+// WithCredentialsFile lets the token manager reload its credentials from the service account file
+// they came from, so a rotated key is picked up without a restart.  The file is re-read whenever
+// the token endpoint rejects the current key, and every interval when the interval is positive.
+func WithCredentialsFile(path string, interval time.Duration) TokenManagerOption {
+	return func(tm *TokenManager) {
+		tm.credentialsFile = path
+		tm.reloadInterval = interval
+	}
 }
 
-func NewTokenManager(credentials *Credentials) (*TokenManager, error) {
+func NewTokenManager(credentials *Credentials, options ...TokenManagerOption) (*TokenManager, error) {
 	signer, err := common.NewJWTSigner(credentials.PrivateKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create JWT signer: %w", err)
 	}
 
-	return &TokenManager{
+	tm := &TokenManager{
 		credentials: credentials,
 		client:      &http.Client{},
 		signer:      signer,
-	}, nil
+		loadedAt:    time.Now(),
+	}
+
+	for _, option := range options {
+		option(tm)
+	}
+
+	return tm, nil
 }
 
-func (tm *TokenManager) GetToken(ctx context.Context) (string, error) {
-	// Check if current token is valid
-	if tm.currentToken != nil && time.Now().Before(tm.expiresAt) {
-		return tm.currentToken.AccessToken, nil
+// reloadDue reports whether the credentials file should be re-read on the interval
+func (tm *TokenManager) reloadDue() bool {
+	return tm.credentialsFile != "" && tm.reloadInterval > 0 && time.Since(tm.loadedAt) >= tm.reloadInterval
+}
+
+// reloadCredentials re-reads the credentials file.  When the key has changed the cached token is
+// dropped, so the next token is fetched with the new key.  Must be called with mu held.
+func (tm *TokenManager) reloadCredentials() error {
+	tm.loadedAt = time.Now()
+
+	creds, err := loadServiceAccountCredentials(tm.credentialsFile)
+	if err != nil {
+		return fmt.Errorf("failed to reload credentials: %w", err)
+	}
+
+	if creds.PrivateKey == tm.credentials.PrivateKey && creds.ClientEmail == tm.credentials.ClientEmail {
+		return nil
+	}
+
+	signer, err := common.NewJWTSigner(creds.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to create JWT signer for reloaded credentials: %w", err)
 	}
 
-	// Need to refresh
+	// the token endpoint isn't part of the key, keep the one we've been using
+	creds.TokenURL = tm.credentials.TokenURL
+	tm.credentials = creds
+	tm.signer = signer
+	tm.currentToken = nil
+
+	common.LogProvider("traefik-cloud-saver", "Reloaded GCP credentials from %s (key id %s)", tm.credentialsFile, creds.PrivateKeyID)
+	return nil
+}
+
+// Invalidate drops the cached token, e.g. after the API rejected it
+func (tm *TokenManager) Invalidate() {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.currentToken = nil
+}
+
+func (tm *TokenManager) GetToken(ctx context.Context) (string, error) {
+	// fetchToken returns the current token if it's still valid, the token and the credentials
+	// may be swapped by a reload so they're only looked at with the lock held
 	token, err := tm.fetchToken(ctx)
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch token: %w", err)
@@ -72,11 +156,46 @@ func (tm *TokenManager) fetchToken(ctx context.Context) (string, error) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
-	// Double-check after acquiring lock
+	if tm.reloadDue() {
+		if err := tm.reloadCredentials(); err != nil {
+			// keep going with the credentials we have, they may well still work
+			common.LogProvider("traefik-cloud-saver", "[WARNING] %v", err)
+		}
+	}
+
+	// Check if current token is valid
 	if tm.currentToken != nil && time.Now().Before(tm.expiresAt) {
 		return tm.currentToken.AccessToken, nil
 	}
 
+	if tm.metadataURL != "" {
+		return tm.requestMetadataToken(ctx)
+	}
+
+	token, err := tm.requestToken(ctx)
+	var rejected *keyRejectedError
+	if errors.As(err, &rejected) && tm.credentialsFile != "" {
+		// the key may have been rotated, try again with whatever is in the file now
+		common.LogProvider("traefik-cloud-saver", "[WARNING] token endpoint rejected the current key (status %d), reloading credentials", rejected.statusCode)
+		if reloadErr := tm.reloadCredentials(); reloadErr != nil {
+			return "", fmt.Errorf("%w (%v)", err, reloadErr)
+		}
+		token, err = tm.requestToken(ctx)
+	}
+	return token, err
+}
+
+// keyRejectedError is returned when the token endpoint refuses the signed assertion
+type keyRejectedError struct {
+	statusCode int
+}
+
+func (e *keyRejectedError) Error() string {
+	return fmt.Sprintf("token request failed with status %d", e.statusCode)
+}
+
+// requestToken exchanges a freshly signed JWT for an access token.  Must be called with mu held.
+func (tm *TokenManager) requestToken(ctx context.Context) (string, error) {
 	now := time.Now()
 	claims := map[string]interface{}{
 		"iss":   tm.credentials.ClientEmail,
@@ -109,6 +228,11 @@ func (tm *TokenManager) fetchToken(ctx context.Context) (string, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		// invalid_grant and friends, the key has most likely been revoked
+		return "", &keyRejectedError{statusCode: resp.StatusCode}
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return "", fmt.Errorf("token request failed with status %d", resp.StatusCode)
 	}
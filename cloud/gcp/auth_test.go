@@ -2,9 +2,14 @@ package gcp
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -137,3 +142,244 @@ func TestTokenManager_Concurrent(t *testing.T) {
 		t.Errorf("Expected 1 request to server, got %d", requestCount)
 	}
 }
+
+func TestStaticTokenSource(t *testing.T) {
+	ts := &StaticTokenSource{Token: "pre-fetched"}
+	got, err := ts.GetToken(context.Background())
+	if err != nil {
+		t.Fatalf("GetToken() error = %v", err)
+	}
+	if got != "pre-fetched" {
+		t.Errorf("GetToken() = %v, want pre-fetched", got)
+	}
+
+	empty := &StaticTokenSource{}
+	if _, err := empty.GetToken(context.Background()); err == nil {
+		t.Error("GetToken() should fail for an empty token")
+	}
+}
+
+// writeServiceAccountFile writes a service account file for the test key with the given client email
+func writeServiceAccountFile(t *testing.T, path, clientEmail string) {
+	t.Helper()
+	data, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "test-project",
+		"private_key_id": clientEmail,
+		"private_key":    testCredentials("").PrivateKey,
+		"client_email":   clientEmail,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rotatingTokenServer only issues tokens for assertions from the currently valid client email
+func rotatingTokenServer(t *testing.T, valid *atomic.Value) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse token request: %v", err)
+		}
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		if len(parts) != 3 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			t.Errorf("failed to decode assertion: %v", err)
+		}
+		var claims struct {
+			Issuer string `json:"iss"`
+		}
+		json.Unmarshal(payload, &claims)
+
+		if claims.Issuer != valid.Load().(string) {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant", "error_description": "Invalid JWT Signature."}`))
+			return
+		}
+		json.NewEncoder(w).Encode(TokenResponse{AccessToken: "token-for-" + claims.Issuer, ExpiresIn: 3600, TokenType: "Bearer"})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newFileTokenManager creates a token manager from a service account file, pointed at the test server
+func newFileTokenManager(t *testing.T, path string, server *httptest.Server, interval time.Duration) *TokenManager {
+	t.Helper()
+	creds, err := loadServiceAccountCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds.TokenURL = server.URL
+	tm, err := NewTokenManager(creds, WithCredentialsFile(path, interval))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+func TestTokenManager_ReloadOnRejectedKey(t *testing.T) {
+	var valid atomic.Value
+	valid.Store("old@test-project.iam.gserviceaccount.com")
+	server := rotatingTokenServer(t, &valid)
+
+	path := filepath.Join(t.TempDir(), "sa.json")
+	writeServiceAccountFile(t, path, "old@test-project.iam.gserviceaccount.com")
+	tm := newFileTokenManager(t, path, server, 0)
+
+	ctx := context.Background()
+	token, err := tm.GetToken(ctx)
+	if err != nil || token != "token-for-old@test-project.iam.gserviceaccount.com" {
+		t.Fatalf("GetToken() = %q, %v", token, err)
+	}
+
+	// the key is rotated: the old one is revoked and the file replaced
+	valid.Store("new@test-project.iam.gserviceaccount.com")
+	writeServiceAccountFile(t, path, "new@test-project.iam.gserviceaccount.com")
+	tm.expiresAt = time.Now().Add(-time.Second)
+
+	token, err = tm.GetToken(ctx)
+	if err != nil {
+		t.Fatalf("GetToken() after rotation error = %v", err)
+	}
+	if token != "token-for-new@test-project.iam.gserviceaccount.com" {
+		t.Errorf("expected a token fetched with the new key, got %q", token)
+	}
+}
+
+func TestTokenManager_ReloadOnInterval(t *testing.T) {
+	var valid atomic.Value
+	valid.Store("old@test-project.iam.gserviceaccount.com")
+	server := rotatingTokenServer(t, &valid)
+
+	path := filepath.Join(t.TempDir(), "sa.json")
+	writeServiceAccountFile(t, path, "old@test-project.iam.gserviceaccount.com")
+	tm := newFileTokenManager(t, path, server, 10*time.Millisecond)
+
+	ctx := context.Background()
+	if _, err := tm.GetToken(ctx); err != nil {
+		t.Fatalf("GetToken() error = %v", err)
+	}
+
+	// both keys are valid during the rotation, the cached token is still good
+	valid.Store("new@test-project.iam.gserviceaccount.com")
+	writeServiceAccountFile(t, path, "new@test-project.iam.gserviceaccount.com")
+	time.Sleep(20 * time.Millisecond)
+
+	token, err := tm.GetToken(ctx)
+	if err != nil {
+		t.Fatalf("GetToken() error = %v", err)
+	}
+	if token != "token-for-new@test-project.iam.gserviceaccount.com" {
+		t.Errorf("expected the reloaded key to be used, got %q", token)
+	}
+}
+
+func TestTokenManager_RejectedKeyWithoutFile(t *testing.T) {
+	var valid atomic.Value
+	valid.Store("someone-else@test-project.iam.gserviceaccount.com")
+	server := rotatingTokenServer(t, &valid)
+
+	tm, err := NewTokenManager(testCredentials(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tm.GetToken(context.Background()); err == nil {
+		t.Error("expected an error when the key is rejected and there's no file to reload")
+	}
+}
+
+func TestTokenManager_InvalidatedOnUnauthorized(t *testing.T) {
+	server, client := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": {"code": 401, "message": "Invalid Credentials"}}`))
+	})
+	defer server.Close()
+
+	if _, err := client.GetInstance(context.Background(), "test-project", "test-zone", "instance-1"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if client.tokenManager.currentToken != nil {
+		t.Error("expected the rejected token to be dropped")
+	}
+}
+
+// newMetadataServer fakes the GCE metadata server, counting token requests
+func newMetadataServer(t *testing.T, tokenRequests *atomic.Int32) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case metadataTokenPath:
+			tokenRequests.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"metadata-token","token_type":"Bearer","expires_in":3600}`))
+		case metadataProjectPath:
+			w.Write([]byte("metadata-project"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMetadataTokenManager(t *testing.T) {
+	var tokenRequests atomic.Int32
+	server := newMetadataServer(t, &tokenRequests)
+
+	tm := NewMetadataTokenManager(server.URL)
+	for i := 0; i < 2; i++ {
+		token, err := tm.GetToken(context.Background())
+		if err != nil {
+			t.Fatalf("GetToken() error = %v", err)
+		}
+		if token != "metadata-token" {
+			t.Errorf("GetToken() = %v, want metadata-token", token)
+		}
+	}
+	if got := tokenRequests.Load(); got != 1 {
+		t.Errorf("expected the token to be cached, got %d token requests", got)
+	}
+
+	tm.Invalidate()
+	if _, err := tm.GetToken(context.Background()); err != nil {
+		t.Fatalf("GetToken() after Invalidate() error = %v", err)
+	}
+	if got := tokenRequests.Load(); got != 2 {
+		t.Errorf("expected a new token after Invalidate(), got %d token requests", got)
+	}
+
+	projectID, err := tm.MetadataProjectID(context.Background())
+	if err != nil {
+		t.Fatalf("MetadataProjectID() error = %v", err)
+	}
+	if projectID != "metadata-project" {
+		t.Errorf("MetadataProjectID() = %v, want metadata-project", projectID)
+	}
+}
+
+func TestMetadataTokenManagerUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	tm := NewMetadataTokenManager(server.URL)
+	if _, err := tm.GetToken(context.Background()); err == nil || !strings.Contains(err.Error(), "metadata server") {
+		t.Errorf("GetToken() error = %v, want a metadata server error", err)
+	}
+	if _, err := tm.MetadataProjectID(context.Background()); err == nil {
+		t.Error("MetadataProjectID() should fail when the metadata server is unavailable")
+	}
+}
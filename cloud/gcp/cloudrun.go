@@ -0,0 +1,158 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// Resource types a GCP cloud service can scale
+const (
+	ResourceInstance = "instance" // compute engine instances, the default
+	ResourceCloudRun = "cloudRun" // Cloud Run services, through their min instances
+)
+
+const cloudRunBasePath = "https://run.googleapis.com/v2"
+
+// CloudRunService scales Cloud Run services by their min instances, the service level setting
+// behind the run.googleapis.com/minScale annotation.  Cloud Run scales on requests by itself,
+// driving min instances to 0 while idle and back to 1 trades idle cost for warm responses.
+type CloudRunService struct {
+	// requests to the Cloud Run admin API go through a compute client, its authentication and
+	// retries work for any Google API
+	api       *ComputeClient
+	projectID string
+	region    string
+}
+
+// cloudRunScaling is the scaling section of a Cloud Run service
+type cloudRunScaling struct {
+	MinInstanceCount int32 `json:"minInstanceCount"`
+}
+
+// cloudRunService is the part of a Cloud Run service resource we read and patch
+type cloudRunService struct {
+	Name    string            `json:"name,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Scaling *cloudRunScaling  `json:"scaling,omitempty"`
+}
+
+// NewCloudRun creates a cloud service scaling the Cloud Run services of a project and region
+func NewCloudRun(config *common.CloudServiceConfig) (*CloudRunService, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config can't be nil for GCP")
+	}
+
+	if config.Region == "" {
+		return nil, fmt.Errorf("region is required for GCP")
+	}
+
+	if len(config.MachineTypes) > 0 {
+		return nil, fmt.Errorf("machineTypes only applies to GCP instances, not cloud run")
+	}
+	if config.SpotPolicy != "" {
+		return nil, fmt.Errorf("spotPolicy only applies to GCP instances, not cloud run")
+	}
+
+	projectID, tokenManager, options, err := authenticate(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := config.TLS.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+	options = append(options, WithTLSConfig(tlsConfig))
+
+	base := cloudRunBasePath
+	if config.Endpoint != "" {
+		base = config.Endpoint
+	}
+	api, err := NewComputeClient(&base, tokenManager, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cloud run client: %w", err)
+	}
+
+	return &CloudRunService{
+		api:       api,
+		projectID: projectID,
+		region:    config.Region,
+	}, nil
+}
+
+func (s *CloudRunService) servicePath(serviceName string) string {
+	return path.Join("projects", s.projectID, "locations", s.region, "services", serviceName)
+}
+
+// getService fetches a Cloud Run service
+func (s *CloudRunService) getService(ctx context.Context, serviceName string) (*cloudRunService, error) {
+	resp, err := s.api.doRequest(ctx, http.MethodGet, s.servicePath(serviceName), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cloud run service %s: %w", serviceName, err)
+	}
+
+	var service cloudRunService
+	if err := json.Unmarshal(resp, &service); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cloud run service response: %w", err)
+	}
+	return &service, nil
+}
+
+// GetCurrentScale returns the min instances of a Cloud Run service
+func (s *CloudRunService) GetCurrentScale(ctx context.Context, serviceName string) (int32, error) {
+	service, err := s.getService(ctx, serviceName)
+	if err != nil {
+		return 0, err
+	}
+	if service.Scaling == nil {
+		return 0, nil
+	}
+	return service.Scaling.MinInstanceCount, nil
+}
+
+// GetLabels returns the labels set on a Cloud Run service
+func (s *CloudRunService) GetLabels(ctx context.Context, serviceName string) (map[string]string, error) {
+	service, err := s.getService(ctx, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	return service.Labels, nil
+}
+
+// ScaleDown lets a Cloud Run service scale to zero while it's idle
+func (s *CloudRunService) ScaleDown(ctx context.Context, serviceName string) error {
+	common.DebugLog("traefik-cloud-saver", "ScaleDown for cloud run service %s", serviceName)
+	return s.ScaleTo(ctx, serviceName, 0)
+}
+
+// ScaleUp keeps an instance of a Cloud Run service warm, unless it already has min instances
+func (s *CloudRunService) ScaleUp(ctx context.Context, serviceName string) error {
+	common.DebugLog("traefik-cloud-saver", "ScaleUp for cloud run service %s", serviceName)
+
+	current, err := s.GetCurrentScale(ctx, serviceName)
+	if err != nil {
+		return err
+	}
+	if current > 0 {
+		common.DebugLog("traefik-cloud-saver", "Cloud run service %s already has %d min instances", serviceName, current)
+		return nil
+	}
+	return s.ScaleTo(ctx, serviceName, 1)
+}
+
+// ScaleTo sets the min instances of a Cloud Run service.  Only the scaling field is patched, so
+// no new revision is deployed.
+func (s *CloudRunService) ScaleTo(ctx context.Context, serviceName string, target int32) error {
+	urlPath := s.servicePath(serviceName) + "?updateMask=scaling.minInstanceCount"
+	body := cloudRunService{Scaling: &cloudRunScaling{MinInstanceCount: target}}
+
+	if _, err := s.api.doRequest(ctx, http.MethodPatch, urlPath, body); err != nil {
+		return fmt.Errorf("failed to set min instances of cloud run service %s to %d: %w", serviceName, target, err)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// fakeCloudRun is a Cloud Run admin API holding the min instances of its services
+type fakeCloudRun struct {
+	mu       sync.Mutex
+	minScale map[string]int32
+	patches  int
+}
+
+func (f *fakeCloudRun) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	const prefix = "/v2/projects/test-project/locations/test-region/services/"
+	if len(r.URL.Path) <= len(prefix) || r.URL.Path[:len(prefix)] != prefix {
+		http.NotFound(w, r)
+		return
+	}
+	name := r.URL.Path[len(prefix):]
+	minScale, ok := f.minScale[name]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error": {"message": "service not found"}}`))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"name":    name,
+			"labels":  map[string]string{"team": "web"},
+			"scaling": map[string]int32{"minInstanceCount": minScale},
+		})
+	case http.MethodPatch:
+		if r.URL.Query().Get("updateMask") != "scaling.minInstanceCount" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var body cloudRunService
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Scaling == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.minScale[name] = body.Scaling.MinInstanceCount
+		f.patches++
+		_, _ = w.Write([]byte(`{"name": "operations/1"}`))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestCloudRun(t *testing.T, minScale map[string]int32) (*CloudRunService, *fakeCloudRun) {
+	t.Helper()
+	fake := &fakeCloudRun{minScale: minScale}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	svc, err := NewCloudRun(&common.CloudServiceConfig{
+		Type:         "gcp",
+		ResourceType: ResourceCloudRun,
+		ProjectID:    "test-project",
+		Region:       "test-region",
+		Endpoint:     server.URL + "/v2",
+		Credentials:  &common.CredentialsConfig{Type: "static_token", Secret: "token"},
+	})
+	if err != nil {
+		t.Fatalf("NewCloudRun() error = %v", err)
+	}
+	return svc, fake
+}
+
+func TestCloudRunScaling(t *testing.T) {
+	ctx := context.Background()
+	svc, fake := newTestCloudRun(t, map[string]int32{"web": 1})
+
+	scale, err := svc.GetCurrentScale(ctx, "web")
+	if err != nil || scale != 1 {
+		t.Fatalf("GetCurrentScale() = %d, %v, want 1", scale, err)
+	}
+
+	if err := svc.ScaleDown(ctx, "web"); err != nil {
+		t.Fatalf("ScaleDown() error = %v", err)
+	}
+	if scale, _ := svc.GetCurrentScale(ctx, "web"); scale != 0 {
+		t.Errorf("expected min instances 0 after scale down, got %d", scale)
+	}
+
+	if err := svc.ScaleUp(ctx, "web"); err != nil {
+		t.Fatalf("ScaleUp() error = %v", err)
+	}
+	if scale, _ := svc.GetCurrentScale(ctx, "web"); scale != 1 {
+		t.Errorf("expected min instances 1 after scale up, got %d", scale)
+	}
+
+	// a service which already keeps instances warm isn't touched
+	patches := fake.patches
+	if err := svc.ScaleUp(ctx, "web"); err != nil {
+		t.Fatalf("second ScaleUp() error = %v", err)
+	}
+	if fake.patches != patches {
+		t.Errorf("expected no patch for a service already scaled up, got %d", fake.patches-patches)
+	}
+
+	if err := svc.ScaleTo(ctx, "web", 3); err != nil {
+		t.Fatalf("ScaleTo() error = %v", err)
+	}
+	if scale, _ := svc.GetCurrentScale(ctx, "web"); scale != 3 {
+		t.Errorf("expected min instances 3, got %d", scale)
+	}
+
+	labels, err := svc.GetLabels(ctx, "web")
+	if err != nil || labels["team"] != "web" {
+		t.Errorf("GetLabels() = %v, %v", labels, err)
+	}
+
+	if err := svc.ScaleDown(ctx, "missing"); err == nil {
+		t.Error("expected an error scaling down a missing service")
+	}
+}
+
+func TestNewCloudRunRequiresRegion(t *testing.T) {
+	_, err := NewCloudRun(&common.CloudServiceConfig{
+		Type:         "gcp",
+		ResourceType: ResourceCloudRun,
+		ProjectID:    "test-project",
+		Credentials:  &common.CredentialsConfig{Type: "static_token", Secret: "token"},
+	})
+	if err == nil {
+		t.Error("expected an error without a region")
+	}
+}
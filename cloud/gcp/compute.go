@@ -3,11 +3,17 @@ package gcp
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
 	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
@@ -19,14 +25,62 @@ type ComputeClient struct {
 	client       *http.Client
 	baseURL      string
 	tokenManager *TokenManager
+	tokenSource  TokenSource
 	timeout      time.Duration
 	pollInterval time.Duration
+	retryPolicy  RetryPolicy
+
+	// set by WithPollInterval, only an explicit interval is checked against the timeout
+	pollIntervalSet bool
+
+	// how many times a started instance's status is checked while it's still coming up
+	startVerifyAttempts int
 }
 
+// ErrInstanceStopping is returned when a stop operation completed but the instance hasn't reached
+// TERMINATED yet
+var ErrInstanceStopping = errors.New("instance is still stopping")
+
+// ErrInstanceStarting is returned when an instance can't be stopped because it's still starting
+// (PROVISIONING or STAGING).  Stopping it mid-start would race the start, the stop is deferred.
+var ErrInstanceStarting = fmt.Errorf("instance is still starting: %w", common.ErrTransitioning)
+
+// ErrInstanceNotStarted is returned when a start operation completed but the instance never reached
+// RUNNING, e.g. because the zone ran out of resources or a quota was exhausted
+var ErrInstanceNotStarted = errors.New("instance failed to start")
+
+// defaultStartVerifyAttempts is how many times a started instance's status is checked by default
+const defaultStartVerifyAttempts = 5
+
 // Instance represents a GCP compute instance
 type Instance struct {
-	Name   string `json:"name"`
-	Status string `json:"status"`
+	Name   string            `json:"name"`
+	Status string            `json:"status"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Zone   string            `json:"zone,omitempty"` // URL of the zone the instance lives in
+
+	MachineType string `json:"machineType,omitempty"` // URL of the instance's machine type
+
+	Scheduling *Scheduling `json:"scheduling,omitempty"`
+}
+
+// Scheduling is how GCP schedules an instance, including whether it may be preempted
+type Scheduling struct {
+	Preemptible               bool   `json:"preemptible,omitempty"`
+	ProvisioningModel         string `json:"provisioningModel,omitempty"`         // STANDARD or SPOT
+	InstanceTerminationAction string `json:"instanceTerminationAction,omitempty"` // STOP or DELETE, what preemption does to a spot instance
+}
+
+// IsSpot reports whether GCP may stop the instance on its own, i.e. it's a spot or a (legacy)
+// preemptible instance
+func (i *Instance) IsSpot() bool {
+	return i.Scheduling != nil && (i.Scheduling.Preemptible || i.Scheduling.ProvisioningModel == "SPOT")
+}
+
+// instanceList is one page of an instances list response
+type instanceList struct {
+	Items         []Instance `json:"items"`
+	NextPageToken string     `json:"nextPageToken,omitempty"`
 }
 
 type ComputeClientOption func(*ComputeClient)
@@ -37,6 +91,131 @@ func WithTimeout(timeout time.Duration) ComputeClientOption {
 	}
 }
 
+// WithPollInterval sets how often a pending operation is polled while waiting for it to complete,
+// e.g. less often for instances which are slow to stop.  The interval must be positive and shorter
+// than the client timeout.
+func WithPollInterval(interval time.Duration) ComputeClientOption {
+	return func(c *ComputeClient) {
+		c.pollInterval = interval
+		c.pollIntervalSet = true
+	}
+}
+
+// WithStartVerifyAttempts sets how many times StartInstance checks the status of an instance which
+// is still PROVISIONING or STAGING after its start operation completed, pollInterval apart
+func WithStartVerifyAttempts(attempts int) ComputeClientOption {
+	return func(c *ComputeClient) {
+		c.startVerifyAttempts = attempts
+	}
+}
+
+// RetryPolicy controls how failed reads are retried.  Delays grow exponentially from BaseDelay,
+// with up to 50% jitter added so many clients don't retry in lockstep.  Rate limited requests
+// aren't counted against MaxAttempts, they're retried up to maxRateLimitRetries times.
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts including the first, 1 disables retries
+	BaseDelay   time.Duration // delay before the first retry
+}
+
+// defaultRetryPolicy retries a couple of times, enough to ride out a brief GCP hiccup within a window
+var defaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 500 * time.Millisecond}
+
+// maxRateLimitRetries is how many times a rate limited request is retried, whatever the retry
+// policy, after waiting as long as the API asks or the policy's backoff when it doesn't say
+const maxRateLimitRetries = 3
+
+// backoff returns the delay before the retry following the given attempt
+func (r RetryPolicy) backoff(attempt int) time.Duration {
+	delay := r.BaseDelay << (attempt - 1)
+	if delay <= 0 {
+		return 0
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// isRetryable reports whether a failed request is worth repeating: server errors and transport
+// failures are, client errors (400, 401, 403, 404, ...) and an expired context aren't
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		default:
+			return false
+		}
+	}
+	// TLS failures are configuration problems, retrying won't fix a certificate
+	var verifyErr *tls.CertificateVerificationError
+	if errors.As(err, &verifyErr) {
+		return false
+	}
+	// the token couldn't be fetched, or the request never got a response
+	return true
+}
+
+// rateLimitDelay reports whether a request was rejected by rate limiting (a 429, or a 503 with a
+// Retry-After header), along with how long the API asked us to wait
+func rateLimitDelay(err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return 0, false
+	}
+	if apiErr.StatusCode == http.StatusTooManyRequests || (apiErr.StatusCode == http.StatusServiceUnavailable && apiErr.RetryAfter > 0) {
+		return apiErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+// parseRetryAfter parses a Retry-After header, given either as a number of seconds or an HTTP date.
+// Missing, malformed or past values return zero.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// WithRetryPolicy sets how failed reads (including operation polls) are retried
+func WithRetryPolicy(policy RetryPolicy) ComputeClientOption {
+	return func(c *ComputeClient) {
+		c.retryPolicy = policy
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used for requests to the compute endpoint,
+// e.g. to trust a private CA or present a client certificate to a proxy
+func WithTLSConfig(tlsConfig *tls.Config) ComputeClientOption {
+	return func(c *ComputeClient) {
+		if tlsConfig == nil {
+			return
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		c.client.Transport = transport
+	}
+}
+
+// WithTokenSource overrides where bearer tokens come from, e.g. a StaticTokenSource.  When set,
+// NewComputeClient doesn't need a TokenManager.
+func WithTokenSource(tokenSource TokenSource) ComputeClientOption {
+	return func(c *ComputeClient) {
+		c.tokenSource = tokenSource
+	}
+}
+
 // Operation represents a GCP compute operation
 type Operation struct {
 	Name   string `json:"name"`
@@ -48,50 +227,140 @@ type Operation struct {
 	} `json:"error,omitempty"`
 }
 
+// errorMessage joins the structured error messages reported by a failed operation
+func (o *Operation) errorMessage() string {
+	if o.Error == nil || len(o.Error.Errors) == 0 {
+		return "unknown error"
+	}
+	messages := make([]string, 0, len(o.Error.Errors))
+	for _, e := range o.Error.Errors {
+		messages = append(messages, e.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// APIError is an error response from the compute API
+type APIError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // from the Retry-After header, zero if there wasn't one
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
 func NewComputeClient(baseURL *string, tokenManager *TokenManager, options ...ComputeClientOption) (*ComputeClient, error) {
 	base := computeBasePath
 	if baseURL != nil && *baseURL != "" {
 		base = *baseURL
 	}
 
-	if tokenManager == nil {
-		return nil, fmt.Errorf("token manager is required")
-	}
-
 	c := &ComputeClient{
 		baseURL:      base,
 		tokenManager: tokenManager,
 		client:       &http.Client{},
 		timeout:      5 * time.Minute,
 		pollInterval: 10 * time.Second,
+		retryPolicy:  defaultRetryPolicy,
+
+		startVerifyAttempts: defaultStartVerifyAttempts,
+	}
+	if tokenManager != nil {
+		c.tokenSource = tokenManager
 	}
 
 	for _, option := range options {
 		option(c)
 	}
 
+	if c.tokenSource == nil {
+		return nil, fmt.Errorf("a token manager or token source is required")
+	}
+
+	if c.pollIntervalSet && (c.pollInterval <= 0 || c.pollInterval >= c.timeout) {
+		return nil, fmt.Errorf("poll interval must be positive and shorter than the timeout (%v), got %v", c.timeout, c.pollInterval)
+	}
+
+	if c.startVerifyAttempts < 1 {
+		return nil, fmt.Errorf("start verify attempts must be at least 1, got %d", c.startVerifyAttempts)
+	}
+
 	return c, nil
 }
 
 func (c *ComputeClient) doRequest(ctx context.Context, method, urlPath string, body interface{}) ([]byte, error) {
-	var bodyReader io.Reader
+	var jsonBody []byte
 	if body != nil {
-		jsonBody, err := json.Marshal(body)
+		var err error
+		jsonBody, err = json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request body: %w", err)
 		}
-		bodyReader = bytes.NewReader(jsonBody)
 	}
 
 	url := fmt.Sprintf("%s/%s", c.baseURL, urlPath)
 
+	// only reads are retried, repeating a stop or start isn't ours to decide
+	attempts := 1
+	if method == http.MethodGet && c.retryPolicy.MaxAttempts > 1 {
+		attempts = c.retryPolicy.MaxAttempts
+	}
+
+	// rate limited requests have their own budget, so waiting as long as the API asks still
+	// happens with a retry policy which disables retries
+	retries, rateLimitRetries := 0, 0
+	for {
+		respBody, err := c.doRequestOnce(ctx, method, url, jsonBody)
+		if err == nil || !isRetryable(ctx, err) {
+			return respBody, err
+		}
+
+		// a rate limited request wasn't processed, so it's safe to repeat whatever the method
+		var delay time.Duration
+		if retryAfter, rateLimited := rateLimitDelay(err); rateLimited {
+			if rateLimitRetries >= maxRateLimitRetries {
+				return respBody, err
+			}
+			rateLimitRetries++
+			delay = retryAfter
+			if delay == 0 {
+				delay = c.retryPolicy.backoff(rateLimitRetries)
+			}
+			common.DebugLog("traefik-cloud-saver", "%s %s rate limited (retry %d of %d), retrying in %v: %v", method, urlPath, rateLimitRetries, maxRateLimitRetries, delay, err)
+		} else {
+			if retries+1 >= attempts {
+				return respBody, err
+			}
+			retries++
+			delay = c.retryPolicy.backoff(retries)
+			common.DebugLog("traefik-cloud-saver", "%s %s failed (attempt %d of %d), retrying in %v: %v", method, urlPath, retries, attempts, delay, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w (giving up retrying: %v)", err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// doRequestOnce makes a single request to the compute API
+func (c *ComputeClient) doRequestOnce(ctx context.Context, method, url string, jsonBody []byte) ([]byte, error) {
+	var bodyReader io.Reader
+	if jsonBody != nil {
+		bodyReader = bytes.NewReader(jsonBody)
+	}
+
 	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	// Get token from token manager
-	token, err := c.tokenManager.GetToken(ctx)
+	// Get token from the token source
+	token, err := c.tokenSource.GetToken(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get auth token: %w", err)
 	}
@@ -110,7 +379,16 @@ func (c *ComputeClient) doRequest(ctx context.Context, method, urlPath string, b
 		return nil, fmt.Errorf("failed to read response body: %w", err)
 	}
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		// the token was revoked or the key behind it rotated, don't keep using it
+		if invalidator, ok := c.tokenSource.(interface{ Invalidate() }); ok {
+			invalidator.Invalidate()
+		}
+	}
+
 	if resp.StatusCode >= 400 {
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+
 		// Try to parse GCP error response
 		var gcpError struct {
 			Error struct {
@@ -122,11 +400,11 @@ func (c *ComputeClient) doRequest(ctx context.Context, method, urlPath string, b
 		}
 
 		if err := json.Unmarshal(respBody, &gcpError); err == nil && gcpError.Error.Message != "" {
-			return nil, fmt.Errorf("%s", gcpError.Error.Message)
+			return nil, &APIError{StatusCode: resp.StatusCode, Message: gcpError.Error.Message, RetryAfter: retryAfter}
 		}
 
 		// Fallback to simple error if can't parse GCP error format
-		return nil, fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(respBody))
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: fmt.Sprintf("request failed with status %d: %s", resp.StatusCode, string(respBody)), RetryAfter: retryAfter}
 	}
 
 	return respBody, nil
@@ -148,6 +426,45 @@ func (c *ComputeClient) GetInstance(ctx context.Context, projectID, zone, instan
 	return &result, nil
 }
 
+// ListInstances returns all instances in a zone matching the filter, e.g. `labels.env = "dev"`.
+// An empty filter lists every instance in the zone.
+func (c *ComputeClient) ListInstances(ctx context.Context, projectID, zone, filter string) ([]Instance, error) {
+	urlPath := path.Join("projects", projectID, "zones", zone, "instances")
+
+	var instances []Instance
+	pageToken := ""
+	for {
+		query := url.Values{}
+		if filter != "" {
+			query.Set("filter", filter)
+		}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+
+		pagePath := urlPath
+		if len(query) > 0 {
+			pagePath += "?" + query.Encode()
+		}
+
+		resp, err := c.doRequest(ctx, http.MethodGet, pagePath, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list instances in zone %s: %w", zone, err)
+		}
+
+		var page instanceList
+		if err := json.Unmarshal(resp, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal instance list response: %w", err)
+		}
+		instances = append(instances, page.Items...)
+
+		if page.NextPageToken == "" {
+			return instances, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
 // StopInstance stops the instance and waits for the operation to complete
 func (c *ComputeClient) StopInstance(ctx context.Context, projectID, zone, instanceName string) (*Operation, error) {
 	// First, make the stop request
@@ -175,6 +492,10 @@ func (c *ComputeClient) StopInstance(ctx context.Context, projectID, zone, insta
 		return nil, err
 	}
 
+	if instance.Status == "STOPPING" {
+		return op, fmt.Errorf("%w: operation %s is done", ErrInstanceStopping, op.Name)
+	}
+
 	if instance.Status != "TERMINATED" {
 		return nil, fmt.Errorf("instance failed to stop: status is %s", instance.Status)
 	}
@@ -182,6 +503,76 @@ func (c *ComputeClient) StopInstance(ctx context.Context, projectID, zone, insta
 	return op, nil
 }
 
+// StartInstance starts the instance and waits for the operation to complete.  A 409 conflict
+// (the instance is already running) isn't an error, there's no operation to return in that case.
+func (c *ComputeClient) StartInstance(ctx context.Context, projectID, zone, instanceName string) (*Operation, error) {
+	// First, make the start request
+	urlPath := path.Join("projects", projectID, "zones", zone, "instances", instanceName, "start")
+	respBody, err := c.doRequest(ctx, http.MethodPost, urlPath, nil)
+
+	var apiErr *APIError
+	var op *Operation
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict:
+		common.DebugLog("traefik-cloud-saver", "start of instance %s conflicted (%s), verifying its state", instanceName, apiErr.Message)
+	case err != nil:
+		return nil, err
+	default:
+		// Get the operation from the response
+		var operation Operation
+		if err := json.Unmarshal(respBody, &operation); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal operation response: %w", err)
+		}
+
+		// Wait for the operation to complete using its name
+		op, err = c.waitForOperation(ctx, projectID, zone, operation.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.verifyRunning(ctx, projectID, zone, instanceName); err != nil {
+		return nil, err
+	}
+
+	return op, nil
+}
+
+// verifyRunning checks that a started instance reaches RUNNING.  An instance still PROVISIONING or
+// STAGING is checked again, up to startVerifyAttempts times, any other status fails right away.
+func (c *ComputeClient) verifyRunning(ctx context.Context, projectID, zone, instanceName string) error {
+	var status string
+	for attempt := 1; attempt <= c.startVerifyAttempts; attempt++ {
+		if attempt > 1 {
+			timer := time.NewTimer(c.pollInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return fmt.Errorf("%w: status is %s, stopped waiting: %v", ErrInstanceNotStarted, status, ctx.Err())
+			case <-timer.C:
+			}
+		}
+
+		instance, err := c.GetInstance(ctx, projectID, zone, instanceName)
+		if err != nil {
+			return err
+		}
+		status = instance.Status
+
+		switch status {
+		case "RUNNING":
+			return nil
+		case "PROVISIONING", "STAGING":
+			common.DebugLog("traefik-cloud-saver", "instance %s is %s (check %d of %d)", instanceName, status, attempt, c.startVerifyAttempts)
+		default:
+			return fmt.Errorf("%w: status is %s", ErrInstanceNotStarted, status)
+		}
+	}
+
+	return fmt.Errorf("%w: status is still %s after %d checks, the zone may be out of resources or a quota exhausted",
+		ErrInstanceNotStarted, status, c.startVerifyAttempts)
+}
+
 func (c *ComputeClient) GetOperation(ctx context.Context, projectID, zone, operation string) (*Operation, error) {
 	urlPath := path.Join("projects", projectID, "zones", zone, "operations", operation)
 
@@ -224,7 +615,7 @@ func (c *ComputeClient) waitForOperation(ctx context.Context, projectID, zone, o
 
 			if operation.Status == "DONE" {
 				if operation.Error != nil {
-					return nil, fmt.Errorf("operation failed: %v", operation.Error)
+					return nil, fmt.Errorf("operation failed: %s", operation.errorMessage())
 				}
 				return &operation, nil
 			}
@@ -2,11 +2,19 @@ package gcp
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
 	"log"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -189,6 +197,28 @@ func TestComputeClient_StopInstance(t *testing.T) {
 			expectedError: "Instance not found",
 			timeout:       1 * time.Second,
 		},
+		{
+			name: "operation done but instance still stopping",
+			responses: map[string]struct {
+				status int
+				body   string
+			}{
+				"instances/instance-1/stop": {
+					status: http.StatusOK,
+					body:   `{"name": "operation-123"}`,
+				},
+				"operations/operation-123": {
+					status: http.StatusOK,
+					body:   `{"status": "DONE"}`,
+				},
+				"instances/instance-1": {
+					status: http.StatusOK,
+					body:   `{"name": "instance-1", "status": "STOPPING"}`,
+				},
+			},
+			expectedError: ErrInstanceStopping.Error(),
+			timeout:       1 * time.Second,
+		},
 		{
 			name: "timeout while stopping",
 			responses: map[string]struct {
@@ -261,3 +291,486 @@ func TestComputeClient_StopInstance(t *testing.T) {
 		})
 	}
 }
+
+// newTLSTestClient creates a compute client pointed at a TLS server, with tokens served from a plain http server
+func newTLSTestClient(t *testing.T, tlsServer *httptest.Server, options ...ComputeClientOption) *ComputeClient {
+	t.Helper()
+
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"test-token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	t.Cleanup(tokenServer.Close)
+
+	tokenManager, err := NewTokenManager(testCredentials(tokenServer.URL))
+	require.NoError(t, err)
+
+	// handshake failures aren't worth retrying in these tests
+	options = append([]ComputeClientOption{WithRetryPolicy(RetryPolicy{MaxAttempts: 1})}, options...)
+
+	baseURL := tlsServer.URL + "/compute/v1"
+	client, err := NewComputeClient(&baseURL, tokenManager, options...)
+	require.NoError(t, err)
+	return client
+}
+
+// selfSignedClientCert generates a throwaway client certificate for mTLS tests
+func selfSignedClientCert(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "cloud-saver-test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, cert
+}
+
+func TestComputeClient_WithTLSConfig(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "instance-1", "status": "RUNNING"}`))
+	})
+
+	t.Run("custom CA pool", func(t *testing.T) {
+		server := httptest.NewTLSServer(handler)
+		defer server.Close()
+
+		pool := x509.NewCertPool()
+		pool.AddCert(server.Certificate())
+
+		client := newTLSTestClient(t, server, WithTLSConfig(&tls.Config{RootCAs: pool}))
+		instance, err := client.GetInstance(context.Background(), "test-project", "test-zone", "instance-1")
+		require.NoError(t, err)
+		assert.Equal(t, "RUNNING", instance.Status)
+	})
+
+	t.Run("untrusted CA without option", func(t *testing.T) {
+		server := httptest.NewTLSServer(handler)
+		defer server.Close()
+
+		client := newTLSTestClient(t, server)
+		_, err := client.GetInstance(context.Background(), "test-project", "test-zone", "instance-1")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "certificate")
+	})
+
+	t.Run("mutual TLS", func(t *testing.T) {
+		clientCert, clientCA := selfSignedClientCert(t)
+		clientCAs := x509.NewCertPool()
+		clientCAs.AddCert(clientCA)
+
+		server := httptest.NewUnstartedServer(handler)
+		server.TLS = &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  clientCAs,
+		}
+		server.StartTLS()
+		defer server.Close()
+
+		pool := x509.NewCertPool()
+		pool.AddCert(server.Certificate())
+
+		// without a client certificate the handshake is rejected
+		client := newTLSTestClient(t, server, WithTLSConfig(&tls.Config{RootCAs: pool}))
+		_, err := client.GetInstance(context.Background(), "test-project", "test-zone", "instance-1")
+		require.Error(t, err)
+
+		client = newTLSTestClient(t, server, WithTLSConfig(&tls.Config{
+			RootCAs:      pool,
+			Certificates: []tls.Certificate{clientCert},
+		}))
+		instance, err := client.GetInstance(context.Background(), "test-project", "test-zone", "instance-1")
+		require.NoError(t, err)
+		assert.Equal(t, "instance-1", instance.Name)
+	})
+}
+
+func TestComputeClient_WithTokenSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer static" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"name": "instance-1", "status": "TERMINATED"}`))
+	}))
+	defer server.Close()
+
+	baseURL := server.URL + "/compute/v1"
+	client, err := NewComputeClient(&baseURL, nil, WithTokenSource(&StaticTokenSource{Token: "static"}))
+	require.NoError(t, err)
+
+	instance, err := client.GetInstance(context.Background(), "test-project", "test-zone", "instance-1")
+	require.NoError(t, err)
+	assert.Equal(t, "TERMINATED", instance.Status)
+
+	_, err = NewComputeClient(&baseURL, nil)
+	assert.Error(t, err, "a token manager or token source is required")
+}
+
+func TestComputeClient_WithPollInterval(t *testing.T) {
+	baseURL := "http://localhost/compute/v1"
+	tokenSource := WithTokenSource(&StaticTokenSource{Token: "static"})
+
+	client, err := NewComputeClient(&baseURL, nil, tokenSource)
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Second, client.pollInterval, "default poll interval")
+
+	client, err = NewComputeClient(&baseURL, nil, tokenSource, WithPollInterval(30*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, client.pollInterval)
+
+	// the order of the options doesn't matter
+	client, err = NewComputeClient(&baseURL, nil, tokenSource, WithPollInterval(time.Second), WithTimeout(2*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, client.pollInterval)
+
+	for _, interval := range []time.Duration{0, -time.Second, 5 * time.Minute} {
+		_, err = NewComputeClient(&baseURL, nil, tokenSource, WithPollInterval(interval))
+		assert.Error(t, err, "poll interval %v should be rejected", interval)
+	}
+
+	_, err = NewComputeClient(&baseURL, nil, tokenSource, WithTimeout(time.Second), WithPollInterval(time.Second))
+	assert.Error(t, err, "poll interval must be shorter than the timeout")
+}
+
+func TestComputeClient_ListInstances(t *testing.T) {
+	var pages []string
+	server, client := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/compute/v1/projects/test-project/zones/test-zone/instances", r.URL.Path)
+		assert.Equal(t, `labels.env = "dev"`, r.URL.Query().Get("filter"))
+
+		pageToken := r.URL.Query().Get("pageToken")
+		pages = append(pages, pageToken)
+		if pageToken == "" {
+			w.Write([]byte(`{"items": [{"name": "instance-1", "status": "RUNNING"}], "nextPageToken": "page-2"}`))
+			return
+		}
+		w.Write([]byte(`{"items": [{"name": "instance-2", "status": "TERMINATED", "labels": {"env": "dev"}}]}`))
+	})
+	defer server.Close()
+
+	instances, err := client.ListInstances(context.Background(), "test-project", "test-zone", `labels.env = "dev"`)
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+	assert.Equal(t, "instance-1", instances[0].Name)
+	assert.Equal(t, "dev", instances[1].Labels["env"])
+	assert.Equal(t, []string{"", "page-2"}, pages)
+}
+
+func TestComputeClient_StartInstance(t *testing.T) {
+	tests := []struct {
+		name          string
+		responses     map[string]string
+		expectedError string
+	}{
+		{
+			name: "successful start",
+			responses: map[string]string{
+				"instances/instance-1/start": `{"name": "operation-456"}`,
+				"operations/operation-456":   `{"status": "DONE"}`,
+				"instances/instance-1":       `{"name": "instance-1", "status": "RUNNING"}`,
+			},
+		},
+		{
+			name: "operation failed",
+			responses: map[string]string{
+				"instances/instance-1/start": `{"name": "operation-456"}`,
+				"operations/operation-456":   `{"status": "DONE", "error": {"errors": [{"message": "quota exceeded"}, {"message": "try another zone"}]}}`,
+				"instances/instance-1":       `{"name": "instance-1", "status": "TERMINATED"}`,
+			},
+			expectedError: "operation failed: quota exceeded; try another zone",
+		},
+		{
+			name: "instance not running after start",
+			responses: map[string]string{
+				"instances/instance-1/start": `{"name": "operation-456"}`,
+				"operations/operation-456":   `{"status": "DONE"}`,
+				"instances/instance-1":       `{"name": "instance-1", "status": "TERMINATED"}`,
+			},
+			expectedError: "instance failed to start: status is TERMINATED",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+				pathSuffix := strings.TrimPrefix(r.URL.Path, "/compute/v1/projects/test-project/zones/test-zone/")
+				body, exists := tt.responses[pathSuffix]
+				if !exists {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if pathSuffix == "instances/instance-1/start" {
+					assert.Equal(t, http.MethodPost, r.Method)
+				}
+				w.Write([]byte(body))
+			})
+			defer server.Close()
+			client.pollInterval = 10 * time.Millisecond
+
+			op, err := client.StartInstance(context.Background(), "test-project", "test-zone", "instance-1")
+			if tt.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			require.NotNil(t, op)
+			assert.Equal(t, "DONE", op.Status)
+		})
+	}
+}
+
+func TestComputeClient_StartInstanceConflict(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        string
+		expectedError string
+	}{
+		{name: "already running", status: "RUNNING"},
+		{name: "conflict but not running", status: "STOPPING", expectedError: "instance failed to start: status is STOPPING"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/compute/v1/projects/test-project/zones/test-zone/instances/instance-1/start":
+					w.WriteHeader(http.StatusConflict)
+					w.Write([]byte(`{"error": {"code": 409, "message": "The instance is already running"}}`))
+				case "/compute/v1/projects/test-project/zones/test-zone/instances/instance-1":
+					w.Write([]byte(`{"name": "instance-1", "status": "` + tt.status + `"}`))
+				default:
+					w.WriteHeader(http.StatusNotFound)
+				}
+			})
+			defer server.Close()
+
+			op, err := client.StartInstance(context.Background(), "test-project", "test-zone", "instance-1")
+			if tt.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Nil(t, op)
+		})
+	}
+}
+
+func TestComputeClient_APIError(t *testing.T) {
+	server, client := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error": {"code": 403, "message": "Required 'compute.instances.get' permission"}}`))
+	})
+	defer server.Close()
+
+	_, err := client.GetInstance(context.Background(), "test-project", "test-zone", "instance-1")
+	require.Error(t, err)
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+	assert.Equal(t, "Required 'compute.instances.get' permission", apiErr.Message)
+}
+
+func TestComputeClient_RetryPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		failures     int
+		failStatus   int
+		wantRequests int
+		wantErr      bool
+	}{
+		{name: "transient 503 is retried", method: http.MethodGet, failures: 2, failStatus: http.StatusServiceUnavailable, wantRequests: 3},
+		{name: "500 is retried", method: http.MethodGet, failures: 1, failStatus: http.StatusInternalServerError, wantRequests: 2},
+		{name: "gives up after max attempts", method: http.MethodGet, failures: 10, failStatus: http.StatusServiceUnavailable, wantRequests: 3, wantErr: true},
+		{name: "400 fails fast", method: http.MethodGet, failures: 10, failStatus: http.StatusBadRequest, wantRequests: 1, wantErr: true},
+		{name: "401 fails fast", method: http.MethodGet, failures: 10, failStatus: http.StatusUnauthorized, wantRequests: 1, wantErr: true},
+		{name: "403 fails fast", method: http.MethodGet, failures: 10, failStatus: http.StatusForbidden, wantRequests: 1, wantErr: true},
+		{name: "404 fails fast", method: http.MethodGet, failures: 10, failStatus: http.StatusNotFound, wantRequests: 1, wantErr: true},
+		{name: "posts are not retried", method: http.MethodPost, failures: 1, failStatus: http.StatusServiceUnavailable, wantRequests: 1, wantErr: true},
+		{name: "429 is retried", method: http.MethodGet, failures: 2, failStatus: http.StatusTooManyRequests, wantRequests: 3},
+		{name: "rate limited posts are retried", method: http.MethodPost, failures: 1, failStatus: http.StatusTooManyRequests, wantRequests: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server, client := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+				if int(requests.Add(1)) <= tt.failures {
+					w.WriteHeader(tt.failStatus)
+					w.Write([]byte(`{"error": {"message": "try again"}}`))
+					return
+				}
+				w.Write([]byte(`{"name": "instance-1", "status": "RUNNING"}`))
+			})
+			defer server.Close()
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})(client)
+
+			_, err := client.doRequest(context.Background(), tt.method, "projects/test-project/zones/test-zone/instances/instance-1", nil)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, int32(tt.wantRequests), requests.Load())
+		})
+	}
+}
+
+func TestComputeClient_RateLimitWithRetriesDisabled(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		failStatus   int
+		retryAfter   string
+		wantRequests int
+		wantErr      bool
+	}{
+		{name: "429 is still retried", failures: 1, failStatus: http.StatusTooManyRequests, wantRequests: 2},
+		{name: "503 with Retry-After is still retried", failures: 1, failStatus: http.StatusServiceUnavailable, retryAfter: "1", wantRequests: 2},
+		{name: "503 without Retry-After isn't", failures: 1, failStatus: http.StatusServiceUnavailable, wantRequests: 1, wantErr: true},
+		{name: "rate limit retries are bounded", failures: 10, failStatus: http.StatusTooManyRequests, wantRequests: 1 + maxRateLimitRetries, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server, client := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+				if int(requests.Add(1)) <= tt.failures {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.WriteHeader(tt.failStatus)
+					w.Write([]byte(`{"error": {"message": "Rate Limit Exceeded"}}`))
+					return
+				}
+				w.Write([]byte(`{"name": "instance-1", "status": "RUNNING"}`))
+			})
+			defer server.Close()
+			WithRetryPolicy(RetryPolicy{MaxAttempts: 1, BaseDelay: time.Millisecond})(client)
+
+			_, err := client.GetInstance(context.Background(), "test-project", "test-zone", "instance-1")
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, int32(tt.wantRequests), requests.Load())
+		})
+	}
+}
+
+func TestComputeClient_RetryRespectsContext(t *testing.T) {
+	var requests atomic.Int32
+	server, client := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer server.Close()
+	WithRetryPolicy(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second})(client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GetInstance(ctx, "test-project", "test-zone", "instance-1")
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "retries should stop at the context deadline")
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestComputeClient_RetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	server, client := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= 2 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error": {"message": "Rate Limit Exceeded"}}`))
+			return
+		}
+		w.Write([]byte(`{"name": "instance-1", "status": "RUNNING"}`))
+	})
+	defer server.Close()
+	// the backoff alone would retry almost immediately
+	WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond})(client)
+
+	start := time.Now()
+	instance, err := client.GetInstance(context.Background(), "test-project", "test-zone", "instance-1")
+	require.NoError(t, err)
+	assert.Equal(t, "RUNNING", instance.Status)
+	assert.Equal(t, int32(3), requests.Load())
+	assert.GreaterOrEqual(t, time.Since(start), 2*time.Second, "should wait as long as Retry-After asks")
+}
+
+func TestComputeClient_RetryAfterRespectsContext(t *testing.T) {
+	var requests atomic.Int32
+	server, client := setupTestServer(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GetInstance(ctx, "test-project", "test-zone", "instance-1")
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond, "Retry-After should be bounded by the context")
+	assert.Equal(t, int32(1), requests.Load())
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, time.Minute, apiErr.RetryAfter)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{value: "", want: 0},
+		{value: "5", want: 5 * time.Second},
+		{value: "0", want: 0},
+		{value: "-3", want: 0},
+		{value: "Mon, 01 Jan 2024 12:00:30 GMT", want: 30 * time.Second},
+		{value: "Mon, 01 Jan 2024 11:59:00 GMT", want: 0},
+		{value: "soon", want: 0},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, parseRetryAfter(tt.value, now), "Retry-After %q", tt.value)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 4, BaseDelay: 100 * time.Millisecond}
+	for attempt, base := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		delay := policy.backoff(attempt + 1)
+		assert.GreaterOrEqual(t, delay, base)
+		assert.LessOrEqual(t, delay, base+base/2)
+	}
+	assert.Equal(t, time.Duration(0), RetryPolicy{}.backoff(1))
+}
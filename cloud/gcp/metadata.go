@@ -0,0 +1,109 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// metadataHost is the GCE metadata server, reachable from GCE VMs and GKE pods
+	metadataHost = "metadata.google.internal"
+
+	// metadataHostEnv overrides the metadata server host, as in Google's own client libraries
+	metadataHostEnv = "GCE_METADATA_HOST"
+
+	metadataTokenPath   = "/computeMetadata/v1/instance/service-accounts/default/token"
+	metadataProjectPath = "/computeMetadata/v1/project/project-id"
+
+	// metadataTimeout bounds a single request to the metadata server, which is local and fast
+	metadataTimeout = 5 * time.Second
+)
+
+// metadataURL returns the base URL of the metadata server
+func metadataURL() string {
+	host := metadataHost
+	if override := os.Getenv(metadataHostEnv); override != "" {
+		host = override
+	}
+	return "http://" + host
+}
+
+// NewMetadataTokenManager creates a TokenManager which gets tokens for the instance's default
+// service account from the metadata server, so no key has to be shipped when running on GCE or
+// GKE.  Tokens are cached until they expire, just like signed ones.
+func NewMetadataTokenManager(metadataURL string) *TokenManager {
+	return &TokenManager{
+		client:      &http.Client{Timeout: metadataTimeout},
+		metadataURL: strings.TrimSuffix(metadataURL, "/"),
+		loadedAt:    time.Now(),
+	}
+}
+
+// requestMetadataToken fetches an access token from the metadata server.  Must be called with mu
+// held.
+func (tm *TokenManager) requestMetadataToken(ctx context.Context) (string, error) {
+	body, err := tm.getMetadata(ctx, metadataTokenPath)
+	if err != nil {
+		return "", fmt.Errorf("token request to the metadata server failed: %w", err)
+	}
+
+	var tokenResp TokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return "", fmt.Errorf("failed to decode metadata token response: %w", err)
+	}
+
+	if tokenResp.AccessToken == "" {
+		return "", fmt.Errorf("received empty access token from the metadata server")
+	}
+
+	tm.currentToken = &tokenResp
+	tm.expiresAt = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+
+	return tokenResp.AccessToken, nil
+}
+
+// MetadataProjectID returns the ID of the project the instance runs in, from the metadata server
+func (tm *TokenManager) MetadataProjectID(ctx context.Context) (string, error) {
+	body, err := tm.getMetadata(ctx, metadataProjectPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get project ID from the metadata server: %w", err)
+	}
+
+	projectID := strings.TrimSpace(string(body))
+	if projectID == "" {
+		return "", fmt.Errorf("metadata server returned an empty project ID")
+	}
+	return projectID, nil
+}
+
+// getMetadata reads a value from the metadata server
+func (tm *TokenManager) getMetadata(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tm.metadataURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metadata request: %w", err)
+	}
+	// required, the metadata server refuses requests without it
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := tm.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata request for %s failed with status %d", path, resp.StatusCode)
+	}
+	return body, nil
+}
@@ -3,12 +3,21 @@ package gcp
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
 )
 
+// defaultMaxStopDuration is how long an instance may be STOPPING before it's considered stuck
+const defaultMaxStopDuration = 10 * time.Minute
+
 // Service implementation
 type Service struct {
 	compute   ComputeClient
@@ -16,6 +25,17 @@ type Service struct {
 	zone      string
 	region    string
 	config    *common.CloudServiceConfig
+
+	// instances seen STOPPING, and when.  Those stopping for longer than maxStopDuration are
+	// quarantined, they're left alone until they leave the STOPPING state.
+	maxStopDuration time.Duration
+	stoppingMu      sync.Mutex
+	stoppingSince   map[string]time.Time
+	quarantined     map[string]bool
+
+	// zones of the instances found by DiscoverServices, those outside it are in zone
+	zonesMu       sync.Mutex
+	instanceZones map[string]string
 }
 
 // loadServiceAccountCredentials loads credentials from a service account JSON file
@@ -38,11 +58,12 @@ func loadServiceAccountCredentials(path string) (*Credentials, error) {
 	}
 
 	return &Credentials{
-		Type:        serviceAccount.Type,
-		ClientEmail: serviceAccount.ClientEmail,
-		PrivateKey:  serviceAccount.PrivateKey,
-		TokenURL:    "https://oauth2.googleapis.com/token",
-		ProjectID:   serviceAccount.ProjectID,
+		Type:         serviceAccount.Type,
+		ClientEmail:  serviceAccount.ClientEmail,
+		PrivateKey:   serviceAccount.PrivateKey,
+		PrivateKeyID: serviceAccount.PrivateKeyID,
+		TokenURL:     "https://oauth2.googleapis.com/token",
+		ProjectID:    serviceAccount.ProjectID,
 	}, nil
 }
 
@@ -59,44 +80,101 @@ func New(config *common.CloudServiceConfig) (*Service, error) {
 		return nil, fmt.Errorf("region is required for GCP")
 	}
 
-	if config.Credentials == nil || config.Credentials.Secret == "" {
-		return nil, fmt.Errorf("credentials are required for GCP")
+	projectID, tokenManager, options, err := authenticate(config)
+	if err != nil {
+		return nil, err
+	}
+	return newService(config, projectID, tokenManager, options...)
+}
+
+// authenticate works out the project, and how requests to Google APIs are authorized, from the
+// credentials config.  Either the token manager is set, or an option with another token source.
+func authenticate(config *common.CloudServiceConfig) (string, *TokenManager, []ComputeClientOption, error) {
+	// without credentials, use the instance's own service account through the metadata server
+	if config.Credentials == nil || config.Credentials.Type == "metadata" {
+		tokenManager := NewMetadataTokenManager(metadataURL())
+		projectID := config.ProjectID
+		if projectID == "" {
+			var err error
+			projectID, err = tokenManager.MetadataProjectID(context.Background())
+			if err != nil {
+				return "", nil, nil, fmt.Errorf("project ID is required for GCP: %w", err)
+			}
+		}
+		return projectID, tokenManager, nil, nil
+	}
+
+	if config.Credentials.Secret == "" {
+		return "", nil, nil, fmt.Errorf("credentials are required for GCP")
+	}
+
+	// a pre-fetched bearer token needs no signing key at all
+	if config.Credentials.Type == "static_token" {
+		if config.ProjectID == "" {
+			return "", nil, nil, fmt.Errorf("project ID is required for GCP")
+		}
+		return config.ProjectID, nil, []ComputeClientOption{WithTokenSource(&StaticTokenSource{Token: config.Credentials.Secret})}, nil
 	}
 
 	var creds *Credentials
+	var tokenOptions []TokenManagerOption
 	var err error
 	if config.Credentials.Type == "service_account" || config.Credentials.Type == "" {
 		// Load credentials from service account JSON file
 		creds, err = loadServiceAccountCredentials(config.Credentials.Secret)
 		if err != nil {
-			return nil, fmt.Errorf("failed to load service account credentials: %w", err)
+			return "", nil, nil, fmt.Errorf("failed to load service account credentials: %w", err)
+		}
+
+		var reloadInterval time.Duration
+		if config.Credentials.ReloadInterval != "" {
+			reloadInterval, err = time.ParseDuration(config.Credentials.ReloadInterval)
+			if err != nil {
+				return "", nil, nil, fmt.Errorf("invalid credentials reloadInterval: %w", err)
+			}
 		}
+		tokenOptions = append(tokenOptions, WithCredentialsFile(config.Credentials.Secret, reloadInterval))
 	} else if config.Credentials.Type == "token" {
-		// Use token directly as the private key, this is used for testing, it won't work in production
+		// Use token directly as the private key, this is used for testing, it won't work in production.
+		// Prefer "static_token" which skips the JWT signer entirely.
 		creds = &Credentials{
 			PrivateKey: config.Credentials.Secret,
 		}
 	} else {
-		return nil, fmt.Errorf("unsupported credentials type: %s", config.Credentials.Type)
+		return "", nil, nil, fmt.Errorf("unsupported credentials type: %s", config.Credentials.Type)
 	}
 
 	// Use ProjectID from service account if not specified in config
 	projectID := config.ProjectID
 	if projectID == "" {
 		if creds.ProjectID == "" {
-			return nil, fmt.Errorf("project ID is required for GCP")
+			return "", nil, nil, fmt.Errorf("project ID is required for GCP")
 		}
 		projectID = creds.ProjectID
 	}
 
 	// Create token manager
-	tokenManager, err := NewTokenManager(creds)
+	tokenManager, err := NewTokenManager(creds, tokenOptions...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create token manager: %w", err)
+		return "", nil, nil, fmt.Errorf("failed to create token manager: %w", err)
+	}
+
+	return projectID, tokenManager, nil, nil
+}
+
+// newService creates the compute client and the service around it
+func newService(config *common.CloudServiceConfig, projectID string, tokenManager *TokenManager, options ...ComputeClientOption) (*Service, error) {
+	tlsConfig, err := config.TLS.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration: %w", err)
+	}
+	options = append(options, WithTLSConfig(tlsConfig))
+	if config.StartVerifyAttempts != 0 {
+		options = append(options, WithStartVerifyAttempts(config.StartVerifyAttempts))
 	}
 
 	// Create compute client with token manager
-	compute, err := NewComputeClient(&config.Endpoint, tokenManager)
+	compute, err := NewComputeClient(&config.Endpoint, tokenManager, options...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create compute client: %w", err)
 	}
@@ -105,12 +183,21 @@ func New(config *common.CloudServiceConfig) (*Service, error) {
 		return nil, fmt.Errorf("compute client is nil")
 	}
 
+	maxStopDuration := defaultMaxStopDuration
+	if config.MaxStopDuration != "" {
+		maxStopDuration, err = time.ParseDuration(config.MaxStopDuration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maxStopDuration: %w", err)
+		}
+	}
+
 	return &Service{
-		compute:   *compute,
-		projectID: projectID,
-		zone:      config.Zone,
-		region:    config.Region,
-		config:    config,
+		compute:         *compute,
+		projectID:       projectID,
+		zone:            config.Zone,
+		region:          config.Region,
+		config:          config,
+		maxStopDuration: maxStopDuration,
 	}, nil
 }
 
@@ -119,18 +206,37 @@ func (s *Service) ScaleDown(ctx context.Context, instanceName string) error {
 
 	common.DebugLog("traefik-cloud-saver", "ScaleDown for instance %s", instanceName)
 
-	instance, err := s.compute.GetInstance(ctx, s.projectID, s.zone, instanceName)
+	instance, err := s.compute.GetInstance(ctx, s.projectID, s.zoneOf(instanceName), instanceName)
 	if err != nil {
 		return fmt.Errorf("failed to get instance %s: %w", instanceName, err)
 	}
 
-	// If instance is already stopped or stopping, return early
-	if instance.Status == "TERMINATED" || instance.Status == "STOPPING" {
-		common.DebugLog("traefik-cloud-saver", "Instance %s is already stopped or stopping", instanceName)
+	s.trackStopping(instanceName, instance.Status)
+	if err := s.checkQuarantine(instanceName); err != nil {
+		return err
+	}
+
+	if err := s.checkMachineType(instance); err != nil {
+		return err
+	}
+
+	switch instance.Status {
+	case "TERMINATED", "STOPPED", "SUSPENDED":
+		common.DebugLog("traefik-cloud-saver", "Instance %s is already stopped (%s)", instanceName, instance.Status)
 		return nil
+	case "STOPPING", "SUSPENDING":
+		common.DebugLog("traefik-cloud-saver", "Instance %s is already stopping (%s)", instanceName, instance.Status)
+		return nil
+	case "PROVISIONING", "STAGING":
+		return fmt.Errorf("not stopping instance %s (%s): %w", instanceName, instance.Status, ErrInstanceStarting)
 	}
 
-	_, err = s.compute.StopInstance(ctx, s.projectID, s.zone, instanceName)
+	_, err = s.compute.StopInstance(ctx, s.projectID, s.zoneOf(instanceName), instanceName)
+	if errors.Is(err, ErrInstanceStopping) {
+		// the stop went through, GCP is just slow getting the instance to TERMINATED
+		s.trackStopping(instanceName, "STOPPING")
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to stop instance %s: %w", instanceName, err)
 	}
@@ -138,16 +244,217 @@ func (s *Service) ScaleDown(ctx context.Context, instanceName string) error {
 	return nil
 }
 
+// checkMachineType returns an error, after logging a warning, if the instance's machine type isn't
+// one of the configured machine types.  Any machine type is fine when none are configured.
+func (s *Service) checkMachineType(instance *Instance) error {
+	if s.config == nil || len(s.config.MachineTypes) == 0 {
+		return nil
+	}
+	machineType := path.Base(instance.MachineType)
+	for _, allowed := range s.config.MachineTypes {
+		if machineType == allowed {
+			return nil
+		}
+	}
+	common.LogProvider("traefik-cloud-saver", "[WARNING] skipping instance %s, machine type %q isn't one of %v", instance.Name, machineType, s.config.MachineTypes)
+	return fmt.Errorf("instance %s has machine type %q: %w", instance.Name, machineType, common.ErrNotEligible)
+}
+
 func (s *Service) ScaleUp(ctx context.Context, instanceName string) error {
-	return fmt.Errorf("scale up operation not implemented for GCP instances")
+	common.DebugLog("traefik-cloud-saver", "ScaleUp for instance %s", instanceName)
+
+	instance, err := s.compute.GetInstance(ctx, s.projectID, s.zoneOf(instanceName), instanceName)
+	if err != nil {
+		return fmt.Errorf("failed to get instance %s: %w", instanceName, err)
+	}
+	s.trackStopping(instanceName, instance.Status)
+	if err := s.checkQuarantine(instanceName); err != nil {
+		return err
+	}
+
+	if err := s.checkMachineType(instance); err != nil {
+		return err
+	}
+
+	// If instance is already running or on its way up, return early
+	switch instance.Status {
+	case "RUNNING", "PROVISIONING", "STAGING":
+		common.DebugLog("traefik-cloud-saver", "Instance %s is already running or starting", instanceName)
+		return nil
+	}
+
+	if err := s.checkSpot(instance); err != nil {
+		return err
+	}
+
+	_, err = s.compute.StartInstance(ctx, s.projectID, s.zoneOf(instanceName), instanceName)
+	if err != nil {
+		return fmt.Errorf("failed to start instance %s: %w", instanceName, err)
+	}
+
+	return nil
+}
+
+// checkSpot returns an ErrNotEligible error for a stopped spot instance the spot policy says not to
+// start.  A spot instance may have been stopped by preemption rather than by the plugin, and
+// starting it again may fail for lack of spot capacity, or be preempted again soon after.
+func (s *Service) checkSpot(instance *Instance) error {
+	if !instance.IsSpot() {
+		return nil
+	}
+	if s.config == nil || s.config.SpotPolicy != common.SpotPolicySkip {
+		common.DebugLog("traefik-cloud-saver", "Starting spot instance %s (%s)", instance.Name, instance.Status)
+		return nil
+	}
+	common.LogProvider("traefik-cloud-saver", "[WARNING] not starting spot instance %s, spotPolicy is %s", instance.Name, common.SpotPolicySkip)
+	return fmt.Errorf("instance %s is a spot instance: %w", instance.Name, common.ErrNotEligible)
+}
+
+// trackStopping records how long an instance has been STOPPING, quarantining (and alerting on) an
+// instance stuck there for longer than maxStopDuration.  Any other status clears the tracking.
+func (s *Service) trackStopping(instanceName, status string) {
+	s.stoppingMu.Lock()
+	defer s.stoppingMu.Unlock()
+
+	if status != "STOPPING" {
+		if s.quarantined[instanceName] {
+			common.LogProvider("traefik-cloud-saver", "Instance %s left STOPPING (now %s), releasing it from quarantine", instanceName, status)
+		}
+		delete(s.stoppingSince, instanceName)
+		delete(s.quarantined, instanceName)
+		return
+	}
+
+	if s.stoppingSince == nil {
+		s.stoppingSince = make(map[string]time.Time)
+		s.quarantined = make(map[string]bool)
+	}
+
+	since, ok := s.stoppingSince[instanceName]
+	if !ok {
+		s.stoppingSince[instanceName] = time.Now()
+		return
+	}
+
+	if !s.quarantined[instanceName] && s.maxStopDuration > 0 && time.Since(since) > s.maxStopDuration {
+		s.quarantined[instanceName] = true
+		common.LogProvider("traefik-cloud-saver", "[ALERT]: instance %s has been STOPPING for %v, quarantining it until it leaves that state",
+			instanceName, time.Since(since).Round(time.Second))
+	}
+}
+
+// IsQuarantined reports whether an instance is stuck STOPPING and has been quarantined
+func (s *Service) IsQuarantined(instanceName string) bool {
+	s.stoppingMu.Lock()
+	defer s.stoppingMu.Unlock()
+	return s.quarantined[instanceName]
+}
+
+// discoveryZones returns the zones scanned by DiscoverInstances
+func (s *Service) discoveryZones() []string {
+	if s.config != nil && len(s.config.DiscoveryZones) > 0 {
+		return s.config.DiscoveryZones
+	}
+	return []string{s.zone}
+}
+
+// DiscoverInstances finds the instances carrying all of the configured resourceTags as labels.
+// Only the configured discovery zones are scanned, listing every zone in a project is slow and
+// costs API quota.
+func (s *Service) DiscoverInstances(ctx context.Context) ([]Instance, error) {
+	var tags map[string]string
+	if s.config != nil {
+		tags = s.config.ResourceTags
+	}
+	filter := labelFilter(tags)
+
+	var instances []Instance
+	for _, zone := range s.discoveryZones() {
+		found, err := s.compute.ListInstances(ctx, s.projectID, zone, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to discover instances: %w", err)
+		}
+		common.DebugLog("traefik-cloud-saver", "discovered %d instances in zone %s", len(found), zone)
+		instances = append(instances, found...)
+	}
+	return instances, nil
+}
+
+// DiscoverServices returns the names of the instances carrying all of the configured resourceTags
+// in the discovery zones.  It remembers which zone each of them is in, so they're scaled there
+// rather than in zone.
+func (s *Service) DiscoverServices(ctx context.Context) ([]string, error) {
+	instances, err := s.DiscoverInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(instances))
+	zones := make(map[string]string, len(instances))
+	for _, instance := range instances {
+		names = append(names, instance.Name)
+		if instance.Zone != "" {
+			zones[instance.Name] = path.Base(instance.Zone)
+		}
+	}
+
+	s.zonesMu.Lock()
+	defer s.zonesMu.Unlock()
+	s.instanceZones = zones
+	return names, nil
+}
+
+// zoneOf returns the zone an instance was discovered in, or the configured zone
+func (s *Service) zoneOf(instanceName string) string {
+	s.zonesMu.Lock()
+	defer s.zonesMu.Unlock()
+	if zone, ok := s.instanceZones[instanceName]; ok {
+		return zone
+	}
+	return s.zone
+}
+
+// labelFilter builds a list filter matching instances which carry all of the given labels
+func labelFilter(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	terms := make([]string, 0, len(keys))
+	for _, key := range keys {
+		terms = append(terms, fmt.Sprintf("labels.%s = %q", key, labels[key]))
+	}
+	return strings.Join(terms, " AND ")
+}
+
+// checkQuarantine returns an ErrQuarantined error for a quarantined instance, so it's left alone
+// until it leaves the STOPPING state
+func (s *Service) checkQuarantine(instanceName string) error {
+	if !s.IsQuarantined(instanceName) {
+		return nil
+	}
+	return fmt.Errorf("instance %s is stuck STOPPING: %w", instanceName, common.ErrQuarantined)
+}
+
+// GetLabels returns the labels set on the instance
+func (s *Service) GetLabels(ctx context.Context, instanceName string) (map[string]string, error) {
+	instance, err := s.compute.GetInstance(ctx, s.projectID, s.zoneOf(instanceName), instanceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance %s: %w", instanceName, err)
+	}
+	return instance.Labels, nil
 }
 
 func (s *Service) GetCurrentScale(ctx context.Context, instanceName string) (int32, error) {
-	instance, err := s.compute.GetInstance(ctx, s.projectID, s.zone, instanceName)
+	instance, err := s.compute.GetInstance(ctx, s.projectID, s.zoneOf(instanceName), instanceName)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get instance %s: %w", instanceName, err)
 	}
 
+	s.trackStopping(instanceName, instance.Status)
+
 	switch instance.Status {
 	case "RUNNING", "PROVISIONING", "STAGING":
 		return 1, nil
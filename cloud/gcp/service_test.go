@@ -2,11 +2,15 @@ package gcp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -115,11 +119,618 @@ func TestGetCurrentScale(t *testing.T) {
 	}
 }
 
+func TestGetLabels(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"test-token","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/instances/test-instance", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status": "RUNNING", "name": "test-instance", "labels": {"cloudsaver-exclude": "true", "env": "dev"}}`))
+	})
+
+	svc, ts := setupMockService(mux)
+	svc.compute.tokenManager.credentials.TokenURL = ts.URL + "/token"
+	defer ts.Close()
+
+	labels, err := svc.GetLabels(context.Background(), "test-instance")
+	if err != nil {
+		t.Fatalf("GetLabels() error = %v", err)
+	}
+	if labels["cloudsaver-exclude"] != "true" || labels["env"] != "dev" {
+		t.Errorf("GetLabels() = %v", labels)
+	}
+
+	if _, err := svc.GetLabels(context.Background(), "missing-instance"); err == nil {
+		t.Error("GetLabels() should fail for a missing instance")
+	}
+}
+
+func TestDiscoverInstances(t *testing.T) {
+	tests := []struct {
+		name      string
+		zones     []string
+		wantZones []string
+	}{
+		{name: "defaults to the service zone", zones: nil, wantZones: []string{"test-zone"}},
+		{name: "configured zones only", zones: []string{"us-east1-b", "us-east1-c"}, wantZones: []string{"us-east1-b", "us-east1-c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queried []string
+			var filters []string
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"access_token":"test-token","token_type":"Bearer","expires_in":3600}`))
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/", func(w http.ResponseWriter, r *http.Request) {
+				parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/compute/v1/projects/test-project/zones/"), "/")
+				zone := parts[0]
+				queried = append(queried, zone)
+				filters = append(filters, r.URL.Query().Get("filter"))
+
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"items": [{"name": "web-%s", "status": "RUNNING", "labels": {"env": "dev"}}]}`, zone)
+			})
+
+			svc, ts := setupMockService(mux)
+			svc.compute.tokenManager.credentials.TokenURL = ts.URL + "/token"
+			svc.config = &common.CloudServiceConfig{
+				ResourceTags:   map[string]string{"env": "dev", "cloudsaver": "managed"},
+				DiscoveryZones: tt.zones,
+			}
+			defer ts.Close()
+
+			instances, err := svc.DiscoverInstances(context.Background())
+			if err != nil {
+				t.Fatalf("DiscoverInstances() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(queried, tt.wantZones) {
+				t.Errorf("queried zones %v, want %v", queried, tt.wantZones)
+			}
+			if len(instances) != len(tt.wantZones) {
+				t.Errorf("expected %d instances, got %d", len(tt.wantZones), len(instances))
+			}
+			for _, filter := range filters {
+				if filter != `labels.cloudsaver = "managed" AND labels.env = "dev"` {
+					t.Errorf("unexpected filter %q", filter)
+				}
+			}
+		})
+	}
+}
+
+func TestDiscoverServicesUsesInstanceZone(t *testing.T) {
+	var requested []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"test-token","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/compute/v1/projects/test-project/zones/us-east1-c/instances", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items": [{"name": "web", "status": "RUNNING", "zone": "https://www.googleapis.com/compute/v1/projects/test-project/zones/us-east1-c"}]}`))
+	})
+	mux.HandleFunc("/compute/v1/projects/test-project/zones/", func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "web", "status": "RUNNING"}`))
+	})
+
+	svc, ts := setupMockService(mux)
+	svc.compute.tokenManager.credentials.TokenURL = ts.URL + "/token"
+	svc.config = &common.CloudServiceConfig{
+		ResourceTags:   map[string]string{"cloudsaver": "managed"},
+		DiscoveryZones: []string{"us-east1-c"},
+	}
+	defer ts.Close()
+
+	names, err := svc.DiscoverServices(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverServices() error = %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"web"}) {
+		t.Errorf("DiscoverServices() = %v, want [web]", names)
+	}
+
+	if _, err := svc.GetCurrentScale(context.Background(), "web"); err != nil {
+		t.Fatalf("GetCurrentScale() error = %v", err)
+	}
+	if _, err := svc.GetCurrentScale(context.Background(), "other"); err != nil {
+		t.Fatalf("GetCurrentScale() error = %v", err)
+	}
+	want := []string{
+		"/compute/v1/projects/test-project/zones/us-east1-c/instances/web",
+		"/compute/v1/projects/test-project/zones/test-zone/instances/other",
+	}
+	if !reflect.DeepEqual(requested, want) {
+		t.Errorf("requested %v, want %v", requested, want)
+	}
+}
+
+func TestStuckStoppingInstance(t *testing.T) {
+	var status atomic.Value
+	status.Store("STOPPING")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"test-token","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/instances/test-instance", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"status": %q, "name": "test-instance"}`, status.Load())
+	})
+	mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/instances/test-instance/stop", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("a stuck instance should not be stopped again")
+	})
+
+	svc, ts := setupMockService(mux)
+	svc.compute.tokenManager.credentials.TokenURL = ts.URL + "/token"
+	svc.maxStopDuration = time.Minute
+	defer ts.Close()
+
+	ctx := context.Background()
+
+	// first sighting starts the clock, no error and no quarantine
+	if err := svc.ScaleDown(ctx, "test-instance"); err != nil {
+		t.Fatalf("ScaleDown() error = %v", err)
+	}
+	if svc.IsQuarantined("test-instance") {
+		t.Fatal("instance should not be quarantined on first sighting")
+	}
+
+	// stuck for longer than the maximum, quarantined and left alone
+	svc.stoppingSince["test-instance"] = time.Now().Add(-2 * time.Minute)
+	if err := svc.ScaleDown(ctx, "test-instance"); !errors.Is(err, common.ErrQuarantined) {
+		t.Fatalf("ScaleDown() error = %v, want ErrQuarantined", err)
+	}
+	if !svc.IsQuarantined("test-instance") {
+		t.Fatal("instance stuck STOPPING should be quarantined")
+	}
+	if err := svc.ScaleUp(ctx, "test-instance"); !errors.Is(err, common.ErrQuarantined) {
+		t.Errorf("ScaleUp() error = %v, want ErrQuarantined", err)
+	}
+	if scale, err := svc.GetCurrentScale(ctx, "test-instance"); err != nil || scale != 0 {
+		t.Errorf("GetCurrentScale() = %d, %v", scale, err)
+	}
+
+	// the instance finally stops, it's released
+	status.Store("TERMINATED")
+	if _, err := svc.GetCurrentScale(ctx, "test-instance"); err != nil {
+		t.Fatalf("GetCurrentScale() error = %v", err)
+	}
+	if svc.IsQuarantined("test-instance") {
+		t.Error("instance should be released from quarantine once it leaves STOPPING")
+	}
+	if _, ok := svc.stoppingSince["test-instance"]; ok {
+		t.Error("stopping time should be cleared")
+	}
+}
+
+func TestNewServiceMaxStopDuration(t *testing.T) {
+	config := &common.CloudServiceConfig{
+		Type:            "gcp",
+		ProjectID:       "test-project",
+		Zone:            "test-zone",
+		Region:          "test-region",
+		Credentials:     &common.CredentialsConfig{Type: "static_token", Secret: "token"},
+		MaxStopDuration: "not-a-duration",
+	}
+	if _, err := New(config); err == nil {
+		t.Error("expected an error for an invalid maxStopDuration")
+	}
+
+	config.MaxStopDuration = ""
+	svc, err := New(config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if svc.maxStopDuration != defaultMaxStopDuration {
+		t.Errorf("maxStopDuration = %v, want %v", svc.maxStopDuration, defaultMaxStopDuration)
+	}
+}
+
 func TestScaleUp(t *testing.T) {
-	svc := &Service{}
-	err := svc.ScaleUp(context.Background(), "test-instance")
-	if err == nil {
-		t.Error("ScaleUp() should return error as it's not implemented")
+	tests := []struct {
+		name        string
+		status      string
+		afterStart  string
+		wantStarted bool
+		wantErr     bool
+	}{
+		{name: "stopped instance is started", status: "TERMINATED", afterStart: "RUNNING", wantStarted: true},
+		{name: "running instance is left alone", status: "RUNNING"},
+		{name: "provisioning instance is left alone", status: "PROVISIONING"},
+		{name: "staging instance is left alone", status: "STAGING"},
+		{name: "instance fails to start", status: "TERMINATED", afterStart: "TERMINATED", wantStarted: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var started atomic.Bool
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"access_token":"test-token","token_type":"Bearer","expires_in":3600}`))
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/instances/test-instance", func(w http.ResponseWriter, r *http.Request) {
+				status := tt.status
+				if started.Load() {
+					status = tt.afterStart
+				}
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"status": %q, "name": "test-instance"}`, status)
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/instances/test-instance/start", func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("expected POST, got %s", r.Method)
+				}
+				started.Store(true)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "operation-start"}`))
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/operations/operation-start", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "operation-start", "status": "DONE"}`))
+			})
+
+			svc, ts := setupMockService(mux)
+			svc.compute.tokenManager.credentials.TokenURL = ts.URL + "/token"
+			svc.compute.pollInterval = 10 * time.Millisecond
+			defer ts.Close()
+
+			err := svc.ScaleUp(context.Background(), "test-instance")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ScaleUp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if started.Load() != tt.wantStarted {
+				t.Errorf("instance started = %v, want %v", started.Load(), tt.wantStarted)
+			}
+		})
+	}
+}
+
+func TestScaleDown(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         string
+		wantStopped    bool
+		wantTransition bool
+	}{
+		{name: "running instance is stopped", status: "RUNNING", wantStopped: true},
+		{name: "terminated instance is left alone", status: "TERMINATED"},
+		{name: "stopping instance is left alone", status: "STOPPING"},
+		{name: "provisioning instance is deferred", status: "PROVISIONING", wantTransition: true},
+		{name: "staging instance is deferred", status: "STAGING", wantTransition: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stopped atomic.Bool
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"access_token":"test-token","token_type":"Bearer","expires_in":3600}`))
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/instances/test-instance", func(w http.ResponseWriter, r *http.Request) {
+				status := tt.status
+				if stopped.Load() {
+					status = "TERMINATED"
+				}
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"status": %q, "name": "test-instance"}`, status)
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/instances/test-instance/stop", func(w http.ResponseWriter, r *http.Request) {
+				stopped.Store(true)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "operation-stop"}`))
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/operations/operation-stop", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "operation-stop", "status": "DONE"}`))
+			})
+
+			svc, ts := setupMockService(mux)
+			svc.compute.tokenManager.credentials.TokenURL = ts.URL + "/token"
+			svc.compute.pollInterval = 10 * time.Millisecond
+			defer ts.Close()
+
+			err := svc.ScaleDown(context.Background(), "test-instance")
+			if tt.wantTransition {
+				if !errors.Is(err, ErrInstanceStarting) || !errors.Is(err, common.ErrTransitioning) {
+					t.Errorf("ScaleDown() error = %v, want an instance starting error", err)
+				}
+			} else if err != nil {
+				t.Errorf("ScaleDown() error = %v", err)
+			}
+			if stopped.Load() != tt.wantStopped {
+				t.Errorf("instance stopped = %v, want %v", stopped.Load(), tt.wantStopped)
+			}
+		})
+	}
+}
+
+func TestMachineTypeFilter(t *testing.T) {
+	tests := []struct {
+		name        string
+		machineType string
+		wantStopped bool
+	}{
+		{name: "eligible machine type is stopped", machineType: "e2-small", wantStopped: true},
+		{name: "ineligible machine type is skipped", machineType: "n2-highmem-32"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stopped atomic.Bool
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"access_token":"test-token","token_type":"Bearer","expires_in":3600}`))
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/instances/test-instance", func(w http.ResponseWriter, r *http.Request) {
+				status := "RUNNING"
+				if stopped.Load() {
+					status = "TERMINATED"
+				}
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"status": %q, "name": "test-instance", "machineType": "https://www.googleapis.com/compute/v1/projects/test-project/zones/test-zone/machineTypes/%s"}`, status, tt.machineType)
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/instances/test-instance/stop", func(w http.ResponseWriter, r *http.Request) {
+				stopped.Store(true)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "operation-stop"}`))
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/operations/operation-stop", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "operation-stop", "status": "DONE"}`))
+			})
+
+			svc, ts := setupMockService(mux)
+			svc.compute.tokenManager.credentials.TokenURL = ts.URL + "/token"
+			svc.compute.pollInterval = 10 * time.Millisecond
+			svc.config = &common.CloudServiceConfig{MachineTypes: []string{"e2-micro", "e2-small"}}
+			defer ts.Close()
+
+			err := svc.ScaleDown(context.Background(), "test-instance")
+			if tt.wantStopped && err != nil {
+				t.Errorf("ScaleDown() error = %v", err)
+			}
+			if !tt.wantStopped && !errors.Is(err, common.ErrNotEligible) {
+				t.Errorf("ScaleDown() error = %v, want a not eligible error", err)
+			}
+			if stopped.Load() != tt.wantStopped {
+				t.Errorf("instance stopped = %v, want %v", stopped.Load(), tt.wantStopped)
+			}
+
+			if !tt.wantStopped {
+				if err := svc.ScaleUp(context.Background(), "test-instance"); !errors.Is(err, common.ErrNotEligible) {
+					t.Errorf("ScaleUp() error = %v, want a not eligible error", err)
+				}
+			}
+		})
+	}
+}
+
+func TestSpotInstanceScaleUp(t *testing.T) {
+	tests := []struct {
+		name        string
+		scheduling  string
+		policy      string
+		wantStarted bool
+	}{
+		{name: "standard instance is started", scheduling: `{"provisioningModel": "STANDARD"}`, policy: common.SpotPolicySkip, wantStarted: true},
+		{name: "spot instance is started by default", scheduling: `{"provisioningModel": "SPOT", "instanceTerminationAction": "STOP"}`, wantStarted: true},
+		{name: "spot instance is skipped", scheduling: `{"provisioningModel": "SPOT", "instanceTerminationAction": "STOP"}`, policy: common.SpotPolicySkip},
+		{name: "preemptible instance is skipped", scheduling: `{"preemptible": true}`, policy: common.SpotPolicySkip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var started atomic.Bool
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"access_token":"test-token","token_type":"Bearer","expires_in":3600}`))
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/instances/test-instance", func(w http.ResponseWriter, r *http.Request) {
+				status := "TERMINATED"
+				if started.Load() {
+					status = "RUNNING"
+				}
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"status": %q, "name": "test-instance", "scheduling": %s}`, status, tt.scheduling)
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/instances/test-instance/start", func(w http.ResponseWriter, r *http.Request) {
+				started.Store(true)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "operation-start"}`))
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/operations/operation-start", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "operation-start", "status": "DONE"}`))
+			})
+
+			svc, ts := setupMockService(mux)
+			svc.compute.tokenManager.credentials.TokenURL = ts.URL + "/token"
+			svc.compute.pollInterval = 10 * time.Millisecond
+			svc.config = &common.CloudServiceConfig{SpotPolicy: tt.policy}
+			defer ts.Close()
+
+			err := svc.ScaleUp(context.Background(), "test-instance")
+			if tt.wantStarted && err != nil {
+				t.Errorf("ScaleUp() error = %v", err)
+			}
+			if !tt.wantStarted && !errors.Is(err, common.ErrNotEligible) {
+				t.Errorf("ScaleUp() error = %v, want a not eligible error", err)
+			}
+			if started.Load() != tt.wantStarted {
+				t.Errorf("instance started = %v, want %v", started.Load(), tt.wantStarted)
+			}
+		})
+	}
+}
+
+func TestScaleUpVerification(t *testing.T) {
+	tests := []struct {
+		name          string
+		stagingChecks int32 // checks reporting STAGING after the start, before RUNNING
+		attempts      int
+		wantChecks    int32
+		wantErr       bool
+	}{
+		{name: "running on the first check", stagingChecks: 0, attempts: 5, wantChecks: 1},
+		{name: "running after several polls", stagingChecks: 3, attempts: 5, wantChecks: 4},
+		{name: "never reaches running", stagingChecks: 100, attempts: 3, wantChecks: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var started atomic.Bool
+			var checks atomic.Int32
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"access_token":"test-token","token_type":"Bearer","expires_in":3600}`))
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/instances/test-instance", func(w http.ResponseWriter, r *http.Request) {
+				status := "TERMINATED"
+				if started.Load() {
+					status = "RUNNING"
+					if checks.Add(1) <= tt.stagingChecks {
+						status = "STAGING"
+					}
+				}
+				w.Header().Set("Content-Type", "application/json")
+				fmt.Fprintf(w, `{"status": %q, "name": "test-instance"}`, status)
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/instances/test-instance/start", func(w http.ResponseWriter, r *http.Request) {
+				started.Store(true)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "operation-start"}`))
+			})
+			mux.HandleFunc("/compute/v1/projects/test-project/zones/test-zone/operations/operation-start", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"name": "operation-start", "status": "DONE"}`))
+			})
+
+			svc, ts := setupMockService(mux)
+			svc.compute.tokenManager.credentials.TokenURL = ts.URL + "/token"
+			svc.compute.pollInterval = 10 * time.Millisecond
+			WithStartVerifyAttempts(tt.attempts)(&svc.compute)
+			defer ts.Close()
+
+			err := svc.ScaleUp(context.Background(), "test-instance")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ScaleUp() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrInstanceNotStarted) {
+				t.Errorf("expected ErrInstanceNotStarted, got %v", err)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "still STAGING after 3 checks") {
+				t.Errorf("expected a descriptive error, got %v", err)
+			}
+			if got := checks.Load(); got != tt.wantChecks {
+				t.Errorf("status checked %d times after the start, want %d", got, tt.wantChecks)
+			}
+		})
+	}
+}
+
+func TestNewServiceMetadata(t *testing.T) {
+	var tokenRequests atomic.Int32
+	metadata := newMetadataServer(t, &tokenRequests)
+	t.Setenv(metadataHostEnv, strings.TrimPrefix(metadata.URL, "http://"))
+
+	compute := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer metadata-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/compute/v1/projects/metadata-project/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status": "RUNNING", "name": "test-instance"}`))
+	}))
+	defer compute.Close()
+
+	for _, credentials := range []*common.CredentialsConfig{nil, {Type: "metadata"}} {
+		config := &common.CloudServiceConfig{
+			Type:        "gcp",
+			Zone:        "test-zone",
+			Region:      "test-region",
+			Endpoint:    compute.URL + "/compute/v1",
+			Credentials: credentials,
+		}
+
+		svc, err := New(config)
+		if err != nil {
+			t.Fatalf("New() with metadata credentials failed: %v", err)
+		}
+		if svc.projectID != "metadata-project" {
+			t.Errorf("projectID = %v, want the one from the metadata server", svc.projectID)
+		}
+
+		scale, err := svc.GetCurrentScale(context.Background(), "test-instance")
+		if err != nil {
+			t.Fatalf("GetCurrentScale() failed: %v", err)
+		}
+		if scale != 1 {
+			t.Errorf("GetCurrentScale() = %d, want 1", scale)
+		}
+	}
+
+	// a configured project ID wins over the metadata server's
+	svc, err := New(&common.CloudServiceConfig{Type: "gcp", Zone: "test-zone", Region: "test-region", ProjectID: "configured"})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if svc.projectID != "configured" {
+		t.Errorf("projectID = %v, want configured", svc.projectID)
+	}
+}
+
+func TestNewServiceStartVerifyAttempts(t *testing.T) {
+	config := &common.CloudServiceConfig{
+		Type:        "gcp",
+		ProjectID:   "test-project",
+		Zone:        "test-zone",
+		Region:      "test-region",
+		Credentials: &common.CredentialsConfig{Type: "static_token", Secret: "token"},
+	}
+	svc, err := New(config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if svc.compute.startVerifyAttempts != defaultStartVerifyAttempts {
+		t.Errorf("startVerifyAttempts = %d, want %d", svc.compute.startVerifyAttempts, defaultStartVerifyAttempts)
+	}
+
+	config.StartVerifyAttempts = 12
+	svc, err = New(config)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if svc.compute.startVerifyAttempts != 12 {
+		t.Errorf("startVerifyAttempts = %d, want 12", svc.compute.startVerifyAttempts)
+	}
+
+	config.StartVerifyAttempts = -1
+	if _, err := New(config); err == nil {
+		t.Error("expected an error for negative startVerifyAttempts")
 	}
 }
 
@@ -233,3 +844,48 @@ func TestNewService(t *testing.T) {
 		})
 	}
 }
+
+func TestNewServiceStaticToken(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer pre-fetched-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status": "RUNNING", "name": "test-instance"}`))
+	}))
+	defer ts.Close()
+
+	config := &common.CloudServiceConfig{
+		Type:      "gcp",
+		ProjectID: "test-project",
+		Zone:      "test-zone",
+		Region:    "test-region",
+		Endpoint:  ts.URL + "/compute/v1",
+		Credentials: &common.CredentialsConfig{
+			Type:   "static_token",
+			Secret: "pre-fetched-token",
+		},
+	}
+
+	svc, err := New(config)
+	if err != nil {
+		t.Fatalf("New() with static token failed: %v", err)
+	}
+	if svc.compute.tokenManager != nil {
+		t.Error("static token credentials should not create a JWT token manager")
+	}
+
+	scale, err := svc.GetCurrentScale(context.Background(), "test-instance")
+	if err != nil {
+		t.Fatalf("GetCurrentScale() failed: %v", err)
+	}
+	if scale != 1 {
+		t.Errorf("GetCurrentScale() = %d, want 1", scale)
+	}
+
+	config.ProjectID = ""
+	if _, err := New(config); err == nil {
+		t.Error("New() should require a project ID for static tokens")
+	}
+}
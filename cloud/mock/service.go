@@ -3,6 +3,7 @@ package mock
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -12,12 +13,14 @@ import (
 // Service implements cloud.Service interface for testing
 type Service struct {
 	scale      map[string]int32
+	labels     map[string]map[string]string
 	mu         sync.RWMutex // Protects scale map for concurrent access
 	opCount    int
 	failAfter  int
 	resetAfter time.Duration
 	initError  error
 	scaleErr   error
+	opDelay    time.Duration // how long each scale operation takes
 	config     *common.CloudServiceConfig
 }
 
@@ -64,11 +67,15 @@ func New(cloudConfig *common.CloudServiceConfig, opts ...ServiceOption) (*Servic
 	// Initialize with any pre-configured scales
 	s.Reset()
 
-	// Start a reset timer which will reset the scale to the initial values
-	// after the configured duration
+	// Start a reset timer which will reset the scale to the initial values (or recover
+	// the configured services) after the configured duration
 	if s.resetAfter > 0 {
 		go func() {
 			time.Sleep(s.resetAfter)
+			if len(cloudConfig.RecoverScale) > 0 {
+				s.Recover(cloudConfig.RecoverScale)
+				return
+			}
 			s.Reset()
 		}()
 	}
@@ -96,14 +103,23 @@ func (s *Service) checkFailure() error {
 	return nil
 }
 
+// wait simulates a scale operation taking a while to complete, like a cloud provider's
+func (s *Service) wait() {
+	s.mu.RLock()
+	delay := s.opDelay
+	s.mu.RUnlock()
+	time.Sleep(delay)
+}
+
 func (s *Service) ScaleDown(_ context.Context, serviceName string) error {
+	s.wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if err := s.checkFailure(); err != nil {
 		return err
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	current, exists := s.scale[serviceName]
 	if !exists {
 		return fmt.Errorf("service %s not found", serviceName)
@@ -119,6 +135,7 @@ func (s *Service) ScaleDown(_ context.Context, serviceName string) error {
 }
 
 func (s *Service) ScaleUp(_ context.Context, serviceName string) error {
+	s.wait()
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -134,14 +151,43 @@ func (s *Service) ScaleUp(_ context.Context, serviceName string) error {
 	return nil
 }
 
-func (s *Service) GetCurrentScale(_ context.Context, serviceName string) (int32, error) {
+// ScaleTo brings a service up to the target in one step.  It only scales up, like the plugin
+// uses it, a service already at or above the target is left alone.
+func (s *Service) ScaleTo(_ context.Context, serviceName string, target int32) error {
+	s.wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkFailure(); err != nil {
+		return err
+	}
 	if s.scaleErr != nil {
-		return 0, s.scaleErr
+		return s.scaleErr
+	}
+
+	current, exists := s.scale[serviceName]
+	if !exists {
+		return fmt.Errorf("service %s not found", serviceName)
+	}
+
+	if current >= target {
+		common.DebugLog("mock", "service %s already at scale %d, not scaling to %d", serviceName, current, target)
+		return nil
 	}
 
+	common.DebugLog("mock", "scaling service '%s' from %d to %d", serviceName, current, target)
+	s.scale[serviceName] = target
+	return nil
+}
+
+func (s *Service) GetCurrentScale(_ context.Context, serviceName string) (int32, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	if s.scaleErr != nil {
+		return 0, s.scaleErr
+	}
+
 	scale, exists := s.scale[serviceName]
 	if !exists {
 		return 0, fmt.Errorf("service %s not found", serviceName)
@@ -150,6 +196,51 @@ func (s *Service) GetCurrentScale(_ context.Context, serviceName string) (int32,
 	return scale, nil
 }
 
+// GetLabels returns the labels of a service, a service without labels returns nil
+func (s *Service) GetLabels(_ context.Context, serviceName string) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.scaleErr != nil {
+		return nil, s.scaleErr
+	}
+
+	if _, exists := s.scale[serviceName]; !exists {
+		return nil, fmt.Errorf("service %s not found", serviceName)
+	}
+
+	return s.labels[serviceName], nil
+}
+
+// DiscoverServices returns the services whose labels carry all of the configured resourceTags
+func (s *Service) DiscoverServices(_ context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.scaleErr != nil {
+		return nil, s.scaleErr
+	}
+
+	var names []string
+	for serviceName := range s.scale {
+		if hasLabels(s.labels[serviceName], s.config.ResourceTags) {
+			names = append(names, serviceName)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// hasLabels reports whether labels carry every one of the wanted labels
+func hasLabels(labels, wanted map[string]string) bool {
+	for key, value := range wanted {
+		if got, ok := labels[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
+
 // Test helper methods
 
 // SetScale allows tests to preset the scale of a service
@@ -159,6 +250,20 @@ func (p *Service) SetScale(serviceName string, scale int32) {
 	p.scale[serviceName] = scale
 }
 
+// SetOperationDelay allows tests to make every scale operation take this long
+func (p *Service) SetOperationDelay(delay time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.opDelay = delay
+}
+
+// SetLabels allows tests to set the labels of a service
+func (p *Service) SetLabels(serviceName string, labels map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.labels[serviceName] = labels
+}
+
 // Reset clears all stored scales and errors
 func (p *Service) Reset() {
 	common.DebugLog("mock", "resetting scale values for mock service")
@@ -171,4 +276,23 @@ func (p *Service) Reset() {
 	for k, v := range p.config.InitialScale {
 		p.scale[k] = v
 	}
+
+	p.labels = make(map[string]map[string]string)
+	for k, v := range p.config.Labels {
+		p.labels[k] = v
+	}
+}
+
+// Recover simulates something external bringing services back, scaling each of the given
+// services up to its target.  Services already at or above their target are left alone.
+func (p *Service) Recover(targets map[string]int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for serviceName, target := range targets {
+		if p.scale[serviceName] < target {
+			common.DebugLog("mock", "recovering service '%s' from scale %d to %d", serviceName, p.scale[serviceName], target)
+			p.scale[serviceName] = target
+		}
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
 )
@@ -106,3 +107,178 @@ func TestMockProvider(t *testing.T) {
 		}
 	})
 }
+
+func TestMockResetAfter(t *testing.T) {
+	ctx := context.Background()
+
+	waitForScale := func(t *testing.T, provider *Service, serviceName string, want int32) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if scale, err := provider.GetCurrentScale(ctx, serviceName); err == nil && scale == want {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		scale, _ := provider.GetCurrentScale(ctx, serviceName)
+		t.Fatalf("timed out waiting for %s to reach scale %d, got %d", serviceName, want, scale)
+	}
+
+	t.Run("full reset", func(t *testing.T) {
+		provider, err := New(&common.CloudServiceConfig{
+			Type:         "mock",
+			InitialScale: map[string]int32{"web": 1, "api": 2},
+			ResetAfter:   "100ms",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		provider.SetScale("web", 0)
+		provider.SetScale("api", 0)
+
+		waitForScale(t, provider, "web", 1)
+		waitForScale(t, provider, "api", 2)
+	})
+
+	t.Run("targeted recovery", func(t *testing.T) {
+		provider, err := New(&common.CloudServiceConfig{
+			Type:         "mock",
+			InitialScale: map[string]int32{"web": 1, "api": 1},
+			ResetAfter:   "100ms",
+			RecoverScale: map[string]int32{"web": 3},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		provider.SetScale("web", 0)
+		provider.SetScale("api", 0)
+
+		waitForScale(t, provider, "web", 3)
+
+		// api isn't part of the recovery and stays scaled down
+		scale, err := provider.GetCurrentScale(ctx, "api")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if scale != 0 {
+			t.Errorf("expected api to stay at scale 0, got %d", scale)
+		}
+	})
+
+	t.Run("recover leaves higher scales alone", func(t *testing.T) {
+		provider, err := New(&common.CloudServiceConfig{Type: "mock"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		provider.SetScale("web", 5)
+		provider.Recover(map[string]int32{"web": 2, "new": 1})
+
+		if scale, _ := provider.GetCurrentScale(ctx, "web"); scale != 5 {
+			t.Errorf("expected web to stay at 5, got %d", scale)
+		}
+		if scale, _ := provider.GetCurrentScale(ctx, "new"); scale != 1 {
+			t.Errorf("expected new to be recovered to 1, got %d", scale)
+		}
+	})
+}
+
+func TestMockScaleTo(t *testing.T) {
+	ctx := context.Background()
+	provider, err := New(&common.CloudServiceConfig{Type: "mock", InitialScale: map[string]int32{"web": 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := provider.ScaleTo(ctx, "web", 3); err != nil {
+		t.Fatalf("ScaleTo failed: %v", err)
+	}
+	if scale, _ := provider.GetCurrentScale(ctx, "web"); scale != 3 {
+		t.Errorf("expected scale 3, got %d", scale)
+	}
+
+	// a lower target doesn't scale the service down
+	if err := provider.ScaleTo(ctx, "web", 1); err != nil {
+		t.Fatalf("ScaleTo failed: %v", err)
+	}
+	if scale, _ := provider.GetCurrentScale(ctx, "web"); scale != 3 {
+		t.Errorf("expected web to stay at 3, got %d", scale)
+	}
+
+	if err := provider.ScaleTo(ctx, "missing", 1); err == nil {
+		t.Error("expected an error scaling an unknown service")
+	}
+}
+
+func TestMockScaleToFailAfter(t *testing.T) {
+	ctx := context.Background()
+	provider, err := New(&common.CloudServiceConfig{Type: "mock", InitialScale: map[string]int32{"web": 0}, FailAfter: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := provider.ScaleTo(ctx, "web", 2); err != nil {
+		t.Fatalf("first ScaleTo failed: %v", err)
+	}
+	provider.SetScale("web", 0)
+	if err := provider.ScaleTo(ctx, "web", 2); err == nil {
+		t.Error("expected ScaleTo to fail after 1 operation")
+	}
+	if scale, _ := provider.GetCurrentScale(ctx, "web"); scale != 0 {
+		t.Errorf("expected a failed ScaleTo to leave web at 0, got %d", scale)
+	}
+}
+
+func TestMockGetLabels(t *testing.T) {
+	ctx := context.Background()
+	provider, err := New(&common.CloudServiceConfig{
+		Type:         "mock",
+		InitialScale: map[string]int32{"web": 1, "api": 1},
+		Labels:       map[string]map[string]string{"web": {"cloudsaver-exclude": "true"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels, err := provider.GetLabels(ctx, "web")
+	if err != nil {
+		t.Fatalf("GetLabels failed: %v", err)
+	}
+	if labels["cloudsaver-exclude"] != "true" {
+		t.Errorf("expected configured labels, got %v", labels)
+	}
+
+	if labels, err := provider.GetLabels(ctx, "api"); err != nil || len(labels) != 0 {
+		t.Errorf("expected no labels for api, got %v (err %v)", labels, err)
+	}
+
+	if _, err := provider.GetLabels(ctx, "missing"); err == nil {
+		t.Error("expected an error for an unknown service")
+	}
+}
+
+func TestMockDiscoverServices(t *testing.T) {
+	provider, err := New(&common.CloudServiceConfig{
+		Type:         "mock",
+		ResourceTags: map[string]string{"cloudsaver": "managed"},
+		InitialScale: map[string]int32{"web": 1, "api": 1, "db": 1},
+		Labels: map[string]map[string]string{
+			"web": {"cloudsaver": "managed", "env": "dev"},
+			"api": {"cloudsaver": "managed"},
+			"db":  {"cloudsaver": "ignored"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := provider.DiscoverServices(context.Background())
+	if err != nil {
+		t.Fatalf("DiscoverServices failed: %v", err)
+	}
+	if len(names) != 2 || names[0] != "api" || names[1] != "web" {
+		t.Errorf("expected [api web] to be discovered, got %v", names)
+	}
+}
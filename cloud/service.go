@@ -17,6 +17,24 @@ type Service interface {
 	GetCurrentScale(ctx context.Context, serviceName string) (int32, error)
 }
 
+// TargetScaler is implemented by services that can scale directly to a target count in a
+// single operation, rather than one ScaleUp at a time
+type TargetScaler interface {
+	ScaleTo(ctx context.Context, serviceName string, target int32) error
+}
+
+// LabelReader is implemented by services whose resources carry labels.  Labels let the policy
+// for a resource live with the resource itself, overriding the plugin's global configuration.
+type LabelReader interface {
+	GetLabels(ctx context.Context, serviceName string) (map[string]string, error)
+}
+
+// Discoverer is implemented by services which can find the resources carrying the configured
+// resourceTags.  When they're set, only the discovered resources are managed.
+type Discoverer interface {
+	DiscoverServices(ctx context.Context) ([]string, error)
+}
+
 const (
 	aws_t   = "aws"   // placeholder for future AWS implementation
 	gcp_t   = "gcp"   // active GCP implementation
@@ -30,6 +48,17 @@ func NewService(config *common.CloudServiceConfig) (Service, error) {
 	case aws_t:
 		return nil, fmt.Errorf("AWS implementation not yet available")
 	case gcp_t:
+		switch config.ResourceType {
+		case "", gcp.ResourceInstance:
+		case gcp.ResourceCloudRun:
+			svc, err := gcp.NewCloudRun(config)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create GCP cloud run service: %w", err)
+			}
+			return svc, nil
+		default:
+			return nil, fmt.Errorf("unknown GCP resource type: %s", config.ResourceType)
+		}
 		svc, err := gcp.New(config)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create GCP cloud service: %w", err)
@@ -6,8 +6,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/danbiagini/traefik-cloud-saver/cloud"
@@ -17,79 +21,391 @@ import (
 
 // RouterFilter defines criteria for selecting which routers to monitor
 type RouterFilter struct {
-	Names []string `json:"names,omitempty"` // e.g., ["my-api-router", "web-router"]
+	Names    []string       `json:"names,omitempty"`    // exact router names, e.g., ["my-api-router", "web-router"]
+	Patterns []string       `json:"patterns,omitempty"` // regular expressions matching whole router names, e.g., ["api-.*@docker"]
+	Routers  []RouterConfig `json:"routers,omitempty"`  // router names or patterns with their own threshold, e.g., [{"name": "api-router", "threshold": 5}]
+
+	Exclude         []string `json:"exclude,omitempty"`         // exact router names never monitored, even when selected above, e.g., ["api@internal"]
+	ExcludePatterns []string `json:"excludePatterns,omitempty"` // regular expressions matching whole router names never monitored, e.g., ["dashboard-.*"]
+
+	ThresholdPrecedence string `json:"thresholdPrecedence,omitempty"` // mostSpecific (default) or firstMatch, when several routers entries match a router
 }
 
 // CloudSaver provider plugin to turn off cloud instances when traffic is below a threshold.
 type CloudSaver struct {
 	name             string
-	trafficThreshold float64
+	trafficThreshold float64       // scale down below this rate
+	scaleUpThreshold float64       // when set, a scaled down service is only scaled up above this rate
+	idleTimeout      time.Duration // when set, scale down after no requests for this long instead of on the rate
+	scaleOn          string        // concurrency scales down only with no requests in progress, instead of on the rate
 	windowSize       time.Duration
-	routerFilter     *RouterFilter
-	metricsCollector *MetricsCollector
-	cloudService     cloud.Service
-	testMode         bool
-	cancel           func()
-	apiURL           string
-	debug            bool
+	pollInterval     time.Duration // decisions are made this often, zero for once per window
+	initialWindow    time.Duration // a shorter first window, zero for a full one
+	scrapeInterval   time.Duration
+	routerMatcher    *regexp.Regexp // nil monitors every router
+	routerExclusion  *regexp.Regexp // nil excludes none
+	monitorInternal  bool           // don't skip @internal routers
+	// routers entries overriding trafficThreshold, which one applies when several match a router,
+	// and the routers an overlap has been logged for
+	thresholdRules      []thresholdRule
+	thresholdPrecedence string
+	overlapLogged       map[string]bool
+	metricsCollector    *MetricsCollector
+	cloudService        cloud.Service
+	testMode            bool
+	dryRun              bool            // only log the scale actions that would be taken
+	ctx                 context.Context // cancelled by Stop, scoping everything the provider runs
+	cancel              func()
+	stopOnce            sync.Once
+	apiURL              string
+	apiClient           *http.Client // shared by every request to the API, sending apiAuth
+	apiAuth             *MetricsAuth
+	routerCache         routerCache
+	preflightChecks     bool // check the metrics endpoints and the API answer in Init
+	debug               bool
+	clock               Clock
+
+	// guards the per-service state below.  The window loop holds it for a whole window, readers
+	// go through State().
+	mu sync.RWMutex
+
+	// while set, only observe rates until then to recommend thresholds
+	bootstrapUntil      time.Time
+	bootstrapPercentile float64
+
+	// coordinates scale actions with other replicas, nil when running alone
+	locker    Locker
+	lockOwner string
+
+	// anomaly detection / fail-open state
+	failOpenOnAnomaly bool
+	lastServiceCount  int
+	managedServices   map[string]bool
+	discover          bool // only the cloud services carrying the resourceTags are managed
+
+	// what to do when the metrics can't be scraped, and the rates reused for a "reuse" policy
+	scrapeFailurePolicy string
+	maxStaleWindows     int
+	lastRates           map[string]*ServiceRate
+	staleWindows        int // consecutive windows decided on lastRates
+
+	// services whose backend is currently scaled down to zero, keyed by traefik service name, and
+	// what they answer with meanwhile
+	sleeping              map[string]*sleepingService
+	sleepingPage          *SleepingPage
+	scaledDownBehavior    string
+	scaledDownRedirectURL string
+	scaledDownTransport   *ScaledDownTransport
+
+	// cloud services scaled down and not yet seen serving traffic again
+	latches map[string]latchState
+
+	// no scale action is taken on a cloud service within cooldownPeriod (or its override) of its last one
+	cooldownPeriod    time.Duration
+	cooldownOverrides map[string]time.Duration
+	lastActionTime    map[string]time.Time
+
+	// time of day overlays of the threshold, window size and cooldown, and the one in effect this window
+	schedules []*schedule
+	schedule  *schedule
+
+	// skip or queue a window whose tick came due while the previous one was still running
+	windowOverlap string
+
+	// scale sleeping services back up when requests to them fail with 5xx
+	wakeOnServerErrors bool
+
+	// services present in the metrics but unknown to the Traefik API
+	orphans           map[string]*orphanService
+	orphanGracePeriod time.Duration
+	scaleDownOrphans  bool
+
+	// per cloud service number of instances to bring back on scale up
+	scaleUpTargets map[string]int32
+	scaledUpAt     map[string]time.Time // when the plugin last scaled up each cloud service
+	stateless      bool                 // the provider can't report the current scale
+
+	// per cloud service req/min one instance can take, scale downs mustn't overload the others
+	instanceCapacity map[string]float64
+
+	// per cloud service dependencies, no scale action is taken while one is unhealthy
+	dependencies map[string][]Dependency
+
+	// traefik and cloud services which are evaluated but never scaled down
+	neverScaleDown map[string]bool
+
+	// traefik services sharing a cloud service, and how much each one's traffic counts
+	serviceInstances map[string]string
+	serviceWeights   map[string]float64
+
+	// metrics other than requests which count as activity, keyed by traefik service name
+	activityMetrics map[string][]ActivityMetric
+
+	// router protocols whose services are monitored, and the open connections gauge of TCP services
+	protocols []string
+	tcpMetric string
+
+	// scaled up services waiting on their readiness probe, keyed by cloud service name
+	readinessProbe   *ReadinessProbe
+	readinessTimeout time.Duration
+	warming          map[string]*warmingService
+
+	// counters of the decisions made and scale actions taken, and per service idle times and rates,
+	// optionally served on selfMetricsAddress
+	decisions           *decisionMetrics
+	idleGauges          *idleGauges
+	actions             *actionMetrics
+	selfMetricsAddress  string
+	selfMetricsServer   *http.Server
+	selfMetricsListener net.Listener
+
+	// admin endpoints, e.g. waking a service up on demand, optionally served on adminAddress
+	adminAddress  string
+	adminServer   *http.Server
+	adminListener net.Listener
+	waking        map[string]bool // cloud services a wake request is scaling up
+	wakes         sync.WaitGroup  // the scale ups of wake requests still running
+
+	// cloud services the provider has quarantined, it refuses to scale them until they recover
+	quarantined map[string]bool
+
+	// re-check scale actions this long after making them, zero disables the check
+	scaleVerifyDelay time.Duration
+	scaleChecks      []scaleCheck
+
+	// optional stream of decisions to an external collector
+	decisionSink *decisionSink
+
+	// told about every scale action, the webhooks among them send from their own goroutines
+	notifiers []Notifier
+	webhooks  []*webhookNotifier
+
+	// outcome of the current (or last completed) window, and what's served on /health
+	summary windowSummary
+	health  *healthState
+
+	// shadow decision engine, only logged and counted in the self metrics
+	shadow *ShadowConfig
 }
 
-// New creates a new Provider plugin.
-func New(_ context.Context, config *Config, name string) (*CloudSaver, error) {
+// New creates a new Provider plugin.  Options override the dependencies it would otherwise take
+// from the config.
+func New(_ context.Context, config *Config, name string, options ...CloudSaverOption) (*CloudSaver, error) {
 
 	if config == nil {
 		return nil, fmt.Errorf("config is nil")
 	}
+	var o overrides
+	for _, option := range options {
+		option(&o)
+	}
+	config = expandEnv(config)
+	if o.apiURL != "" {
+		config.APIURL = o.apiURL
+	}
+	if o.metricsURL != "" {
+		config.MetricsURL = o.metricsURL
+	}
+	settings, err := config.validate(o.cloudService == nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
 
-	common.LogProvider("traefik-cloud-saver", "cloud saver plugin created")
+	common.LogProvider("traefik-cloud-saver", "cloud saver plugin created (version %s, commit %s)", Version, Commit)
 
-	windowSize, err := time.ParseDuration(config.WindowSize)
-	if err != nil {
-		return nil, fmt.Errorf("invalid window size: %w", err)
+	windowSize := settings.windowSize
+	pollInterval := settings.pollInterval
+
+	clock := o.clock
+	if clock == nil {
+		clock = realClock{}
 	}
 
-	// Basic configuration parsing validation
-	if windowSize < time.Minute && !config.testMode {
-		return nil, fmt.Errorf("window size must be at least 1 minute, got %v", windowSize)
+	opts := []MetricsCollectorOption{WithSampleWindow(config.SampleWindow), WithMetricLabels(config.MetricLabels),
+		WithMetricSource(config.MetricSource), WithMetricsAuth(settings.endpoints[0].auth), WithReplicas(settings.endpoints[1:])}
+	if config.MetricsType == metricsTypeQuery {
+		opts = append(opts, WithPromQL(config.PromQL, windowSize))
+	} else if pollInterval > 0 && pollInterval < windowSize {
+		opts = append(opts, WithRateWindow(windowSize))
+	}
+	if pollInterval > 0 {
+		opts = append(opts, WithDurationGuard(config.RateDuration, pollInterval))
+	} else {
+		opts = append(opts, WithDurationGuard(config.RateDuration, windowSize))
+	}
+	if config.ScaleOn == scaleOnConcurrency {
+		opts = append(opts, WithConcurrency())
+	}
+	if config.DebugParsedCounts {
+		opts = append(opts, WithParseDebug())
+	}
+	if config.MetricsTimeouts != nil {
+		opts = append(opts, WithTimeouts(settings.connectTimeout, settings.totalTimeout))
+	}
+	collector := NewMetricsCollector(settings.endpoints[0].url, opts...)
+	collector.clock = clock
+	collector.lastTime = clock.Now()
+	collector.activityMetrics = settings.activityFamilies
+	if hasProtocol(settings.protocols, protocolTCP) {
+		collector.trackTCPConnections(settings.tcpMetric)
 	}
+	collector.successClasses = settings.successClasses
 
-	collector := NewMetricsCollector(config.MetricsURL)
+	var bootstrapUntil time.Time
+	if settings.bootstrapDuration > 0 {
+		bootstrapUntil = clock.Now().Add(settings.bootstrapDuration)
+	}
 
-	service, err := cloud.NewService(config.CloudConfig)
+	service := o.cloudService
+	if service == nil {
+		service, err = cloud.NewService(config.CloudConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cloud service: %w", err)
+		}
+		common.LogProvider("traefik-cloud-saver", "Cloud service created successfully")
+	}
+	discover, err := checkDiscovery(config.CloudConfig, service)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cloud service: %w", err)
+		return nil, err
 	}
 
-	common.LogProvider("traefik-cloud-saver", "Cloud service created successfully")
-
 	common.SetDebug(config.Debug)
-	
+
+	neverScaleDown := make(map[string]bool, len(config.NeverScaleDown))
+	for _, name := range config.NeverScaleDown {
+		neverScaleDown[name] = true
+	}
+
+	precedence := thresholdPrecedenceSpecific
+	if config.RouterFilter != nil && config.RouterFilter.ThresholdPrecedence != "" {
+		precedence = config.RouterFilter.ThresholdPrecedence
+	}
+
+	locker := o.locker
+	if locker == nil && config.Lock != nil {
+		locker, err = newFileLocker(config.Lock.Dir, settings.lockTTL, clock)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	webhooks := newNotifiers(config.Notifications)
+	var notifiers []Notifier
+	for _, webhook := range webhooks {
+		notifiers = append(notifiers, webhook)
+	}
+	if o.notifier != nil {
+		notifiers = append(notifiers, o.notifier)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	return &CloudSaver{
 		name:             name,
 		windowSize:       windowSize,
-		trafficThreshold: config.TrafficThreshold,
-		routerFilter:     config.RouterFilter,
+		pollInterval:     pollInterval,
+		initialWindow:    settings.initialWindow,
+		scrapeInterval:   settings.scrapeInterval,
+		trafficThreshold: settings.trafficThreshold,
+		scaleUpThreshold: config.ScaleUpThreshold,
+		idleTimeout:      settings.idleTimeout,
+		scaleOn:          config.ScaleOn,
+		routerMatcher:    settings.routerMatcher,
+		routerExclusion:  settings.routerExclusion,
+		monitorInternal:  config.MonitorInternal,
 		metricsCollector: collector,
 		testMode:         config.testMode,
+		dryRun:           config.DryRun,
 		apiURL:           config.APIURL,
+		apiClient:        &http.Client{Timeout: settings.apiTimeout},
+		apiAuth:          config.APIAuth,
+		preflightChecks:  config.PreflightChecks,
+		routerCache:      routerCache{ttl: settings.routerCacheTTL},
 		debug:            config.Debug,
+		clock:            clock,
 		cloudService:     service,
+		ctx:              ctx,
+		cancel:           cancel,
+
+		failOpenOnAnomaly: config.FailOpenOnAnomaly,
+		managedServices:   make(map[string]bool),
+		discover:          discover,
+		sleeping:          make(map[string]*sleepingService),
+		sleepingPage:      config.SleepingPage,
+		latches:           make(map[string]latchState),
+		waking:            make(map[string]bool),
+		quarantined:       make(map[string]bool),
+		cooldownPeriod:    settings.cooldownPeriod,
+		cooldownOverrides: settings.cooldownOverrides,
+		lastActionTime:    make(map[string]time.Time),
+		schedules:         settings.schedules,
+		shadow:            config.Shadow,
+		scaleUpTargets:    config.ScaleUpTargets,
+		scaledUpAt:        make(map[string]time.Time),
+
+		scaledDownBehavior:    config.ScaledDownBehavior,
+		scaledDownRedirectURL: config.ScaledDownRedirect,
+		scaledDownTransport:   config.ScaledDownTransport,
+
+		instanceCapacity: config.InstanceCapacity,
+		dependencies:     config.Dependencies,
+
+		neverScaleDown: neverScaleDown,
+
+		windowOverlap: config.WindowOverlap,
+
+		scrapeFailurePolicy: config.ScrapeFailurePolicy,
+		maxStaleWindows:     settings.maxStaleWindows,
+
+		bootstrapUntil:      bootstrapUntil,
+		bootstrapPercentile: settings.bootstrapPercentile,
+
+		locker:    locker,
+		lockOwner: newLockOwner(name),
+
+		serviceInstances: config.ServiceInstances,
+		serviceWeights:   config.ServiceWeights,
+		activityMetrics:  config.ActivityMetrics,
+
+		protocols: settings.protocols,
+		tcpMetric: settings.tcpMetric,
+
+		thresholdRules:      settings.thresholdRules,
+		thresholdPrecedence: precedence,
+		overlapLogged:       make(map[string]bool),
+
+		readinessProbe:   config.ReadinessProbe,
+		readinessTimeout: settings.readinessTimeout,
+		warming:          make(map[string]*warmingService),
+
+		wakeOnServerErrors: config.WakeOnServerErrors,
+
+		orphans:           make(map[string]*orphanService),
+		orphanGracePeriod: settings.orphanGracePeriod,
+		scaleDownOrphans:  config.ScaleDownOrphans,
+
+		decisions:          newDecisionMetrics(),
+		idleGauges:         newIdleGauges(),
+		actions:            newActionMetrics(),
+		health:             newHealthState(clock.Now()),
+		selfMetricsAddress: config.SelfMetricsAddress,
+		adminAddress:       config.AdminAddr,
+		decisionSink:       settings.decisionSink,
+		notifiers:          notifiers,
+		webhooks:           webhooks,
+		scaleVerifyDelay:   settings.scaleVerifyDelay,
 	}, nil
 }
 
 // Init the provider.
 func (p *CloudSaver) Init() error {
-	// Runtime validation - ensures the plugin is in a valid state to start
-	if p.windowSize < time.Minute && !p.testMode {
-		return errors.New("window size must be at least 1 minute")
-	}
-
-	if p.trafficThreshold < 0 {
-		return errors.New("traffic threshold must be non-negative")
+	// the configuration was validated by New, only what needs the outside world is left
+	if p.preflightChecks {
+		if err := p.preflight(); err != nil {
+			return err
+		}
 	}
 
 	// Could add other runtime checks here, like:
-	// - Can we connect to the metrics URL?
 	// - Do we have necessary permissions?
 	// etc.
 
@@ -98,8 +414,20 @@ func (p *CloudSaver) Init() error {
 
 // Provide creates and send dynamic configuration.
 func (p *CloudSaver) Provide(cfgChan chan<- json.Marshaler) error {
-	ctx, cancel := context.WithCancel(context.Background())
-	p.cancel = cancel
+	if err := p.startSelfMetrics(); err != nil {
+		return err
+	}
+	if err := p.startAdmin(); err != nil {
+		return err
+	}
+
+	ctx := p.ctx
+	if p.decisionSink != nil {
+		go p.decisionSink.run(ctx)
+	}
+	for _, webhook := range p.webhooks {
+		go webhook.run(ctx)
+	}
 
 	go func() {
 		defer func() {
@@ -115,19 +443,48 @@ func (p *CloudSaver) Provide(cfgChan chan<- json.Marshaler) error {
 }
 
 func (p *CloudSaver) loadConfiguration(ctx context.Context, cfgChan chan<- json.Marshaler) {
-	ticker := time.NewTicker(p.windowSize)
-	defer ticker.Stop()
+	if p.scrapeInterval > 0 {
+		go p.metricsCollector.RunScraper(ctx, p.scrapeInterval)
+	}
+
+	// configurations go through the coalescer so a slow consumer never builds up a backlog
+	coalescer := newConfigCoalescer()
+	go coalescer.forward(ctx, cfgChan)
+
+	// with an initial window the first decision comes early, then the poll cadence starts.  A
+	// schedule changing the window size takes over at the next tick.
+	initial := p.initialWindow > 0
+	var ticker Ticker
+	var period time.Duration
+	if initial {
+		ticker = p.clock.NewTicker(p.initialWindow)
+	} else {
+		period = p.pollPeriod(p.clock.Now())
+		ticker = p.clock.NewTicker(period)
+		p.metricsCollector.setExpectedDuration(period)
+	}
+	defer func() { ticker.Stop() }()
 
 	for {
 		select {
-		case <-ticker.C:
-			configuration, err := p.generateConfiguration()
+		case <-ticker.C():
+			if next := p.pollPeriod(p.clock.Now()); initial || next != period {
+				ticker.Stop()
+				period = next
+				ticker = p.clock.NewTicker(period)
+				initial = false
+			}
+
+			// this decision was over the previous period, the next one over the new period
+			configuration, err := p.generateConfiguration(ctx)
+			p.metricsCollector.setExpectedDuration(period)
 			if err != nil {
 				common.LogProvider("traefik-cloud-saver", "[ERROR]: Failed to generate configuration: %v", err)
 				continue
 			}
 
-			cfgChan <- configuration
+			coalescer.offer(configuration)
+			p.skipOverrun(ticker)
 
 		case <-ctx.Done():
 			return
@@ -135,10 +492,33 @@ func (p *CloudSaver) loadConfiguration(ctx context.Context, cfgChan chan<- json.
 	}
 }
 
-// Stop to stop the provider and the related go routines.
+// Stop to stop the provider and the related go routines, waiting for wake ups still scaling a
+// service.  It's safe to call before Provide, e.g. when startup fails, and more than once: only the
+// first call stops anything.
 func (p *CloudSaver) Stop() error {
-	p.cancel()
-	return nil
+	var err error
+	p.stopOnce.Do(func() {
+		p.cancel()
+		// wake ups are accepted under the lock while the context is live, so once the lock has
+		// been free every one of them is counted, and they end promptly now it's cancelled
+		p.mu.Lock()
+		p.mu.Unlock()
+		p.wakes.Wait()
+		var errs []error
+		if p.selfMetricsServer != nil {
+			errs = append(errs, p.selfMetricsServer.Close())
+		}
+		if p.adminServer != nil {
+			errs = append(errs, p.adminServer.Close())
+		}
+		err = errors.Join(errs...)
+	})
+	return err
+}
+
+// CloudService returns the cloud service the plugin scales
+func (p *CloudSaver) CloudService() cloud.Service {
+	return p.cloudService
 }
 
 // TraefikRouter struct -  all fields from the API response
@@ -152,53 +532,120 @@ type TraefikRouter struct {
 	Using       []string `json:"using"`
 	Priority    int      `json:"priority,omitempty"`
 	Middlewares []string `json:"middlewares,omitempty"`
+	Protocol    string   `json:"-"` // http or tcp, the part of the API the router was listed by
+
+	TLS *dynamic.RouterTLSConfig `json:"tls,omitempty"` // set when the router terminates TLS
 }
 
-// Add method to get routers from Traefik API
-func (p *CloudSaver) getRoutersFromAPI() (map[string]*TraefikRouter, error) {
-	resp, err := http.Get(p.apiURL + "/http/routers")
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch routers: %w", err)
+// getRoutersFromAPI returns the routers of every monitored protocol from the Traefik API, by name
+func (p *CloudSaver) getRoutersFromAPI(ctx context.Context) (map[string]*TraefikRouter, error) {
+	routerMap := make(map[string]*TraefikRouter)
+	for _, protocol := range p.protocols {
+		resp, err := p.apiGet(ctx, "/"+protocol+"/routers")
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s routers: %w", protocol, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to fetch %s routers: API returned %s", protocol, resp.Status)
+		}
+
+		var routerSlice []TraefikRouter
+		err = json.NewDecoder(resp.Body).Decode(&routerSlice)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s routers: %w", protocol, err)
+		}
+
+		// the same router may be reported more than once (e.g. per entry point)
+		for i := range routerSlice {
+			router := routerSlice[i] // Create a copy to avoid pointer to loop variable
+			router.Protocol = protocol
+			existing, ok := routerMap[router.Name]
+			switch {
+			case !ok:
+				routerMap[router.Name] = &router
+			case existing.Protocol != protocol:
+				common.LogProvider("traefik-cloud-saver", "[WARNING] router %s is both a %s and a %s router, ignoring the %s one",
+					router.Name, existing.Protocol, protocol, protocol)
+			default:
+				mergeRouter(existing, &router)
+			}
+		}
 	}
-	defer resp.Body.Close()
+	return routerMap, nil
+}
 
-	var routerSlice []TraefikRouter
-	if err := json.NewDecoder(resp.Body).Decode(&routerSlice); err != nil {
-		return nil, fmt.Errorf("failed to decode routers: %w", err)
+// mergeRouter folds a duplicate report of a router into the first one seen.  Entry points,
+// middlewares and the using list are combined, the router is enabled if any report has it enabled,
+// the highest priority wins, and so do the TLS settings of the first report with any.  A duplicate pointing at a different service is ignored, since the
+// router can only be sent to sleep for one of them.
+func mergeRouter(router, duplicate *TraefikRouter) {
+	if duplicate.Service != router.Service {
+		common.LogProvider("traefik-cloud-saver", "[WARNING] router %s is reported for services %s and %s, ignoring %s",
+			router.Name, router.Service, duplicate.Service, duplicate.Service)
+		return
 	}
 
-	// Convert slice to map
-	routerMap := make(map[string]*TraefikRouter)
-	for i := range routerSlice {
-		router := routerSlice[i] // Create a copy to avoid pointer to loop variable
-		routerMap[router.Name] = &router
+	router.EntryPoints = appendMissing(router.EntryPoints, duplicate.EntryPoints)
+	router.Using = appendMissing(router.Using, duplicate.Using)
+	router.Middlewares = appendMissing(router.Middlewares, duplicate.Middlewares)
+	if duplicate.Status == "enabled" {
+		router.Status = duplicate.Status
+	}
+	if duplicate.Priority > router.Priority {
+		router.Priority = duplicate.Priority
+	}
+	if router.TLS == nil {
+		router.TLS = duplicate.TLS
 	}
-	return routerMap, nil
 }
 
-func (p *CloudSaver) getRouterForService(serviceName string) (string, error) {
-	resp, err := http.Get(p.apiURL + "/http/services/" + serviceName)
-	if err != nil {
-		return "", fmt.Errorf("failed to fetch information for service %s, err: %w", serviceName, err)
+// appendMissing appends the values not already in list, keeping their order
+func appendMissing(list, values []string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range list {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
 	}
-	defer resp.Body.Close()
+	return list
+}
 
+// decodeUsedBy returns the routers a service's API response lists as using it, in order
+func decodeUsedBy(resp *http.Response, serviceName string) ([]string, error) {
 	var serviceInfo map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&serviceInfo); err != nil {
-		return "", fmt.Errorf("failed to decode service information: %w", err)
+		return nil, fmt.Errorf("failed to decode service information: %w", err)
 	}
 
-	// the usedBy field is an array of strings, let's use the first one.
-	// TODO: handle multiple routers for the same service, not sure if that's possible...
 	usedBy, ok := serviceInfo["usedBy"].([]interface{})
 	if !ok || len(usedBy) == 0 {
-		return "", fmt.Errorf("service %s does not have usedBy field", serviceName)
+		return nil, fmt.Errorf("service %s does not have usedBy field", serviceName)
+	}
+	routerNames := make([]string, 0, len(usedBy))
+	for _, router := range usedBy {
+		routerName, ok := router.(string)
+		if !ok {
+			return nil, fmt.Errorf("service %s has an invalid usedBy entry %v", serviceName, router)
+		}
+		routerNames = append(routerNames, routerName)
 	}
-	routerName := usedBy[0].(string)
-	return routerName, nil
+	sort.Strings(routerNames)
+	return routerNames, nil
 }
 
 func (p *CloudSaver) getCloudServiceName(traefikServiceName string) string {
+	if instance, ok := p.serviceInstances[stripProvider(traefikServiceName)]; ok {
+		return instance
+	}
+
 	// lets check if there is an @ in the serviceName, and if so we will strip it off (including the remaining characters after the @)
 	at_i := strings.Index(traefikServiceName, "@")
 	if at_i != -1 {
@@ -207,67 +654,379 @@ func (p *CloudSaver) getCloudServiceName(traefikServiceName string) string {
 	return traefikServiceName
 }
 
-func (p *CloudSaver) generateConfiguration() (*dynamic.JSONPayload, error) {
+// generateConfiguration decides the scale of every service for a window.  The metrics are fetched
+// until ctx is done, so stopping the provider cancels a slow scrape.
+func (p *CloudSaver) generateConfiguration(ctx context.Context) (*dynamic.JSONPayload, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.startWindow()
+	defer p.logSummary()
+	p.applySchedule()
+	p.discoverServices(ctx)
 
 	// Get current service rates
-	rates, err := p.metricsCollector.GetServiceRates()
+	rates, err := p.metricsCollector.GetServiceRates(ctx)
+	stale := false
+	if errors.Is(err, errImplausibleDuration) {
+		// the metrics are fine, the next decision will be made over a sound duration
+		return nil, fmt.Errorf("skipped the decision: %w", err)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get service rates: %w", err)
+		if p.failOpenOnAnomaly && errors.Is(err, errUnexpectedMetricsContent) {
+			return p.failOpen(ctx, fmt.Sprintf("metrics endpoint returned unexpected content: %v", err))
+		}
+
+		switch p.scrapeFailurePolicy {
+		case scrapeFailureFailOpen:
+			return p.failOpen(ctx, fmt.Sprintf("metrics scrape failed: %v", err))
+		case scrapeFailureReuse:
+			rates, err = p.staleRates(err)
+		}
+		if err != nil {
+			p.summary.errors++
+			return nil, fmt.Errorf("failed to get service rates: %w", err)
+		}
+		stale = true
 	}
 
-	serviceToRouter := make(map[string]string)
-	// loop through each service and get the router name
-	for serviceName, rate := range rates {
-		routerName, err := p.getRouterForService(serviceName)
+	// router metrics are folded into the services they route to, stale rates already have been
+	var routers map[string]*TraefikRouter
+	var routersFor map[string][]string
+	if p.metricsCollector.keyLabel == metricSourceRouter && !stale {
+		routers, err = p.listRouters(ctx)
 		if err != nil {
-			common.LogProvider("traefik-cloud-saver", "[ERROR]: failed to get router for service %s, err: %s", serviceName, err)
+			p.summary.errors++
+			return nil, fmt.Errorf("failed to map router rates to services: %w", err)
+		}
+		rates, routersFor = p.ratesByService(rates, routers)
+	}
+
+	// stale rates were already checked when they were scraped
+	if p.failOpenOnAnomaly && !stale {
+		if reason := p.detectAnomaly(rates); reason != "" {
+			return p.failOpen(ctx, reason)
+		}
+	}
+	if !stale {
+		p.rememberRates(rates)
+	}
+	p.lastServiceCount = len(rates)
+	for serviceName := range rates {
+		if !isGeneratedService(serviceName) {
+			p.summary.services++
+		}
+	}
+	p.idleGauges.update(p.clock, rates)
+	p.actions.updateRates(rates)
+	if p.bootstrapping(rates) {
+		return emptyConfiguration(), nil
+	}
+
+	scaledDown := make(map[string]*sleepingService)
+	awake := make(map[string]bool)
+
+	if p.wakeOnServerErrors {
+		p.wakeOnErrors(ctx, rates, awake)
+	}
+	p.checkReadiness(ctx)
+
+	// our own sleeping services, and services we've just woken up, aren't evaluated
+	var candidates []string
+	for serviceName := range rates {
+		if !isGeneratedService(serviceName) && !awake[serviceName] {
+			candidates = append(candidates, serviceName)
+		}
+	}
+
+	// the routers are listed once, or taken from the cache, rather than looked up for each service,
+	// and tell which ones to leave alone by their status and provider
+	var found map[string]serviceRouters
+	if len(candidates) > 0 {
+		lookup := routersFor == nil
+		if routers == nil {
+			routers, err = p.listRouters(ctx)
+			if err != nil {
+				p.summary.errors++
+				return nil, fmt.Errorf("failed to list routers: %w", err)
+			}
+		}
+		if lookup {
+			routersFor = indexRouters(routers)
+		}
+		found = p.lookupRouters(ctx, candidates, routers, routersFor, lookup)
+	}
+
+	instances := make(map[string][]*instanceMember)
+	for _, serviceName := range candidates {
+		routed := found[serviceName]
+		if errors.Is(routed.err, errServiceNotFound) {
+			// in the metrics, but Traefik doesn't know about it (anymore)
+			p.reconcileOrphan(ctx, serviceName)
 			continue
 		}
+		if routed.err != nil {
+			common.LogProvider("traefik-cloud-saver", "[ERROR]: failed to get router for service %s, err: %s", serviceName, routed.err)
+			p.summary.errors++
+			continue
+		}
+
+		delete(p.orphans, serviceName)
 
-		serviceToRouter[serviceName] = routerName
-		if !p.shouldMonitorRouter(routerName) {
-			common.LogProvider("traefik-cloud-saver", "Skipping router %s - not in monitor list", routerName)
+		// a service is monitored through any of its routers, e.g. one of several hosts
+		var monitored []string
+		for _, routerName := range routed.routerNames {
+			if reason := p.ignoredRouter(routers[routerName]); reason != "" {
+				common.DebugLog("traefik-cloud-saver", "Skipping router %s - %s", routerName, reason)
+				continue
+			}
+			if p.shouldMonitorRouter(routerName) {
+				monitored = append(monitored, routerName)
+			}
+		}
+		if len(monitored) == 0 {
+			common.LogProvider("traefik-cloud-saver", "Skipping router %s - not in monitor list", strings.Join(routed.routerNames, ", "))
+			p.decide(serviceName, actionSkip, reasonFiltered)
 			continue
 		}
 
 		cloudServiceName := p.getCloudServiceName(serviceName)
+		if !p.manage(cloudServiceName) {
+			common.DebugLog("traefik-cloud-saver", "Skipping service %s - %s doesn't carry the resource tags", serviceName, cloudServiceName)
+			p.decide(serviceName, actionSkip, reasonNotDiscovered)
+			continue
+		}
+		instances[cloudServiceName] = append(instances[cloudServiceName], &instanceMember{
+			serviceName: serviceName,
+			routerNames: monitored,
+			protocol:    routed.protocol,
+			rate:        rates[serviceName],
+		})
+	}
 
-		if rate.PerMin < p.trafficThreshold {
-			common.DebugLog("traefik-cloud-saver", "LOW TRAFFIC ALERT: Service %s (router %s) is below threshold (%.2f < %.2f req/min)",
-				serviceName, routerName, rate.PerMin, p.trafficThreshold)
+	// several traefik services may share an instance, decisions are made per instance
+	demand := p.sleepingDemand(rates)
+	for cloudServiceName, members := range instances {
+		p.decideInstance(ctx, cloudServiceName, members, demand[cloudServiceName], scaledDown, awake)
+	}
+
+	// forget orphans which have dropped out of the metrics as well
+	for serviceName := range p.orphans {
+		if _, ok := rates[serviceName]; !ok {
+			delete(p.orphans, serviceName)
+		}
+	}
 
-			if err := p.cloudService.ScaleDown(context.Background(), cloudServiceName); err != nil {
-				common.LogProvider("traefik-cloud-saver", "ERROR: failed to scale down service %s, err: %s", cloudServiceName, err)
-			} else {
-				common.LogProvider("traefik-cloud-saver", "Scaled down service %s (%s) due to rate %.2f below %.2f",
-					serviceName, cloudServiceName, rate.PerMin, p.trafficThreshold)
+	// make sure the scale actions stuck before the configuration is built around them
+	p.verifyScaleActions(ctx)
+
+	// all decisions for this window are applied as one batch, producing a single configuration
+	configuration, err := p.applyBatch(ctx, scaledDown, awake)
+	if err != nil {
+		p.summary.errors++
+		return nil, err
+	}
+	return configuration, nil
+}
+
+// decideInstance scales down a cloud service when the weighted traffic of the traefik services it
+// backs is below the threshold, and none of their activity metrics keep it up, and scales one at
+// zero back up when its traffic resumes.  The requests per minute its sleeping router answered,
+// sleepingDemand, count as traffic.  Scaled down services are added to scaledDown, the others
+// are marked in awake.
+func (p *CloudSaver) decideInstance(ctx context.Context, cloudServiceName string, members []*instanceMember, sleepingDemand float64, scaledDown map[string]*sleepingService, awake map[string]bool) {
+	if p.waking[cloudServiceName] {
+		common.DebugLog("traefik-cloud-saver", "service %s is being woken up on request, not re-evaluating", cloudServiceName)
+		for _, member := range members {
+			p.decide(member.serviceName, actionKeep, reasonWakeRequest)
+		}
+		return
+	}
+	p.updateLatch(cloudServiceName, members)
+
+	if p.isWarming(cloudServiceName) {
+		common.DebugLog("traefik-cloud-saver", "service %s is waiting on its readiness probe, not re-evaluating", cloudServiceName)
+		for _, member := range members {
+			p.decide(member.serviceName, actionKeep, reasonWarmup)
+		}
+		return
+	}
+
+	rate := p.effectiveRate(members)
+	rate.PerMin += sleepingDemand
+	threshold := p.thresholdFor(members)
+	active := p.activeMetric(members)
+	belowThreshold := p.belowThreshold(rate, members, threshold) && active == ""
+	if sleepingDemand > 0 && (p.idleTimeout > 0 || p.scaleOn == scaleOnConcurrency) {
+		// someone asked for the sleeping service this window, it isn't idle
+		belowThreshold = false
+	}
+	atZero := p.atZero(ctx, cloudServiceName)
+	if atZero && !belowThreshold && active == "" && p.scaleUpThreshold > 0 && rate.PerMin <= p.scaleUpThresholdFor(threshold) {
+		// between the two thresholds a service stays however it is, so it doesn't flap
+		common.DebugLog("traefik-cloud-saver", "service %s (%s) is scaled down and its rate %.2f isn't above %.2f, keeping it down",
+			cloudServiceName, memberNames(members), rate.PerMin, p.scaleUpThresholdFor(threshold))
+		belowThreshold = true
+	}
+	for _, member := range members {
+		p.compareShadow(member.serviceName, p.decisionMode(), rate, threshold, belowThreshold, active != "")
+	}
+
+	if !belowThreshold {
+		if active != "" {
+			common.DebugLog("traefik-cloud-saver", "service %s (%s) kept up by activity metric: %s", cloudServiceName, memberNames(members), active)
+		}
+		if atZero {
+			p.wakeOnTraffic(ctx, cloudServiceName, members, rate, threshold, awake)
+			return
+		}
+		for _, member := range members {
+			awake[member.serviceName] = true
+			p.decide(member.serviceName, actionKeep, reasonAboveThreshold)
+		}
+		return
+	}
+
+	p.summary.belowThreshold += len(members)
+	common.DebugLog("traefik-cloud-saver", "LOW TRAFFIC ALERT: Service %s (%s) is below threshold (%.2f < %.2f req/min)",
+		cloudServiceName, memberNames(members), rate.PerMin, threshold)
+
+	names := make([]string, 0, len(members))
+	for _, member := range members {
+		names = append(names, member.serviceName)
+	}
+	if p.neverScaledDown(cloudServiceName, names...) {
+		common.LogProvider("traefik-cloud-saver", "Not scaling down service %s (%s): listed in neverScaleDown", cloudServiceName, memberNames(members))
+		for _, member := range members {
+			p.decide(member.serviceName, actionKeep, reasonNeverScaleDown)
+		}
+		return
+	}
+
+	if !p.isSleeping(cloudServiceName) && p.inCooldown(cloudServiceName, actionScaleDown) {
+		for _, member := range members {
+			p.decide(member.serviceName, actionKeep, reasonCooldown)
+		}
+		return
+	}
+
+	if p.latched(ctx, cloudServiceName) {
+		common.LogProvider("traefik-cloud-saver", "Not scaling down service %s (%s): started again since it was scaled down, waiting for traffic",
+			cloudServiceName, memberNames(members))
+		for _, member := range members {
+			p.decide(member.serviceName, actionKeep, reasonLatched)
+		}
+		return
+	}
+
+	if ok, reason := p.canScaleDown(ctx, cloudServiceName); !ok {
+		common.LogProvider("traefik-cloud-saver", "Not scaling down service %s (%s): %s", cloudServiceName, memberNames(members), reason)
+		for _, member := range members {
+			p.decide(member.serviceName, actionKeep, reasonInstancePolicy)
+		}
+		return
+	}
+
+	if ok, reason := p.hasCapacity(ctx, cloudServiceName, members); !ok {
+		common.LogProvider("traefik-cloud-saver", "Not scaling down service %s (%s): %s", cloudServiceName, memberNames(members), reason)
+		for _, member := range members {
+			p.decide(member.serviceName, actionKeep, reasonCapacity)
+		}
+		return
+	}
+
+	if unhealthy := p.unhealthyDependency(ctx, cloudServiceName); unhealthy != "" {
+		common.LogProvider("traefik-cloud-saver", "Not scaling down service %s (%s): %s", cloudServiceName, memberNames(members), unhealthy)
+		for _, member := range members {
+			p.decide(member.serviceName, actionKeep, reasonDependency)
+		}
+		return
+	}
+
+	if p.skipDryRun(actionScaleDown, cloudServiceName, "(%s), rate %.2f < %.2f", memberNames(members), rate.PerMin, threshold) {
+		for _, member := range members {
+			p.decide(member.serviceName, actionKeep, reasonDryRun)
+		}
+		return
+	}
+
+	// a service already put to sleep is scaled down again every window, which only re-asserts it
+	asleep := p.isSleeping(cloudServiceName)
+	if err := p.scaleDown(ctx, cloudServiceName); err != nil {
+		action, reason := actionKeep, reasonError
+		switch {
+		case errors.Is(err, errLockHeld):
+			reason = reasonLocked
+			common.LogProvider("traefik-cloud-saver", "Not scaling down service %s (%s): another replica holds its lock", cloudServiceName, memberNames(members))
+		case errors.Is(err, common.ErrTransitioning):
+			// retried next window, once the provider has settled
+			reason = reasonTransitioning
+			common.LogProvider("traefik-cloud-saver", "Deferring scale down of service %s (%s): %v", cloudServiceName, memberNames(members), err)
+		case errors.Is(err, common.ErrNotEligible):
+			reason = reasonInstancePolicy
+			common.LogProvider("traefik-cloud-saver", "Not scaling down service %s (%s): %v", cloudServiceName, memberNames(members), err)
+		case errors.Is(err, common.ErrQuarantined):
+			// logged once by trackQuarantine
+			reason = reasonQuarantined
+		default:
+			action = actionScaleDown
+			common.LogProvider("traefik-cloud-saver", "ERROR: failed to scale down service %s, err: %s", cloudServiceName, err)
+		}
+		for _, member := range members {
+			p.decide(member.serviceName, action, reason)
+		}
+		return
+	}
+	if asleep {
+		for _, member := range members {
+			p.decide(member.serviceName, actionKeep, reasonAsleep)
+		}
+		common.DebugLog("traefik-cloud-saver", "service %s (%s) is still scaled down, rate %.2f below %.2f",
+			cloudServiceName, memberNames(members), rate.PerMin, threshold)
+	} else {
+		for _, member := range members {
+			p.decide(member.serviceName, actionScaleDown, reasonBelowThreshold)
+		}
+		p.notify(cloudServiceName, actionScaleDown, reasonBelowThreshold, rate.PerMin, threshold)
+		common.LogProvider("traefik-cloud-saver", "Scaled down service %s (%s) due to rate %.2f below %.2f",
+			cloudServiceName, memberNames(members), rate.PerMin, threshold)
+	}
+
+	if scale, err := p.cloudService.GetCurrentScale(ctx, cloudServiceName); (err == nil && scale == 0) || p.scaleUnsupported(err) {
+		for _, member := range members {
+			scaledDown[member.serviceName] = &sleepingService{
+				serviceName: member.serviceName,
+				routerNames: member.routerNames,
+				cloudName:   cloudServiceName,
+				since:       p.clock.Now(),
 			}
 		}
 	}
+}
 
+// emptyConfiguration returns a dynamic configuration with no routers, services or middlewares
+func emptyConfiguration() *dynamic.JSONPayload {
 	return &dynamic.JSONPayload{
 		Configuration: &dynamic.Configuration{
 			HTTP: &dynamic.HTTPConfiguration{
-				Routers:     make(map[string]*dynamic.Router),
-				Services:    make(map[string]*dynamic.Service),
-				Middlewares: make(map[string]*dynamic.Middleware),
+				Routers:           make(map[string]*dynamic.Router),
+				Services:          make(map[string]*dynamic.Service),
+				Middlewares:       make(map[string]*dynamic.Middleware),
+				ServersTransports: make(map[string]*dynamic.ServersTransport),
 			},
 		},
-	}, nil
+	}
 }
 
-// shouldMonitorRouter checks if a router should be monitored based on filter criteria
+// shouldMonitorRouter checks if a router should be monitored based on filter criteria.  A router
+// listed in RouterFilter.Routers is monitored, and scaled on its own threshold if it has one.  An
+// excluded router is never monitored, exclusion wins over every way of selecting it.
 func (p *CloudSaver) shouldMonitorRouter(routerName string) bool {
-	if p.routerFilter == nil || len(p.routerFilter.Names) == 0 {
-		return true // monitor all routers if no filter specified
+	if p.routerExclusion != nil && p.routerExclusion.MatchString(routerName) {
+		return false
 	}
-
-	// Check if router name matches any in the Names filter
-	// TODO: This is a linear search, could be optimized, but we don't expect this list to be long
-	for _, name := range p.routerFilter.Names {
-		if name == routerName {
-			return true
-		}
+	if p.routerMatcher == nil {
+		return true // monitor all routers if no filter specified
 	}
-	return false
+	return p.routerMatcher.MatchString(routerName)
 }
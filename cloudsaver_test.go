@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -144,7 +146,7 @@ func TestRealWorldResponse(t *testing.T) {
 		saver.apiURL = server.URL + "/api"
 
 		// Call getRoutersFromAPI directly
-		routers, err := saver.getRoutersFromAPI()
+		routers, err := saver.getRoutersFromAPI(context.Background())
 
 		// Check error
 		if err != nil {
@@ -327,7 +329,7 @@ func TestGetRoutersFromAPI(t *testing.T) {
 
 			// Call getRoutersFromAPI directly
 			fmt.Println("Calling getRoutersFromAPI")
-			routers, err := saver.getRoutersFromAPI()
+			routers, err := saver.getRoutersFromAPI(context.Background())
 			fmt.Println("getRoutersFromAPI returned", routers)
 
 			// Check error
@@ -359,3 +361,274 @@ func TestGetRoutersFromAPI(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRoutersFromAPIMergesDuplicates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]*TraefikRouter{
+			{Name: "web@docker", Service: "web", Status: "disabled", EntryPoints: []string{"web"}, Using: []string{"web"}, Priority: 1},
+			{Name: "web@docker", Service: "web", Status: "enabled", EntryPoints: []string{"websecure"}, Using: []string{"websecure"},
+				Middlewares: []string{"auth@docker"}, Priority: 5, TLS: &dynamic.RouterTLSConfig{CertResolver: "le"}},
+			{Name: "web@docker", Service: "other", Status: "enabled", EntryPoints: []string{"admin"}},
+			{Name: "api@docker", Service: "api", Status: "enabled", EntryPoints: []string{"web"}},
+		})
+	}))
+	defer server.Close()
+
+	config := CreateConfig()
+	config.WindowSize = "1s"
+	config.testMode = true
+
+	saver, err := New(context.Background(), config, "test-routers-merge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saver.apiURL = server.URL + "/api"
+
+	routers, err := saver.getRoutersFromAPI(context.Background())
+	if err != nil {
+		t.Fatalf("getRoutersFromAPI() failed: %v", err)
+	}
+	if len(routers) != 2 {
+		t.Fatalf("expected 2 routers, got %d", len(routers))
+	}
+
+	web := routers["web@docker"]
+	if web.Service != "web" {
+		t.Errorf("expected the first service to win, got %s", web.Service)
+	}
+	if !reflect.DeepEqual(web.EntryPoints, []string{"web", "websecure"}) {
+		t.Errorf("expected merged entry points, got %v", web.EntryPoints)
+	}
+	if !reflect.DeepEqual(web.Using, []string{"web", "websecure"}) {
+		t.Errorf("expected merged using, got %v", web.Using)
+	}
+	if !reflect.DeepEqual(web.Middlewares, []string{"auth@docker"}) {
+		t.Errorf("expected merged middlewares, got %v", web.Middlewares)
+	}
+	if web.TLS == nil || web.TLS.CertResolver != "le" {
+		t.Errorf("expected the TLS settings of the duplicate, got %+v", web.TLS)
+	}
+	if web.Status != "enabled" {
+		t.Errorf("expected router to be enabled, got %s", web.Status)
+	}
+	if web.Priority != 5 {
+		t.Errorf("expected highest priority 5, got %d", web.Priority)
+	}
+}
+
+func TestScrapeIntervalBetweenDecisions(t *testing.T) {
+	var mu sync.Mutex
+	scrapes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" {
+			mu.Lock()
+			scrapes++
+			mu.Unlock()
+		}
+		w.Write([]byte("# Empty metrics for testing\n"))
+	}))
+	defer server.Close()
+
+	config := CreateConfig()
+	config.WindowSize = "300ms"
+	config.ScrapeInterval = "50ms"
+	config.testMode = true
+
+	provider, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.apiURL = server.URL + "/api"
+	provider.metricsCollector.metricsURL = server.URL + "/metrics"
+
+	cfgChan := make(chan json.Marshaler)
+	if err := provider.Provide(cfgChan); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = provider.Stop()
+	})
+
+	select {
+	case <-cfgChan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for configuration")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if scrapes < 3 {
+		t.Errorf("expected several scrapes before the first decision, got %d", scrapes)
+	}
+}
+
+func TestScrapeIntervalValidation(t *testing.T) {
+	config := CreateConfig()
+	config.WindowSize = "1s"
+	config.ScrapeInterval = "2s"
+	config.testMode = true
+
+	if _, err := New(context.Background(), config, "test"); err == nil {
+		t.Error("expected an error for a scrape interval longer than the window")
+	}
+
+	config.ScrapeInterval = "not-a-duration"
+	if _, err := New(context.Background(), config, "test"); err == nil {
+		t.Error("expected an error for an invalid scrape interval")
+	}
+}
+
+// tickClock hands out tickers the test fires by hand, announcing each one on created
+type tickClock struct {
+	realClock
+	created chan *manualTicker
+}
+
+type manualTicker struct {
+	interval time.Duration
+	c        chan time.Time
+	stopped  chan struct{}
+}
+
+func (c *tickClock) NewTicker(d time.Duration) Ticker {
+	ticker := &manualTicker{interval: d, c: make(chan time.Time, 1), stopped: make(chan struct{})}
+	c.created <- ticker
+	return ticker
+}
+
+func (t *manualTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTicker) Stop() {
+	select {
+	case <-t.stopped:
+	default:
+		close(t.stopped)
+	}
+}
+
+func TestInitialWindow(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("svc@docker", "svc@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="svc@docker"} 100`, "")
+
+	clock := &tickClock{created: make(chan *manualTicker, 1)}
+	saver, _ := newTestSaver(t, backend, nil, func(c *Config) {
+		c.WindowSize = "1h"
+		c.InitialWindow = "1m"
+	}, WithClock(clock))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cfgChan := make(chan json.Marshaler)
+	go saver.loadConfiguration(ctx, cfgChan)
+
+	initial := <-clock.created
+	if initial.interval != time.Minute {
+		t.Fatalf("expected the first window to tick after 1m, got %v", initial.interval)
+	}
+	initial.c <- time.Now()
+
+	select {
+	case <-cfgChan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a configuration after the initial window")
+	}
+
+	regular := <-clock.created
+	if regular.interval != time.Hour {
+		t.Errorf("expected the full window cadence after the first window, got %v", regular.interval)
+	}
+	select {
+	case <-initial.stopped:
+	default:
+		t.Error("expected the initial ticker to be stopped")
+	}
+}
+
+func TestInitialWindowValidation(t *testing.T) {
+	for _, initialWindow := range []string{"soon", "0s", "1s", "2s"} {
+		config := CreateConfig()
+		config.WindowSize = "1s"
+		config.testMode = true
+		config.InitialWindow = initialWindow
+		if _, err := New(context.Background(), config, "test"); err == nil {
+			t.Errorf("expected error for initial window %q", initialWindow)
+		}
+	}
+}
+
+func TestPollInterval(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("svc@docker", "svc@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="svc@docker"} 100`, "")
+
+	clock := &tickClock{created: make(chan *manualTicker, 1)}
+	saver, _ := newTestSaver(t, backend, nil, func(c *Config) {
+		c.WindowSize = "1h"
+		c.PollInterval = "5m"
+	}, WithClock(clock))
+	if saver.metricsCollector.rateWindow != time.Hour {
+		t.Errorf("expected rates over the 1h window, got %v", saver.metricsCollector.rateWindow)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go saver.loadConfiguration(ctx, make(chan json.Marshaler, 1))
+
+	if ticker := <-clock.created; ticker.interval != 5*time.Minute {
+		t.Errorf("expected decisions every 5m, got %v", ticker.interval)
+	}
+}
+
+func TestPollIntervalValidation(t *testing.T) {
+	tests := []struct {
+		name         string
+		pollInterval string
+		schedules    []Schedule
+	}{
+		{name: "invalid", pollInterval: "often"},
+		{name: "negative", pollInterval: "-1m"},
+		{name: "longer than the window", pollInterval: "2h"},
+		{name: "schedule changing the window size", pollInterval: "5m", schedules: []Schedule{{Name: "night", Start: "22:00", End: "06:00", WindowSize: "2h"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.WindowSize = "1h"
+			config.testMode = true
+			config.PollInterval = tt.pollInterval
+			config.Schedules = tt.schedules
+			if _, err := New(context.Background(), config, "test"); err == nil {
+				t.Errorf("expected an error for poll interval %q", tt.pollInterval)
+			}
+		})
+	}
+}
+
+func TestStopBeforeProvide(t *testing.T) {
+	saver, _ := newTestSaver(t, newTestBackend(t), nil, nil)
+	if err := saver.Stop(); err != nil {
+		t.Fatalf("Stop() before Provide() failed: %v", err)
+	}
+	if err := saver.Stop(); err != nil {
+		t.Fatalf("second Stop() failed: %v", err)
+	}
+}
+
+func TestStopTwice(t *testing.T) {
+	saver, _ := newTestSaver(t, newTestBackend(t), nil, func(c *Config) {
+		c.SelfMetricsAddress = "127.0.0.1:0"
+	})
+	if err := saver.Provide(make(chan json.Marshaler, 1)); err != nil {
+		t.Fatalf("Provide() failed: %v", err)
+	}
+	if err := saver.Stop(); err != nil {
+		t.Fatalf("Stop() failed: %v", err)
+	}
+	if err := saver.Stop(); err != nil {
+		t.Errorf("second Stop() failed: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// configCoalescer sits between the window loop and Traefik's configuration channel.  Only the latest
+// configuration is kept, so a slow consumer gets the current state instead of a backlog of stale
+// configurations.
+type configCoalescer struct {
+	latest chan json.Marshaler
+}
+
+func newConfigCoalescer() *configCoalescer {
+	return &configCoalescer{latest: make(chan json.Marshaler, 1)}
+}
+
+// offer queues a configuration, replacing any configuration which hasn't been picked up yet.  It
+// never blocks, and must only be called from a single goroutine.
+func (c *configCoalescer) offer(configuration json.Marshaler) {
+	select {
+	case <-c.latest:
+		common.DebugLog("traefik-cloud-saver", "configuration not consumed yet, replacing it with the latest")
+	default:
+	}
+	c.latest <- configuration
+}
+
+// forward delivers queued configurations to out until the context is done.  While waiting on out,
+// a newer configuration replaces the one being delivered.
+func (c *configCoalescer) forward(ctx context.Context, out chan<- json.Marshaler) {
+	var pending json.Marshaler
+	for {
+		if pending == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case pending = <-c.latest:
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case out <- pending:
+			pending = nil
+		case newer := <-c.latest:
+			common.DebugLog("traefik-cloud-saver", "configuration not consumed yet, replacing it with the latest")
+			pending = newer
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testConfiguration is a numbered configuration, so tests can tell which one was delivered
+type testConfiguration int
+
+func (c testConfiguration) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Itoa(int(c))), nil
+}
+
+// receive waits briefly for a configuration, returning nil if none arrives
+func receive(t *testing.T, out <-chan json.Marshaler) json.Marshaler {
+	t.Helper()
+	select {
+	case configuration := <-out:
+		return configuration
+	case <-time.After(100 * time.Millisecond):
+		return nil
+	}
+}
+
+func TestConfigCoalescerKeepsLatest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	coalescer := newConfigCoalescer()
+	out := make(chan json.Marshaler)
+
+	// rapid windows before anyone is forwarding or consuming
+	for i := 1; i <= 5; i++ {
+		coalescer.offer(testConfiguration(i))
+	}
+
+	go coalescer.forward(ctx, out)
+
+	if got := receive(t, out); got != testConfiguration(5) {
+		t.Errorf("expected only the latest configuration 5, got %v", got)
+	}
+	if got := receive(t, out); got != nil {
+		t.Errorf("expected no further configurations, got %v", got)
+	}
+}
+
+func TestConfigCoalescerReplacesPending(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	coalescer := newConfigCoalescer()
+	out := make(chan json.Marshaler)
+	go coalescer.forward(ctx, out)
+
+	// the forwarder picks this one up and blocks on the slow consumer
+	coalescer.offer(testConfiguration(1))
+	deadline := time.Now().Add(time.Second)
+	for len(coalescer.latest) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	coalescer.offer(testConfiguration(2))
+	coalescer.offer(testConfiguration(3))
+	time.Sleep(20 * time.Millisecond)
+
+	if got := receive(t, out); got != testConfiguration(3) {
+		t.Errorf("expected the latest configuration 3, got %v", got)
+	}
+	if got := receive(t, out); got != nil {
+		t.Errorf("expected no further configurations, got %v", got)
+	}
+
+	// later windows are still delivered
+	coalescer.offer(testConfiguration(4))
+	if got := receive(t, out); got != testConfiguration(4) {
+		t.Errorf("expected configuration 4, got %v", got)
+	}
+}
+
+func TestConfigCoalescerStops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	coalescer := newConfigCoalescer()
+	out := make(chan json.Marshaler)
+
+	done := make(chan struct{})
+	go func() {
+		coalescer.forward(ctx, out)
+		close(done)
+	}()
+
+	// blocked delivering to a consumer which never reads
+	coalescer.offer(testConfiguration(1))
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("forward did not return after the context was cancelled")
+	}
+}
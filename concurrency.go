@@ -0,0 +1,74 @@
+package traefik_cloud_saver
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	scaleOnRate        = "rate"
+	scaleOnConcurrency = "concurrency"
+
+	// inProgressMetric is the gauge of requests a service is serving right now
+	inProgressMetric = "traefik_service_requests_in_progress"
+)
+
+// WithConcurrency tracks the requests in progress gauge of each service, reporting the highest
+// value seen across the samples of a window as its concurrency
+func WithConcurrency() MetricsCollectorOption {
+	return func(mc *MetricsCollector) {
+		mc.trackConcurrency = true
+	}
+}
+
+// validateScaleOn checks the scale down signal can be used with the rest of the config
+func validateScaleOn(config *Config) error {
+	switch config.ScaleOn {
+	case "", scaleOnRate:
+		return nil
+	case scaleOnConcurrency:
+	default:
+		return fmt.Errorf("invalid scaleOn %q, expected %s or %s", config.ScaleOn, scaleOnRate, scaleOnConcurrency)
+	}
+
+	switch {
+	case config.MetricsType == metricsTypeQuery:
+		return fmt.Errorf("scaleOn %s can't be used with metricsType %s", scaleOnConcurrency, metricsTypeQuery)
+	case config.MetricSource == metricSourceRouter:
+		return fmt.Errorf("scaleOn %s needs the service metrics, not metricSource %s", scaleOnConcurrency, metricSourceRouter)
+	case config.IdleTimeout != "":
+		return fmt.Errorf("idleTimeout can't be used with scaleOn %s", scaleOnConcurrency)
+	}
+	return nil
+}
+
+// peakConcurrency returns the most requests in progress across the window for any of the traefik
+// services sharing a cloud service.  A service with zero weight doesn't count toward keeping it up.
+func (p *CloudSaver) peakConcurrency(members []*instanceMember) float64 {
+	peak := 0.0
+	for _, member := range members {
+		if p.serviceWeight(member.serviceName) <= 0 {
+			continue
+		}
+		if member.rate.Concurrency > peak {
+			peak = member.rate.Concurrency
+		}
+	}
+	return peak
+}
+
+// observeConcurrency records the highest requests in progress of each service across samples
+func observeConcurrency(rates map[string]*ServiceRate, samples []metricsSample, duration time.Duration) {
+	for _, sample := range samples {
+		for service, inFlight := range sample.inFlight {
+			rate, ok := rates[service]
+			if !ok {
+				rate = &ServiceRate{ServiceName: service, Duration: duration}
+				rates[service] = rate
+			}
+			if inFlight > rate.Concurrency {
+				rate.Concurrency = inFlight
+			}
+		}
+	}
+}
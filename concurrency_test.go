@@ -0,0 +1,118 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScaleOnConcurrency(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("batch@docker", "batch@docker")
+	backend.addService("stream@docker", "stream@docker")
+	// stream has a long running request open across entrypoints, batch only finished ones
+	backend.setMetrics(`
+traefik_service_requests_total{service="batch@docker"} 100
+traefik_service_requests_total{service="stream@docker"} 0
+traefik_service_requests_in_progress{service="batch@docker",entrypoint="web"} 0
+traefik_service_requests_in_progress{service="stream@docker",entrypoint="web"} 0
+traefik_service_requests_in_progress{service="stream@docker",entrypoint="websecure"} 1
+`, "")
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"batch": 1, "stream": 1}, func(c *Config) {
+		c.ScaleOn = scaleOnConcurrency
+	})
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	if scale := currentScale(t, svc, "batch"); scale != 0 {
+		t.Errorf("expected batch to be scaled down with nothing in progress, got scale %d", scale)
+	}
+	if scale := currentScale(t, svc, "stream"); scale != 1 {
+		t.Errorf("expected a request in progress to keep stream up, got scale %d", scale)
+	}
+	if got := saver.decisions.count("stream@docker", actionKeep, reasonAboveThreshold); got != 1 {
+		t.Errorf("expected 1 above threshold decision for stream, got %d", got)
+	}
+}
+
+func TestConcurrencySustainedForWindow(t *testing.T) {
+	ctx := context.Background()
+	backend := newTestBackend(t)
+	backend.addService("svc@docker", "svc@docker")
+	setInProgress := func(body string) {
+		backend.setMetrics(`traefik_service_requests_total{service="svc@docker"} 0
+`+body, "")
+	}
+	setInProgress(`traefik_service_requests_in_progress{service="svc@docker"} 1`)
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"svc": 1}, func(c *Config) {
+		c.ScaleOn = scaleOnConcurrency
+	})
+	window := func() {
+		t.Helper()
+		if _, err := saver.generateConfiguration(ctx); err != nil {
+			t.Fatalf("generateConfiguration() failed: %v", err)
+		}
+	}
+	scrape := func() {
+		t.Helper()
+		if err := saver.metricsCollector.Scrape(ctx); err != nil {
+			t.Fatalf("Scrape() failed: %v", err)
+		}
+	}
+
+	window()
+
+	// a request in progress at any scrape of the window keeps the service up, even if it's
+	// finished by the end of it
+	setInProgress(`traefik_service_requests_in_progress{service="svc@docker"} 2`)
+	scrape()
+	setInProgress(`traefik_service_requests_in_progress{service="svc@docker"} 0`)
+	scrape()
+	window()
+	if scale := currentScale(t, svc, "svc"); scale != 1 {
+		t.Fatalf("expected svc to stay up after requests in progress during the window, got scale %d", scale)
+	}
+
+	scrape()
+	scrape()
+	window()
+	if scale := currentScale(t, svc, "svc"); scale != 0 {
+		t.Errorf("expected svc to be scaled down after a window with nothing in progress, got scale %d", scale)
+	}
+}
+
+func TestScaleOnValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*Config)
+	}{
+		{name: "unknown", configure: func(c *Config) { c.ScaleOn = "latency" }},
+		{name: "prometheus query", configure: func(c *Config) {
+			c.ScaleOn = scaleOnConcurrency
+			c.MetricsType = metricsTypeQuery
+		}},
+		{name: "router source", configure: func(c *Config) {
+			c.ScaleOn = scaleOnConcurrency
+			c.MetricSource = metricSourceRouter
+		}},
+		{name: "idle timeout", configure: func(c *Config) {
+			c.ScaleOn = scaleOnConcurrency
+			c.IdleTimeout = "10m"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.WindowSize = "1s"
+			config.testMode = true
+			tt.configure(config)
+			if _, err := New(context.Background(), config, "test"); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
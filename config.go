@@ -1,19 +1,80 @@
 package traefik_cloud_saver
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+
 	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
 )
 
 // Config the plugin configuration.
 type Config struct {
-	TrafficThreshold float64                    `json:"trafficThreshold,omitempty"`
-	WindowSize       string                     `json:"windowSize,omitempty"`
-	MetricsURL       string                     `json:"metricsURL,omitempty"`
-	RouterFilter     *RouterFilter              `json:"routerFilter,omitempty"`
-	CloudConfig      *common.CloudServiceConfig `json:"cloudConfig,omitempty"`
-	APIURL           string                     `json:"apiURL,omitempty"`
-	Debug            bool                       `json:"debug,omitempty"`
-	testMode         bool
+	TrafficThreshold    float64                     `json:"trafficThreshold,omitempty"`
+	ScaleDownThreshold  float64                     `json:"scaleDownThreshold,omitempty"` // scale down below this req/min, replaces trafficThreshold when set
+	ScaleUpThreshold    float64                     `json:"scaleUpThreshold,omitempty"`   // when set, a scaled down service is scaled back up once its rate is above this req/min
+	WindowSize          string                      `json:"windowSize,omitempty"`
+	PollInterval        string                      `json:"pollInterval,omitempty"`   // how often rates are computed and decisions made, default windowSize, the rates still span windowSize
+	ScrapeInterval      string                      `json:"scrapeInterval,omitempty"` // background scrape cadence, empty scrapes once per window
+	InitialWindow       string                      `json:"initialWindow,omitempty"`  // make the first decision this long after startup rather than a full windowSize
+	WindowOverlap       string                      `json:"windowOverlap,omitempty"`  // queue (default) runs a tick missed by a long window right after it, skip drops it
+	MetricsURL          string                      `json:"metricsURL,omitempty"`     // comma separated to sum the metrics of several Traefik replicas
+	RouterFilter        *RouterFilter               `json:"routerFilter,omitempty"`
+	MonitorInternal     bool                        `json:"monitorInternal,omitempty"` // also evaluate the services behind @internal routers, which have no cloud backend
+	CloudConfig         *common.CloudServiceConfig  `json:"cloudConfig,omitempty"`
+	APIURL              string                      `json:"apiURL,omitempty"`
+	APIAuth             *MetricsAuth                `json:"apiAuth,omitempty"`         // credentials for the Traefik API when it's behind auth, a bearer token or basic auth
+	APITimeout          string                      `json:"apiTimeout,omitempty"`      // bound on each request to the Traefik API, default 10s
+	RouterCacheTTL      string                      `json:"routerCacheTTL,omitempty"`  // reuse the routers listed from the Traefik API for this long, default 1m, 0s lists them every window
+	PreflightChecks     bool                        `json:"preflightChecks,omitempty"` // check metricsURL and apiURL answer when starting, failing startup when they don't
+	Debug               bool                        `json:"debug,omitempty"`
+	FailOpenOnAnomaly   bool                        `json:"failOpenOnAnomaly,omitempty"`   // scale everything up instead of down when the metrics look bogus
+	Shadow              *ShadowConfig               `json:"shadow,omitempty"`              // alternate decision engine whose decisions are only logged
+	ScaleUpTargets      map[string]int32            `json:"scaleUpTargets,omitempty"`      // per cloud service instance count to scale up to, at least 1, default 1, above 1 needs cloudRun
+	InstanceCapacity    map[string]float64          `json:"instanceCapacity,omitempty"`    // cloud service -> req/min one instance can take, scaling down never leaves the others above it
+	NeverScaleDown      []string                    `json:"neverScaleDown,omitempty"`      // traefik or cloud services evaluated as usual but never scaled down, e.g. monitoring canaries
+	WakeOnServerErrors  bool                        `json:"wakeOnServerErrors,omitempty"`  // 5xx for a scaled down service triggers an immediate scale up
+	OrphanGracePeriod   string                      `json:"orphanGracePeriod,omitempty"`   // how long a service may be in the metrics but missing from the API
+	ScaleDownOrphans    bool                        `json:"scaleDownOrphans,omitempty"`    // scale down a managed service once it's been missing from the API past the grace period
+	SelfMetricsAddress  string                      `json:"selfMetricsAddress,omitempty"`  // address (e.g. ":9105") to serve the plugin's own Prometheus metrics on
+	DebugParsedCounts   bool                        `json:"debugParsedCounts,omitempty"`   // serve the counts parsed from the last scrape on selfMetricsAddress at /debug/parsed
+	AdminAddr           string                      `json:"adminAddr,omitempty"`           // address (e.g. "127.0.0.1:9106") to accept POST /wake/{service} on, unauthenticated so keep it private
+	SleepingPage        *SleepingPage               `json:"sleepingPage,omitempty"`        // page served in place of the bare 503 of a scaled down service
+	ScaledDownBehavior  string                      `json:"scaledDownBehavior,omitempty"`  // serve-503 (default), redirect, or leave the router of a scaled down service alone
+	ScaledDownRedirect  string                      `json:"scaledDownRedirect,omitempty"`  // URL the redirect behavior sends requests to, e.g. a status page
+	ScaledDownTransport *ScaledDownTransport        `json:"scaledDownTransport,omitempty"` // forwarding timeouts and retries for the requests to a scaled down service
+	ReadinessProbe      *ReadinessProbe             `json:"readinessProbe,omitempty"`      // probe a scaled up service before it's eligible for scale down again
+	Dependencies        map[string][]Dependency     `json:"dependencies,omitempty"`        // cloud service -> dependencies which must be healthy for it to be scaled either way
+	ServiceInstances    map[string]string           `json:"serviceInstances,omitempty"`    // traefik service (without @provider) -> cloud service, default the service name
+	ServiceWeights      map[string]float64          `json:"serviceWeights,omitempty"`      // how much a traefik service's traffic counts toward keeping its cloud service up, default 1
+	DecisionSink        *DecisionSinkConfig         `json:"decisionSink,omitempty"`        // stream every decision as JSON to a collector
+	Notifications       *NotificationsConfig        `json:"notifications,omitempty"`       // webhooks told about every scale action
+	ActivityMetrics     map[string][]ActivityMetric `json:"activityMetrics,omitempty"`     // traefik service (without @provider) -> other metrics any of which keeps it up
+	ScrapeFailurePolicy string                      `json:"scrapeFailurePolicy,omitempty"` // skip (default), reuse or failOpen when the metrics can't be scraped
+	MaxStaleWindows     int                         `json:"maxStaleWindows,omitempty"`     // windows in a row the reuse policy may decide on the last known rates, default 3
+	ScaleVerifyDelay    string                      `json:"scaleVerifyDelay,omitempty"`    // re-check the scale this long after scaling to catch reverted actions, empty disables
+	SuccessCodes        []string                    `json:"successCodes,omitempty"`        // response code classes counted as traffic, default ["2xx"], e.g. ["2xx", "3xx"]
+	IdleTimeout         string                      `json:"idleTimeout,omitempty"`         // scale down once no requests are seen for this long, instead of on trafficThreshold
+	ScaleOn             string                      `json:"scaleOn,omitempty"`             // rate (default) scales down below trafficThreshold, concurrency only with no requests in progress all window
+	SampleWindow        int                         `json:"sampleWindow,omitempty"`        // average rates over this many scrapes, default the increase since the last window
+	RateDuration        string                      `json:"rateDuration,omitempty"`        // measured (default), skip or clamp to the poll period when the time since the last decision is under half or over twice of it
+	MetricLabels        map[string]string           `json:"metricLabels,omitempty"`        // only count request series with all these label values, e.g. {"namespace": "prod"}
+	MetricSource        string                      `json:"metricSource,omitempty"`        // service (default) or router request counters to compute rates from
+	Protocols           []string                    `json:"protocols,omitempty"`           // router protocols whose services are monitored, default ["http"], e.g. ["http", "tcp"]
+	TCPMetric           string                      `json:"tcpMetric,omitempty"`           // gauge of a TCP service's open connections, any of which keeps it up, default traefik_service_open_connections
+	MetricsType         string                      `json:"metricsType,omitempty"`         // prometheus-scrape (default) scrapes metricsURL, prometheus-query queries a Prometheus server at metricsURL
+	PromQL              string                      `json:"promQL,omitempty"`              // per second rates by service for prometheus-query, {{window}} is replaced with the window size
+	MetricsTimeouts     *MetricsTimeouts            `json:"metricsTimeouts,omitempty"`     // separate connect and total timeouts for metrics requests, default 5s for the whole request
+	MetricsAuth         *MetricsAuth                `json:"metricsAuth,omitempty"`         // credentials for the metrics endpoint, or embed user:password in metricsURL
+	Bootstrap           *BootstrapConfig            `json:"bootstrap,omitempty"`           // only observe for a while, then log recommended thresholds
+	DryRun              bool                        `json:"dryRun,omitempty"`              // log the scale actions that would be taken, without taking them
+	CooldownPeriod      string                      `json:"cooldownPeriod,omitempty"`      // no further scale action on a service for this long after one, default none
+	CooldownOverrides   map[string]string           `json:"cooldownOverrides,omitempty"`   // cloud service -> cooldown period replacing cooldownPeriod for it, e.g. {"heavy-vm": "1h"}
+	Schedules           []Schedule                  `json:"schedules,omitempty"`           // time of day ranges with their own threshold, window size or cooldown period, the first matching applies
+	Lock                *LockConfig                 `json:"lock,omitempty"`                // lock scale actions through files shared with other replicas
+	testMode            bool
 }
 
 // CreateConfig creates the default plugin configuration.
@@ -29,5 +90,353 @@ func CreateConfig() *Config {
 		testMode: false,
 		APIURL:   "http://localhost:8080/api/",
 		Debug:    false,
+
+		ScrapeInterval:    "",
+		OrphanGracePeriod: "5m",
+		FailOpenOnAnomaly: false,
+	}
+}
+
+// Validate checks every setting which can be checked without creating anything, and returns all the
+// problems found joined together rather than stopping at the first one
+func (c *Config) Validate() error {
+	_, err := c.validate(true)
+	return err
+}
+
+// settings are the values validate parsed out of a configuration, so New builds the plugin from
+// them without parsing anything a second time
+type settings struct {
+	windowSize        time.Duration
+	pollInterval      time.Duration
+	scrapeInterval    time.Duration
+	initialWindow     time.Duration
+	idleTimeout       time.Duration
+	scaleVerifyDelay  time.Duration
+	orphanGracePeriod time.Duration
+	cooldownPeriod    time.Duration
+	readinessTimeout  time.Duration
+	apiTimeout        time.Duration
+	routerCacheTTL    time.Duration
+	connectTimeout    time.Duration // both zero without metricsTimeouts
+	totalTimeout      time.Duration
+
+	trafficThreshold  float64
+	thresholdRules    []thresholdRule
+	routerMatcher     *regexp.Regexp
+	routerExclusion   *regexp.Regexp
+	cooldownOverrides map[string]time.Duration
+	schedules         []*schedule
+	endpoints         []metricsEndpoint
+	protocols         []string
+	tcpMetric         string
+	activityFamilies  map[string]bool
+	successClasses    string
+	maxStaleWindows   int
+
+	bootstrapDuration   time.Duration
+	bootstrapPercentile float64
+	lockTTL             time.Duration
+	decisionSink        *decisionSink
+}
+
+// validate is Validate, with the cloud config only required when the cloud service is created
+// from it rather than injected.  It also returns the parsed settings, which are only complete
+// when there's no error.
+func (c *Config) validate(needCloudConfig bool) (*settings, error) {
+	var errs []error
+	add := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s := &settings{}
+	var err error
+
+	s.windowSize, err = time.ParseDuration(c.WindowSize)
+	switch {
+	case err != nil:
+		add(fmt.Errorf("invalid window size: %w", err))
+	case s.windowSize < time.Minute && !c.testMode:
+		add(fmt.Errorf("window size must be at least 1 minute, got %v", s.windowSize))
+	}
+	// the intervals are only checked against a window size which parsed
+	windowValid := err == nil
+
+	s.pollInterval, err = parseDuration("poll interval", c.PollInterval)
+	switch {
+	case err != nil:
+		add(err)
+	case c.PollInterval == "":
+	case s.pollInterval <= 0 || (windowValid && s.pollInterval > s.windowSize):
+		add(fmt.Errorf("poll interval must be positive and no longer than the window size, got %v", s.pollInterval))
+	case s.pollInterval < time.Minute && !c.testMode:
+		add(fmt.Errorf("poll interval must be at least 1 minute, got %v", s.pollInterval))
+	}
+	s.scrapeInterval, err = parseDuration("scrape interval", c.ScrapeInterval)
+	switch {
+	case err != nil:
+		add(err)
+	case c.ScrapeInterval == "":
+	case s.scrapeInterval <= 0 || (windowValid && s.scrapeInterval >= s.windowSize):
+		add(fmt.Errorf("scrape interval must be positive and shorter than the window size, got %v", s.scrapeInterval))
+	}
+	s.initialWindow, err = parseDuration("initial window", c.InitialWindow)
+	switch {
+	case err != nil:
+		add(err)
+	case c.InitialWindow == "":
+	case s.initialWindow <= 0 || (windowValid && s.initialWindow >= s.windowSize):
+		add(fmt.Errorf("initial window must be positive and shorter than the window size, got %v", s.initialWindow))
+	}
+	s.idleTimeout, err = parseDuration("idle timeout", c.IdleTimeout)
+	switch {
+	case err != nil:
+		add(err)
+	case c.IdleTimeout != "" && s.idleTimeout <= 0:
+		add(fmt.Errorf("idle timeout must be positive, got %v", s.idleTimeout))
+	}
+	s.scaleVerifyDelay, err = parseDuration("scale verify delay", c.ScaleVerifyDelay)
+	switch {
+	case err != nil:
+		add(err)
+	case c.ScaleVerifyDelay == "":
+	case s.scaleVerifyDelay < 0 || (windowValid && s.scaleVerifyDelay >= s.windowSize):
+		add(fmt.Errorf("scale verify delay must be non-negative and shorter than the window size, got %v", s.scaleVerifyDelay))
+	}
+	s.orphanGracePeriod, err = nonNegativeDuration("orphan grace period", c.OrphanGracePeriod)
+	add(err)
+	s.cooldownPeriod, err = nonNegativeDuration("cooldown period", c.CooldownPeriod)
+	add(err)
+	s.readinessTimeout = defaultReadinessTimeout
+	if c.ReadinessProbe != nil && c.ReadinessProbe.Timeout != "" {
+		s.readinessTimeout, err = parseDuration("readiness probe timeout", c.ReadinessProbe.Timeout)
+		switch {
+		case err != nil:
+			add(err)
+		case s.readinessTimeout <= 0:
+			add(fmt.Errorf("readiness probe timeout must be positive, got %v", s.readinessTimeout))
+		}
+	}
+	s.apiTimeout, err = parseAPITimeout(c.APITimeout)
+	add(err)
+	s.routerCacheTTL, err = parseRouterCacheTTL(c.RouterCacheTTL)
+	add(err)
+	s.cooldownOverrides, err = parseCooldownOverrides(c.CooldownOverrides)
+	add(err)
+	s.schedules, err = parseSchedules(c)
+	add(err)
+	for _, sched := range s.schedules {
+		if sched.windowSize > 0 && s.pollInterval > 0 {
+			add(fmt.Errorf("schedule %s can't change the window size along with a poll interval", sched))
+		}
+		if sched.windowSize > 0 && (s.scrapeInterval >= sched.windowSize || s.scaleVerifyDelay >= sched.windowSize) {
+			add(fmt.Errorf("scrape interval and scale verify delay must be shorter than the window size of schedule %s, got %v", sched, sched.windowSize))
+		}
+	}
+	for _, name := range c.NeverScaleDown {
+		if name == "" {
+			add(errors.New("never scale down can't list an empty service name"))
+			break
+		}
+	}
+	if c.MetricsTimeouts != nil {
+		s.connectTimeout, s.totalTimeout, err = c.MetricsTimeouts.parse()
+		add(err)
+	}
+	switch c.WindowOverlap {
+	case "", windowOverlapQueue, windowOverlapSkip:
+	default:
+		add(fmt.Errorf("unknown window overlap policy %q, expected %s or %s", c.WindowOverlap, windowOverlapQueue, windowOverlapSkip))
+	}
+	s.bootstrapDuration, s.bootstrapPercentile, err = parseBootstrap(c.Bootstrap)
+	add(err)
+
+	s.endpoints, err = parseMetricsEndpoints(c.MetricsURL, c.MetricsAuth)
+	add(err)
+	for _, endpoint := range s.endpoints {
+		add(checkURL("metrics URL", endpoint.url))
+	}
+	add(checkURL("api URL", c.APIURL))
+	if c.APIAuth != nil {
+		if err := c.APIAuth.validate(); err != nil {
+			add(fmt.Errorf("api %w", err))
+		}
+	}
+
+	if c.TrafficThreshold < 0 {
+		add(fmt.Errorf("traffic threshold must be non-negative, got %v", c.TrafficThreshold))
+	}
+	if c.ScaleDownThreshold < 0 {
+		add(fmt.Errorf("scale down threshold must be non-negative, got %v", c.ScaleDownThreshold))
+	}
+	if c.ScaleUpThreshold < 0 {
+		add(fmt.Errorf("scale up threshold must be non-negative, got %v", c.ScaleUpThreshold))
+	}
+	s.trafficThreshold, err = validateThresholds(c)
+	add(err)
+	s.thresholdRules, err = parseThresholdRules(c.RouterFilter)
+	add(err)
+	s.routerMatcher, err = compileRouterFilter(c.RouterFilter)
+	add(err)
+	s.routerExclusion, err = compileRouterExclusion(c.RouterFilter)
+	add(err)
+	if c.Shadow != nil && c.Shadow.TrafficThreshold < 0 {
+		add(fmt.Errorf("shadow traffic threshold must be non-negative, got %v", c.Shadow.TrafficThreshold))
+	}
+
+	if c.SampleWindow < 0 || c.SampleWindow == 1 {
+		add(fmt.Errorf("sample window must be at least 2 samples, got %d", c.SampleWindow))
+	}
+	for label := range c.MetricLabels {
+		if label == "" || label == metricSourceService || label == metricSourceRouter || label == "code" {
+			add(fmt.Errorf("metric labels can't filter on %q", label))
+		}
+	}
+	switch c.MetricSource {
+	case "", metricSourceService, metricSourceRouter:
+	default:
+		add(fmt.Errorf("invalid metric source %q, expected %s or %s", c.MetricSource, metricSourceService, metricSourceRouter))
+	}
+
+	s.protocols, err = parseProtocols(c.Protocols)
+	add(err)
+	if hasProtocol(s.protocols, protocolTCP) && c.MetricSource == metricSourceRouter {
+		add(fmt.Errorf("tcp routers can't be monitored with metric source %s, they don't count requests", metricSourceRouter))
+	}
+	add(validateMetricsType(c))
+	add(validateDurationPolicy(c.RateDuration))
+	add(validateScaleOn(c))
+	s.activityFamilies, err = activityFamilies(c.ActivityMetrics)
+	add(err)
+	for serviceName, metrics := range c.ActivityMetrics {
+		for _, metric := range metrics {
+			if metric.Name == "" {
+				add(fmt.Errorf("activity metric for service %s must have a name", serviceName))
+			}
+			if metric.Threshold < 0 {
+				add(fmt.Errorf("activity metric %s threshold for service %s must be non-negative, got %v", metric.Name, serviceName, metric.Threshold))
+			}
+		}
+	}
+	s.tcpMetric = c.TCPMetric
+	if s.tcpMetric == "" {
+		s.tcpMetric = defaultTCPConnectionsMetric
+	}
+	if gauge, ok := s.activityFamilies[s.tcpMetric]; ok && !gauge && hasProtocol(s.protocols, protocolTCP) {
+		add(fmt.Errorf("tcp connections metric %s is configured as an activity counter", s.tcpMetric))
+	}
+	s.successClasses, err = parseSuccessCodes(c.SuccessCodes)
+	add(err)
+
+	switch c.ScrapeFailurePolicy {
+	case "", scrapeFailureSkip, scrapeFailureReuse, scrapeFailureFailOpen:
+	default:
+		add(fmt.Errorf("unknown scrape failure policy %q, expected %s, %s or %s", c.ScrapeFailurePolicy, scrapeFailureSkip, scrapeFailureReuse, scrapeFailureFailOpen))
+	}
+	s.maxStaleWindows = defaultMaxStaleWindows
+	switch {
+	case c.MaxStaleWindows < 0:
+		add(fmt.Errorf("max stale windows must be at least 1, got %d", c.MaxStaleWindows))
+	case c.MaxStaleWindows > 0:
+		s.maxStaleWindows = c.MaxStaleWindows
+	}
+
+	for serviceName, target := range c.ScaleUpTargets {
+		if target < 1 {
+			add(fmt.Errorf("scale up target for %s must be at least 1, got %d", serviceName, target))
+		}
+	}
+	for serviceName, capacity := range c.InstanceCapacity {
+		if capacity < 0 {
+			add(fmt.Errorf("instance capacity for %s must be non-negative, got %v", serviceName, capacity))
+		}
+	}
+	for serviceName, weight := range c.ServiceWeights {
+		if weight < 0 {
+			add(fmt.Errorf("weight for service %s must be non-negative, got %v", serviceName, weight))
+		}
+	}
+	add(validateDependencies(c.Dependencies))
+
+	if c.SleepingPage != nil && c.SleepingPage.Service == "" {
+		add(errors.New("sleeping page needs a service to serve it"))
+	}
+	switch c.ScaledDownBehavior {
+	case "", scaledDownServe503:
+	case scaledDownLeave, scaledDownRedirect:
+		if c.SleepingPage != nil {
+			add(fmt.Errorf("sleeping page can only be served with scaled down behavior %s", scaledDownServe503))
+		}
+	default:
+		add(fmt.Errorf("unknown scaled down behavior %q, expected %s, %s or %s", c.ScaledDownBehavior, scaledDownLeave, scaledDownServe503, scaledDownRedirect))
+	}
+	if c.ScaledDownBehavior == scaledDownRedirect {
+		target, err := url.Parse(c.ScaledDownRedirect)
+		if err != nil || target.Scheme == "" || target.Host == "" {
+			add(fmt.Errorf("scaled down behavior %s needs an absolute redirect URL, got %q", scaledDownRedirect, c.ScaledDownRedirect))
+		}
+	}
+	if c.ScaledDownTransport != nil {
+		if c.ScaledDownBehavior == scaledDownLeave {
+			add(fmt.Errorf("scaled down transport can't be used with scaled down behavior %s, nothing is rendered", scaledDownLeave))
+		}
+		add(c.ScaledDownTransport.validate())
+	}
+
+	if c.Lock != nil {
+		s.lockTTL, err = parseLockTTL(c.Lock)
+		add(err)
+	}
+	if c.DecisionSink != nil {
+		s.decisionSink, err = newDecisionSink(c.DecisionSink)
+		add(err)
+	}
+
+	if c.CloudConfig == nil {
+		if needCloudConfig {
+			add(errors.New("cloud config is required"))
+		}
+	} else if err := c.CloudConfig.Validate(); err != nil {
+		add(fmt.Errorf("invalid cloud config: %w", err))
+	}
+
+	return s, errors.Join(errs...)
+}
+
+// parseDuration parses an optional duration setting, zero when it's unset
+func parseDuration(name, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return duration, nil
+}
+
+// nonNegativeDuration parses an optional duration setting which can't be negative, zero when it's
+// unset
+func nonNegativeDuration(name, value string) (time.Duration, error) {
+	duration, err := parseDuration(name, value)
+	if err != nil {
+		return 0, err
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("%s must be non-negative, got %v", name, duration)
+	}
+	return duration, nil
+}
+
+// checkURL checks a setting is an absolute http or https URL
+func checkURL(name, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%s must be an absolute http or https URL, got %q", name, parsed.Redacted())
 	}
+	return nil
 }
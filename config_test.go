@@ -0,0 +1,118 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+func TestConfigValidate(t *testing.T) {
+	if err := CreateConfig().Validate(); err != nil {
+		t.Fatalf("Validate() of the default config = %v, want nil", err)
+	}
+
+	config := CreateConfig()
+	config.WindowSize = "often"
+	config.ScaleDownThreshold = -1
+	config.APIURL = "localhost:8080/api"
+	config.MetricsURL = "http://localhost:8080/metrics, ::bad"
+	config.CloudConfig = &common.CloudServiceConfig{Type: "gcp"}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		"invalid window size",
+		"scale down threshold must be non-negative",
+		"api URL must be an absolute http or https URL",
+		"invalid metrics URL",
+		"invalid cloud config: projectID is required",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, want it to report %q", err, want)
+		}
+	}
+
+	// New reports the same problems, before creating anything
+	if _, newErr := New(context.Background(), config, "test"); newErr == nil || !strings.Contains(newErr.Error(), err.Error()) {
+		t.Errorf("New() = %v, want the problems reported by Validate()", newErr)
+	}
+}
+
+func TestConfigValidateCrossField(t *testing.T) {
+	config := CreateConfig()
+	config.WindowSize = "5m"
+	config.PollInterval = "10m"
+	config.ScrapeInterval = "5m"
+	config.InitialWindow = "30s"
+	config.IdleTimeout = "0s"
+	config.SampleWindow = 1
+	config.MetricSource = "host"
+	config.NeverScaleDown = []string{""}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		"poll interval must be positive and no longer than the window size",
+		"scrape interval must be positive and shorter than the window size",
+		"idle timeout must be positive",
+		"sample window must be at least 2 samples",
+		`invalid metric source "host"`,
+		"never scale down can't list an empty service name",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, want it to report %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "initial window") {
+		t.Errorf("Validate() = %v, want the initial window accepted", err)
+	}
+
+	// intervals aren't compared against a window size which doesn't parse
+	config = CreateConfig()
+	config.WindowSize = "often"
+	config.PollInterval = "10m"
+	if err := config.Validate(); err == nil || strings.Contains(err.Error(), "poll interval") {
+		t.Errorf("Validate() = %v, want only the window size reported", err)
+	}
+}
+
+func TestConfigValidateBehaviorSettings(t *testing.T) {
+	config := CreateConfig()
+	config.ScrapeFailurePolicy = "retry"
+	config.MaxStaleWindows = -1
+	config.ScaledDownBehavior = "hide"
+	config.WindowOverlap = "parallel"
+	config.ScaleUpTargets = map[string]int32{"web": -1}
+	config.InstanceCapacity = map[string]float64{"pool": -1}
+	config.ServiceWeights = map[string]float64{"api": -1}
+	config.Dependencies = map[string][]Dependency{"app": {{Probe: "db:5432"}}}
+	config.Shadow = &ShadowConfig{TrafficThreshold: -1}
+	config.Lock = &LockConfig{}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		`unknown scrape failure policy "retry"`,
+		"max stale windows must be at least 1",
+		`unknown scaled down behavior "hide"`,
+		`unknown window overlap policy "parallel"`,
+		"scale up target for web must be at least 1",
+		"instance capacity for pool must be non-negative",
+		"weight for service api must be non-negative",
+		"dependency of service app needs a name",
+		"shadow traffic threshold must be non-negative",
+		"lock dir is required",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v, want it to report %q", err, want)
+		}
+	}
+}
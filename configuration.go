@@ -0,0 +1,229 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+	"github.com/traefik/genconf/dynamic"
+)
+
+const (
+	// configPrefix is prepended to every router/service/middleware name the plugin generates
+	configPrefix = "cloud-saver-"
+
+	// sleepingHeadersMiddleware tags responses served while a backend is scaled down
+	sleepingHeadersMiddleware = configPrefix + "sleeping-headers"
+
+	// sleepingPageMiddleware replaces the bare 503 of a sleeping service with the sleeping page
+	sleepingPageMiddleware = configPrefix + "sleeping-page"
+
+	// sleepingRedirectMiddleware sends the requests for a sleeping service elsewhere
+	sleepingRedirectMiddleware = configPrefix + "sleeping-redirect"
+)
+
+// What the configuration does with the router of a scaled down service
+const (
+	scaledDownLeave    = "leave"     // nothing, the original router keeps proxying to the stopped backend
+	scaledDownServe503 = "serve-503" // a shadow router answers 503, with the sleeping page when there is one
+	scaledDownRedirect = "redirect"  // a shadow router redirects to scaledDownRedirectURL
+)
+
+// SleepingPage is a page served in place of the bare 503 while a service is scaled down, e.g. one
+// saying the service is waking up
+type SleepingPage struct {
+	Service string `json:"service"`         // traefik service serving the page, e.g. maintenance@file
+	Query   string `json:"query,omitempty"` // path requested from it, default /
+}
+
+// sleepingService is a Traefik service whose cloud backend has been scaled down to zero
+type sleepingService struct {
+	serviceName string   // traefik service name, e.g. whoami@docker
+	routerNames []string // traefik routers in front of the service, each shadowed while it sleeps
+	cloudName   string   // cloud instance/service name
+	since       time.Time
+}
+
+// applyBatch merges one window's worth of scale decisions into the set of sleeping services and
+// renders a single configuration covering all of them.  The sleeping set is only committed once the
+// configuration has been built successfully, so a failure never leaves a half-applied state behind.
+func (p *CloudSaver) applyBatch(ctx context.Context, scaledDown map[string]*sleepingService, awake map[string]bool) (*dynamic.JSONPayload, error) {
+	next := make(map[string]*sleepingService, len(p.sleeping)+len(scaledDown))
+	for name, svc := range p.sleeping {
+		if !awake[name] {
+			next[name] = svc
+		}
+	}
+	for name, svc := range scaledDown {
+		if _, exists := next[name]; !exists {
+			next[name] = svc
+		}
+	}
+
+	// drop anything that was brought back up outside of the plugin
+	for name, svc := range next {
+		if scale, err := p.cloudService.GetCurrentScale(ctx, svc.cloudName); err == nil && scale > 0 {
+			common.DebugLog("traefik-cloud-saver", "service %s is running again (scale %d), no longer sleeping", name, scale)
+			delete(next, name)
+		}
+	}
+
+	configuration, err := p.buildConfiguration(ctx, next)
+	if err != nil {
+		return nil, err
+	}
+
+	p.sleeping = next
+	return configuration, nil
+}
+
+// buildConfiguration renders the dynamic configuration for the given sleeping services.  Each
+// sleeping service gets a router shadowing its original router (same rule, TLS settings and
+// middlewares, higher priority) which answers with a 503 from an empty load balancer instead of proxying to the dead backend, and with
+// the sleeping page as its body when one is configured, or redirects to scaledDownRedirectURL.  With
+// the leave behavior nothing is rendered.  A service scaled back up simply isn't rendered, which
+// drops its router and middlewares.
+func (p *CloudSaver) buildConfiguration(ctx context.Context, sleeping map[string]*sleepingService) (*dynamic.JSONPayload, error) {
+	payload := emptyConfiguration()
+	if len(sleeping) == 0 || p.scaledDownBehavior == scaledDownLeave {
+		return payload, nil
+	}
+
+	routers, err := p.listRouters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build configuration: %w", err)
+	}
+
+	middlewares := []string{sleepingHeadersMiddleware}
+	switch {
+	case p.scaledDownBehavior == scaledDownRedirect:
+		middlewares = append(middlewares, sleepingRedirectMiddleware)
+	case p.sleepingPage != nil:
+		middlewares = append(middlewares, sleepingPageMiddleware)
+	}
+
+	httpConfig := payload.Configuration.HTTP
+	for _, svc := range sleeping {
+		serviceName := sleepingServiceName(svc.cloudName)
+		for _, routerName := range svc.routerNames {
+			router, ok := routers[routerName]
+			if !ok {
+				common.LogProvider("traefik-cloud-saver", "[WARNING] router %s for sleeping service %s not found, skipping", routerName, svc.serviceName)
+				p.invalidateRouters("router " + routerName + " not found")
+				continue
+			}
+			if router.Protocol == protocolTCP {
+				// no http router can stand in for it, connections simply fail while the service sleeps
+				common.DebugLog("traefik-cloud-saver", "not shadowing tcp router %s of sleeping service %s", routerName, svc.serviceName)
+				continue
+			}
+
+			httpConfig.Routers[configPrefix+stripProvider(router.Name)] = &dynamic.Router{
+				EntryPoints: router.EntryPoints,
+				Rule:        router.Rule,
+				Priority:    shadowPriority(router),
+				Middlewares: shadowMiddlewares(router, middlewares),
+				Service:     serviceName,
+				TLS:         shadowTLS(router),
+			}
+			httpConfig.Services[serviceName] = &dynamic.Service{
+				LoadBalancer: &dynamic.ServersLoadBalancer{
+					Servers: []dynamic.Server{},
+				},
+			}
+		}
+	}
+
+	p.addTransport(httpConfig)
+	if len(httpConfig.Routers) > 0 {
+		httpConfig.Middlewares[sleepingHeadersMiddleware] = &dynamic.Middleware{
+			Headers: &dynamic.Headers{
+				CustomResponseHeaders: map[string]string{"X-Cloud-Saver": "sleeping"},
+			},
+		}
+		if p.scaledDownBehavior == scaledDownRedirect {
+			httpConfig.Middlewares[sleepingRedirectMiddleware] = &dynamic.Middleware{
+				RedirectRegex: &dynamic.RedirectRegex{
+					Regex:       "^.*$",
+					Replacement: p.scaledDownRedirectURL,
+				},
+			}
+		} else if p.sleepingPage != nil {
+			query := p.sleepingPage.Query
+			if query == "" {
+				query = "/"
+			}
+			httpConfig.Middlewares[sleepingPageMiddleware] = &dynamic.Middleware{
+				Errors: &dynamic.ErrorPage{
+					Status:  []string{"503"},
+					Service: p.sleepingPage.Service,
+					Query:   query,
+				},
+			}
+		}
+	}
+
+	return payload, nil
+}
+
+// sleepingServiceName is the name of the generated service answering for a sleeping cloud service
+func sleepingServiceName(cloudName string) string {
+	return configPrefix + "sleeping-" + cloudName
+}
+
+// isGeneratedService reports whether a traefik service was generated by this plugin
+func isGeneratedService(serviceName string) bool {
+	return strings.HasPrefix(serviceName, configPrefix)
+}
+
+// shadowPriority returns a priority that wins over the original router.  Traefik defaults a
+// router's priority to the length of its rule when none is set.
+func shadowPriority(router *TraefikRouter) int {
+	if router.Priority > 0 {
+		return router.Priority + 1
+	}
+	return len(router.Rule) + 1
+}
+
+// shadowMiddlewares returns the middlewares of a shadow router: the original router's own chain,
+// e.g. its auth or headers, so requests are handled the same way before the sleeping service's
+func shadowMiddlewares(router *TraefikRouter, sleeping []string) []string {
+	chain := make([]string, 0, len(router.Middlewares)+len(sleeping))
+	for _, name := range router.Middlewares {
+		chain = append(chain, qualifyName(name, router.Provider))
+	}
+	return append(chain, sleeping...)
+}
+
+// shadowTLS returns the TLS settings of a shadow router, those of the original router so it
+// matches the same requests on an HTTPS entry point, or nil when the original doesn't terminate TLS.
+// TLS options are looked up in the original router's provider, unless they're the default ones.
+func shadowTLS(router *TraefikRouter) *dynamic.RouterTLSConfig {
+	if router.TLS == nil {
+		return nil
+	}
+	tls := *router.TLS
+	if tls.Options != "" && tls.Options != "default" {
+		tls.Options = qualifyName(tls.Options, router.Provider)
+	}
+	return &tls
+}
+
+// qualifyName adds a provider to the name of a Traefik object, unless it already has one.  Names
+// in the plugin's configuration would otherwise be looked up in the plugin's own provider.
+func qualifyName(name, provider string) string {
+	if provider == "" || strings.Contains(name, "@") {
+		return name
+	}
+	return name + "@" + provider
+}
+
+// stripProvider removes the @provider suffix from a Traefik object name
+func stripProvider(name string) string {
+	if at := strings.Index(name, "@"); at != -1 {
+		return name[:at]
+	}
+	return name
+}
@@ -0,0 +1,369 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/traefik/genconf/dynamic"
+	"github.com/traefik/genconf/dynamic/types"
+)
+
+func TestBatchedConfiguration(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("svc1@docker", "r1@docker")
+	backend.addService("svc2@docker", "r2@docker")
+	backend.addService("busy@docker", "busy@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="svc1@docker"} 0
+traefik_service_requests_total{service="svc2@docker"} 0
+traefik_service_requests_total{service="busy@docker"} 100
+`, "")
+
+	saver, cloud := newTestSaver(t, backend, map[string]int32{"svc1": 1, "svc2": 1, "busy": 1}, nil)
+
+	payload, err := saver.generateConfiguration(context.Background())
+	if err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	httpConfig := payload.Configuration.HTTP
+	if len(httpConfig.Routers) != 2 {
+		t.Fatalf("expected 2 routers in a single configuration, got %d: %v", len(httpConfig.Routers), httpConfig.Routers)
+	}
+	if len(httpConfig.Services) != 2 {
+		t.Errorf("expected 2 services, got %d", len(httpConfig.Services))
+	}
+	if _, ok := httpConfig.Middlewares[sleepingHeadersMiddleware]; !ok {
+		t.Errorf("expected middleware %s, got %v", sleepingHeadersMiddleware, httpConfig.Middlewares)
+	}
+
+	for _, name := range []string{"r1", "r2"} {
+		router, ok := httpConfig.Routers[configPrefix+name]
+		if !ok {
+			t.Errorf("expected router %s", configPrefix+name)
+			continue
+		}
+		wantRule := "Host(`" + name + ".localhost`)"
+		if router.Rule != wantRule {
+			t.Errorf("router %s rule = %s, want %s", name, router.Rule, wantRule)
+		}
+		if router.Priority <= len(wantRule) {
+			t.Errorf("router %s priority %d does not override the original", name, router.Priority)
+		}
+		if _, ok := httpConfig.Services[router.Service]; !ok {
+			t.Errorf("router %s points at missing service %s", name, router.Service)
+		}
+		if len(router.Middlewares) != 1 || router.Middlewares[0] != sleepingHeadersMiddleware {
+			t.Errorf("router %s middlewares = %v", name, router.Middlewares)
+		}
+	}
+	if _, ok := httpConfig.Routers[configPrefix+"busy"]; ok {
+		t.Error("busy service should not be shadowed")
+	}
+
+	// svc1 is brought back up outside of the plugin and gets traffic, it should drop out of the
+	// next configuration
+	cloud.SetScale("svc1", 1)
+	backend.setMetrics(`
+traefik_service_requests_total{service="svc1@docker"} 100
+traefik_service_requests_total{service="busy@docker"} 200
+`, "")
+
+	payload, err = saver.generateConfiguration(context.Background())
+	if err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	routers := payload.Configuration.HTTP.Routers
+	if len(routers) != 1 {
+		t.Fatalf("expected 1 router after svc1 woke up, got %d: %v", len(routers), routers)
+	}
+	if _, ok := routers[configPrefix+"r2"]; !ok {
+		t.Errorf("expected svc2 to still be sleeping, got %v", routers)
+	}
+}
+
+func TestBatchedConfigurationIsTransactional(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("svc1@docker", "r1@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="svc1@docker"} 0`, "")
+
+	saver, _ := newTestSaver(t, backend, map[string]int32{"svc1": 1}, func(c *Config) {
+		c.RouterCacheTTL = "0s" // the routers are listed for every configuration
+	})
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if len(saver.sleeping) != 1 {
+		t.Fatalf("expected 1 sleeping service, got %d", len(saver.sleeping))
+	}
+
+	// the API goes away, the configuration can't be assembled so nothing should be committed or emitted
+	saver.apiURL = "http://127.0.0.1:1/api"
+	payload, err := saver.generateConfiguration(context.Background())
+	if err == nil {
+		t.Fatalf("expected an error, got configuration %v", payload)
+	}
+	if len(saver.sleeping) != 1 {
+		t.Errorf("sleeping set should be left untouched, got %d entries", len(saver.sleeping))
+	}
+}
+
+func TestShadowRouterTLS(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("secure@docker", "secure@docker")
+	backend.addService("plain@docker", "plain@docker")
+	backend.routers[0].EntryPoints = []string{"websecure"}
+	backend.routers[0].TLS = &dynamic.RouterTLSConfig{
+		CertResolver: "letsencrypt",
+		Options:      "modern",
+		Domains:      []types.Domain{{Main: "secure.localhost"}},
+	}
+	backend.setMetrics(`
+traefik_service_requests_total{service="secure@docker"} 0
+traefik_service_requests_total{service="plain@docker"} 0
+`, "")
+
+	saver, _ := newTestSaver(t, backend, map[string]int32{"secure": 1, "plain": 1}, nil)
+	payload, err := saver.generateConfiguration(context.Background())
+	if err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	// the shadow router matches the same requests on the HTTPS entry point as the original
+	secure := payload.Configuration.HTTP.Routers[configPrefix+"secure"]
+	if secure == nil {
+		t.Fatalf("expected a shadow router for secure, got %v", payload.Configuration.HTTP.Routers)
+	}
+	want := &dynamic.RouterTLSConfig{
+		CertResolver: "letsencrypt",
+		Options:      "modern@docker",
+		Domains:      []types.Domain{{Main: "secure.localhost"}},
+	}
+	if !reflect.DeepEqual(secure.TLS, want) {
+		t.Errorf("shadow router TLS = %+v, want %+v", secure.TLS, want)
+	}
+	if !reflect.DeepEqual(secure.EntryPoints, []string{"websecure"}) {
+		t.Errorf("shadow router entry points = %v", secure.EntryPoints)
+	}
+
+	if plain := payload.Configuration.HTTP.Routers[configPrefix+"plain"]; plain == nil || plain.TLS != nil {
+		t.Errorf("expected a shadow router without TLS for plain, got %+v", plain)
+	}
+}
+
+func TestShadowRouterMiddlewares(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("private@docker", "private@docker")
+	backend.routers[0].Middlewares = []string{"auth@file", "security-headers"}
+	backend.setMetrics(`traefik_service_requests_total{service="private@docker"} 0`, "")
+
+	saver, _ := newTestSaver(t, backend, map[string]int32{"private": 1}, func(c *Config) {
+		c.SleepingPage = &SleepingPage{Service: "maintenance@file"}
+	})
+	payload, err := saver.generateConfiguration(context.Background())
+	if err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	// requests still go through the original router's auth before being told the service sleeps
+	router := payload.Configuration.HTTP.Routers[configPrefix+"private"]
+	if router == nil {
+		t.Fatalf("expected a shadow router for private, got %v", payload.Configuration.HTTP.Routers)
+	}
+	want := []string{"auth@file", "security-headers@docker", sleepingHeadersMiddleware, sleepingPageMiddleware}
+	if !reflect.DeepEqual(router.Middlewares, want) {
+		t.Errorf("shadow router middlewares = %v, want %v", router.Middlewares, want)
+	}
+}
+
+func TestShadowTLSOptions(t *testing.T) {
+	tests := []struct {
+		options string
+		want    string
+	}{
+		{options: "", want: ""},
+		{options: "default", want: "default"},
+		{options: "modern", want: "modern@docker"},
+		{options: "modern@file", want: "modern@file"},
+	}
+
+	for _, tt := range tests {
+		router := &TraefikRouter{Provider: "docker", TLS: &dynamic.RouterTLSConfig{Options: tt.options}}
+		if got := shadowTLS(router).Options; got != tt.want {
+			t.Errorf("shadowTLS(%q).Options = %q, want %q", tt.options, got, tt.want)
+		}
+	}
+	if router := (&TraefikRouter{Provider: "docker"}); shadowTLS(router) != nil {
+		t.Error("expected no TLS for a router without it")
+	}
+}
+
+func TestShadowPriority(t *testing.T) {
+	tests := []struct {
+		name   string
+		router *TraefikRouter
+		want   int
+	}{
+		{name: "default priority", router: &TraefikRouter{Rule: "Host(`a`)"}, want: 10},
+		{name: "explicit priority", router: &TraefikRouter{Rule: "Host(`a`)", Priority: 100}, want: 101},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shadowPriority(tt.router); got != tt.want {
+				t.Errorf("shadowPriority() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildConfigurationEmpty(t *testing.T) {
+	saver := &CloudSaver{}
+	payload, err := saver.buildConfiguration(context.Background(), map[string]*sleepingService{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Configuration.HTTP.Routers) != 0 || len(payload.Configuration.HTTP.Middlewares) != 0 {
+		t.Errorf("expected empty configuration, got %v", payload.Configuration.HTTP)
+	}
+}
+
+func TestSleepingPage(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("svc1@docker", "r1@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="svc1@docker"} 0`, "")
+
+	saver, cloud := newTestSaver(t, backend, map[string]int32{"svc1": 1}, func(c *Config) {
+		c.SleepingPage = &SleepingPage{Service: "maintenance@file"}
+	})
+
+	payload, err := saver.generateConfiguration(context.Background())
+	if err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	httpConfig := payload.Configuration.HTTP
+	router, ok := httpConfig.Routers[configPrefix+"r1"]
+	if !ok {
+		t.Fatalf("expected a sleeping router, got %v", httpConfig.Routers)
+	}
+	if len(router.Middlewares) != 2 || router.Middlewares[1] != sleepingPageMiddleware {
+		t.Errorf("router middlewares = %v, want the sleeping page after the headers", router.Middlewares)
+	}
+	page, ok := httpConfig.Middlewares[sleepingPageMiddleware]
+	if !ok || page.Errors == nil {
+		t.Fatalf("expected an errors middleware %s, got %v", sleepingPageMiddleware, httpConfig.Middlewares)
+	}
+	if page.Errors.Service != "maintenance@file" || page.Errors.Query != "/" || len(page.Errors.Status) != 1 || page.Errors.Status[0] != "503" {
+		t.Errorf("sleeping page middleware = %+v", page.Errors)
+	}
+
+	// scaled back up, the router and its middlewares are gone from the next configuration
+	cloud.SetScale("svc1", 1)
+	backend.setMetrics(`traefik_service_requests_total{service="svc1@docker"} 100`, "")
+	payload, err = saver.generateConfiguration(context.Background())
+	if err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if httpConfig := payload.Configuration.HTTP; len(httpConfig.Routers) != 0 || len(httpConfig.Middlewares) != 0 {
+		t.Errorf("expected an empty configuration once awake, got routers %v middlewares %v", httpConfig.Routers, httpConfig.Middlewares)
+	}
+}
+
+func TestSleepingPageValidation(t *testing.T) {
+	config := CreateConfig()
+	config.SleepingPage = &SleepingPage{Query: "/sleeping.html"}
+	if err := config.Validate(); err == nil {
+		t.Error("expected an error for a sleeping page without a service")
+	}
+}
+
+func TestScaledDownBehavior(t *testing.T) {
+	tests := []struct {
+		name        string
+		behavior    string
+		middlewares []string
+	}{
+		{name: "default serves a 503", middlewares: []string{sleepingHeadersMiddleware}},
+		{name: "serve-503", behavior: scaledDownServe503, middlewares: []string{sleepingHeadersMiddleware}},
+		{name: "redirect", behavior: scaledDownRedirect, middlewares: []string{sleepingHeadersMiddleware, sleepingRedirectMiddleware}},
+		{name: "leave", behavior: scaledDownLeave},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			backend.addService("svc1@docker", "r1@docker")
+			backend.setMetrics(`traefik_service_requests_total{service="svc1@docker"} 0`, "")
+
+			saver, cloud := newTestSaver(t, backend, map[string]int32{"svc1": 1}, func(c *Config) {
+				c.ScaledDownBehavior = tt.behavior
+				c.ScaledDownRedirect = "https://status.example.com/sleeping"
+			})
+			if err := saver.Init(); err != nil {
+				t.Fatalf("Init() failed: %v", err)
+			}
+
+			payload, err := saver.generateConfiguration(context.Background())
+			if err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+			if scale := currentScale(t, cloud, "svc1"); scale != 0 {
+				t.Fatalf("expected svc1 to be scaled down, got scale %d", scale)
+			}
+			if _, ok := saver.sleeping["svc1@docker"]; !ok {
+				t.Error("expected svc1 to be tracked as sleeping")
+			}
+
+			httpConfig := payload.Configuration.HTTP
+			router, ok := httpConfig.Routers[configPrefix+"r1"]
+			if tt.middlewares == nil {
+				if ok || len(httpConfig.Middlewares) != 0 {
+					t.Errorf("expected the original router to be left alone, got routers %v middlewares %v", httpConfig.Routers, httpConfig.Middlewares)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("expected a sleeping router, got %v", httpConfig.Routers)
+			}
+			if !reflect.DeepEqual(router.Middlewares, tt.middlewares) {
+				t.Errorf("router middlewares = %v, want %v", router.Middlewares, tt.middlewares)
+			}
+			if tt.behavior == scaledDownRedirect {
+				redirect, ok := httpConfig.Middlewares[sleepingRedirectMiddleware]
+				if !ok || redirect.RedirectRegex == nil || redirect.RedirectRegex.Replacement != "https://status.example.com/sleeping" {
+					t.Errorf("expected a redirect to the status page, got %+v", redirect)
+				}
+			}
+		})
+	}
+}
+
+func TestScaledDownBehaviorValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*Config)
+	}{
+		{name: "unknown behavior", configure: func(c *Config) { c.ScaledDownBehavior = "hide" }},
+		{name: "redirect without a URL", configure: func(c *Config) { c.ScaledDownBehavior = scaledDownRedirect }},
+		{name: "redirect to a relative URL", configure: func(c *Config) {
+			c.ScaledDownBehavior = scaledDownRedirect
+			c.ScaledDownRedirect = "/status"
+		}},
+		{name: "sleeping page with leave", configure: func(c *Config) {
+			c.ScaledDownBehavior = scaledDownLeave
+			c.SleepingPage = &SleepingPage{Service: "maintenance@file"}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			tt.configure(config)
+			if err := config.Validate(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package traefik_cloud_saver
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// parseCooldownOverrides parses the per cloud service cooldown periods
+func parseCooldownOverrides(overrides map[string]string) (map[string]time.Duration, error) {
+	periods := make(map[string]time.Duration, len(overrides))
+	for cloudServiceName, override := range overrides {
+		period, err := time.ParseDuration(override)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cooldown period for service %s: %w", cloudServiceName, err)
+		}
+		if period < 0 {
+			return nil, fmt.Errorf("cooldown period for service %s must be non-negative, got %v", cloudServiceName, period)
+		}
+		periods[cloudServiceName] = period
+	}
+	return periods, nil
+}
+
+// cooldownFor returns the cooldown period of a cloud service, its override if it has one, then the
+// schedule's if it sets one
+func (p *CloudSaver) cooldownFor(cloudServiceName string) time.Duration {
+	if period, ok := p.cooldownOverrides[cloudServiceName]; ok {
+		return period
+	}
+	if p.schedule != nil && p.schedule.cooldownPeriod != nil {
+		return *p.schedule.cooldownPeriod
+	}
+	return p.cooldownPeriod
+}
+
+// recordAction notes when a cloud service was last scaled, starting its cooldown
+func (p *CloudSaver) recordAction(cloudServiceName string) {
+	if p.cooldownFor(cloudServiceName) > 0 {
+		p.lastActionTime[cloudServiceName] = p.clock.Now()
+	}
+}
+
+// isSleeping reports whether a cloud service is already scaled down by the plugin, scaling it
+// down again only re-asserts its scale and isn't a new action
+func (p *CloudSaver) isSleeping(cloudServiceName string) bool {
+	for _, svc := range p.sleeping {
+		if svc.cloudName == cloudServiceName {
+			return true
+		}
+	}
+	return false
+}
+
+// sleepingMembers returns the traefik services sleeping on a cloud service, sorted, or the given
+// fallback name when none are
+func (p *CloudSaver) sleepingMembers(cloudServiceName, fallback string) []string {
+	var members []string
+	for serviceName, svc := range p.sleeping {
+		if svc.cloudName == cloudServiceName {
+			members = append(members, serviceName)
+		}
+	}
+	if len(members) == 0 {
+		return []string{fallback}
+	}
+	sort.Strings(members)
+	return members
+}
+
+// inCooldown reports whether a scale action on a cloud service must be suppressed because it was
+// scaled less than its cooldown period ago, logging the suppressed action
+func (p *CloudSaver) inCooldown(cloudServiceName, action string) bool {
+	period := p.cooldownFor(cloudServiceName)
+	if period <= 0 {
+		return false
+	}
+	last, ok := p.lastActionTime[cloudServiceName]
+	if !ok {
+		return false
+	}
+	remaining := period - since(p.clock, last)
+	if remaining <= 0 {
+		delete(p.lastActionTime, cloudServiceName)
+		return false
+	}
+	common.LogProvider("traefik-cloud-saver", "Suppressing %s of service %s, in cooldown for another %v", action, cloudServiceName, remaining.Round(time.Second))
+	return true
+}
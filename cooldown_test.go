@@ -0,0 +1,132 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCooldownPeriod(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	serverErrors := 0
+	setErrors := func() {
+		backend.setMetrics(fmt.Sprintf(`
+traefik_service_requests_total{service="idle@docker",code="200"} 0
+traefik_service_requests_total{service="idle@docker",code="503"} %d
+`, serverErrors), "")
+	}
+	setErrors()
+
+	clock := &stepClock{now: time.Now()}
+	saver, svc := newTestSaver(t, backend, map[string]int32{"idle": 1}, func(c *Config) {
+		c.WakeOnServerErrors = true
+		c.CooldownPeriod = "30m"
+	}, WithClock(clock))
+	window := func(elapsed time.Duration) {
+		t.Helper()
+		clock.now = clock.now.Add(elapsed)
+		if _, err := saver.generateConfiguration(context.Background()); err != nil {
+			t.Fatalf("generateConfiguration() failed: %v", err)
+		}
+	}
+
+	window(0)
+	if scale := currentScale(t, svc, "idle"); scale != 0 {
+		t.Fatalf("expected idle to be scaled down, got scale %d", scale)
+	}
+
+	// requests fail on the sleeping service, but it was only just scaled down
+	serverErrors += 3
+	setErrors()
+	window(10 * time.Minute)
+	if scale := currentScale(t, svc, "idle"); scale != 0 {
+		t.Errorf("expected the cooldown to suppress the scale up, got scale %d", scale)
+	}
+	if got := saver.decisions.count("idle@docker", actionKeep, reasonCooldown); got != 1 {
+		t.Errorf("expected 1 cooldown decision, got %d", got)
+	}
+
+	serverErrors += 3
+	setErrors()
+	window(25 * time.Minute)
+	if scale := currentScale(t, svc, "idle"); scale != 1 {
+		t.Errorf("expected idle to be scaled up once the cooldown passed, got scale %d", scale)
+	}
+}
+
+func TestCooldownOverrides(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("heavy@docker", "heavy@docker")
+	backend.addService("light@docker", "light@docker")
+	serverErrors := 0
+	setErrors := func() {
+		backend.setMetrics(fmt.Sprintf(`
+traefik_service_requests_total{service="heavy@docker",code="200"} 0
+traefik_service_requests_total{service="heavy@docker",code="503"} %d
+traefik_service_requests_total{service="light@docker",code="200"} 0
+traefik_service_requests_total{service="light@docker",code="503"} %d
+`, serverErrors, serverErrors), "")
+	}
+	setErrors()
+
+	clock := &stepClock{now: time.Now()}
+	saver, svc := newTestSaver(t, backend, map[string]int32{"heavy": 1, "light": 1}, func(c *Config) {
+		c.WakeOnServerErrors = true
+		c.CooldownPeriod = "10m"
+		c.CooldownOverrides = map[string]string{"heavy": "1h"}
+	}, WithClock(clock))
+	window := func(elapsed time.Duration) {
+		t.Helper()
+		clock.now = clock.now.Add(elapsed)
+		serverErrors += 3
+		setErrors()
+		if _, err := saver.generateConfiguration(context.Background()); err != nil {
+			t.Fatalf("generateConfiguration() failed: %v", err)
+		}
+	}
+
+	window(0)
+	if scale := currentScale(t, svc, "heavy"); scale != 0 {
+		t.Fatalf("expected heavy to be scaled down, got scale %d", scale)
+	}
+
+	// past the global cooldown, only light may be woken up
+	window(20 * time.Minute)
+	if scale := currentScale(t, svc, "light"); scale != 1 {
+		t.Errorf("expected light to be scaled up after the global cooldown, got scale %d", scale)
+	}
+	if scale := currentScale(t, svc, "heavy"); scale != 0 {
+		t.Errorf("expected heavy's longer cooldown to suppress the scale up, got scale %d", scale)
+	}
+
+	window(time.Hour)
+	if scale := currentScale(t, svc, "heavy"); scale != 1 {
+		t.Errorf("expected heavy to be scaled up once its cooldown passed, got scale %d", scale)
+	}
+}
+
+func TestCooldownPeriodValidation(t *testing.T) {
+	for _, period := range []string{"soon", "-1m"} {
+		config := CreateConfig()
+		config.WindowSize = "1s"
+		config.testMode = true
+		config.CooldownPeriod = period
+		if _, err := New(context.Background(), config, "test"); err == nil {
+			t.Errorf("expected error for cooldown period %q", period)
+		}
+	}
+}
+
+func TestCooldownOverridesValidation(t *testing.T) {
+	for _, period := range []string{"soon", "-1m"} {
+		config := CreateConfig()
+		config.WindowSize = "1s"
+		config.testMode = true
+		config.CooldownOverrides = map[string]string{"svc": period}
+		if _, err := New(context.Background(), config, "test"); err == nil {
+			t.Errorf("expected error for cooldown override %q", period)
+		}
+	}
+}
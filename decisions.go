@@ -0,0 +1,154 @@
+package traefik_cloud_saver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// decision actions
+const (
+	actionScaleDown = "scale_down"
+	actionScaleUp   = "scale_up"
+	actionKeep      = "keep"
+	actionSkip      = "skip"
+)
+
+// decision reasons
+const (
+	reasonBelowThreshold = "below_threshold"
+	reasonAboveThreshold = "above_threshold"
+	reasonFiltered       = "filtered"
+	reasonWarmup         = "warmup"
+	reasonInstancePolicy = "instance_policy"
+	reasonServerErrors   = "server_errors"
+	reasonAnomaly        = "anomaly"
+	reasonOrphaned       = "orphaned"
+	reasonError          = "error"
+	reasonBootstrap      = "bootstrap"
+	reasonLocked         = "locked"
+	reasonTransitioning  = "transitioning"
+	reasonLatched        = "latched"
+	reasonCooldown       = "cooldown"
+	reasonDryRun         = "dry_run"
+	reasonWakeRequest    = "wake_request"
+	reasonCapacity       = "capacity"
+	reasonDependency     = "dependency_unhealthy"
+	reasonNeverScaleDown = "never_scale_down"
+	reasonAsleep         = "asleep" // already scaled down, the scale down is only re-asserted
+	reasonQuarantined    = "quarantined"
+	reasonNotDiscovered  = "not_discovered" // the cloud service doesn't carry the resourceTags
+)
+
+// decisionsMetric is the name of the counter exposing scale decisions
+const decisionsMetric = "cloudsaver_decisions_total"
+
+type decisionKey struct {
+	service string
+	action  string
+	reason  string
+}
+
+// decisionMetrics counts the decisions made for each service, and why.  It serves the counters
+// in the Prometheus text format so they can be graphed alongside the Traefik metrics.
+type decisionMetrics struct {
+	mu     sync.Mutex
+	counts map[decisionKey]uint64
+}
+
+func newDecisionMetrics() *decisionMetrics {
+	return &decisionMetrics{counts: make(map[decisionKey]uint64)}
+}
+
+// record counts one decision
+func (m *decisionMetrics) record(service, action, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counts[decisionKey{service: service, action: action, reason: reason}]++
+}
+
+// count returns the current value of a counter
+func (m *decisionMetrics) count(service, action, reason string) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counts[decisionKey{service: service, action: action, reason: reason}]
+}
+
+func (m *decisionMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	keys := make([]decisionKey, 0, len(m.counts))
+	for key := range m.counts {
+		keys = append(keys, key)
+	}
+	counts := make(map[decisionKey]uint64, len(m.counts))
+	for key, count := range m.counts {
+		counts[key] = count
+	}
+	m.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].service != keys[j].service {
+			return keys[i].service < keys[j].service
+		}
+		if keys[i].action != keys[j].action {
+			return keys[i].action < keys[j].action
+		}
+		return keys[i].reason < keys[j].reason
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprintf(w, "# HELP %s Scale decisions made by cloud saver, by service, action and reason.\n", decisionsMetric)
+	fmt.Fprintf(w, "# TYPE %s counter\n", decisionsMetric)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s{service=\"%s\",action=\"%s\",reason=\"%s\"} %d\n",
+			decisionsMetric, escapeLabelValue(key.service), key.action, key.reason, counts[key])
+	}
+}
+
+// escapeLabelValue escapes a Prometheus label value
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// startSelfMetrics serves the plugin's own metrics, a health snapshot, the effective configuration
+// and, with debugParsedCounts, the last parsed scrapes, on the configured address if any
+func (p *CloudSaver) startSelfMetrics() error {
+	if p.selfMetricsAddress == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", p.selfMetricsAddress)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s for self metrics: %w", p.selfMetricsAddress, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		p.decisions.ServeHTTP(w, r)
+		p.idleGauges.writeTo(w)
+		p.actions.writeTo(w, p.metricsCollector.ScrapeErrors())
+		writeBuildInfo(w)
+	})
+	mux.Handle("/health", p.health)
+	mux.HandleFunc("/config", p.serveEffectiveConfig)
+	if p.metricsCollector.parsed != nil {
+		mux.HandleFunc("/debug/parsed", p.serveParsedScrapes)
+	}
+	p.selfMetricsServer = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	p.selfMetricsListener = listener
+
+	go func() {
+		if err := p.selfMetricsServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			common.LogProvider("traefik-cloud-saver", "[ERROR]: self metrics server stopped: %v", err)
+		}
+	}()
+
+	common.LogProvider("traefik-cloud-saver", "Serving self metrics on %s/metrics", listener.Addr())
+	return nil
+}
@@ -0,0 +1,106 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrapeDecisions fetches the decision counters from a self metrics endpoint
+func scrapeDecisions(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("failed to scrape %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestDecisionCounters(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.addService("busy@docker", "busy@docker")
+	backend.addService("other@docker", "other@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="idle@docker"} 0
+traefik_service_requests_total{service="busy@docker"} 100
+traefik_service_requests_total{service="other@docker"} 0
+`, "")
+
+	saver, _ := newTestSaver(t, backend, map[string]int32{"idle": 1, "busy": 1, "other": 1}, func(c *Config) {
+		c.RouterFilter = &RouterFilter{Names: []string{"idle@docker", "busy@docker"}}
+	})
+
+	server := httptest.NewServer(saver.decisions)
+	defer server.Close()
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	body := scrapeDecisions(t, server.URL)
+	for _, want := range []string{
+		"# TYPE cloudsaver_decisions_total counter",
+		`cloudsaver_decisions_total{service="idle@docker",action="scale_down",reason="below_threshold"} 1`,
+		`cloudsaver_decisions_total{service="busy@docker",action="keep",reason="above_threshold"} 1`,
+		`cloudsaver_decisions_total{service="other@docker",action="skip",reason="filtered"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in scrape:\n%s", want, body)
+		}
+	}
+
+	// the next window increments the counters
+	backend.setMetrics(`
+traefik_service_requests_total{service="idle@docker"} 0
+traefik_service_requests_total{service="busy@docker"} 200
+traefik_service_requests_total{service="other@docker"} 0
+`, "")
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	body = scrapeDecisions(t, server.URL)
+	for _, want := range []string{
+		`cloudsaver_decisions_total{service="busy@docker",action="keep",reason="above_threshold"} 2`,
+		`cloudsaver_decisions_total{service="other@docker",action="skip",reason="filtered"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in scrape:\n%s", want, body)
+		}
+	}
+}
+
+func TestSelfMetricsServer(t *testing.T) {
+	saver, _ := newTestSaver(t, newTestBackend(t), map[string]int32{"svc1": 1}, func(c *Config) {
+		c.SelfMetricsAddress = "127.0.0.1:0"
+	})
+
+	if err := saver.startSelfMetrics(); err != nil {
+		t.Fatalf("startSelfMetrics() failed: %v", err)
+	}
+	defer saver.selfMetricsServer.Close()
+
+	saver.decisions.record("svc1@docker", actionScaleUp, reasonServerErrors)
+
+	body := scrapeDecisions(t, "http://"+saver.selfMetricsListener.Addr().String()+"/metrics")
+	want := `cloudsaver_decisions_total{service="svc1@docker",action="scale_up",reason="server_errors"} 1`
+	if !strings.Contains(body, want) {
+		t.Errorf("expected %q in scrape:\n%s", want, body)
+	}
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	if got := escapeLabelValue("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("escapeLabelValue() = %s", got)
+	}
+}
@@ -0,0 +1,188 @@
+package traefik_cloud_saver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+const (
+	defaultSinkBatchSize     = 50
+	defaultSinkQueueSize     = 1000
+	defaultSinkFlushInterval = 10 * time.Second
+	defaultSinkMaxRetries    = 3
+	sinkRetryDelay           = 500 * time.Millisecond
+)
+
+// DecisionSinkConfig streams every decision as JSON to a collector endpoint
+type DecisionSinkConfig struct {
+	URL           string `json:"url,omitempty"`           // collector endpoint, decisions are POSTed as a JSON array
+	BatchSize     int    `json:"batchSize,omitempty"`     // decisions per request, default 50
+	FlushInterval string `json:"flushInterval,omitempty"` // send a partial batch after this long, default 10s
+	QueueSize     int    `json:"queueSize,omitempty"`     // decisions held while the collector is slow, newer ones are dropped once full, default 1000
+	MaxRetries    int    `json:"maxRetries,omitempty"`    // retries for a failed batch before it's dropped, default 3
+}
+
+// decisionEvent is a single decision as sent to the collector
+type decisionEvent struct {
+	Time    time.Time `json:"time"`
+	Window  int       `json:"window"`
+	Service string    `json:"service"`
+	Action  string    `json:"action"`
+	Reason  string    `json:"reason"`
+}
+
+// decisionSink batches decisions and POSTs them to a collector from its own goroutine, so a slow
+// or unavailable collector never holds up a window
+type decisionSink struct {
+	url           string
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	queue         chan decisionEvent
+	client        *http.Client
+	dropped       int
+}
+
+func newDecisionSink(config *DecisionSinkConfig) (*decisionSink, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("decision sink url is required")
+	}
+
+	sink := &decisionSink{
+		url:           config.URL,
+		batchSize:     defaultSinkBatchSize,
+		flushInterval: defaultSinkFlushInterval,
+		maxRetries:    defaultSinkMaxRetries,
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+	if config.BatchSize > 0 {
+		sink.batchSize = config.BatchSize
+	}
+	if config.MaxRetries > 0 {
+		sink.maxRetries = config.MaxRetries
+	}
+	if config.FlushInterval != "" {
+		interval, err := time.ParseDuration(config.FlushInterval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid decision sink flush interval: %w", err)
+		}
+		if interval <= 0 {
+			return nil, fmt.Errorf("decision sink flush interval must be positive, got %v", interval)
+		}
+		sink.flushInterval = interval
+	}
+
+	queueSize := defaultSinkQueueSize
+	if config.QueueSize > 0 {
+		queueSize = config.QueueSize
+	}
+	sink.queue = make(chan decisionEvent, queueSize)
+
+	return sink, nil
+}
+
+// enqueue adds a decision to the queue without blocking, dropping it if the queue is full
+func (s *decisionSink) enqueue(event decisionEvent) {
+	select {
+	case s.queue <- event:
+	default:
+		s.dropped++
+		common.DebugLog("traefik-cloud-saver", "decision sink queue is full, dropped %d decisions so far", s.dropped)
+	}
+}
+
+// run sends batches until the context is done, then flushes what's left
+func (s *decisionSink) run(ctx context.Context) {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]decisionEvent, 0, s.batchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.send(ctx, batch); err != nil {
+			common.LogProvider("traefik-cloud-saver", "[ERROR]: dropping %d decisions, failed to send them to %s: %v", len(batch), s.url, err)
+		}
+		batch = make([]decisionEvent, 0, s.batchSize)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// one last try for whatever is queued, bounded so shutdown isn't held up
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			for {
+				select {
+				case event := <-s.queue:
+					batch = append(batch, event)
+					if len(batch) >= s.batchSize {
+						flush(shutdownCtx)
+					}
+				default:
+					flush(shutdownCtx)
+					return
+				}
+			}
+		case event := <-s.queue:
+			batch = append(batch, event)
+			if len(batch) >= s.batchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+// send POSTs a batch, retrying with a growing delay
+func (s *decisionSink) send(ctx context.Context, batch []decisionEvent) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal decisions: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= s.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("%w (%v)", lastErr, ctx.Err())
+			case <-time.After(sinkRetryDelay * time.Duration(attempt)):
+			}
+		}
+
+		lastErr = s.post(ctx, body)
+		if lastErr == nil {
+			return nil
+		}
+		common.DebugLog("traefik-cloud-saver", "failed to send %d decisions (attempt %d): %v", len(batch), attempt+1, lastErr)
+	}
+	return lastErr
+}
+
+func (s *decisionSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
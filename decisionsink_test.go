@@ -0,0 +1,212 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCollector records the batches POSTed to it, failing the first failures requests
+type testCollector struct {
+	mu       sync.Mutex
+	batches  [][]decisionEvent
+	requests int
+	failures int
+	server   *httptest.Server
+}
+
+func newTestCollector(t *testing.T, failures int) *testCollector {
+	t.Helper()
+	c := &testCollector{failures: failures}
+	c.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.requests++
+		if c.requests <= c.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var batch []decisionEvent
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Errorf("collector failed to decode batch: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c.batches = append(c.batches, batch)
+	}))
+	t.Cleanup(c.server.Close)
+	return c
+}
+
+// waitForBatches waits until the collector has received n batches
+func (c *testCollector) waitForBatches(t *testing.T, n int) [][]decisionEvent {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		if len(c.batches) >= n {
+			batches := c.batches
+			c.mu.Unlock()
+			return batches
+		}
+		c.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t.Fatalf("expected %d batches, got %d", n, len(c.batches))
+	return nil
+}
+
+func TestDecisionSinkBatches(t *testing.T) {
+	collector := newTestCollector(t, 0)
+	sink, err := newDecisionSink(&DecisionSinkConfig{URL: collector.server.URL, BatchSize: 2, FlushInterval: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sink.run(ctx)
+		close(done)
+	}()
+
+	for _, service := range []string{"a", "b", "c", "d", "e"} {
+		sink.enqueue(decisionEvent{Service: service, Action: actionScaleDown, Reason: reasonBelowThreshold})
+	}
+
+	batches := collector.waitForBatches(t, 2)
+	if len(batches[0]) != 2 || len(batches[1]) != 2 {
+		t.Errorf("expected full batches of 2, got %v", batches)
+	}
+
+	// the partial batch is flushed on shutdown
+	cancel()
+	<-done
+	batches = collector.waitForBatches(t, 3)
+	if len(batches[2]) != 1 || batches[2][0].Service != "e" {
+		t.Errorf("expected the remaining decision on shutdown, got %v", batches[2])
+	}
+}
+
+func TestDecisionSinkFlushInterval(t *testing.T) {
+	collector := newTestCollector(t, 0)
+	sink, err := newDecisionSink(&DecisionSinkConfig{URL: collector.server.URL, BatchSize: 100, FlushInterval: "20ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sink.run(ctx)
+
+	sink.enqueue(decisionEvent{Service: "a", Action: actionKeep, Reason: reasonAboveThreshold})
+
+	batches := collector.waitForBatches(t, 1)
+	if len(batches[0]) != 1 || batches[0][0].Action != actionKeep {
+		t.Errorf("unexpected batch %v", batches[0])
+	}
+}
+
+func TestDecisionSinkRetries(t *testing.T) {
+	collector := newTestCollector(t, 1)
+	sink, err := newDecisionSink(&DecisionSinkConfig{URL: collector.server.URL, BatchSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sink.run(ctx)
+
+	sink.enqueue(decisionEvent{Service: "a", Action: actionScaleUp, Reason: reasonServerErrors})
+
+	batches := collector.waitForBatches(t, 1)
+	if len(batches) != 1 || batches[0][0].Service != "a" {
+		t.Errorf("expected the batch to be delivered once after a retry, got %v", batches)
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if collector.requests != 2 {
+		t.Errorf("expected 2 requests, got %d", collector.requests)
+	}
+}
+
+func TestDecisionSinkBoundedQueue(t *testing.T) {
+	sink, err := newDecisionSink(&DecisionSinkConfig{URL: "http://127.0.0.1:1", QueueSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is draining the queue
+	for i := 0; i < 5; i++ {
+		sink.enqueue(decisionEvent{Service: "a"})
+	}
+	if len(sink.queue) != 2 || sink.dropped != 3 {
+		t.Errorf("expected 2 queued and 3 dropped, got %d queued and %d dropped", len(sink.queue), sink.dropped)
+	}
+}
+
+func TestDecisionSinkConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *DecisionSinkConfig
+		wantErr bool
+	}{
+		{name: "defaults", config: &DecisionSinkConfig{URL: "http://collector"}},
+		{name: "missing url", config: &DecisionSinkConfig{}, wantErr: true},
+		{name: "invalid flush interval", config: &DecisionSinkConfig{URL: "http://collector", FlushInterval: "soon"}, wantErr: true},
+		{name: "negative flush interval", config: &DecisionSinkConfig{URL: "http://collector", FlushInterval: "-1s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newDecisionSink(tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("newDecisionSink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecisionsStreamedToSink(t *testing.T) {
+	collector := newTestCollector(t, 0)
+
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.addService("busy@docker", "busy@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="idle@docker"} 0
+traefik_service_requests_total{service="busy@docker"} 100
+`, "")
+
+	saver, _ := newTestSaver(t, backend, map[string]int32{"idle": 1, "busy": 1}, func(c *Config) {
+		c.DecisionSink = &DecisionSinkConfig{URL: collector.server.URL, BatchSize: 2}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go saver.decisionSink.run(ctx)
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	batches := collector.waitForBatches(t, 1)
+	got := make(map[string]decisionEvent)
+	for _, event := range batches[0] {
+		got[event.Service] = event
+	}
+	if event := got["idle@docker"]; event.Action != actionScaleDown || event.Reason != reasonBelowThreshold || event.Window != 1 {
+		t.Errorf("unexpected decision for idle: %+v", event)
+	}
+	if event := got["busy@docker"]; event.Action != actionKeep || event.Reason != reasonAboveThreshold {
+		t.Errorf("unexpected decision for busy: %+v", event)
+	}
+}
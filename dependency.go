@@ -0,0 +1,104 @@
+package traefik_cloud_saver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Dependency is something a cloud service needs in order to serve, e.g. its database.  While a
+// dependency is unhealthy the service is neither scaled down nor up: it can't serve either way, and
+// scaling it would only churn instances.  Health comes from a probe, or a gauge in the Prometheus
+// metrics of e.g. an exporter.
+type Dependency struct {
+	Name       string            `json:"name"`                 // shown in the logs
+	Probe      string            `json:"probe,omitempty"`      // http(s) URL which must answer 2xx or 3xx, or host:port accepting TCP connections
+	Gauge      string            `json:"gauge,omitempty"`      // metric family healthy while all its series are non-zero, e.g. pg_up
+	Labels     map[string]string `json:"labels,omitempty"`     // only the gauge series with all these label values
+	MetricsURL string            `json:"metricsURL,omitempty"` // endpoint serving the gauge in the Prometheus text format
+}
+
+// validateDependencies checks each dependency has exactly one source of health
+func validateDependencies(dependencies map[string][]Dependency) error {
+	for cloudServiceName, deps := range dependencies {
+		for _, dep := range deps {
+			switch {
+			case dep.Name == "":
+				return fmt.Errorf("dependency of service %s needs a name", cloudServiceName)
+			case (dep.Probe == "") == (dep.Gauge == ""):
+				return fmt.Errorf("dependency %s of service %s needs either a probe or a gauge", dep.Name, cloudServiceName)
+			case dep.Gauge != "" && dep.MetricsURL == "":
+				return fmt.Errorf("dependency %s of service %s needs the metrics URL serving its gauge", dep.Name, cloudServiceName)
+			}
+		}
+	}
+	return nil
+}
+
+// unhealthyDependency returns a description of the first unhealthy dependency of a cloud service,
+// or an empty string if they're all healthy
+func (p *CloudSaver) unhealthyDependency(ctx context.Context, cloudServiceName string) string {
+	for _, dep := range p.dependencies[cloudServiceName] {
+		var err error
+		if dep.Probe != "" {
+			err = probe(ctx, dep.Probe)
+		} else {
+			err = checkGauge(ctx, dep)
+		}
+		if err != nil {
+			return fmt.Sprintf("dependency %s is unhealthy: %v", dep.Name, err)
+		}
+	}
+	return ""
+}
+
+// checkGauge fetches a dependency's metrics, failing unless its gauge has at least one matching
+// series and none of them are zero
+func checkGauge(ctx context.Context, dep Dependency) error {
+	ctx, cancel := context.WithTimeout(ctx, readinessProbeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, dep.MetricsURL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid metrics URL %s: %w", dep.MetricsURL, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("metrics endpoint %s returned %s", dep.MetricsURL, resp.Status)
+	}
+
+	found := false
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if metricFamily(line) != dep.Gauge || !matchesLabels(line, dep.Labels) {
+			continue
+		}
+		end := strings.LastIndex(line, " ")
+		if end == -1 {
+			continue
+		}
+		value, err := strconv.ParseFloat(line[end+1:], 64)
+		if err != nil {
+			continue
+		}
+		if value == 0 {
+			return fmt.Errorf("%s is 0", line[:end])
+		}
+		found = true
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read metrics: %w", err)
+	}
+	if !found {
+		return fmt.Errorf("gauge %s not found", dep.Gauge)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// dependencyServer serves a health endpoint at /health and metrics at /metrics, switched with healthy
+func dependencyServer(t *testing.T, healthy *atomic.Bool) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		up := 0
+		if healthy.Load() {
+			up = 1
+		}
+		switch r.URL.Path {
+		case "/health":
+			if up == 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case "/metrics":
+			fmt.Fprintf(w, "pg_up{instance=\"db\"} %d\n", up)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDependencyGate(t *testing.T) {
+	tests := []struct {
+		name         string
+		initialScale int32
+		count        string
+		wantScale    int32 // once the dependency is healthy again
+		dependency   func(url string) Dependency
+	}{
+		{
+			name:         "probe holds back scale down",
+			initialScale: 1,
+			count:        "0",
+			wantScale:    0,
+			dependency:   func(url string) Dependency { return Dependency{Name: "db", Probe: url + "/health"} },
+		},
+		{
+			name:         "gauge holds back scale down",
+			initialScale: 1,
+			count:        "0",
+			wantScale:    0,
+			dependency: func(url string) Dependency {
+				return Dependency{Name: "db", Gauge: "pg_up", MetricsURL: url + "/metrics"}
+			},
+		},
+		{
+			name:         "probe holds back scale up",
+			initialScale: 0,
+			count:        "100",
+			wantScale:    1,
+			dependency:   func(url string) Dependency { return Dependency{Name: "db", Probe: url + "/health"} },
+		},
+		{
+			name:         "gauge holds back scale up",
+			initialScale: 0,
+			count:        "100",
+			wantScale:    1,
+			dependency: func(url string) Dependency {
+				return Dependency{Name: "db", Gauge: "pg_up", MetricsURL: url + "/metrics"}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var healthy atomic.Bool
+			dep := dependencyServer(t, &healthy)
+
+			backend := newTestBackend(t)
+			backend.addService("app@docker", "app@docker")
+			backend.setMetrics(`traefik_service_requests_total{service="app@docker"} `+tt.count, "")
+
+			saver, svc := newTestSaver(t, backend, map[string]int32{"app": tt.initialScale}, func(c *Config) {
+				c.Dependencies = map[string][]Dependency{"app": {tt.dependency(dep.URL)}}
+			})
+			if err := saver.Init(); err != nil {
+				t.Fatalf("Init() failed: %v", err)
+			}
+
+			if _, err := saver.generateConfiguration(context.Background()); err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+			if scale := currentScale(t, svc, "app"); scale != tt.initialScale {
+				t.Errorf("expected app to stay at scale %d while its dependency is down, got %d", tt.initialScale, scale)
+			}
+			if count := saver.decisions.count("app@docker", actionKeep, reasonDependency); count != 1 {
+				t.Errorf("expected a dependency decision, got %d", count)
+			}
+
+			// the counter keeps going, so the rate stays the same in the next window
+			healthy.Store(true)
+			backend.setMetrics(`traefik_service_requests_total{service="app@docker"} `+tt.count+tt.count, "")
+			if _, err := saver.generateConfiguration(context.Background()); err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+			if scale := currentScale(t, svc, "app"); scale != tt.wantScale {
+				t.Errorf("expected app at scale %d once its dependency is healthy, got %d", tt.wantScale, scale)
+			}
+		})
+	}
+}
+
+func TestCheckGauge(t *testing.T) {
+	tests := []struct {
+		name    string
+		metrics string
+		labels  map[string]string
+		wantErr string
+	}{
+		{name: "healthy", metrics: "pg_up 1\n"},
+		{name: "down", metrics: "pg_up 0\n", wantErr: "pg_up is 0"},
+		{name: "missing", metrics: "mysql_up 1\n", wantErr: "not found"},
+		{name: "any series down", metrics: "pg_up{instance=\"a\"} 1\npg_up{instance=\"b\"} 0\n", wantErr: `instance="b"`},
+		{
+			name:    "only matching labels count",
+			metrics: "pg_up{instance=\"a\"} 1\npg_up{instance=\"b\"} 0\n",
+			labels:  map[string]string{"instance": "a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				fmt.Fprint(w, tt.metrics)
+			}))
+			defer server.Close()
+
+			err := checkGauge(context.Background(), Dependency{Name: "db", Gauge: "pg_up", Labels: tt.labels, MetricsURL: server.URL})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("checkGauge() failed: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("checkGauge() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDependencyValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		dep  Dependency
+	}{
+		{name: "no name", dep: Dependency{Probe: "db:5432"}},
+		{name: "no source", dep: Dependency{Name: "db"}},
+		{name: "probe and gauge", dep: Dependency{Name: "db", Probe: "db:5432", Gauge: "pg_up", MetricsURL: "http://exporter/metrics"}},
+		{name: "gauge without metrics URL", dep: Dependency{Name: "db", Gauge: "pg_up"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.Dependencies = map[string][]Dependency{"app": {tt.dep}}
+			if err := config.Validate(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud"
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// checkDiscovery makes sure the cloud service can discover its resources when resourceTags are set
+func checkDiscovery(config *common.CloudServiceConfig, service cloud.Service) (bool, error) {
+	if config == nil || len(config.ResourceTags) == 0 {
+		return false, nil
+	}
+	if _, ok := service.(cloud.Discoverer); !ok {
+		return false, fmt.Errorf("resourceTags need a cloud service which discovers its resources, %s doesn't", config.Type)
+	}
+	return true, nil
+}
+
+// discoverServices replaces the managed services with the cloud services carrying the configured
+// resourceTags, scanning only the configured discovery zones.  A failed discovery keeps the last
+// ones, so a flaky API doesn't drop every service out of management.
+func (p *CloudSaver) discoverServices(ctx context.Context) {
+	discoverer, ok := p.cloudService.(cloud.Discoverer)
+	if !p.discover || !ok {
+		return
+	}
+
+	names, err := discoverer.DiscoverServices(ctx)
+	if err != nil {
+		common.LogProvider("traefik-cloud-saver", "[ERROR]: failed to discover services, keeping the last %d, err: %s", len(p.managedServices), err)
+		p.summary.errors++
+		return
+	}
+
+	managed := make(map[string]bool, len(names))
+	for _, name := range names {
+		managed[name] = true
+	}
+	p.managedServices = managed
+	common.DebugLog("traefik-cloud-saver", "Discovered %d managed services", len(managed))
+}
+
+// manage reports whether decisions are made for a cloud service.  Without discovery every cloud
+// service a traefik service maps to is managed from then on, with it only the discovered ones are.
+func (p *CloudSaver) manage(cloudServiceName string) bool {
+	if p.discover {
+		return p.managedServices[cloudServiceName]
+	}
+	p.managedServices[cloudServiceName] = true
+	return true
+}
@@ -0,0 +1,68 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud"
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+func TestDiscoveredServices(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("tagged@docker", "tagged@docker")
+	backend.addService("untagged@docker", "untagged@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="tagged@docker"} 0
+traefik_service_requests_total{service="untagged@docker"} 0
+`, "")
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"tagged": 1, "untagged": 1, "stopped": 0}, func(c *Config) {
+		c.CloudConfig.ResourceTags = map[string]string{"cloudsaver": "managed"}
+		c.CloudConfig.Labels = map[string]map[string]string{
+			"tagged":  {"cloudsaver": "managed"},
+			"stopped": {"cloudsaver": "managed"},
+		}
+	})
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, svc, "tagged"); scale != 0 {
+		t.Errorf("expected the discovered service to be scaled down, got scale %d", scale)
+	}
+	if scale := currentScale(t, svc, "untagged"); scale != 1 {
+		t.Errorf("expected the undiscovered service to be left alone, got scale %d", scale)
+	}
+	if got := saver.decisions.count("untagged@docker", actionSkip, reasonNotDiscovered); got != 1 {
+		t.Errorf("expected 1 not discovered decision, got %d", got)
+	}
+	// a discovered service is managed before any traefik service maps to it
+	if managed := saver.State().Managed; !reflect.DeepEqual(managed, []string{"stopped", "tagged"}) {
+		t.Errorf("expected the discovered services to be managed, got %v", managed)
+	}
+
+	// once the tag is gone so is the service, even while it's scaled down
+	svc.SetLabels("tagged", nil)
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if managed := saver.State().Managed; !reflect.DeepEqual(managed, []string{"stopped"}) {
+		t.Errorf("expected only stopped to be managed, got %v", managed)
+	}
+}
+
+// plainService only has the methods every cloud service has
+type plainService struct {
+	cloud.Service
+}
+
+func TestDiscoveryNeedsDiscoverer(t *testing.T) {
+	config := CreateConfig()
+	config.testMode = true
+	config.CloudConfig = &common.CloudServiceConfig{Type: "plain", ResourceTags: map[string]string{"cloudsaver": "managed"}}
+	if _, err := New(context.Background(), config, "test", WithCloudService(&plainService{})); err == nil {
+		t.Error("expected an error for resourceTags on a cloud service which can't discover")
+	}
+}
@@ -0,0 +1,25 @@
+package traefik_cloud_saver
+
+import (
+	"fmt"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// dryRunTag marks the log lines of actions skipped in dry run mode
+const dryRunTag = "[DRY-RUN]"
+
+// skipDryRun logs the scale action the plugin would take on a cloud service, reporting whether
+// it must be skipped because the plugin runs in dry run mode.  Everything up to the action itself,
+// rates, instance policies, reading the current scale, still goes to the cloud service.
+func (p *CloudSaver) skipDryRun(action, cloudServiceName, format string, v ...interface{}) bool {
+	if !p.dryRun {
+		return false
+	}
+	verb := "scale up"
+	if action == actionScaleDown {
+		verb = "scale down"
+	}
+	common.LogProvider("traefik-cloud-saver", "%s would %s service %s %s", dryRunTag, verb, cloudServiceName, fmt.Sprintf(format, v...))
+	return true
+}
@@ -0,0 +1,51 @@
+package traefik_cloud_saver
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.addService("busy@docker", "busy@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="idle@docker"} 0
+traefik_service_requests_total{service="busy@docker"} 100
+`, "")
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"idle": 1, "busy": 1}, func(c *Config) {
+		c.DryRun = true
+	})
+
+	configuration, err := saver.generateConfiguration(context.Background())
+	if err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	if scale := currentScale(t, svc, "idle"); scale != 1 {
+		t.Errorf("expected dry run to leave idle up, got scale %d", scale)
+	}
+	if len(configuration.Configuration.HTTP.Routers) != 0 {
+		t.Errorf("expected no sleeping routers in dry run, got %v", configuration.Configuration.HTTP.Routers)
+	}
+	if got := saver.decisions.count("idle@docker", actionKeep, reasonDryRun); got != 1 {
+		t.Errorf("expected 1 dry run decision for idle, got %d", got)
+	}
+
+	want := "[DRY-RUN] would scale down service idle (idle@docker), rate 0.00 < 1.00"
+	if !strings.Contains(logs.String(), want) {
+		t.Errorf("expected %q in the logs, got:\n%s", want, logs.String())
+	}
+	if strings.Contains(logs.String(), "would scale down service busy") {
+		t.Errorf("expected no dry run action for busy, got:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,76 @@
+package traefik_cloud_saver
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// what to do when the time since the last decision is implausible for the poll period, e.g. two
+// ticks back to back or ticks missed while the host was suspended
+const (
+	durationMeasured = "measured" // compute the rates over the measured duration anyway
+	durationSkip     = "skip"     // skip the decision
+	durationClamp    = "clamp"    // compute the rates over the poll period instead
+)
+
+// a duration is plausible from half to twice the poll period
+const (
+	minDurationRatio = 0.5
+	maxDurationRatio = 2
+)
+
+// errImplausibleDuration is returned by GetServiceRates when the durationSkip policy skips a decision
+var errImplausibleDuration = errors.New("implausible duration since the last decision")
+
+// WithDurationGuard checks the time since the last decision against the expected poll period,
+// applying policy when it's under half or over twice of it.  It only applies to rates computed from
+// the increase since the last decision, a sample or rate window has its own horizon.
+func WithDurationGuard(policy string, expected time.Duration) MetricsCollectorOption {
+	return func(mc *MetricsCollector) {
+		if policy != "" && policy != durationMeasured {
+			mc.durationPolicy = policy
+			mc.expectedDuration = expected
+		}
+	}
+}
+
+// validateDurationPolicy checks the rate duration policy is one of the known ones
+func validateDurationPolicy(policy string) error {
+	switch policy {
+	case "", durationMeasured, durationSkip, durationClamp:
+		return nil
+	}
+	return fmt.Errorf("unknown rate duration policy %q, expected %s, %s or %s", policy, durationMeasured, durationSkip, durationClamp)
+}
+
+// setExpectedDuration updates the poll period the duration guard expects, when it changes
+func (mc *MetricsCollector) setExpectedDuration(expected time.Duration) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.durationPolicy != "" {
+		mc.expectedDuration = expected
+	}
+}
+
+// checkDuration applies the duration policy to the time since the last decision.  It returns the
+// duration to compute the rates over, and whether the baseline should move on to the latest sample
+// when the decision is skipped: a gap that's too long would never get any shorter otherwise.
+func (mc *MetricsCollector) checkDuration(duration time.Duration) (time.Duration, bool, error) {
+	if mc.durationPolicy == "" || mc.expectedDuration <= 0 {
+		return duration, false, nil
+	}
+	tooShort := duration < time.Duration(float64(mc.expectedDuration)*minDurationRatio)
+	tooLong := duration > time.Duration(float64(mc.expectedDuration)*maxDurationRatio)
+	if !tooShort && !tooLong {
+		return duration, false, nil
+	}
+
+	if mc.durationPolicy == durationClamp {
+		common.LogProvider("traefik-cloud-saver", "[WARNING] %v since the last decision, computing rates over the expected %v instead", duration, mc.expectedDuration)
+		return mc.expectedDuration, false, nil
+	}
+	return duration, tooLong, fmt.Errorf("%w: %v, expected %v", errImplausibleDuration, duration, mc.expectedDuration)
+}
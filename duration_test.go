@@ -0,0 +1,173 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// counterServer serves a request counter for service1 which the test sets
+type counterServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	count int
+}
+
+func newCounterServer(t *testing.T) *counterServer {
+	t.Helper()
+	s := &counterServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		fmt.Fprintf(w, "traefik_service_requests_total{service=\"service1\"} %d\n", s.count)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *counterServer) set(count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.count = count
+}
+
+func TestDurationGuard(t *testing.T) {
+	// 10 requests after a window of 60 expected every minute
+	tests := []struct {
+		name       string
+		policy     string
+		gap        time.Duration
+		wantErr    bool
+		wantPerMin float64
+	}{
+		{name: "measured tiny", policy: durationMeasured, gap: time.Second, wantPerMin: 600},
+		{name: "measured plausible", policy: durationMeasured, gap: time.Minute, wantPerMin: 10},
+		{name: "measured huge", policy: durationMeasured, gap: 10 * time.Minute, wantPerMin: 1},
+		{name: "clamp tiny", policy: durationClamp, gap: time.Second, wantPerMin: 10},
+		{name: "clamp plausible", policy: durationClamp, gap: 50 * time.Second, wantPerMin: 12},
+		{name: "clamp huge", policy: durationClamp, gap: 10 * time.Minute, wantPerMin: 10},
+		{name: "skip tiny", policy: durationSkip, gap: time.Second, wantErr: true},
+		{name: "skip plausible", policy: durationSkip, gap: 80 * time.Second, wantPerMin: 7.5},
+		{name: "skip huge", policy: durationSkip, gap: 10 * time.Minute, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newCounterServer(t)
+			clock := &stepClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+			mc := NewMetricsCollector(server.URL, WithDurationGuard(tt.policy, time.Minute))
+			mc.clock = clock
+			mc.lastTime = clock.Now()
+
+			for _, count := range []int{0, 60} {
+				server.set(count)
+				if _, err := mc.GetServiceRates(context.Background()); err != nil {
+					t.Fatalf("GetServiceRates() failed: %v", err)
+				}
+				clock.now = clock.now.Add(time.Minute)
+			}
+
+			clock.now = clock.now.Add(tt.gap - time.Minute)
+			server.set(70)
+			rates, err := mc.GetServiceRates(context.Background())
+			if tt.wantErr {
+				if !errors.Is(err, errImplausibleDuration) {
+					t.Fatalf("GetServiceRates() = %v, want an implausible duration error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetServiceRates() failed: %v", err)
+			}
+			if perMin := rates["service1"].PerMin; perMin != tt.wantPerMin {
+				t.Errorf("PerMin = %v, want %v", perMin, tt.wantPerMin)
+			}
+		})
+	}
+}
+
+func TestDurationGuardSkipBaseline(t *testing.T) {
+	tests := []struct {
+		name       string
+		gap        time.Duration
+		wantPerMin float64
+	}{
+		// the next rate covers the skipped second too
+		{name: "tiny gap keeps the baseline", gap: time.Second, wantPerMin: 70.0 / 61 * 60},
+		// otherwise every later decision would be skipped as well
+		{name: "huge gap moves the baseline", gap: 10 * time.Minute, wantPerMin: 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newCounterServer(t)
+			clock := &stepClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+			mc := NewMetricsCollector(server.URL, WithDurationGuard(durationSkip, time.Minute))
+			mc.clock = clock
+			mc.lastTime = clock.Now()
+
+			if _, err := mc.GetServiceRates(context.Background()); err != nil {
+				t.Fatalf("GetServiceRates() failed: %v", err)
+			}
+
+			clock.now = clock.now.Add(tt.gap)
+			server.set(10)
+			if _, err := mc.GetServiceRates(context.Background()); !errors.Is(err, errImplausibleDuration) {
+				t.Fatalf("GetServiceRates() = %v, want an implausible duration error", err)
+			}
+
+			clock.now = clock.now.Add(time.Minute)
+			server.set(70)
+			rates, err := mc.GetServiceRates(context.Background())
+			if err != nil {
+				t.Fatalf("GetServiceRates() failed: %v", err)
+			}
+			if perMin := rates["service1"].PerMin; perMin != tt.wantPerMin {
+				t.Errorf("PerMin = %v, want %v", perMin, tt.wantPerMin)
+			}
+		})
+	}
+}
+
+func TestDurationGuardSkipsDecision(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("svc@docker", "svc@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="svc@docker"} 100`, "")
+
+	clock := &stepClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	saver, svc := newTestSaver(t, backend, map[string]int32{"svc": 1}, func(c *Config) {
+		c.WindowSize = "1m"
+		c.RateDuration = durationSkip
+		c.ScrapeFailurePolicy = scrapeFailureFailOpen
+	}, WithClock(clock))
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	// no traffic over a gap long enough to be missed ticks isn't a reason to scale down, nor to fail open
+	clock.now = clock.now.Add(10 * time.Minute)
+	if _, err := saver.generateConfiguration(context.Background()); !errors.Is(err, errImplausibleDuration) {
+		t.Fatalf("generateConfiguration() = %v, want an implausible duration error", err)
+	}
+	if scale := currentScale(t, svc, "svc"); scale != 1 {
+		t.Errorf("expected svc to stay at scale 1, got %d", scale)
+	}
+	if count := saver.decisions.count("svc@docker", actionScaleUp, reasonAnomaly); count != 0 {
+		t.Errorf("expected no fail open, got %d scale ups", count)
+	}
+}
+
+func TestDurationGuardValidation(t *testing.T) {
+	config := CreateConfig()
+	config.WindowSize = "1s"
+	config.testMode = true
+	config.RateDuration = "stretch"
+	if _, err := New(context.Background(), config, "test"); err == nil {
+		t.Error("expected an error for an unknown rate duration policy")
+	}
+}
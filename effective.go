@@ -0,0 +1,199 @@
+package traefik_cloud_saver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// EffectiveConfig is the configuration the plugin is running with, once defaults are filled in and
+// per-service overrides are resolved, to check the values in effect against what was intended
+type EffectiveConfig struct {
+	WindowSize          string   `json:"windowSize"`
+	PollInterval        string   `json:"pollInterval"`
+	InitialWindow       string   `json:"initialWindow,omitempty"`
+	WindowOverlap       string   `json:"windowOverlap"`
+	ScrapeInterval      string   `json:"scrapeInterval,omitempty"`
+	ScaleOn             string   `json:"scaleOn"`
+	TrafficThreshold    float64  `json:"trafficThreshold"`
+	ScaleUpThreshold    float64  `json:"scaleUpThreshold,omitempty"`
+	IdleTimeout         string   `json:"idleTimeout,omitempty"`
+	MetricsType         string   `json:"metricsType"`
+	MetricSource        string   `json:"metricSource"`
+	Protocols           []string `json:"protocols"`
+	TCPMetric           string   `json:"tcpMetric,omitempty"` // only when tcp routers are monitored
+	SampleWindow        int      `json:"sampleWindow,omitempty"`
+	RateDuration        string   `json:"rateDuration"`
+	SuccessCodes        []string `json:"successCodes"`
+	ScrapeFailurePolicy string   `json:"scrapeFailurePolicy"`
+	MaxStaleWindows     int      `json:"maxStaleWindows"`
+	CooldownPeriod      string   `json:"cooldownPeriod"`
+	OrphanGracePeriod   string   `json:"orphanGracePeriod"`
+	ScaleDownOrphans    bool     `json:"scaleDownOrphans"`
+	WakeOnServerErrors  bool     `json:"wakeOnServerErrors"`
+	FailOpenOnAnomaly   bool     `json:"failOpenOnAnomaly"`
+	ReadinessTimeout    string   `json:"readinessTimeout"`
+	ScaleVerifyDelay    string   `json:"scaleVerifyDelay,omitempty"`
+	ScaledDownBehavior  string   `json:"scaledDownBehavior"`
+	DryRun              bool     `json:"dryRun"`
+	MonitorInternal     bool     `json:"monitorInternal"`
+	APITimeout          string   `json:"apiTimeout"`
+	RouterCacheTTL      string   `json:"routerCacheTTL"`
+	PreflightChecks     bool     `json:"preflightChecks"`
+	Schedule            string   `json:"schedule,omitempty"` // the schedule in effect for the last window, the values above are the base ones
+
+	RouterThresholds    map[string]float64                `json:"routerThresholds,omitempty"` // router names and patterns with their own threshold
+	ThresholdPrecedence string                            `json:"thresholdPrecedence"`
+	ServiceWeights      map[string]float64                `json:"serviceWeights,omitempty"` // traefik services not weighted 1
+	NeverScaleDown      []string                          `json:"neverScaleDown,omitempty"` // traefik and cloud services never scaled down
+	Services            map[string]EffectiveServiceConfig `json:"services"`                 // keyed by cloud service name
+}
+
+// EffectiveServiceConfig is what's in effect for one cloud service
+type EffectiveServiceConfig struct {
+	TraefikServices  []string `json:"traefikServices,omitempty"` // configured to share the cloud service
+	CooldownPeriod   string   `json:"cooldownPeriod"`
+	ScaleUpTarget    int32    `json:"scaleUpTarget"`
+	InstanceCapacity float64  `json:"instanceCapacity,omitempty"`
+	Dependencies     []string `json:"dependencies,omitempty"` // names of the dependencies gating its scale actions
+}
+
+// EffectiveConfig returns the resolved configuration.  Services has an entry for every cloud
+// service with an override, and every one the plugin has made decisions for, so it waits for a
+// window in progress to finish.
+func (p *CloudSaver) EffectiveConfig() EffectiveConfig {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	config := EffectiveConfig{
+		WindowSize:          p.windowSize.String(),
+		PollInterval:        p.windowSize.String(),
+		ScaleOn:             scaleOnRate,
+		TrafficThreshold:    p.trafficThreshold,
+		ScaleUpThreshold:    p.scaleUpThreshold,
+		MetricsType:         metricsTypeScrape,
+		MetricSource:        p.metricsCollector.keyLabel,
+		Protocols:           p.protocols,
+		SampleWindow:        p.metricsCollector.sampleWindow,
+		RateDuration:        durationMeasured,
+		ScrapeFailurePolicy: scrapeFailureSkip,
+		ScaledDownBehavior:  scaledDownServe503,
+		WindowOverlap:       windowOverlapQueue,
+		MaxStaleWindows:     p.maxStaleWindows,
+		CooldownPeriod:      p.cooldownPeriod.String(),
+		OrphanGracePeriod:   p.orphanGracePeriod.String(),
+		ScaleDownOrphans:    p.scaleDownOrphans,
+		WakeOnServerErrors:  p.wakeOnServerErrors,
+		FailOpenOnAnomaly:   p.failOpenOnAnomaly,
+		ReadinessTimeout:    p.readinessTimeout.String(),
+		DryRun:              p.dryRun,
+		MonitorInternal:     p.monitorInternal,
+		APITimeout:          p.apiClient.Timeout.String(),
+		RouterCacheTTL:      p.routerCache.ttl.String(),
+		PreflightChecks:     p.preflightChecks,
+		RouterThresholds:    make(map[string]float64, len(p.thresholdRules)),
+		ThresholdPrecedence: p.thresholdPrecedence,
+		ServiceWeights:      make(map[string]float64, len(p.serviceWeights)),
+		Services:            make(map[string]EffectiveServiceConfig),
+	}
+	if hasProtocol(p.protocols, protocolTCP) {
+		config.TCPMetric = p.tcpMetric
+	}
+	if p.pollInterval > 0 {
+		config.PollInterval = p.pollInterval.String()
+	}
+	if p.initialWindow > 0 {
+		config.InitialWindow = p.initialWindow.String()
+	}
+	if p.scrapeInterval > 0 {
+		config.ScrapeInterval = p.scrapeInterval.String()
+	}
+	if p.scaleOn != "" {
+		config.ScaleOn = p.scaleOn
+	}
+	if p.idleTimeout > 0 {
+		config.IdleTimeout = p.idleTimeout.String()
+	}
+	if p.metricsCollector.promQL != "" {
+		config.MetricsType = metricsTypeQuery
+	}
+	for _, class := range p.metricsCollector.successClasses {
+		config.SuccessCodes = append(config.SuccessCodes, string(class)+"xx")
+	}
+	if p.metricsCollector.durationPolicy != "" {
+		config.RateDuration = p.metricsCollector.durationPolicy
+	}
+	if p.scrapeFailurePolicy != "" {
+		config.ScrapeFailurePolicy = p.scrapeFailurePolicy
+	}
+	if p.scaledDownBehavior != "" {
+		config.ScaledDownBehavior = p.scaledDownBehavior
+	}
+	if p.windowOverlap != "" {
+		config.WindowOverlap = p.windowOverlap
+	}
+	if p.schedule != nil {
+		config.Schedule = p.schedule.String()
+	}
+	if p.scaleVerifyDelay > 0 {
+		config.ScaleVerifyDelay = p.scaleVerifyDelay.String()
+	}
+	for _, rule := range p.thresholdRules {
+		config.RouterThresholds[rule.String()] = rule.threshold
+	}
+	for serviceName, weight := range p.serviceWeights {
+		config.ServiceWeights[serviceName] = weight
+	}
+	for name := range p.neverScaleDown {
+		config.NeverScaleDown = append(config.NeverScaleDown, name)
+	}
+	sort.Strings(config.NeverScaleDown)
+
+	names := make(map[string]bool)
+	for name := range p.managedServices {
+		names[name] = true
+	}
+	for name := range p.cooldownOverrides {
+		names[name] = true
+	}
+	for name := range p.scaleUpTargets {
+		names[name] = true
+	}
+	for _, name := range p.serviceInstances {
+		names[name] = true
+	}
+	for name := range p.instanceCapacity {
+		names[name] = true
+	}
+	for name := range p.dependencies {
+		names[name] = true
+	}
+	for name := range names {
+		service := EffectiveServiceConfig{
+			CooldownPeriod:   p.cooldownFor(name).String(),
+			ScaleUpTarget:    p.scaleUpTarget(name),
+			InstanceCapacity: p.instanceCapacity[name],
+		}
+		for _, dep := range p.dependencies[name] {
+			service.Dependencies = append(service.Dependencies, dep.Name)
+		}
+		for traefikService, instance := range p.serviceInstances {
+			if instance == name {
+				service.TraefikServices = append(service.TraefikServices, traefikService)
+			}
+		}
+		sort.Strings(service.TraefikServices)
+		config.Services[name] = service
+	}
+	return config
+}
+
+// serveEffectiveConfig serves the resolved configuration as JSON
+func (p *CloudSaver) serveEffectiveConfig(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(p.EffectiveConfig()); err != nil {
+		common.LogProvider("traefik-cloud-saver", "[ERROR]: failed to write effective config: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestEffectiveConfigDefaults(t *testing.T) {
+	backend := newTestBackend(t)
+	saver, _ := newTestSaver(t, backend, nil, nil)
+
+	config := saver.EffectiveConfig()
+	if config.WindowSize != "1s" || config.TrafficThreshold != 1 {
+		t.Errorf("window %s threshold %v, want 1s and 1", config.WindowSize, config.TrafficThreshold)
+	}
+	if config.ScaleOn != scaleOnRate || config.MetricsType != metricsTypeScrape || config.MetricSource != metricSourceService {
+		t.Errorf("scaleOn %s metricsType %s metricSource %s, want the defaults", config.ScaleOn, config.MetricsType, config.MetricSource)
+	}
+	if !reflect.DeepEqual(config.SuccessCodes, []string{"2xx"}) {
+		t.Errorf("success codes %v, want [2xx]", config.SuccessCodes)
+	}
+	if config.ScaledDownBehavior != scaledDownServe503 {
+		t.Errorf("scaled down behavior %s, want %s", config.ScaledDownBehavior, scaledDownServe503)
+	}
+	if config.ScrapeFailurePolicy != scrapeFailureSkip || config.MaxStaleWindows != defaultMaxStaleWindows {
+		t.Errorf("scrape failure policy %s (%d windows), want %s (%d)", config.ScrapeFailurePolicy, config.MaxStaleWindows, scrapeFailureSkip, defaultMaxStaleWindows)
+	}
+	if config.CooldownPeriod != "0s" || config.OrphanGracePeriod != "5m0s" || config.ReadinessTimeout != defaultReadinessTimeout.String() {
+		t.Errorf("cooldown %s orphan grace %s readiness timeout %s, want the defaults", config.CooldownPeriod, config.OrphanGracePeriod, config.ReadinessTimeout)
+	}
+	if len(config.Services) != 0 {
+		t.Errorf("expected no services before any decision, got %v", config.Services)
+	}
+}
+
+func TestEffectiveConfigOverrides(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("orders@docker", "orders@docker")
+	backend.addService("web@docker", "web@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="orders@docker"} 100
+traefik_service_requests_total{service="web@docker"} 100
+`, "")
+
+	saver, _ := newTestSaver(t, backend, map[string]int32{"heavy-vm": 1, "web": 1}, func(c *Config) {
+		c.ScaleDownThreshold = 2
+		c.ScaleUpThreshold = 8
+		c.CooldownPeriod = "10m"
+		c.CooldownOverrides = map[string]string{"heavy-vm": "1h"}
+		c.ScaleUpTargets = map[string]int32{"heavy-vm": 3}
+		c.ServiceInstances = map[string]string{"orders": "heavy-vm"}
+		c.ServiceWeights = map[string]float64{"orders": 0.5}
+		c.RouterFilter = &RouterFilter{Routers: []RouterConfig{{Name: "orders@docker", Threshold: 5}, {Name: "web@docker"}}}
+		c.SuccessCodes = []string{"2xx", "3xx"}
+		c.ScrapeFailurePolicy = scrapeFailureReuse
+		c.SelfMetricsAddress = "127.0.0.1:0"
+	})
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	config := saver.EffectiveConfig()
+	if config.TrafficThreshold != 2 || config.ScaleUpThreshold != 8 {
+		t.Errorf("thresholds %v/%v, want 2/8", config.TrafficThreshold, config.ScaleUpThreshold)
+	}
+	if !reflect.DeepEqual(config.SuccessCodes, []string{"2xx", "3xx"}) || config.ScrapeFailurePolicy != scrapeFailureReuse {
+		t.Errorf("success codes %v policy %s, want [2xx 3xx] and reuse", config.SuccessCodes, config.ScrapeFailurePolicy)
+	}
+	if !reflect.DeepEqual(config.RouterThresholds, map[string]float64{"orders@docker": 5}) {
+		t.Errorf("router thresholds %v, want only orders@docker", config.RouterThresholds)
+	}
+	if config.ServiceWeights["orders"] != 0.5 {
+		t.Errorf("service weights %v, want orders at 0.5", config.ServiceWeights)
+	}
+
+	want := map[string]EffectiveServiceConfig{
+		"heavy-vm": {TraefikServices: []string{"orders"}, CooldownPeriod: "1h0m0s", ScaleUpTarget: 3},
+		"web":      {CooldownPeriod: "10m0s", ScaleUpTarget: 1},
+	}
+	if !reflect.DeepEqual(config.Services, want) {
+		t.Errorf("services = %+v, want %+v", config.Services, want)
+	}
+
+	// served as JSON alongside the self metrics
+	if err := saver.startSelfMetrics(); err != nil {
+		t.Fatalf("startSelfMetrics() failed: %v", err)
+	}
+	defer saver.selfMetricsServer.Close()
+	resp, err := http.Get("http://" + saver.selfMetricsListener.Addr().String() + "/config")
+	if err != nil {
+		t.Fatalf("GET /config failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var served EffectiveConfig
+	if err := json.NewDecoder(resp.Body).Decode(&served); err != nil {
+		t.Fatalf("failed to decode effective config: %v", err)
+	}
+	if !reflect.DeepEqual(served.Services, want) {
+		t.Errorf("served services = %+v, want %+v", served.Services, want)
+	}
+}
@@ -0,0 +1,24 @@
+package traefik_cloud_saver
+
+import (
+	"os"
+)
+
+// expandEnv returns a copy of the config with the environment variables referenced as ${VAR} or
+// $VAR expanded in its URLs and cloud credentials secret, so a container can pass them in through
+// its environment.  A variable which isn't set expands to an empty string.  The config passed in
+// is left as it is.
+func expandEnv(config *Config) *Config {
+	expanded := *config
+	expanded.MetricsURL = os.ExpandEnv(config.MetricsURL)
+	expanded.APIURL = os.ExpandEnv(config.APIURL)
+
+	if config.CloudConfig != nil && config.CloudConfig.Credentials != nil {
+		cloudConfig := *config.CloudConfig
+		credentials := *config.CloudConfig.Credentials
+		credentials.Secret = os.ExpandEnv(credentials.Secret)
+		cloudConfig.Credentials = &credentials
+		expanded.CloudConfig = &cloudConfig
+	}
+	return &expanded
+}
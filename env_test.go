@@ -0,0 +1,40 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("SAVER_TRAEFIK_HOST", "traefik:8080")
+	t.Setenv("SAVER_TOKEN_PATH", "/run/secrets/gcp.json")
+
+	config := CreateConfig()
+	config.WindowSize = "1s"
+	config.testMode = true
+	config.MetricsURL = "http://${SAVER_TRAEFIK_HOST}/metrics"
+	config.APIURL = "http://$SAVER_TRAEFIK_HOST/api"
+	config.CloudConfig.Credentials = &common.CredentialsConfig{Secret: "${SAVER_TOKEN_PATH}${SAVER_UNSET}"}
+
+	expanded := expandEnv(config)
+	for name, got := range map[string][2]string{
+		"metricsURL":         {expanded.MetricsURL, "http://traefik:8080/metrics"},
+		"apiURL":             {expanded.APIURL, "http://traefik:8080/api"},
+		"credentials secret": {expanded.CloudConfig.Credentials.Secret, "/run/secrets/gcp.json"},
+		"original secret":    {config.CloudConfig.Credentials.Secret, "${SAVER_TOKEN_PATH}${SAVER_UNSET}"},
+	} {
+		if got[0] != got[1] {
+			t.Errorf("%s = %q, want %q", name, got[0], got[1])
+		}
+	}
+
+	saver, err := New(context.Background(), config, "test")
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if saver.apiURL != "http://traefik:8080/api" || saver.metricsCollector.metricsURL != "http://traefik:8080/metrics" {
+		t.Errorf("New() used %s and %s, want the expanded URLs", saver.apiURL, saver.metricsCollector.metricsURL)
+	}
+}
@@ -0,0 +1,16 @@
+package traefik_cloud_saver
+
+// neverScaledDown reports whether a cloud service, or a traefik service on it, is listed in
+// neverScaleDown, e.g. a canary kept up for monitoring.  Traefik services match with or without
+// their @provider.  Listed services are still evaluated, only the scale down is skipped.
+func (p *CloudSaver) neverScaledDown(cloudServiceName string, serviceNames ...string) bool {
+	if p.neverScaleDown[cloudServiceName] {
+		return true
+	}
+	for _, serviceName := range serviceNames {
+		if p.neverScaleDown[serviceName] || p.neverScaleDown[stripProvider(serviceName)] {
+			return true
+		}
+	}
+	return false
+}
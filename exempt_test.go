@@ -0,0 +1,82 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNeverScaleDown(t *testing.T) {
+	tests := []struct {
+		name      string
+		listed    []string
+		wantScale int32
+	}{
+		{name: "not listed", wantScale: 0},
+		{name: "traefik service", listed: []string{"canary@docker"}, wantScale: 1},
+		{name: "traefik service without provider", listed: []string{"canary"}, wantScale: 1},
+		{name: "cloud service", listed: []string{"pool"}, wantScale: 1},
+		{name: "other service", listed: []string{"web"}, wantScale: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			backend.addService("canary@docker", "canary@docker")
+			backend.setMetrics(`traefik_service_requests_total{service="canary@docker"} 0`, "")
+
+			saver, svc := newTestSaver(t, backend, map[string]int32{"pool": 1}, func(c *Config) {
+				c.ServiceInstances = map[string]string{"canary": "pool"}
+				c.NeverScaleDown = tt.listed
+			})
+			for i := 0; i < 2; i++ {
+				if _, err := saver.generateConfiguration(context.Background()); err != nil {
+					t.Fatalf("generateConfiguration() failed: %v", err)
+				}
+			}
+
+			if scale := currentScale(t, svc, "pool"); scale != tt.wantScale {
+				t.Errorf("expected pool at scale %d, got %d", tt.wantScale, scale)
+			}
+			// the canary is still evaluated, and its rate reported
+			if _, ok := saver.lastRates["canary@docker"]; !ok {
+				t.Error("expected the canary's rate to be tracked")
+			}
+			if exempt := saver.decisions.count("canary@docker", actionKeep, reasonNeverScaleDown) == 2; exempt != (tt.wantScale == 1) {
+				t.Errorf("never scale down decisions = %d", saver.decisions.count("canary@docker", actionKeep, reasonNeverScaleDown))
+			}
+		})
+	}
+}
+
+func TestNeverScaleDownOrphan(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("canary@docker", "canary@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="canary@docker"} 100`, "")
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"canary": 1}, func(c *Config) {
+		c.OrphanGracePeriod = "0s"
+		c.ScaleDownOrphans = true
+		c.NeverScaleDown = []string{"canary"}
+	})
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	backend.removeService("canary@docker")
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	if scale := currentScale(t, svc, "canary"); scale != 1 {
+		t.Errorf("expected the orphaned canary to stay at scale 1, got %d", scale)
+	}
+}
+
+func TestNeverScaleDownValidation(t *testing.T) {
+	config := CreateConfig()
+	config.WindowSize = "1s"
+	config.testMode = true
+	config.NeverScaleDown = []string{""}
+	if _, err := New(context.Background(), config, "test"); err == nil {
+		t.Error("expected an error for an empty service name")
+	}
+}
@@ -0,0 +1,36 @@
+package traefik_cloud_saver
+
+import (
+	"fmt"
+)
+
+// validateThresholds resolves the scale down threshold, scaleDownThreshold taking precedence over
+// its alias trafficThreshold, and checks the scale up threshold leaves a dead band above it
+func validateThresholds(config *Config) (float64, error) {
+	down := config.TrafficThreshold
+	if config.ScaleDownThreshold != 0 {
+		down = config.ScaleDownThreshold
+	}
+	if config.ScaleUpThreshold == 0 {
+		return down, nil
+	}
+
+	switch {
+	case config.ScaleUpThreshold < down:
+		return 0, fmt.Errorf("scale up threshold must be at least the scale down threshold %v, got %v", down, config.ScaleUpThreshold)
+	case config.IdleTimeout != "":
+		return 0, fmt.Errorf("scaleUpThreshold can't be used with idleTimeout")
+	case config.ScaleOn == scaleOnConcurrency:
+		return 0, fmt.Errorf("scaleUpThreshold can't be used with scaleOn %s", scaleOnConcurrency)
+	}
+	return down, nil
+}
+
+// scaleUpThresholdFor returns the rate a scaled down cloud service must climb above to be scaled up,
+// never below its scale down threshold
+func (p *CloudSaver) scaleUpThresholdFor(threshold float64) float64 {
+	if p.scaleUpThreshold < threshold {
+		return threshold
+	}
+	return p.scaleUpThreshold
+}
@@ -0,0 +1,93 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestScaleHysteresis(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("api@docker", "api@docker")
+	requests := 0
+	clock := &stepClock{now: time.Now()}
+	saver, svc := newTestSaver(t, backend, map[string]int32{"api": 1}, func(c *Config) {
+		c.ScaleDownThreshold = 2
+		c.ScaleUpThreshold = 10
+	}, WithClock(clock))
+	// each window is a minute, so the requests added are the rate
+	window := func(perMin int) {
+		t.Helper()
+		requests += perMin
+		backend.setMetrics(fmt.Sprintf(`traefik_service_requests_total{service="api@docker"} %d`, requests), "")
+		clock.now = clock.now.Add(time.Minute)
+		if _, err := saver.generateConfiguration(context.Background()); err != nil {
+			t.Fatalf("generateConfiguration() failed: %v", err)
+		}
+	}
+
+	steps := []struct {
+		name   string
+		perMin int
+		want   int32
+	}{
+		{name: "below the down threshold", perMin: 1, want: 0},
+		{name: "dead band keeps it down", perMin: 5, want: 0},
+		{name: "up threshold is exclusive", perMin: 10, want: 0},
+		{name: "above the up threshold", perMin: 15, want: 1},
+		{name: "dead band keeps it up", perMin: 5, want: 1},
+		{name: "down threshold is exclusive", perMin: 2, want: 1},
+		{name: "below the down threshold again", perMin: 1, want: 0},
+	}
+	for _, step := range steps {
+		window(step.perMin)
+		if scale := currentScale(t, svc, "api"); scale != step.want {
+			t.Fatalf("%s: %d req/min, expected scale %d, got %d", step.name, step.perMin, step.want, scale)
+		}
+	}
+
+	if got := saver.decisions.count("api@docker", actionScaleUp, reasonAboveThreshold); got != 1 {
+		t.Errorf("expected 1 scale up above the threshold, got %d", got)
+	}
+}
+
+func TestScaleThresholdsValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*Config)
+		wantErr   bool
+		wantDown  float64
+	}{
+		{name: "traffic threshold alias", configure: func(c *Config) { c.TrafficThreshold = 3 }, wantDown: 3},
+		{name: "scale down threshold wins", configure: func(c *Config) { c.ScaleDownThreshold = 4 }, wantDown: 4},
+		{name: "dead band", configure: func(c *Config) {
+			c.ScaleDownThreshold = 2
+			c.ScaleUpThreshold = 5
+		}, wantDown: 2},
+		{name: "up below down", configure: func(c *Config) {
+			c.ScaleDownThreshold = 5
+			c.ScaleUpThreshold = 2
+		}, wantErr: true},
+		{name: "with idle timeout", configure: func(c *Config) {
+			c.ScaleUpThreshold = 5
+			c.IdleTimeout = "10m"
+		}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.WindowSize = "1s"
+			config.testMode = true
+			tt.configure(config)
+			saver, err := New(context.Background(), config, "test")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && saver.trafficThreshold != tt.wantDown {
+				t.Errorf("expected scale down threshold %v, got %v", tt.wantDown, saver.trafficThreshold)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package traefik_cloud_saver
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// idleMetric is the name of the gauge exposing how long each service has gone without requests
+const idleMetric = "cloudsaver_service_idle_seconds"
+
+// scaleOnIdle is the decision mode of an idle timeout, alongside scaleOnRate and scaleOnConcurrency
+const scaleOnIdle = "idle"
+
+// decisionMode returns what the active engine scales down on: scaleOnConcurrency, scaleOnIdle with
+// an idle timeout, or otherwise scaleOnRate
+func (p *CloudSaver) decisionMode() string {
+	switch {
+	case p.scaleOn == scaleOnConcurrency:
+		return scaleOnConcurrency
+	case p.idleTimeout > 0:
+		return scaleOnIdle
+	}
+	return scaleOnRate
+}
+
+// belowThreshold reports whether the traefik services sharing a cloud service are idle enough to
+// scale it down.  With an idle timeout configured a service is idle once no requests have been
+// observed for that long, when scaling on concurrency no request may have been in progress during
+// the window, otherwise its weighted rate must be below the given traffic threshold.
+func (p *CloudSaver) belowThreshold(rate *ServiceRate, members []*instanceMember, threshold float64) bool {
+	switch p.decisionMode() {
+	case scaleOnConcurrency:
+		return p.peakConcurrency(members) == 0
+	case scaleOnIdle:
+		return p.idleFor(members) >= p.idleTimeout
+	}
+	return rate.PerMin < threshold
+}
+
+// idleFor returns how long it's been since any of the traefik services sharing a cloud service
+// received a request.  A service with zero weight doesn't count toward keeping it up.
+func (p *CloudSaver) idleFor(members []*instanceMember) time.Duration {
+	var lastRequest time.Time
+	for _, member := range members {
+		if p.serviceWeight(member.serviceName) <= 0 {
+			continue
+		}
+		if member.rate.LastRequest.After(lastRequest) {
+			lastRequest = member.rate.LastRequest
+		}
+	}
+	if lastRequest.IsZero() {
+		return p.idleTimeout
+	}
+	return since(p.clock, lastRequest)
+}
+
+// idleGauges holds how long each traefik service had gone without a request as of the last
+// window, to show which services are candidates for scale down
+type idleGauges struct {
+	mu      sync.Mutex
+	seconds map[string]float64
+}
+
+func newIdleGauges() *idleGauges {
+	return &idleGauges{seconds: make(map[string]float64)}
+}
+
+// update replaces the gauges with the idle time of each service in the window's rates, so
+// services which are gone drop out
+func (g *idleGauges) update(clock Clock, rates map[string]*ServiceRate) {
+	seconds := make(map[string]float64, len(rates))
+	for serviceName, rate := range rates {
+		if isGeneratedService(serviceName) || rate.LastRequest.IsZero() {
+			continue
+		}
+		seconds[serviceName] = since(clock, rate.LastRequest).Seconds()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.seconds = seconds
+}
+
+// get returns the gauge of a service
+func (g *idleGauges) get(serviceName string) (float64, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	seconds, ok := g.seconds[serviceName]
+	return seconds, ok
+}
+
+// writeTo writes the gauges in the Prometheus text format
+func (g *idleGauges) writeTo(w io.Writer) {
+	g.mu.Lock()
+	services := make([]string, 0, len(g.seconds))
+	for serviceName := range g.seconds {
+		services = append(services, serviceName)
+	}
+	seconds := make(map[string]float64, len(g.seconds))
+	for serviceName, value := range g.seconds {
+		seconds[serviceName] = value
+	}
+	g.mu.Unlock()
+	sort.Strings(services)
+
+	fmt.Fprintf(w, "# HELP %s Seconds since each service last received a request, as of the last window.\n", idleMetric)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", idleMetric)
+	for _, serviceName := range services {
+		fmt.Fprintf(w, "%s{service=\"%s\"} %g\n", idleMetric, escapeLabelValue(serviceName), seconds[serviceName])
+	}
+}
@@ -0,0 +1,115 @@
+package traefik_cloud_saver
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("busy@docker", "busy@docker")
+	backend.addService("recent@docker", "recent@docker")
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="busy@docker"} 100
+traefik_service_requests_total{service="recent@docker"} 5
+traefik_service_requests_total{service="idle@docker"} 5
+`, "")
+
+	saver, cloud := newTestSaver(t, backend, map[string]int32{"busy": 1, "recent": 1, "idle": 1}, func(c *Config) {
+		c.IdleTimeout = "1h"
+	})
+
+	// every service was just seen for the first time, so none of them have been idle long enough
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("first generateConfiguration() failed: %v", err)
+	}
+	for _, name := range []string{"busy", "recent", "idle"} {
+		if scale := currentScale(t, cloud, name); scale != 1 {
+			t.Fatalf("expected %s to stay up in the first window, got %d", name, scale)
+		}
+	}
+
+	// recent and idle get no requests this window, but only idle has gone without for an hour
+	now := time.Now()
+	saver.metricsCollector.lastRequest["recent@docker"] = now.Add(-10 * time.Minute)
+	saver.metricsCollector.lastRequest["idle@docker"] = now.Add(-2 * time.Hour)
+	saver.metricsCollector.lastRequest["busy@docker"] = now.Add(-2 * time.Hour)
+	backend.setMetrics(`
+traefik_service_requests_total{service="busy@docker"} 101
+traefik_service_requests_total{service="recent@docker"} 5
+traefik_service_requests_total{service="idle@docker"} 5
+`, "")
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("second generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, cloud, "busy"); scale != 1 {
+		t.Errorf("expected busy to stay up after a request, got %d", scale)
+	}
+	if scale := currentScale(t, cloud, "recent"); scale != 1 {
+		t.Errorf("expected recently active service to stay up, got %d", scale)
+	}
+	if scale := currentScale(t, cloud, "idle"); scale != 0 {
+		t.Errorf("expected idle service to be scaled down, got %d", scale)
+	}
+}
+
+func TestIdleTimeoutValidation(t *testing.T) {
+	for _, timeout := range []string{"later", "0s", "-1m"} {
+		config := CreateConfig()
+		config.WindowSize = "1s"
+		config.testMode = true
+		config.IdleTimeout = timeout
+		if _, err := New(context.Background(), config, "test"); err == nil {
+			t.Errorf("expected error for idle timeout %q", timeout)
+		}
+	}
+}
+
+func TestIdleGauges(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("busy@docker", "busy@docker")
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="busy@docker"} 100
+traefik_service_requests_total{service="idle@docker"} 5
+`, "")
+
+	clock := &stepClock{now: time.Now()}
+	saver, _ := newTestSaver(t, backend, map[string]int32{"busy": 1, "idle": 1}, nil, WithClock(clock))
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("first generateConfiguration() failed: %v", err)
+	}
+
+	// ten minutes on, only busy got requests
+	clock.now = clock.now.Add(10 * time.Minute)
+	backend.setMetrics(`
+traefik_service_requests_total{service="busy@docker"} 200
+traefik_service_requests_total{service="idle@docker"} 5
+`, "")
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("second generateConfiguration() failed: %v", err)
+	}
+
+	for serviceName, want := range map[string]float64{"busy@docker": 0, "idle@docker": 600} {
+		if got, ok := saver.idleGauges.get(serviceName); !ok || got != want {
+			t.Errorf("expected %s idle for %vs, got %v (present %v)", serviceName, want, got, ok)
+		}
+	}
+
+	var out bytes.Buffer
+	saver.idleGauges.writeTo(&out)
+	for _, want := range []string{
+		"# TYPE cloudsaver_service_idle_seconds gauge",
+		`cloudsaver_service_idle_seconds{service="busy@docker"} 0`,
+		`cloudsaver_service_idle_seconds{service="idle@docker"} 600`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in the self metrics, got:\n%s", want, out.String())
+		}
+	}
+}
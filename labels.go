@@ -0,0 +1,81 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud"
+)
+
+const (
+	// labelExclude set to "true" on an instance keeps the plugin from ever scaling it down
+	labelExclude = "cloudsaver-exclude"
+
+	// labelMinUptime is the minimum time (e.g. "30m") an instance stays up after the plugin has
+	// scaled it up, before it may be scaled down again
+	labelMinUptime = "cloudsaver-min-uptime"
+)
+
+// instancePolicy is the per-instance behavior read from the labels of a cloud resource
+type instancePolicy struct {
+	exclude   bool
+	minUptime time.Duration
+}
+
+// instancePolicy reads the labels of a cloud service, for providers which support them.  Providers
+// without labels always get the default (empty) policy.
+func (p *CloudSaver) instancePolicy(ctx context.Context, cloudServiceName string) (instancePolicy, error) {
+	var policy instancePolicy
+
+	reader, ok := p.cloudService.(cloud.LabelReader)
+	if !ok {
+		return policy, nil
+	}
+
+	labels, err := reader.GetLabels(ctx, cloudServiceName)
+	if err != nil {
+		return policy, fmt.Errorf("failed to get labels for %s: %w", cloudServiceName, err)
+	}
+
+	if value, ok := labels[labelExclude]; ok {
+		exclude, err := strconv.ParseBool(value)
+		if err != nil {
+			return policy, fmt.Errorf("invalid %s label on %s: %q", labelExclude, cloudServiceName, value)
+		}
+		policy.exclude = exclude
+	}
+
+	if value, ok := labels[labelMinUptime]; ok {
+		minUptime, err := time.ParseDuration(value)
+		if err != nil || minUptime < 0 {
+			return policy, fmt.Errorf("invalid %s label on %s: %q", labelMinUptime, cloudServiceName, value)
+		}
+		policy.minUptime = minUptime
+	}
+
+	return policy, nil
+}
+
+// canScaleDown checks the instance policy of a cloud service, returning a reason when the
+// instance must be left running
+func (p *CloudSaver) canScaleDown(ctx context.Context, cloudServiceName string) (bool, string) {
+	policy, err := p.instancePolicy(ctx, cloudServiceName)
+	if err != nil {
+		// without the labels we can't know if the instance opted out, so leave it alone
+		return false, err.Error()
+	}
+
+	if policy.exclude {
+		return false, fmt.Sprintf("%s label is set", labelExclude)
+	}
+
+	if scaledUpAt, ok := p.scaledUpAt[cloudServiceName]; ok && policy.minUptime > 0 {
+		if uptime := since(p.clock, scaledUpAt); uptime < policy.minUptime {
+			return false, fmt.Sprintf("up for %s, %s is %s", uptime.Round(time.Second), labelMinUptime, policy.minUptime)
+		}
+	}
+
+	return true, ""
+}
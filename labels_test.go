@@ -0,0 +1,96 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInstanceLabelExclude(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("svc1@docker", "r1@docker")
+	backend.addService("svc2@docker", "r2@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="svc1@docker"} 0
+traefik_service_requests_total{service="svc2@docker"} 0
+`, "")
+
+	saver, cloud := newTestSaver(t, backend, map[string]int32{"svc1": 1, "svc2": 1}, nil)
+	cloud.SetLabels("svc1", map[string]string{labelExclude: "true"})
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	if scale := currentScale(t, cloud, "svc1"); scale != 1 {
+		t.Errorf("excluded svc1 should be left running, got scale %d", scale)
+	}
+	if scale := currentScale(t, cloud, "svc2"); scale != 0 {
+		t.Errorf("expected svc2 to be scaled down, got scale %d", scale)
+	}
+	if _, ok := saver.sleeping["svc1@docker"]; ok {
+		t.Error("excluded svc1 should not be sleeping")
+	}
+}
+
+func TestInstanceLabelMinUptime(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("svc1@docker", "r1@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="svc1@docker"} 0`, "")
+
+	saver, cloud := newTestSaver(t, backend, map[string]int32{"svc1": 0}, nil)
+	cloud.SetLabels("svc1", map[string]string{labelMinUptime: "1h"})
+
+	// the plugin has just brought svc1 back up
+	if err := saver.scaleUp(context.Background(), "svc1"); err != nil {
+		t.Fatalf("scaleUp() failed: %v", err)
+	}
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, cloud, "svc1"); scale != 1 {
+		t.Errorf("svc1 should stay up for its minimum uptime, got scale %d", scale)
+	}
+
+	// once the minimum uptime has passed it's fair game
+	saver.scaledUpAt["svc1"] = time.Now().Add(-2 * time.Hour)
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, cloud, "svc1"); scale != 0 {
+		t.Errorf("expected svc1 to be scaled down after its minimum uptime, got scale %d", scale)
+	}
+}
+
+func TestInstancePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    instancePolicy
+		wantErr bool
+	}{
+		{name: "no labels", labels: nil, want: instancePolicy{}},
+		{name: "unrelated labels", labels: map[string]string{"env": "dev"}, want: instancePolicy{}},
+		{name: "excluded", labels: map[string]string{labelExclude: "true"}, want: instancePolicy{exclude: true}},
+		{name: "explicitly included", labels: map[string]string{labelExclude: "false"}, want: instancePolicy{}},
+		{name: "min uptime", labels: map[string]string{labelMinUptime: "30m"}, want: instancePolicy{minUptime: 30 * time.Minute}},
+		{name: "invalid exclude", labels: map[string]string{labelExclude: "maybe"}, wantErr: true},
+		{name: "invalid min uptime", labels: map[string]string{labelMinUptime: "soon"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saver, cloud := newTestSaver(t, newTestBackend(t), map[string]int32{"svc1": 1}, nil)
+			cloud.SetLabels("svc1", tt.labels)
+
+			got, err := saver.instancePolicy(context.Background(), "svc1")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("instancePolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("instancePolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
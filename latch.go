@@ -0,0 +1,66 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// latchState latches a cloud service after it's scaled down, so an instance started again (by
+// hand, or by the plugin itself) isn't scaled straight back down before it's had a chance to
+// serve anything.  The latch is released once the service has seen traffic and a full window has
+// passed since it was scaled down.
+type latchState struct {
+	since      time.Time
+	sawTraffic bool
+}
+
+// latch marks a cloud service as just scaled down
+func (p *CloudSaver) latch(cloudServiceName string) {
+	p.latches[cloudServiceName] = latchState{since: p.clock.Now()}
+}
+
+// updateLatch records traffic to any of the traefik services sharing a latched cloud service,
+// and releases the latch once the conditions are met
+func (p *CloudSaver) updateLatch(cloudServiceName string, members []*instanceMember) {
+	state, ok := p.latches[cloudServiceName]
+	if !ok {
+		return
+	}
+
+	if !state.sawTraffic {
+		for _, member := range members {
+			if member.rate.PerMin > 0 {
+				state.sawTraffic = true
+				p.latches[cloudServiceName] = state
+				break
+			}
+		}
+	}
+
+	if state.sawTraffic && since(p.clock, state.since) >= p.windowSize {
+		common.DebugLog("traefik-cloud-saver", "service %s has seen traffic since it was scaled down, releasing its latch", cloudServiceName)
+		delete(p.latches, cloudServiceName)
+	}
+}
+
+// demandSeen records requests for a latched cloud service which didn't show up in its rate,
+// e.g. those answered by its sleeping router that woke it up
+func (p *CloudSaver) demandSeen(cloudServiceName string) {
+	if state, ok := p.latches[cloudServiceName]; ok {
+		state.sawTraffic = true
+		p.latches[cloudServiceName] = state
+	}
+}
+
+// latched reports whether scaling a cloud service down must wait for its latch.  A service still
+// at zero is fine to scale down again, that only re-asserts the scale, and so is one whose scale
+// can't be read since there's no telling it was started again.
+func (p *CloudSaver) latched(ctx context.Context, cloudServiceName string) bool {
+	if _, ok := p.latches[cloudServiceName]; !ok {
+		return false
+	}
+	scale, err := p.cloudService.GetCurrentScale(ctx, cloudServiceName)
+	return err == nil && scale > 0
+}
@@ -0,0 +1,78 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestScaleDownLatch(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	requests := 5
+	setRequests := func() {
+		backend.setMetrics(fmt.Sprintf(`traefik_service_requests_total{service="idle@docker"} %d`, requests), "")
+	}
+	setRequests()
+
+	clock := &stepClock{now: time.Now()}
+	saver, svc := newTestSaver(t, backend, map[string]int32{"idle": 1}, nil, WithClock(clock))
+	window := func() {
+		t.Helper()
+		clock.now = clock.now.Add(10 * time.Minute)
+		if _, err := saver.generateConfiguration(context.Background()); err != nil {
+			t.Fatalf("generateConfiguration() failed: %v", err)
+		}
+	}
+
+	// the first window's counter is taken as the rate, wait for a quiet window to scale down
+	window()
+	window()
+	if scale := currentScale(t, svc, "idle"); scale != 0 {
+		t.Fatalf("expected idle to be scaled down, got scale %d", scale)
+	}
+
+	// started by hand, without traffic it stays up however many windows pass
+	svc.SetScale("idle", 1)
+	window()
+	window()
+	if scale := currentScale(t, svc, "idle"); scale != 1 {
+		t.Errorf("expected the latch to keep idle up, got scale %d", scale)
+	}
+	if got := saver.decisions.count("idle@docker", actionKeep, reasonLatched); got != 2 {
+		t.Errorf("expected 2 latched decisions, got %d", got)
+	}
+
+	// a request, even below the threshold, releases the latch
+	requests++
+	setRequests()
+	window()
+	if scale := currentScale(t, svc, "idle"); scale != 0 {
+		t.Errorf("expected idle to be scaled down once it has seen traffic, got scale %d", scale)
+	}
+}
+
+func TestLatchWaitsForWindow(t *testing.T) {
+	clock := &stepClock{now: time.Now()}
+	backend := newTestBackend(t)
+	saver, _ := newTestSaver(t, backend, nil, func(c *Config) {
+		c.WindowSize = "10m"
+	}, WithClock(clock))
+
+	busy := []*instanceMember{{serviceName: "svc@docker", rate: &ServiceRate{PerMin: 5}}}
+	saver.latch("svc")
+
+	// traffic straight after scaling down isn't enough on its own
+	clock.now = clock.now.Add(time.Minute)
+	saver.updateLatch("svc", busy)
+	if _, ok := saver.latches["svc"]; !ok {
+		t.Fatal("expected the latch to be held until a window has passed")
+	}
+
+	clock.now = clock.now.Add(10 * time.Minute)
+	saver.updateLatch("svc", []*instanceMember{{serviceName: "svc@docker", rate: &ServiceRate{}}})
+	if _, ok := saver.latches["svc"]; ok {
+		t.Error("expected the latch to be released once traffic was seen and a window passed")
+	}
+}
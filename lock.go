@@ -0,0 +1,168 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// Locker coordinates scale actions between replicas of the plugin watching the same services.  A
+// replica only scales a cloud service while it holds that service's lock.  Implementations backed
+// by shared storage (GCS, Redis, ...) can be passed to New with WithLocker, the default is file
+// based.
+type Locker interface {
+	// TryLock takes the named lock for owner without waiting, reporting false if another owner
+	// holds it
+	TryLock(ctx context.Context, name, owner string) (bool, error)
+	// Unlock releases the named lock if owner holds it
+	Unlock(ctx context.Context, name, owner string) error
+}
+
+// LockConfig configures the file based Locker
+type LockConfig struct {
+	Dir string `json:"dir"`           // directory shared by the replicas, e.g. a mounted volume
+	TTL string `json:"ttl,omitempty"` // locks older than this are from a crashed replica and taken over, default 5m
+}
+
+// defaultLockTTL is well beyond how long a scale action takes
+const defaultLockTTL = 5 * time.Minute
+
+// errLockHeld is returned for a scale action skipped because another replica holds the lock
+var errLockHeld = errors.New("scale lock held by another replica")
+
+// fileLocker implements Locker with one lock file per name, created exclusively so only one
+// replica can hold it
+type fileLocker struct {
+	dir   string
+	ttl   time.Duration
+	clock Clock
+}
+
+// parseLockTTL validates the lock configuration and returns its ttl
+func parseLockTTL(config *LockConfig) (time.Duration, error) {
+	if config.Dir == "" {
+		return 0, errors.New("lock dir is required")
+	}
+	if config.TTL == "" {
+		return defaultLockTTL, nil
+	}
+	ttl, err := time.ParseDuration(config.TTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid lock ttl: %w", err)
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("lock ttl must be positive, got %v", ttl)
+	}
+	return ttl, nil
+}
+
+// newFileLocker creates the lock directory of a configuration parseLockTTL has checked
+func newFileLocker(dir string, ttl time.Duration, clock Clock) (*fileLocker, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create lock dir: %w", err)
+	}
+	return &fileLocker{dir: dir, ttl: ttl, clock: clock}, nil
+}
+
+// path returns the lock file for a name, which may contain characters not allowed in file names
+func (l *fileLocker) path(name string) string {
+	return filepath.Join(l.dir, strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(name)+".lock")
+}
+
+func (l *fileLocker) TryLock(_ context.Context, name, owner string) (bool, error) {
+	path := l.path(name)
+
+	// a single retry, after removing a stale lock
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, err = file.WriteString(owner)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				_ = os.Remove(path)
+				return false, fmt.Errorf("failed to write lock %s: %w", path, err)
+			}
+			return true, nil
+		}
+		if !os.IsExist(err) {
+			return false, fmt.Errorf("failed to create lock %s: %w", path, err)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// released in the meantime
+				continue
+			}
+			return false, fmt.Errorf("failed to stat lock %s: %w", path, err)
+		}
+		if since(l.clock, info.ModTime()) < l.ttl {
+			return false, nil
+		}
+		common.LogProvider("traefik-cloud-saver", "taking over stale lock %s, held since %s", path, info.ModTime().Format(time.RFC3339))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return false, fmt.Errorf("failed to remove stale lock %s: %w", path, err)
+		}
+	}
+	return false, nil
+}
+
+func (l *fileLocker) Unlock(_ context.Context, name, owner string) error {
+	path := l.path(name)
+	holder, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read lock %s: %w", path, err)
+	}
+	if string(holder) != owner {
+		// taken over as stale, it's no longer ours to release
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove lock %s: %w", path, err)
+	}
+	return nil
+}
+
+// newLockOwner returns an identity for this replica, unique even for replicas in one process
+func newLockOwner(name string) string {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s/%s/%d/%s", hostname, name, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// withScaleLock runs a scale action on a cloud service while holding its lock, returning
+// errLockHeld without running it if another replica holds the lock.  Without a locker the action
+// always runs.
+func (p *CloudSaver) withScaleLock(ctx context.Context, cloudServiceName string, action func() error) error {
+	if p.locker == nil {
+		return action()
+	}
+
+	locked, err := p.locker.TryLock(ctx, cloudServiceName, p.lockOwner)
+	if err != nil {
+		return fmt.Errorf("failed to lock %s: %w", cloudServiceName, err)
+	}
+	if !locked {
+		return errLockHeld
+	}
+	defer func() {
+		if err := p.locker.Unlock(ctx, cloudServiceName, p.lockOwner); err != nil {
+			common.LogProvider("traefik-cloud-saver", "ERROR: failed to unlock %s: %v", cloudServiceName, err)
+		}
+	}()
+	return action()
+}
@@ -0,0 +1,135 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFileLocker(t *testing.T) {
+	ctx := context.Background()
+	clock := &stepClock{now: time.Now()}
+	locker, err := newFileLocker(t.TempDir(), time.Minute, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := locker.TryLock(ctx, "svc", "a"); err != nil || !ok {
+		t.Fatalf("TryLock(a) = %v, %v, want true", ok, err)
+	}
+	if ok, err := locker.TryLock(ctx, "svc", "b"); err != nil || ok {
+		t.Fatalf("TryLock(b) while held by a = %v, %v, want false", ok, err)
+	}
+	if ok, err := locker.TryLock(ctx, "other", "b"); err != nil || !ok {
+		t.Fatalf("TryLock(b) on another service = %v, %v, want true", ok, err)
+	}
+
+	// only the holder releases the lock
+	if err := locker.Unlock(ctx, "svc", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(locker.path("svc")); err != nil {
+		t.Fatalf("lock released by a non-holder: %v", err)
+	}
+	if err := locker.Unlock(ctx, "svc", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := locker.TryLock(ctx, "svc", "b"); err != nil || !ok {
+		t.Fatalf("TryLock(b) after release = %v, %v, want true", ok, err)
+	}
+
+	// a stale lock is taken over
+	clock.now = clock.now.Add(2 * time.Minute)
+	if ok, err := locker.TryLock(ctx, "svc", "a"); err != nil || !ok {
+		t.Fatalf("TryLock(a) on a stale lock = %v, %v, want true", ok, err)
+	}
+}
+
+func TestFileLockerContention(t *testing.T) {
+	locker, err := newFileLocker(t.TempDir(), defaultLockTTL, realClock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	winners := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			ok, err := locker.TryLock(context.Background(), "svc", owner)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			}
+		}(newLockOwner("test"))
+	}
+	wg.Wait()
+
+	if winners != 1 {
+		t.Errorf("expected exactly one replica to take the lock, got %d", winners)
+	}
+}
+
+func TestScaleLockBetweenReplicas(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+	lockDir := t.TempDir()
+	configure := func(c *Config) {
+		c.Lock = &LockConfig{Dir: lockDir}
+	}
+	first, svc := newTestSaver(t, backend, map[string]int32{"idle": 1}, configure)
+	second, _ := newTestSaver(t, backend, nil, configure)
+	second.cloudService = svc
+
+	// the first replica is in the middle of acting on the service
+	ctx := context.Background()
+	if ok, err := first.locker.TryLock(ctx, "idle", first.lockOwner); err != nil || !ok {
+		t.Fatalf("TryLock() = %v, %v, want true", ok, err)
+	}
+
+	if _, err := second.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, svc, "idle"); scale != 1 {
+		t.Errorf("expected the second replica to leave idle alone while locked, got scale %d", scale)
+	}
+	if got := second.decisions.counts[decisionKey{"idle@docker", actionKeep, reasonLocked}]; got != 1 {
+		t.Errorf("expected one locked decision, got %d", got)
+	}
+
+	if err := first.locker.Unlock(ctx, "idle", first.lockOwner); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := second.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, svc, "idle"); scale != 0 {
+		t.Errorf("expected the second replica to scale idle down once unlocked, got scale %d", scale)
+	}
+	if _, err := os.Stat(first.locker.(*fileLocker).path("idle")); !os.IsNotExist(err) {
+		t.Errorf("expected the lock to be released after scaling, got %v", err)
+	}
+}
+
+func TestLockConfigValidation(t *testing.T) {
+	for _, lock := range []*LockConfig{{Dir: ""}, {Dir: t.TempDir(), TTL: "soon"}, {Dir: t.TempDir(), TTL: "-1m"}} {
+		config := CreateConfig()
+		config.WindowSize = "1s"
+		config.testMode = true
+		config.Lock = lock
+		if _, err := New(context.Background(), config, "test"); err == nil {
+			t.Errorf("expected error for lock config %+v", lock)
+		}
+	}
+}
@@ -2,61 +2,265 @@ package traefik_cloud_saver
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
 )
 
+// errUnexpectedMetricsContent is returned when the metrics endpoint responds with something
+// that clearly isn't Prometheus text format (e.g. an HTML error or login page)
+var errUnexpectedMetricsContent = errors.New("unexpected metrics content")
+
+// maxBufferedSamples bounds the scrape buffer if decisions stop consuming it
+const maxBufferedSamples = 1024
+
 // MetricsCollector handles all metrics-related operations
 type MetricsCollector struct {
+	scrapeErrors uint64 // failed fetches, first for 64-bit alignment of the atomic counter
+
 	client     *http.Client
 	metricsURL string
+
+	// serializes GetServiceRates, which updates the baselines and the per service tracking below
+	mu         sync.Mutex
 	lastCounts map[string]float64
+	lastErrors map[string]float64
 	lastTime   time.Time
+	clock      Clock
+
+	// when each service's request counter last increased
+	lastRequest map[string]time.Time
+
+	// with a sample or rate window, the last sampleWindow counter samples of each service, going
+	// back rateWindow
+	sampleWindow int
+	rateWindow   time.Duration
+	history      map[string][]ratePoint
+
+	// first digits of the response codes counted as successful traffic, e.g. "2" for 2xx
+	successClasses string
+
+	// labels a request counter series must carry, with these values, to be counted
+	labelFilter map[string]string
+
+	// per service rates observed while bootstrapping
+	observed map[string][]float64
+
+	// when set, rates come from this PromQL query against a Prometheus server instead of a scrape
+	promQL string
+
+	// credentials sent with every scrape, nil for an open endpoint
+	auth *MetricsAuth
+
+	// other Traefik replicas whose counters are added to the metrics endpoint's, and the last
+	// sample each one answered with
+	replicas       []metricsEndpoint
+	replicasMu     sync.Mutex
+	replicaSamples map[string]metricsSample
+
+	// the request counter family, and the label rates are keyed by
+	requestsMetric string
+	keyLabel       string
+
+	// additional metric families tracked per service, true for gauges
+	activityMetrics map[string]bool
+	lastActivity    map[string]map[string]float64
+
+	// whether the requests in progress gauge is tracked
+	trackConcurrency bool
+
+	// what to do when the time since the last decision is implausible for the expected poll period
+	durationPolicy   string
+	expectedDuration time.Duration
+
+	// samples scraped in the background since the last GetServiceRates call
+	samplesMu sync.Mutex
+	samples   []metricsSample
+
+	// with WithParseDebug, what the last scrape of each endpoint parsed into
+	parsedMu sync.Mutex
+	parsed   map[string]ParsedScrape
+}
+
+// metricsSample is one scrape of the per-service request counters
+type metricsSample struct {
+	time         time.Time
+	counts       map[string]float64 // successful requests
+	serverErrors map[string]float64 // 5xx responses
+
+	activity map[string]map[string]float64 // metric family -> service -> value
+	inFlight map[string]float64            // requests in progress
 }
 
 type ServiceRate struct {
-	ServiceName string
-	Total       float64
-	PerMin      float64
-	Duration    time.Duration
+	ServiceName  string
+	Total        float64
+	PerMin       float64
+	Duration     time.Duration
+	ServerErrors float64   // number of 5xx responses since the last call
+	LastRequest  time.Time // when the request counter last increased, first seen if it never has
+	Samples      int       // number of counter samples the rate is based on
+
+	// per activity metric family, the per minute increase of a counter or the current value of a gauge
+	Activity map[string]float64
+
+	Concurrency float64 // most requests in progress in any sample of the window, when tracked
+}
+
+// MetricsCollectorOption configures a MetricsCollector
+type MetricsCollectorOption func(*MetricsCollector)
+
+// WithMetricLabels only counts request counter series carrying all of the labels with the given
+// values, e.g. {"namespace": "prod"} when several environments share the metrics.
+func WithMetricLabels(labels map[string]string) MetricsCollectorOption {
+	return func(mc *MetricsCollector) {
+		mc.labelFilter = labels
+	}
+}
+
+// WithMetricSource keys rates by the router of the router request counters rather than by the
+// service of the service request counters, for setups where the service label isn't reliable
+func WithMetricSource(source string) MetricsCollectorOption {
+	return func(mc *MetricsCollector) {
+		if source == metricSourceRouter {
+			mc.requestsMetric = routerRequestsMetric
+			mc.keyLabel = metricSourceRouter
+		}
+	}
 }
 
 // NewMetricsCollector creates a new metrics collector
-func NewMetricsCollector(url string) *MetricsCollector {
-	return &MetricsCollector{
-		client:     &http.Client{Timeout: 5 * time.Second},
+func NewMetricsCollector(url string, opts ...MetricsCollectorOption) *MetricsCollector {
+	mc := &MetricsCollector{
+		client:     &http.Client{Timeout: defaultMetricsTimeout},
 		metricsURL: url,
 		lastCounts: make(map[string]float64),
 		lastTime:   time.Now(),
+
+		lastRequest: make(map[string]time.Time),
+		clock:       realClock{},
+
+		successClasses: defaultSuccessClasses,
+		requestsMetric: serviceRequestsMetric,
+		keyLabel:       metricSourceService,
+	}
+	for _, opt := range opts {
+		opt(mc)
 	}
+	return mc
 }
 
-// GetServiceRates fetches request rates for all services
-func (mc *MetricsCollector) GetServiceRates() (map[string]*ServiceRate, error) {
-	currentCounts, err := mc.fetchServiceRequests()
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch service metrics: %w", err)
+// defaultSuccessClasses counts every 2xx response as traffic
+const defaultSuccessClasses = "2"
+
+// parseSuccessCodes turns code classes such as ["2xx", "3xx"] into the first digits they accept.
+// 5xx can't be counted as traffic since those responses are tracked as server errors.
+func parseSuccessCodes(codes []string) (string, error) {
+	if len(codes) == 0 {
+		return defaultSuccessClasses, nil
+	}
+
+	var classes string
+	for _, code := range codes {
+		lower := strings.ToLower(code)
+		if len(lower) != 3 || lower[1:] != "xx" || lower[0] < '1' || lower[0] > '4' {
+			return "", fmt.Errorf("invalid success code class %q, expected one of 1xx, 2xx, 3xx or 4xx", code)
+		}
+		if !strings.Contains(classes, lower[:1]) {
+			classes += lower[:1]
+		}
+	}
+	return classes, nil
+}
+
+// GetServiceRates fetches request rates for all services.  If a background scraper is running the
+// buffered samples are consumed, otherwise the metrics endpoint is scraped once now, until ctx is
+// done.
+func (mc *MetricsCollector) GetServiceRates(ctx context.Context) (map[string]*ServiceRate, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if mc.promQL != "" {
+		return mc.queryServiceRates(ctx)
+	}
+
+	samples := mc.drainSamples()
+	if len(samples) == 0 {
+		sample, err := mc.fetchSample(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch service metrics: %w", err)
+		}
+		samples = []metricsSample{sample}
+	}
+
+	if mc.windowed() {
+		mc.recordHistory(samples)
+	}
+
+	// with no previous decision, the first buffered sample (if there's more than one) is the baseline
+	decided := len(mc.lastCounts) > 0
+	if !decided && len(samples) > 1 {
+		mc.setBaseline(samples[0])
+		samples = samples[1:]
 	}
 
-	now := time.Now()
-	duration := now.Sub(mc.lastTime)
+	latest := samples[len(samples)-1]
+	duration := latest.time.Sub(mc.lastTime)
+	if decided && !mc.windowed() {
+		checked, advance, err := mc.checkDuration(duration)
+		if err != nil {
+			if advance {
+				for service := range latest.counts {
+					mc.trackLastRequest(service, samples)
+				}
+				mc.setBaseline(latest)
+			}
+			return nil, err
+		}
+		duration = checked
+	}
 	rates := make(map[string]*ServiceRate)
+	pending := make(map[string]bool) // services without enough samples for a windowed rate
 
-	common.DebugLog("traefik-cloud-saver", "Current counts: %v, Last counts: %v, Duration: %v", currentCounts, mc.lastCounts, duration)
+	common.DebugLog("traefik-cloud-saver", "Current counts: %v, Last counts: %v, Duration: %v, Samples: %d", latest.counts, mc.lastCounts, duration, len(samples))
 
-	for service, count := range currentCounts {
+	for service, count := range latest.counts {
 		var ratePerMin float64
-		if len(mc.lastCounts) == 0 {
+		sampleCount := len(samples) + 1
+		if mc.windowed() {
+			var ok bool
+			ratePerMin, sampleCount, ok = mc.windowRate(service)
+			if !ok {
+				common.DebugLog("traefik-cloud-saver", "service %s has %d sample(s), waiting for more before reporting a rate", service, sampleCount)
+				mc.trackLastRequest(service, samples)
+				pending[service] = true
+				continue
+			}
+		} else if len(mc.lastCounts) == 0 {
+			sampleCount = 1
 			// map is empty on first run - use total count divided by 1 minute as initial rate
 			ratePerMin = count
 		} else {
-			lastCount := mc.lastCounts[service]
-			requestDiff := count - lastCount
+			// sum the increase between each consecutive sample, starting from the last decision
+			requestDiff := 0.0
+			previous := mc.lastCounts[service]
+			for _, sample := range samples {
+				current, ok := sample.counts[service]
+				if !ok {
+					continue
+				}
+				requestDiff += counterIncrease(previous, current)
+				previous = current
+			}
 			if duration.Seconds() > 0 {
 				ratePerMin = (requestDiff / duration.Seconds()) * 60
 			}
@@ -67,20 +271,230 @@ func (mc *MetricsCollector) GetServiceRates() (map[string]*ServiceRate, error) {
 			Total:       count,
 			PerMin:      ratePerMin,
 			Duration:    duration,
+			LastRequest: mc.trackLastRequest(service, samples),
+			Samples:     sampleCount,
+		}
+	}
+
+	// Traefik may drop the counter of a service which stops getting requests altogether, and that's
+	// the service we most want to scale down, so services seen before are reported with no traffic.
+	// An empty scrape is left alone, it says more about the metrics than about the services.
+	if len(latest.counts) > 0 {
+		for service, lastRequest := range mc.lastRequest {
+			if _, ok := latest.counts[service]; ok {
+				continue
+			}
+			common.DebugLog("traefik-cloud-saver", "service %s is missing from the metrics, reporting no traffic", service)
+			rates[service] = &ServiceRate{
+				ServiceName: service,
+				Duration:    duration,
+				LastRequest: lastRequest,
+				Samples:     len(samples),
+			}
+		}
+	}
+
+	// 5xx responses are tracked separately from traffic.  On the first run there's no baseline,
+	// so historic errors are ignored.
+	if mc.lastErrors != nil {
+		for service, errorCount := range latest.serverErrors {
+			increase := counterIncrease(mc.lastErrors[service], errorCount)
+			if increase <= 0 {
+				continue
+			}
+			rate, ok := rates[service]
+			if !ok {
+				rate = &ServiceRate{ServiceName: service, Duration: duration}
+				rates[service] = rate
+			}
+			rate.ServerErrors = increase
+		}
+	}
+
+	for family, gauge := range mc.activityMetrics {
+		for service := range latest.activity[family] {
+			rate, ok := rates[service]
+			if !ok {
+				rate = &ServiceRate{ServiceName: service, Duration: duration}
+				rates[service] = rate
+			}
+			if rate.Activity == nil {
+				rate.Activity = make(map[string]float64)
+			}
+			rate.Activity[family] = mc.activityRate(family, service, gauge, samples, duration)
 		}
 	}
 
-	mc.lastCounts = currentCounts
-	mc.lastTime = now
+	if mc.trackConcurrency {
+		observeConcurrency(rates, samples, duration)
+	}
+
+	mc.setBaseline(latest)
+
+	// errors or activity alone mustn't give a service a (zero) rate before it has enough samples
+	for service := range pending {
+		delete(rates, service)
+	}
 
 	return rates, nil
 }
 
-// fetchServiceRequests parses Prometheus metrics text format manually
-func (mc *MetricsCollector) fetchServiceRequests() (map[string]float64, error) {
-	resp, err := mc.client.Get(mc.metricsURL)
+// setBaseline makes a sample the one the next rates are computed from
+func (mc *MetricsCollector) setBaseline(sample metricsSample) {
+	mc.lastCounts = sample.counts
+	mc.lastErrors = sample.serverErrors
+	mc.lastActivity = sample.activity
+	mc.lastTime = sample.time
+}
+
+// trackLastRequest updates and returns when a service's request counter last increased.  There's no
+// telling how old the requests counted before a service was first seen are, so it's assumed to
+// have had one then.
+func (mc *MetricsCollector) trackLastRequest(service string, samples []metricsSample) time.Time {
+	if _, ok := mc.lastRequest[service]; !ok {
+		mc.lastRequest[service] = samples[len(samples)-1].time
+		return mc.lastRequest[service]
+	}
+
+	previous := mc.lastCounts[service]
+	for _, sample := range samples {
+		current, ok := sample.counts[service]
+		if !ok {
+			continue
+		}
+		if current != previous {
+			mc.lastRequest[service] = sample.time
+		}
+		previous = current
+	}
+	return mc.lastRequest[service]
+}
+
+// counterIncrease returns how much a counter grew between two scrapes.  A counter that went down
+// was reset, e.g. by Traefik restarting, so everything it has counted since is the increase.
+func counterIncrease(previous, current float64) float64 {
+	if current < previous {
+		common.DebugLog("traefik-cloud-saver", "counter reset detected (%.0f -> %.0f)", previous, current)
+		return current
+	}
+	return current - previous
+}
+
+// activityRate returns the current value of a gauge, or the per minute increase of a counter since
+// the last decision.  Like requests, a counter with no baseline uses its total as the initial rate.
+func (mc *MetricsCollector) activityRate(family, service string, gauge bool, samples []metricsSample, duration time.Duration) float64 {
+	latest := samples[len(samples)-1]
+	if gauge || mc.lastActivity == nil {
+		return latest.activity[family][service]
+	}
+
+	increase := 0.0
+	previous := mc.lastActivity[family][service]
+	for _, sample := range samples {
+		current, ok := sample.activity[family][service]
+		if !ok {
+			continue
+		}
+		increase += counterIncrease(previous, current)
+		previous = current
+	}
+	if duration.Seconds() <= 0 {
+		return 0
+	}
+	return (increase / duration.Seconds()) * 60
+}
+
+// Scrape fetches the current counters and buffers them for the next GetServiceRates call
+func (mc *MetricsCollector) Scrape(ctx context.Context) error {
+	sample, err := mc.fetchSample(ctx)
+	if err != nil {
+		return err
+	}
+
+	mc.samplesMu.Lock()
+	defer mc.samplesMu.Unlock()
+
+	if len(mc.samples) >= maxBufferedSamples {
+		// nobody is consuming the buffer, drop the oldest sample.  The deltas telescope so the
+		// rate is still computed against the last decision's baseline.
+		mc.samples = mc.samples[1:]
+	}
+	mc.samples = append(mc.samples, sample)
+	return nil
+}
+
+// RunScraper scrapes the metrics endpoint every interval until the context is cancelled,
+// decoupling how fresh the data is from how often decisions are made
+func (mc *MetricsCollector) RunScraper(ctx context.Context, interval time.Duration) {
+	ticker := mc.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			if err := mc.Scrape(ctx); err != nil {
+				common.LogProvider("traefik-cloud-saver", "[ERROR]: background metrics scrape failed: %v", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// drainSamples returns and clears the buffered samples
+func (mc *MetricsCollector) drainSamples() []metricsSample {
+	mc.samplesMu.Lock()
+	defer mc.samplesMu.Unlock()
+
+	samples := mc.samples
+	mc.samples = nil
+	return samples
+}
+
+// fetchServiceRequests returns the successful request counts per service
+func (mc *MetricsCollector) fetchServiceRequests(ctx context.Context) (map[string]float64, error) {
+	sample, err := mc.fetchSample(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sample.counts, nil
+}
+
+// fetchSample scrapes the metrics endpoint, or every Traefik replica's endpoint when there are several
+func (mc *MetricsCollector) fetchSample(ctx context.Context) (metricsSample, error) {
+	var sample metricsSample
+	var err error
+	if len(mc.replicas) > 0 {
+		sample, err = mc.fetchReplicas(ctx)
+	} else {
+		sample, err = mc.scrapeEndpoint(ctx, mc.metricsURL, mc.auth)
+	}
+	if err != nil {
+		mc.countScrapeError()
+	}
+	return sample, err
+}
+
+// scrapeEndpoint parses Prometheus metrics text format manually
+func (mc *MetricsCollector) scrapeEndpoint(ctx context.Context, metricsURL string, auth *MetricsAuth) (metricsSample, error) {
+	sample := metricsSample{
+		time:         mc.clock.Now(),
+		counts:       make(map[string]float64),
+		serverErrors: make(map[string]float64),
+		activity:     make(map[string]map[string]float64),
+		inFlight:     make(map[string]float64),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metricsURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch metrics: %w", err)
+		return sample, fmt.Errorf("failed to create metrics request: %w", err)
+	}
+	auth.apply(req)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := mc.client.Do(req)
+	if err != nil {
+		return sample, fmt.Errorf("failed to fetch metrics: %w", err)
 	}
 	defer func() {
 		closeErr := resp.Body.Close()
@@ -89,42 +503,206 @@ func (mc *MetricsCollector) fetchServiceRequests() (map[string]float64, error) {
 		}
 	}()
 
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return sample, fmt.Errorf("metrics endpoint %s rejected the request (%s), check the metrics auth", metricsURL, resp.Status)
+	}
+
+	// anything else but a 200 is an error page rather than metrics, and parsing it would look like
+	// no traffic at all.  What's decided without the metrics is up to the scrape failure policy.
+	if resp.StatusCode != http.StatusOK {
+		return sample, fmt.Errorf("metrics endpoint %s returned %s", metricsURL, resp.Status)
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read metrics: %w", err)
+		return sample, fmt.Errorf("failed to read metrics: %w", err)
+	}
+	body, err = decompressMetrics(resp.Header.Get("Content-Encoding"), body)
+	if err != nil {
+		return sample, err
 	}
 
-	// if the body is empty, lets log a warning and return an empty map
+	// if the body is empty, lets log a warning and return an empty sample
 	if len(body) == 0 {
 		common.LogProvider("traefik-cloud-saver", "[WARNING] Metrics response body is empty")
-		return make(map[string]float64), nil
+		mc.recordParse(metricsURL, 0, 0, sample)
+		return sample, nil
+	}
+
+	if isHTMLResponse(resp.Header.Get("Content-Type"), body) {
+		return sample, fmt.Errorf("%w: got HTML from %s", errUnexpectedMetricsContent, metricsURL)
 	}
 
-	serviceCounts := make(map[string]float64)
 	scanner := bufio.NewScanner(strings.NewReader(string(body)))
 
+	requestLines := 0
 	for scanner.Scan() {
 		line := scanner.Text()
-		if strings.HasPrefix(line, "traefik_service_requests_total") {
+		if strings.HasPrefix(line, mc.requestsMetric) {
+			requestLines++
+			if !matchesLabels(line, mc.labelFilter) {
+				continue
+			}
 			// Parse service name and count from the metric line.
-			// Accumulate the count for each service if the response code is 200 or it has no response codes.
+			// Accumulate the count for each service if the response code is in an accepted class
+			// (2xx by default) or it has no response codes.
 			// Example:
 			// traefik_service_requests_total{service="servicename",method="GET",code="200"} 10
-			// traefik_service_requests_total{service="servicename",method="POST",code="200"} 20
+			// traefik_service_requests_total{service="servicename",method="POST",code="204"} 20
 			// traefik_service_requests_total{service="servicename",method="GET",code="404"} 50
 			// will be accumulated as:
 			// serviceCounts["servicename"] = 30
-			if service, count, ok := parseMetricLine(line); ok {
-				serviceCounts[service] += count
+			if service, count, ok := parseMetricLine(line, mc.keyLabel, mc.successClasses); ok {
+				sample.counts[service] += count
+			} else if service, count, ok := parseServerErrorLine(line, mc.keyLabel); ok {
+				sample.serverErrors[service] += count
+			}
+		} else if _, ok := mc.activityMetrics[metricFamily(line)]; ok {
+			// activity metrics are summed across all the series of a service, e.g. every entrypoint
+			if service, value, ok := parseActivityLine(line, mc.keyLabel); ok {
+				family := metricFamily(line)
+				if sample.activity[family] == nil {
+					sample.activity[family] = make(map[string]float64)
+				}
+				sample.activity[family][service] += value
+			}
+		}
+
+		// summed across the series of a service, e.g. every entrypoint and method
+		if mc.trackConcurrency && metricFamily(line) == inProgressMetric {
+			if service, value, ok := parseActivityLine(line, mc.keyLabel); ok {
+				sample.inFlight[service] += value
 			}
 		}
 	}
 
-	return serviceCounts, nil
+	mc.recordParse(metricsURL, len(body), requestLines, sample)
+	return sample, nil
+}
+
+// parseServerErrorLine extracts the service (or other keyLabel) name and count from a metric line
+// with a 5xx code
+func parseServerErrorLine(line, keyLabel string) (string, float64, bool) {
+	parts := strings.Split(line, " ")
+	if len(parts) != 2 {
+		return "", 0, false
+	}
+
+	service := labelValue(parts[0], keyLabel)
+	code := labelValue(parts[0], "code")
+	if service == "" || len(code) != 3 || code[0] != '5' {
+		return "", 0, false
+	}
+
+	var count float64
+	if _, err := fmt.Sscanf(parts[1], "%f", &count); err != nil {
+		return "", 0, false
+	}
+	return service, count, true
+}
+
+// parseActivityLine extracts the service (or other keyLabel) name and value from a line of an
+// activity metric family
+func parseActivityLine(line, keyLabel string) (string, float64, bool) {
+	parts := strings.Split(line, " ")
+	if len(parts) != 2 {
+		return "", 0, false
+	}
+
+	service := labelValue(parts[0], keyLabel)
+	if service == "" {
+		return "", 0, false
+	}
+
+	var value float64
+	if _, err := fmt.Sscanf(parts[1], "%f", &value); err != nil {
+		return "", 0, false
+	}
+	return service, value, true
+}
+
+// matchesLabels reports whether a metric line has every one of the labels with the given value
+func matchesLabels(line string, labels map[string]string) bool {
+	series := line
+	if end := strings.LastIndex(line, " "); end != -1 {
+		series = line[:end]
+	}
+	for label, value := range labels {
+		if labelValue(series, label) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// metricFamily returns the metric name of a series, i.e. everything before the labels or value
+func metricFamily(line string) string {
+	if end := strings.IndexAny(line, "{ "); end != -1 {
+		return line[:end]
+	}
+	return line
+}
+
+// labelValue returns the value of a label in a metric series, or an empty string if it isn't present
+func labelValue(series, label string) string {
+	key := label + `="`
+	start := strings.Index(series, key)
+	// make sure we matched the whole label name, e.g. code=" and not statuscode="
+	for start > 0 && series[start-1] != '{' && series[start-1] != ',' {
+		next := strings.Index(series[start+1:], key)
+		if next == -1 {
+			return ""
+		}
+		start += next + 1
+	}
+	if start == -1 {
+		return ""
+	}
+	start += len(key)
+	end := strings.Index(series[start:], `"`)
+	if end == -1 {
+		return ""
+	}
+	return series[start : start+end]
+}
+
+// decompressMetrics returns the plain text of a metrics response.  Asking for gzip ourselves means
+// the transport leaves decompressing to us, and a body can be gzipped without saying so (e.g. a
+// compressed file served as is), so the gzip magic number is checked as well as the header.
+func decompressMetrics(contentEncoding string, body []byte) ([]byte, error) {
+	gzipped := strings.EqualFold(contentEncoding, "gzip") || bytes.HasPrefix(body, []byte{0x1f, 0x8b})
+	if !gzipped || len(body) == 0 {
+		return body, nil
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress metrics: %w", err)
+	}
+	defer reader.Close()
+
+	plain, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress metrics: %w", err)
+	}
+	return plain, nil
+}
+
+// isHTMLResponse reports whether a metrics response looks like an HTML page rather than Prometheus text
+func isHTMLResponse(contentType string, body []byte) bool {
+	if strings.Contains(strings.ToLower(contentType), "text/html") {
+		return true
+	}
+	trimmed := bytes.ToLower(bytes.TrimSpace(body))
+	return bytes.HasPrefix(trimmed, []byte("<!doctype html")) || bytes.HasPrefix(trimmed, []byte("<html"))
 }
 
-// parseMetricLine extracts service name and count from a metric line
-func parseMetricLine(line string) (string, float64, bool) {
+// parseMetricLine extracts the service (or other keyLabel) name and count from a metric line whose
+// response code's first digit is one of successClasses, or which has no response code.  Only the
+// first digit is checked, so an exporter that buckets codes (code="2xx") is counted like exact
+// codes are; if it exports both the buckets and the exact codes for a service its traffic will be
+// counted twice.
+func parseMetricLine(line, keyLabel, successClasses string) (string, float64, bool) {
 	var serviceName string
 	var count float64
 
@@ -137,22 +715,16 @@ func parseMetricLine(line string) (string, float64, bool) {
 		}
 
 		// Parse service name & response code
-		if start := strings.Index(line, `service="`); start != -1 {
-			start += len(`service="`)
-			if end := strings.Index(line[start:], `"`); end != -1 {
-				serviceName = line[start : start+end]
-
-				// only return true count if the response code is 200 or it has no response codes
-				if responseCode := strings.Index(line, `code="`); responseCode != -1 {
-					code := line[responseCode+len(`code="`) : responseCode+len(`code="`)+3]
-					if code != "200" && code != "" {
-						return "", 0, false
-					}
-					return serviceName, count, true
+		if serviceName = labelValue(parts[0], keyLabel); serviceName != "" {
+			// only return true count if the response code is in an accepted class or it has no response codes
+			if code := labelValue(parts[0], "code"); code != "" {
+				if !strings.ContainsRune(successClasses, rune(code[0])) {
+					return "", 0, false
 				}
-				// return true count if there is no response code
 				return serviceName, count, true
 			}
+			// return true count if there is no response code
+			return serviceName, count, true
 		}
 	}
 
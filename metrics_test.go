@@ -1,8 +1,14 @@
 package traefik_cloud_saver
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 	"time"
 )
@@ -13,6 +19,7 @@ func TestParseMetricLine(t *testing.T) {
 		input         string
 		wantService   string
 		wantCount     float64
+		classes       string
 		wantSucceeded bool
 	}{
 		{
@@ -29,12 +36,97 @@ func TestParseMetricLine(t *testing.T) {
 			wantCount:     0,
 			wantSucceeded: false,
 		},
-		// Add more test cases here
+		{
+			name:          "code before service",
+			input:         `traefik_service_requests_total{code="200",method="GET",service="my-service"} 7`,
+			wantService:   "my-service",
+			wantCount:     7,
+			wantSucceeded: true,
+		},
+		{
+			name:          "other 2xx code",
+			input:         `traefik_service_requests_total{service="my-service",code="204",protocol="http"} 3`,
+			wantService:   "my-service",
+			wantCount:     3,
+			wantSucceeded: true,
+		},
+		{
+			name:          "server error before service",
+			input:         `traefik_service_requests_total{code="503",service="my-service"} 4`,
+			wantSucceeded: false,
+		},
+		{
+			name:          "short code",
+			input:         `traefik_service_requests_total{service="my-service",code="50"} 2`,
+			wantSucceeded: false,
+		},
+		{
+			name:          "four character code",
+			input:         `traefik_service_requests_total{service="my-service",code="5030",method="GET"} 2`,
+			wantSucceeded: false,
+		},
+		{
+			name:          "statuscode isn't the code label",
+			input:         `traefik_service_requests_total{statuscode="500",service="my-service"} 5`,
+			wantService:   "my-service",
+			wantCount:     5,
+			wantSucceeded: true,
+		},
+		{
+			name:          "200",
+			input:         `traefik_service_requests_total{service="my-service",code="200"} 5`,
+			wantService:   "my-service",
+			wantCount:     5,
+			wantSucceeded: true,
+		},
+		{
+			name:          "204 is successful traffic",
+			input:         `traefik_service_requests_total{service="my-service",code="204"} 7`,
+			wantService:   "my-service",
+			wantCount:     7,
+			wantSucceeded: true,
+		},
+		{
+			name:          "bucketed 2xx",
+			input:         `traefik_service_requests_total{service="my-service",code="2xx"} 9`,
+			wantService:   "my-service",
+			wantCount:     9,
+			wantSucceeded: true,
+		},
+		{
+			name:          "3xx not counted by default",
+			input:         `traefik_service_requests_total{service="my-service",code="304"} 3`,
+			wantSucceeded: false,
+		},
+		{
+			name:          "3xx counted when configured",
+			input:         `traefik_service_requests_total{service="my-service",code="304"} 3`,
+			classes:       "23",
+			wantService:   "my-service",
+			wantCount:     3,
+			wantSucceeded: true,
+		},
+		{
+			name:          "404",
+			input:         `traefik_service_requests_total{service="my-service",code="404"} 3`,
+			wantSucceeded: false,
+		},
+		{
+			name:          "statuscode label is not the response code",
+			input:         `traefik_service_requests_total{service="my-service",statuscode="404"} 3`,
+			wantService:   "my-service",
+			wantCount:     3,
+			wantSucceeded: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			service, count, ok := parseMetricLine(tt.input)
+			classes := tt.classes
+			if classes == "" {
+				classes = defaultSuccessClasses
+			}
+			service, count, ok := parseMetricLine(tt.input, metricSourceService, classes)
 			if ok != tt.wantSucceeded {
 				t.Errorf("parseMetricLine() succeeded = %v, want %v", ok, tt.wantSucceeded)
 			}
@@ -66,7 +158,7 @@ traefik_service_requests_total{service="service2"} 200
 	mc := NewMetricsCollector(server.URL)
 
 	// First call to establish baseline
-	_, err := mc.GetServiceRates()
+	_, err := mc.GetServiceRates(context.Background())
 	if err != nil {
 		t.Fatalf("First GetServiceRates() failed: %v", err)
 	}
@@ -75,7 +167,7 @@ traefik_service_requests_total{service="service2"} 200
 	time.Sleep(100 * time.Millisecond)
 
 	// Second call to get rates
-	rates, err := mc.GetServiceRates()
+	rates, err := mc.GetServiceRates(context.Background())
 	if err != nil {
 		t.Fatalf("Second GetServiceRates() failed: %v", err)
 	}
@@ -95,6 +187,92 @@ traefik_service_requests_total{service="service2"} 200
 	}
 }
 
+func TestGetServiceRatesCounterReset(t *testing.T) {
+	var mu sync.Mutex
+	metrics := `traefik_service_requests_total{service="service1"} 1000
+traefik_service_requests_total{service="service1",code="500"} 50`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprint(w, metrics)
+	}))
+	defer server.Close()
+
+	mc := NewMetricsCollector(server.URL)
+	if _, err := mc.GetServiceRates(context.Background()); err != nil {
+		t.Fatalf("First GetServiceRates() failed: %v", err)
+	}
+
+	// traefik restarted, its counters start again from zero
+	mu.Lock()
+	metrics = `traefik_service_requests_total{service="service1"} 30
+traefik_service_requests_total{service="service1",code="500"} 2`
+	mu.Unlock()
+	mc.lastTime = mc.lastTime.Add(-time.Minute)
+
+	rates, err := mc.GetServiceRates(context.Background())
+	if err != nil {
+		t.Fatalf("Second GetServiceRates() failed: %v", err)
+	}
+	rate := rates["service1"]
+	if rate.PerMin < 29 || rate.PerMin > 30 {
+		t.Errorf("expected the reset counter to count as ~30 req/min, got %v", rate.PerMin)
+	}
+	if rate.ServerErrors != 2 {
+		t.Errorf("expected 2 server errors since the reset, got %v", rate.ServerErrors)
+	}
+}
+
+func TestGetServiceRatesMissingService(t *testing.T) {
+	var mu sync.Mutex
+	metrics := `traefik_service_requests_total{service="service1"} 100
+traefik_service_requests_total{service="service2"} 200`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprint(w, metrics)
+	}))
+	defer server.Close()
+
+	mc := NewMetricsCollector(server.URL)
+	if _, err := mc.GetServiceRates(context.Background()); err != nil {
+		t.Fatalf("First GetServiceRates() failed: %v", err)
+	}
+
+	// service2 stopped getting requests and traefik dropped its counter
+	mu.Lock()
+	metrics = `traefik_service_requests_total{service="service1"} 160`
+	mu.Unlock()
+
+	rates, err := mc.GetServiceRates(context.Background())
+	if err != nil {
+		t.Fatalf("Second GetServiceRates() failed: %v", err)
+	}
+	rate, ok := rates["service2"]
+	if !ok {
+		t.Fatal("expected a rate for the missing service2")
+	}
+	if rate.PerMin != 0 {
+		t.Errorf("expected service2 to have no traffic, got %v", rate.PerMin)
+	}
+	if rates["service1"].PerMin <= 0 {
+		t.Errorf("expected service1 to have traffic, got %v", rates["service1"].PerMin)
+	}
+
+	// an empty scrape doesn't report every service as idle
+	mu.Lock()
+	metrics = ""
+	mu.Unlock()
+
+	rates, err = mc.GetServiceRates(context.Background())
+	if err != nil {
+		t.Fatalf("Third GetServiceRates() failed: %v", err)
+	}
+	if len(rates) != 0 {
+		t.Errorf("expected no rates from an empty scrape, got %v", rates)
+	}
+}
+
 func TestFetchServiceRequests(t *testing.T) {
 	// Test with empty response
 	t.Run("empty response", func(t *testing.T) {
@@ -104,7 +282,7 @@ func TestFetchServiceRequests(t *testing.T) {
 		defer server.Close()
 
 		mc := NewMetricsCollector(server.URL)
-		counts, err := mc.fetchServiceRequests()
+		counts, err := mc.fetchServiceRequests(context.Background())
 		if err != nil {
 			t.Errorf("fetchServiceRequests() error = %v", err)
 		}
@@ -131,7 +309,7 @@ traefik_service_requests_total{code="404",method="GET",protocol="http",service="
 		defer server.Close()
 
 		mc := NewMetricsCollector(server.URL)
-		counts, err := mc.fetchServiceRequests()
+		counts, err := mc.fetchServiceRequests(context.Background())
 		if err != nil {
 			t.Errorf("fetchServiceRequests() error = %v", err)
 		}
@@ -146,3 +324,446 @@ traefik_service_requests_total{code="404",method="GET",protocol="http",service="
 		}
 	})
 }
+
+func TestBufferedSamples(t *testing.T) {
+	var mu sync.Mutex
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hits++
+		// counter grows by 60 on every scrape
+		fmt.Fprintf(w, "traefik_service_requests_total{service=\"service1\"} %d\n", hits*60)
+	}))
+	defer server.Close()
+
+	mc := NewMetricsCollector(server.URL)
+
+	for i := 0; i < 3; i++ {
+		if err := mc.Scrape(context.Background()); err != nil {
+			t.Fatalf("Scrape() failed: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rates, err := mc.GetServiceRates(context.Background())
+	if err != nil {
+		t.Fatalf("GetServiceRates() failed: %v", err)
+	}
+
+	mu.Lock()
+	if hits != 3 {
+		t.Errorf("GetServiceRates() should consume the buffered samples without scraping, got %d hits", hits)
+	}
+	mu.Unlock()
+
+	rate := rates["service1"]
+	if rate == nil {
+		t.Fatal("service1 not found in rates")
+	}
+	if rate.Total != 180 {
+		t.Errorf("service1 total = %v, want 180 (latest sample)", rate.Total)
+	}
+	// first sample is the baseline, so 120 requests over the time between sample 1 and 3
+	wantRate := 120 / rate.Duration.Seconds() * 60
+	if rate.PerMin != wantRate {
+		t.Errorf("service1 rate = %v, want %v", rate.PerMin, wantRate)
+	}
+
+	if samples := mc.drainSamples(); len(samples) != 0 {
+		t.Errorf("expected the sample buffer to be drained, got %d samples", len(samples))
+	}
+}
+
+func TestRunScraper(t *testing.T) {
+	var mu sync.Mutex
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hits++
+		fmt.Fprintf(w, "traefik_service_requests_total{service=\"service1\"} %d\n", hits)
+	}))
+	defer server.Close()
+
+	mc := NewMetricsCollector(server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	go mc.RunScraper(ctx, 20*time.Millisecond)
+
+	time.Sleep(150 * time.Millisecond)
+	cancel()
+
+	mu.Lock()
+	scrapes := hits
+	mu.Unlock()
+	if scrapes < 3 {
+		t.Errorf("expected at least 3 background scrapes, got %d", scrapes)
+	}
+
+	if _, err := mc.GetServiceRates(context.Background()); err != nil {
+		t.Fatalf("GetServiceRates() failed: %v", err)
+	}
+}
+
+func TestParseServerErrorLine(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantService string
+		wantCount   float64
+		wantOK      bool
+	}{
+		{
+			name:        "502",
+			input:       `traefik_service_requests_total{code="502",method="GET",protocol="http",service="svc@docker"} 7`,
+			wantService: "svc@docker",
+			wantCount:   7,
+			wantOK:      true,
+		},
+		{
+			name:        "service before code",
+			input:       `traefik_service_requests_total{service="svc@docker",code="503"} 2`,
+			wantService: "svc@docker",
+			wantCount:   2,
+			wantOK:      true,
+		},
+		{
+			name:   "404 is not a server error",
+			input:  `traefik_service_requests_total{code="404",service="svc@docker"} 2`,
+			wantOK: false,
+		},
+		{
+			name:   "no code",
+			input:  `traefik_service_requests_total{service="svc@docker"} 2`,
+			wantOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, count, ok := parseServerErrorLine(tt.input, metricSourceService)
+			if ok != tt.wantOK {
+				t.Fatalf("parseServerErrorLine() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if service != tt.wantService || count != tt.wantCount {
+				t.Errorf("parseServerErrorLine() = %s, %v, want %s, %v", service, count, tt.wantService, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestServerErrorRates(t *testing.T) {
+	var mu sync.Mutex
+	errorCount := 10
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "traefik_service_requests_total{code=\"200\",service=\"svc\"} 100\n")
+		fmt.Fprintf(w, "traefik_service_requests_total{code=\"500\",service=\"svc\"} %d\n", errorCount)
+	}))
+	defer server.Close()
+
+	mc := NewMetricsCollector(server.URL)
+	rates, err := mc.GetServiceRates(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates["svc"].ServerErrors != 0 {
+		t.Errorf("historic errors should be ignored on the first run, got %v", rates["svc"].ServerErrors)
+	}
+
+	mu.Lock()
+	errorCount = 14
+	mu.Unlock()
+
+	rates, err = mc.GetServiceRates(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates["svc"].ServerErrors != 4 {
+		t.Errorf("expected 4 new server errors, got %v", rates["svc"].ServerErrors)
+	}
+	if rates["svc"].Total != 100 {
+		t.Errorf("5xx should not be counted as traffic, total = %v", rates["svc"].Total)
+	}
+}
+
+func TestActivityRates(t *testing.T) {
+	var mu sync.Mutex
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hits++
+		fmt.Fprintf(w, "traefik_service_requests_total{service=\"service1\"} 10\n")
+		fmt.Fprintf(w, "traefik_service_open_connections{service=\"service1\",entrypoint=\"web\"} 2\n")
+		fmt.Fprintf(w, "traefik_service_open_connections{service=\"service1\",entrypoint=\"websecure\"} 3\n")
+		fmt.Fprintf(w, "traefik_service_requests_bytes_total{service=\"service2\"} %d\n", hits*600)
+		fmt.Fprintf(w, "traefik_service_untracked_total{service=\"service3\"} 1\n")
+	}))
+	defer server.Close()
+
+	mc := NewMetricsCollector(server.URL)
+	mc.activityMetrics = map[string]bool{
+		"traefik_service_open_connections":     true,
+		"traefik_service_requests_bytes_total": false,
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := mc.Scrape(context.Background()); err != nil {
+			t.Fatalf("Scrape() failed: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	rates, err := mc.GetServiceRates(context.Background())
+	if err != nil {
+		t.Fatalf("GetServiceRates() failed: %v", err)
+	}
+
+	if got := rates["service1"].Activity["traefik_service_open_connections"]; got != 5 {
+		t.Errorf("service1 open connections = %v, want 5 (summed across entrypoints)", got)
+	}
+
+	// only seen through an activity metric, but still reported
+	rate := rates["service2"]
+	if rate == nil {
+		t.Fatal("service2 not found in rates")
+	}
+	wantBytes := 600 / rate.Duration.Seconds() * 60
+	if got := rate.Activity["traefik_service_requests_bytes_total"]; got != wantBytes {
+		t.Errorf("service2 bytes rate = %v, want %v", got, wantBytes)
+	}
+
+	if _, ok := rates["service3"]; ok {
+		t.Error("untracked metric families should be ignored")
+	}
+}
+
+func TestParseSuccessCodes(t *testing.T) {
+	tests := []struct {
+		codes   []string
+		want    string
+		wantErr bool
+	}{
+		{codes: nil, want: "2"},
+		{codes: []string{"2xx", "3XX"}, want: "23"},
+		{codes: []string{"2xx", "2xx"}, want: "2"},
+		{codes: []string{"5xx"}, wantErr: true},
+		{codes: []string{"200"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSuccessCodes(tt.codes)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSuccessCodes(%v) error = %v, wantErr %v", tt.codes, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSuccessCodes(%v) = %q, want %q", tt.codes, got, tt.want)
+		}
+	}
+}
+
+func TestMetricLabelFilter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `
+traefik_service_requests_total{namespace="prod",service="service1",code="200"} 10
+traefik_service_requests_total{namespace="staging",service="service1",code="200"} 100
+traefik_service_requests_total{namespace="prod",env="eu",service="service2",code="200"} 20
+traefik_service_requests_total{service="service3",code="200"} 30
+traefik_service_requests_total{namespace="prod",service="service1",code="500"} 4
+traefik_service_requests_total{namespace="staging",service="service1",code="500"} 40
+`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		labels     map[string]string
+		wantCounts map[string]float64
+		wantErrors float64
+	}{
+		{
+			name:       "no filter counts everything",
+			wantCounts: map[string]float64{"service1": 110, "service2": 20, "service3": 30},
+			wantErrors: 44,
+		},
+		{
+			name:       "namespace",
+			labels:     map[string]string{"namespace": "prod"},
+			wantCounts: map[string]float64{"service1": 10, "service2": 20},
+			wantErrors: 4,
+		},
+		{
+			name:       "every label must match",
+			labels:     map[string]string{"namespace": "prod", "env": "eu"},
+			wantCounts: map[string]float64{"service2": 20},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := NewMetricsCollector(server.URL, WithMetricLabels(tt.labels))
+			sample, err := mc.fetchSample(context.Background())
+			if err != nil {
+				t.Fatalf("fetchSample() failed: %v", err)
+			}
+			if len(sample.counts) != len(tt.wantCounts) {
+				t.Errorf("expected counts %v, got %v", tt.wantCounts, sample.counts)
+			}
+			for service, want := range tt.wantCounts {
+				if sample.counts[service] != want {
+					t.Errorf("%s count = %v, want %v", service, sample.counts[service], want)
+				}
+			}
+			if sample.serverErrors["service1"] != tt.wantErrors {
+				t.Errorf("service1 server errors = %v, want %v", sample.serverErrors["service1"], tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestGzipMetrics(t *testing.T) {
+	metrics := `traefik_service_requests_total{service="service1"} 100
+traefik_service_requests_total{service="service2"} 200
+`
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write([]byte(metrics)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		header bool
+	}{
+		{name: "content encoding header", header: true},
+		{name: "gzipped without a header", header: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Accept-Encoding") != "gzip" {
+					t.Errorf("expected Accept-Encoding: gzip, got %q", r.Header.Get("Accept-Encoding"))
+				}
+				if tt.header {
+					w.Header().Set("Content-Encoding", "gzip")
+				}
+				_, _ = w.Write(compressed.Bytes())
+			}))
+			defer server.Close()
+
+			mc := NewMetricsCollector(server.URL)
+			counts, err := mc.fetchServiceRequests(context.Background())
+			if err != nil {
+				t.Fatalf("fetchServiceRequests() error = %v", err)
+			}
+			if counts["service1"] != 100 || counts["service2"] != 200 {
+				t.Errorf("expected counts from the decompressed metrics, got %v", counts)
+			}
+		})
+	}
+}
+
+func TestGetServiceRatesCancelled(t *testing.T) {
+	// a metrics endpoint which hangs until the client gives up
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	mc := NewMetricsCollector(server.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := mc.GetServiceRates(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the scrape to be cancelled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected cancelling to stop the scrape promptly, took %v", elapsed)
+	}
+}
+
+func TestGetServiceRatesConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		count += 10
+		fmt.Fprintf(w, "traefik_service_requests_total{service=\"service1\"} %d\n", count)
+	}))
+	defer server.Close()
+
+	mc := NewMetricsCollector(server.URL, WithSampleWindow(3))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				if _, err := mc.GetServiceRates(context.Background()); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// every call consumed exactly one scrape
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if got := mc.lastCounts["service1"]; got != 400 {
+		t.Errorf("expected the baseline of the last of 40 scrapes, got %v", got)
+	}
+}
+
+func TestMetricsErrorStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "server error", status: http.StatusInternalServerError, wantErr: true},
+		{name: "not found", status: http.StatusNotFound, wantErr: true},
+		{name: "unavailable", status: http.StatusServiceUnavailable, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a plain text error body, which would otherwise parse as empty metrics
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(tt.status)
+				if tt.status == http.StatusOK {
+					fmt.Fprint(w, `traefik_service_requests_total{service="service1"} 10`)
+					return
+				}
+				fmt.Fprint(w, "upstream connect error")
+			}))
+			defer server.Close()
+
+			mc := NewMetricsCollector(server.URL)
+			rates, err := mc.GetServiceRates(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetServiceRates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && rates != nil {
+				t.Errorf("expected no rates from an error response, got %v", rates)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, basic := r.BasicAuth()
+		authorized := r.Header.Get("Authorization") == "Bearer s3cret" || (basic && user == "prom" && password == "s3cret")
+		if !authorized {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `traefik_service_requests_total{service="service1"} 100`)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		auth    *MetricsAuth
+		wantErr bool
+	}{
+		{name: "no credentials", url: server.URL, wantErr: true},
+		{name: "bearer token", url: server.URL, auth: &MetricsAuth{BearerToken: "s3cret"}},
+		{name: "basic auth", url: server.URL, auth: &MetricsAuth{Username: "prom", Password: "s3cret"}},
+		{name: "wrong password", url: server.URL, auth: &MetricsAuth{Username: "prom", Password: "guess"}, wantErr: true},
+		{name: "credentials in the URL", url: strings.Replace(server.URL, "http://", "http://prom:s3cret@", 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.WindowSize = "1s"
+			config.testMode = true
+			config.MetricsURL = tt.url
+			config.MetricsAuth = tt.auth
+
+			saver, err := New(context.Background(), config, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(saver.metricsCollector.metricsURL, "s3cret") {
+				t.Errorf("expected credentials to be stripped from the metrics URL, got %s", saver.metricsCollector.metricsURL)
+			}
+
+			sample, err := saver.metricsCollector.fetchSample(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetchSample() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && sample.counts["service1"] != 100 {
+				t.Errorf("expected service1 count 100, got %v", sample.counts)
+			}
+		})
+	}
+}
+
+func TestMetricsAuthValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		auth *MetricsAuth
+	}{
+		{name: "token and basic auth", url: "http://localhost/metrics", auth: &MetricsAuth{BearerToken: "t", Username: "u"}},
+		{name: "empty", url: "http://localhost/metrics", auth: &MetricsAuth{}},
+		{name: "URL and config credentials", url: "http://u:p@localhost/metrics", auth: &MetricsAuth{BearerToken: "t"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.WindowSize = "1s"
+			config.testMode = true
+			config.MetricsURL = tt.url
+			config.MetricsAuth = tt.auth
+			if _, err := New(context.Background(), config, "test"); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package traefik_cloud_saver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// defaultMetricsTimeout bounds a whole metrics request when no timeouts are configured
+const defaultMetricsTimeout = 5 * time.Second
+
+// MetricsTimeouts bounds the requests to the metrics endpoint.  A short connect timeout fails a
+// dead endpoint fast, while a longer total timeout leaves a large payload time to arrive.
+type MetricsTimeouts struct {
+	Connect string `json:"connect,omitempty"` // establishing the connection, including TLS, default the total timeout
+	Total   string `json:"total,omitempty"`   // the whole request, including reading the body, default 5s
+}
+
+// parse returns the connect and total timeouts, filling in the defaults
+func (t *MetricsTimeouts) parse() (time.Duration, time.Duration, error) {
+	total := defaultMetricsTimeout
+	if t == nil {
+		return total, total, nil
+	}
+
+	var err error
+	if t.Total != "" {
+		total, err = time.ParseDuration(t.Total)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid metrics total timeout: %w", err)
+		}
+		if total <= 0 {
+			return 0, 0, fmt.Errorf("metrics total timeout must be positive, got %v", total)
+		}
+	}
+	connect := total
+	if t.Connect != "" {
+		connect, err = time.ParseDuration(t.Connect)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid metrics connect timeout: %w", err)
+		}
+		if connect <= 0 || connect > total {
+			return 0, 0, fmt.Errorf("metrics connect timeout must be positive and at most the total timeout %v, got %v", total, connect)
+		}
+	}
+	return connect, total, nil
+}
+
+// WithTimeouts gives up on connecting to the metrics endpoint after connect, and on a whole
+// request after total, so a slow but progressing scrape isn't cut short by the connect timeout
+func WithTimeouts(connect, total time.Duration) MetricsCollectorOption {
+	return func(mc *MetricsCollector) {
+		dialer := &net.Dialer{Timeout: connect, KeepAlive: 30 * time.Second}
+		mc.client = &http.Client{
+			Timeout: total,
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: connect,
+				MaxIdleConns:        10,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		}
+	}
+}
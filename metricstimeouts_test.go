@@ -0,0 +1,92 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMetricsTimeoutsSlowBody(t *testing.T) {
+	// the metrics arrive in two parts, the second one 300ms after the first
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `traefik_service_requests_total{service="a@docker",code="200"} 10`)
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		fmt.Fprintln(w, `traefik_service_requests_total{service="b@docker",code="200"} 20`)
+	}))
+	defer server.Close()
+
+	mc := NewMetricsCollector(server.URL, WithTimeouts(50*time.Millisecond, 2*time.Second))
+	sample, err := mc.fetchSample(context.Background())
+	if err != nil {
+		t.Fatalf("expected a slow body to be read within the total timeout, got %v", err)
+	}
+	if sample.counts["b@docker"] != 20 {
+		t.Errorf("expected the whole body to be parsed, got %v", sample.counts)
+	}
+
+	mc = NewMetricsCollector(server.URL, WithTimeouts(50*time.Millisecond, 100*time.Millisecond))
+	if _, err := mc.fetchSample(context.Background()); err == nil {
+		t.Error("expected the total timeout to cut the body short")
+	}
+}
+
+func TestMetricsTimeoutsDeadConnect(t *testing.T) {
+	// accepts connections but never answers the TLS handshake
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	mc := NewMetricsCollector("https://"+listener.Addr().String()+"/metrics", WithTimeouts(100*time.Millisecond, 10*time.Second))
+	start := time.Now()
+	if _, err := mc.fetchSample(context.Background()); err == nil {
+		t.Fatal("expected an error from a dead endpoint")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the connect timeout to fail fast, took %v", elapsed)
+	}
+}
+
+func TestMetricsTimeoutsValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		timeouts    *MetricsTimeouts
+		wantConnect time.Duration
+		wantTotal   time.Duration
+		wantErr     bool
+	}{
+		{name: "defaults", wantConnect: defaultMetricsTimeout, wantTotal: defaultMetricsTimeout},
+		{name: "total only", timeouts: &MetricsTimeouts{Total: "30s"}, wantConnect: 30 * time.Second, wantTotal: 30 * time.Second},
+		{name: "both", timeouts: &MetricsTimeouts{Connect: "1s", Total: "30s"}, wantConnect: time.Second, wantTotal: 30 * time.Second},
+		{name: "connect above default total", timeouts: &MetricsTimeouts{Connect: "10s"}, wantErr: true},
+		{name: "invalid total", timeouts: &MetricsTimeouts{Total: "long"}, wantErr: true},
+		{name: "negative connect", timeouts: &MetricsTimeouts{Connect: "-1s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			connect, total, err := tt.timeouts.parse()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (connect != tt.wantConnect || total != tt.wantTotal) {
+				t.Errorf("parse() = %v, %v, want %v, %v", connect, total, tt.wantConnect, tt.wantTotal)
+			}
+		})
+	}
+}
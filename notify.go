@@ -0,0 +1,149 @@
+package traefik_cloud_saver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// notificationQueueSize bounds the events waiting on a slow webhook, newer ones are dropped once full
+const notificationQueueSize = 100
+
+// ScaleEvent is a scale action the plugin took on a cloud service
+type ScaleEvent struct {
+	Service   string    `json:"service"` // cloud service name
+	Action    string    `json:"action"`  // scale_down or scale_up
+	Reason    string    `json:"reason"`
+	Rate      float64   `json:"rate"`      // req/min the action was decided on, zero when it wasn't decided on the rate
+	Threshold float64   `json:"threshold"` // req/min the rate was compared to
+	Time      time.Time `json:"time"`
+}
+
+// Notifier is told about every scale action the plugin takes.  Notify is called from the window
+// loop, so it must return quickly and handle its own failures.  Implementations sending events
+// elsewhere can be passed to New with WithNotifier, alongside those configured in notifications.
+type Notifier interface {
+	Notify(event ScaleEvent)
+}
+
+// NotificationsConfig configures the built in notifiers
+type NotificationsConfig struct {
+	WebhookURL      string `json:"webhookURL,omitempty"`      // receives each scale event POSTed as JSON
+	SlackWebhookURL string `json:"slackWebhookURL,omitempty"` // Slack incoming webhook receiving a message per scale event
+}
+
+// webhookNotifier POSTs scale events from its own goroutine, so a slow or unavailable endpoint
+// never holds up a window
+type webhookNotifier struct {
+	url     string
+	format  func(ScaleEvent) interface{} // the JSON body sent for an event
+	queue   chan ScaleEvent
+	client  *http.Client
+	dropped int
+}
+
+func newWebhookNotifier(url string, format func(ScaleEvent) interface{}) *webhookNotifier {
+	return &webhookNotifier{
+		url:    url,
+		format: format,
+		queue:  make(chan ScaleEvent, notificationQueueSize),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// newNotifiers returns the notifiers configured in notifications
+func newNotifiers(config *NotificationsConfig) []*webhookNotifier {
+	var notifiers []*webhookNotifier
+	if config == nil {
+		return notifiers
+	}
+	if config.WebhookURL != "" {
+		notifiers = append(notifiers, newWebhookNotifier(config.WebhookURL, func(event ScaleEvent) interface{} {
+			return event
+		}))
+	}
+	if config.SlackWebhookURL != "" {
+		notifiers = append(notifiers, newWebhookNotifier(config.SlackWebhookURL, slackMessage))
+	}
+	return notifiers
+}
+
+// slackMessage formats a scale event as a Slack message
+func slackMessage(event ScaleEvent) interface{} {
+	verb := "Scaled up"
+	if event.Action == actionScaleDown {
+		verb = "Scaled down"
+	}
+	text := fmt.Sprintf("%s *%s* (%s)", verb, event.Service, event.Reason)
+	if event.Rate > 0 || event.Threshold > 0 {
+		text = fmt.Sprintf("%s *%s* (%s, %.2f req/min, threshold %.2f)", verb, event.Service, event.Reason, event.Rate, event.Threshold)
+	}
+	return map[string]string{"text": text}
+}
+
+// Notify queues an event without blocking, dropping it if the queue is full
+func (n *webhookNotifier) Notify(event ScaleEvent) {
+	select {
+	case n.queue <- event:
+	default:
+		n.dropped++
+		common.DebugLog("traefik-cloud-saver", "notification queue for %s is full, dropped %d events so far", n.url, n.dropped)
+	}
+}
+
+// run sends the queued events until the context is done
+func (n *webhookNotifier) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-n.queue:
+			if err := n.send(ctx, event); err != nil {
+				common.LogProvider("traefik-cloud-saver", "[ERROR]: failed to notify %s of the %s of %s: %v", n.url, event.Action, event.Service, err)
+			}
+		}
+	}
+}
+
+func (n *webhookNotifier) send(ctx context.Context, event ScaleEvent) error {
+	body, err := json.Marshal(n.format(event))
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notify tells every notifier about a scale action
+func (p *CloudSaver) notify(cloudServiceName, action, reason string, rate, threshold float64) {
+	event := ScaleEvent{
+		Service:   cloudServiceName,
+		Action:    action,
+		Reason:    reason,
+		Rate:      rate,
+		Threshold: threshold,
+		Time:      p.clock.Now(),
+	}
+	for _, notifier := range p.notifiers {
+		notifier.Notify(event)
+	}
+}
@@ -0,0 +1,143 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingNotifier keeps the events it's told about
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []ScaleEvent
+}
+
+func (n *recordingNotifier) Notify(event ScaleEvent) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+}
+
+func TestNotifyScaleEvents(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+	clock := &stepClock{now: time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)}
+	notifier := &recordingNotifier{}
+	saver, _ := newTestSaver(t, backend, map[string]int32{"idle": 1}, nil, WithClock(clock), WithNotifier(notifier))
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	clock.now = clock.now.Add(time.Minute)
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 10`, "")
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	want := []ScaleEvent{
+		{Service: "idle", Action: actionScaleDown, Reason: reasonBelowThreshold, Rate: 0, Threshold: 1, Time: clock.now.Add(-time.Minute)},
+		{Service: "idle", Action: actionScaleUp, Reason: reasonAboveThreshold, Rate: 10, Threshold: 1, Time: clock.now},
+	}
+	if len(notifier.events) != len(want) {
+		t.Fatalf("events = %+v, want %+v", notifier.events, want)
+	}
+	for i := range want {
+		if notifier.events[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, notifier.events[i], want[i])
+		}
+	}
+}
+
+func TestNotifySleepingServiceOnce(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+	clock := &stepClock{now: time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)}
+	notifier := &recordingNotifier{}
+	saver, _ := newTestSaver(t, backend, map[string]int32{"idle": 1}, nil, WithClock(clock), WithNotifier(notifier))
+
+	// the scale down is re-asserted every window the service stays idle, but only announced once
+	for i := 0; i < 4; i++ {
+		if _, err := saver.generateConfiguration(context.Background()); err != nil {
+			t.Fatalf("generateConfiguration() failed: %v", err)
+		}
+		clock.now = clock.now.Add(time.Minute)
+	}
+
+	if len(notifier.events) != 1 || notifier.events[0].Action != actionScaleDown {
+		t.Errorf("events = %+v, want a single scale down", notifier.events)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	received := make(chan map[string]interface{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode notification: %v", err)
+		}
+		received <- body
+	}))
+	defer server.Close()
+
+	notifiers := newNotifiers(&NotificationsConfig{WebhookURL: server.URL, SlackWebhookURL: server.URL})
+	if len(notifiers) != 2 {
+		t.Fatalf("expected a webhook and a Slack notifier, got %d", len(notifiers))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	event := ScaleEvent{Service: "web", Action: actionScaleDown, Reason: reasonBelowThreshold, Rate: 0.5, Threshold: 2, Time: time.Now()}
+	for _, notifier := range notifiers {
+		go notifier.run(ctx)
+		notifier.Notify(event)
+	}
+
+	var webhook, slack map[string]interface{}
+	for i := 0; i < 2; i++ {
+		select {
+		case body := <-received:
+			if _, ok := body["text"]; ok {
+				slack = body
+			} else {
+				webhook = body
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for notifications")
+		}
+	}
+	if webhook["service"] != "web" || webhook["action"] != actionScaleDown || webhook["rate"] != 0.5 || webhook["threshold"] != 2.0 {
+		t.Errorf("webhook body = %v", webhook)
+	}
+	if want := "Scaled down *web* (below_threshold, 0.50 req/min, threshold 2.00)"; slack["text"] != want {
+		t.Errorf("slack text = %q, want %q", slack["text"], want)
+	}
+}
+
+func TestWebhookNotifierDoesNotBlock(t *testing.T) {
+	// nothing drains the queue, as with an endpoint that never answers
+	notifier := newWebhookNotifier("http://127.0.0.1:1", slackMessage)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < notificationQueueSize+5; i++ {
+			notifier.Notify(ScaleEvent{Service: "web", Action: actionScaleUp})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Notify blocked on a full queue")
+	}
+	if notifier.dropped != 5 {
+		t.Errorf("expected 5 dropped events, got %d", notifier.dropped)
+	}
+}
@@ -0,0 +1,63 @@
+package traefik_cloud_saver
+
+import (
+	"github.com/danbiagini/traefik-cloud-saver/cloud"
+)
+
+// CloudSaverOption overrides a dependency New would otherwise take from the config, e.g. to inject
+// a mock cloud service from another package
+type CloudSaverOption func(*overrides)
+
+// overrides are the dependencies passed to New, the zero value of each comes from the config
+type overrides struct {
+	cloudService cloud.Service
+	apiURL       string
+	metricsURL   string
+	locker       Locker
+	notifier     Notifier
+	clock        Clock
+}
+
+// WithCloudService scales through the given cloud service instead of creating one from
+// cloudConfig, which may then be left out
+func WithCloudService(service cloud.Service) CloudSaverOption {
+	return func(o *overrides) {
+		o.cloudService = service
+	}
+}
+
+// WithAPIURL reads the routers and services from the Traefik API at the given URL instead of apiURL
+func WithAPIURL(apiURL string) CloudSaverOption {
+	return func(o *overrides) {
+		o.apiURL = apiURL
+	}
+}
+
+// WithMetricsURL reads the metrics from the given URL instead of metricsURL, comma separated for
+// several Traefik replicas the same way
+func WithMetricsURL(metricsURL string) CloudSaverOption {
+	return func(o *overrides) {
+		o.metricsURL = metricsURL
+	}
+}
+
+// WithLocker locks scale actions through the given locker instead of the files of lock
+func WithLocker(locker Locker) CloudSaverOption {
+	return func(o *overrides) {
+		o.locker = locker
+	}
+}
+
+// WithNotifier tells the given notifier about every scale action, alongside notifications
+func WithNotifier(notifier Notifier) CloudSaverOption {
+	return func(o *overrides) {
+		o.notifier = notifier
+	}
+}
+
+// WithClock takes the time from the given clock instead of the wall clock
+func WithClock(clock Clock) CloudSaverOption {
+	return func(o *overrides) {
+		o.clock = clock
+	}
+}
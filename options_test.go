@@ -0,0 +1,67 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+	"github.com/danbiagini/traefik-cloud-saver/cloud/mock"
+)
+
+func TestCloudSaverOptions(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+	svc, err := mock.New(&common.CloudServiceConfig{Type: "mock", InitialScale: map[string]int32{"idle": 1}})
+	if err != nil {
+		t.Fatalf("mock.New() failed: %v", err)
+	}
+
+	config := CreateConfig()
+	config.WindowSize = "1s"
+	config.testMode = true
+	config.CloudConfig = nil
+	if _, err := New(context.Background(), config, "test"); err == nil {
+		t.Fatal("expected an error without a cloud config or a cloud service")
+	}
+
+	saver, err := New(context.Background(), config, "test", WithCloudService(svc),
+		WithAPIURL(backend.server.URL+"/api"), WithMetricsURL(backend.server.URL+"/metrics"))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if saver.CloudService() != svc {
+		t.Fatalf("expected the injected cloud service, got %T", saver.CloudService())
+	}
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, svc, "idle"); scale != 0 {
+		t.Errorf("expected idle to be scaled down through the injected service, got scale %d", scale)
+	}
+}
+
+// heldLocker reports every lock as held by another replica
+type heldLocker struct{}
+
+func (heldLocker) TryLock(context.Context, string, string) (bool, error) { return false, nil }
+func (heldLocker) Unlock(context.Context, string, string) error          { return nil }
+
+func TestWithLocker(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"idle": 1}, nil, WithLocker(heldLocker{}))
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, svc, "idle"); scale != 1 {
+		t.Errorf("expected the injected locker to hold off the scale down, got scale %d", scale)
+	}
+	if got := saver.decisions.count("idle@docker", actionKeep, reasonLocked); got != 1 {
+		t.Errorf("expected 1 locked decision, got %d", got)
+	}
+}
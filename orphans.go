@@ -0,0 +1,66 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// errServiceNotFound is returned when the Traefik API doesn't know about a service
+var errServiceNotFound = errors.New("service not found in traefik API")
+
+// orphanService tracks a service which shows up in the metrics but not in the Traefik API,
+// typically because it's being torn down and the counters haven't expired yet
+type orphanService struct {
+	firstSeen time.Time
+	gone      bool // grace period has passed and the service was handled
+}
+
+// reconcileOrphan applies the grace policy for a service missing from the Traefik API.  The service
+// is retained for the grace period in case the API catches up, after that it's considered gone and,
+// if configured and the service was previously managed, its backing instance is scaled down.
+func (p *CloudSaver) reconcileOrphan(ctx context.Context, serviceName string) {
+	orphan, ok := p.orphans[serviceName]
+	if !ok {
+		orphan = &orphanService{firstSeen: p.clock.Now()}
+		p.orphans[serviceName] = orphan
+		common.LogProvider("traefik-cloud-saver", "Service %s is in the metrics but not the Traefik API, waiting %v before treating it as gone", serviceName, p.orphanGracePeriod)
+	}
+
+	if orphan.gone || since(p.clock, orphan.firstSeen) < p.orphanGracePeriod {
+		return
+	}
+	orphan.gone = true
+
+	cloudServiceName := p.getCloudServiceName(serviceName)
+	common.LogProvider("traefik-cloud-saver", "Service %s has been missing from the Traefik API for %v, considering it gone", serviceName, since(p.clock, orphan.firstSeen).Round(time.Second))
+
+	if !p.scaleDownOrphans || !p.managedServices[cloudServiceName] {
+		return
+	}
+	if p.neverScaledDown(cloudServiceName, serviceName) {
+		p.decide(serviceName, actionKeep, reasonNeverScaleDown)
+		return
+	}
+	if p.inCooldown(cloudServiceName, actionScaleDown) {
+		// try again once the cooldown is over
+		orphan.gone = false
+		p.decide(serviceName, actionKeep, reasonCooldown)
+		return
+	}
+
+	if p.skipDryRun(actionScaleDown, cloudServiceName, "(orphaned %s)", serviceName) {
+		p.decide(serviceName, actionKeep, reasonDryRun)
+		return
+	}
+	if err := p.scaleDown(ctx, cloudServiceName); err != nil {
+		common.LogProvider("traefik-cloud-saver", "[ERROR]: failed to scale down orphaned service %s, err: %s", cloudServiceName, err)
+		p.decide(serviceName, actionScaleDown, reasonError)
+		return
+	}
+	p.decide(serviceName, actionScaleDown, reasonOrphaned)
+	p.notify(cloudServiceName, actionScaleDown, reasonOrphaned, 0, 0)
+	common.LogProvider("traefik-cloud-saver", "Scaled down orphaned service %s (%s)", serviceName, cloudServiceName)
+}
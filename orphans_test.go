@@ -0,0 +1,110 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOrphanedServices(t *testing.T) {
+	busy := `traefik_service_requests_total{service="svc1@docker"} 100`
+
+	tests := []struct {
+		name             string
+		gracePeriod      string
+		scaleDownOrphans bool
+		wantScale        int32
+		wantGone         bool
+	}{
+		{
+			name:             "scaled down once the grace period has passed",
+			gracePeriod:      "0s",
+			scaleDownOrphans: true,
+			wantScale:        0,
+			wantGone:         true,
+		},
+		{
+			name:             "retained during the grace period",
+			gracePeriod:      "1h",
+			scaleDownOrphans: true,
+			wantScale:        1,
+			wantGone:         false,
+		},
+		{
+			name:             "gone but scale down disabled",
+			gracePeriod:      "0s",
+			scaleDownOrphans: false,
+			wantScale:        1,
+			wantGone:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			backend.addService("svc1@docker", "r1@docker")
+			backend.setMetrics(busy, "")
+
+			saver, cloud := newTestSaver(t, backend, map[string]int32{"svc1": 1}, func(c *Config) {
+				c.OrphanGracePeriod = tt.gracePeriod
+				c.ScaleDownOrphans = tt.scaleDownOrphans
+				c.RouterCacheTTL = "0s" // see the service go right away
+			})
+
+			// first window, the service is known to both sources and busy
+			if _, err := saver.generateConfiguration(context.Background()); err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+
+			// the service is torn down in Traefik, but its counters are still in the metrics
+			backend.removeService("svc1@docker")
+			if _, err := saver.generateConfiguration(context.Background()); err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+
+			orphan, ok := saver.orphans["svc1@docker"]
+			if !ok {
+				t.Fatal("expected svc1 to be tracked as an orphan")
+			}
+			if orphan.gone != tt.wantGone {
+				t.Errorf("orphan gone = %v, want %v", orphan.gone, tt.wantGone)
+			}
+			if scale := currentScale(t, cloud, "svc1"); scale != tt.wantScale {
+				t.Errorf("expected svc1 scale %d, got %d", tt.wantScale, scale)
+			}
+		})
+	}
+}
+
+func TestOrphanReappears(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.setMetrics(`traefik_service_requests_total{service="svc1@docker"} 100`, "")
+
+	saver, _ := newTestSaver(t, backend, map[string]int32{"svc1": 1}, func(c *Config) {
+		c.OrphanGracePeriod = "1h"
+	})
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if _, ok := saver.orphans["svc1@docker"]; !ok {
+		t.Fatal("expected svc1 to be tracked as an orphan")
+	}
+
+	// the API catches up
+	backend.addService("svc1@docker", "r1@docker")
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if _, ok := saver.orphans["svc1@docker"]; ok {
+		t.Error("svc1 should no longer be an orphan once the API knows about it")
+	}
+
+	// and an orphan that drops out of the metrics is forgotten
+	saver.orphans["old@docker"] = &orphanService{}
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if _, ok := saver.orphans["old@docker"]; ok {
+		t.Error("orphans missing from the metrics should be forgotten")
+	}
+}
@@ -0,0 +1,27 @@
+package traefik_cloud_saver
+
+import (
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// what to do with a tick that came due while a window was still running, e.g. waiting on a slow
+// scale operation
+const (
+	windowOverlapQueue = "queue" // run the next window as soon as the long one finishes
+	windowOverlapSkip  = "skip"  // drop the tick and wait for the following one
+)
+
+// skipOverrun drops the tick that came due while the window was running, if any and the overlap
+// policy is skip, so the next window starts a full period after this one finished.  Windows never
+// run concurrently, the ticker holds at most one tick for the loop to pick up.
+func (p *CloudSaver) skipOverrun(ticker Ticker) {
+	if p.windowOverlap != windowOverlapSkip {
+		return
+	}
+	select {
+	case <-ticker.C():
+		p.actions.windowSkipped()
+		common.LogProvider("traefik-cloud-saver", "[WARNING] window took longer than the window size, skipping the next one")
+	default:
+	}
+}
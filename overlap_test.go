@@ -0,0 +1,93 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWindowOverlap(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		wantWindows int
+		wantSkipped uint64
+	}{
+		{name: "queue runs the overdue window", policy: "", wantWindows: 2, wantSkipped: 0},
+		{name: "skip drops the overdue window", policy: windowOverlapSkip, wantWindows: 1, wantSkipped: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			backend.addService("idle@docker", "idle@docker")
+			backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+			clock := &tickClock{created: make(chan *manualTicker, 1)}
+			saver, svc := newTestSaver(t, backend, map[string]int32{"idle": 1}, func(c *Config) {
+				c.WindowOverlap = tt.policy
+			}, WithClock(clock))
+			svc.SetOperationDelay(300 * time.Millisecond)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go saver.loadConfiguration(ctx, make(chan json.Marshaler, 10))
+
+			// the second tick is only buffered once the loop took the first, so it comes due
+			// while the first window waits on the scale down
+			ticker := <-clock.created
+			ticker.c <- time.Now()
+			ticker.c <- time.Now()
+
+			windows := func() (int, uint64) {
+				saver.mu.RLock()
+				defer saver.mu.RUnlock()
+				saver.actions.mu.Lock()
+				defer saver.actions.mu.Unlock()
+				return saver.summary.window, saver.actions.skipped
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				window, skipped := windows()
+				if window == tt.wantWindows && skipped == tt.wantSkipped && len(ticker.c) == 0 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("got %d windows and %d skipped, want %d and %d", window, skipped, tt.wantWindows, tt.wantSkipped)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			// nothing else is pending, so no further window runs
+			time.Sleep(50 * time.Millisecond)
+			if window, skipped := windows(); window != tt.wantWindows || skipped != tt.wantSkipped {
+				t.Errorf("got %d windows and %d skipped, want %d and %d", window, skipped, tt.wantWindows, tt.wantSkipped)
+			}
+			if scale := currentScale(t, svc, "idle"); scale != 0 {
+				t.Errorf("expected idle to be scaled down, got scale %d", scale)
+			}
+		})
+	}
+}
+
+func TestWindowOverlapMetric(t *testing.T) {
+	metrics := newActionMetrics()
+	metrics.windowSkipped()
+	metrics.windowSkipped()
+
+	var body strings.Builder
+	metrics.writeTo(&body, 0)
+	if want := "cloudsaver_windows_skipped_total 2"; !strings.Contains(body.String(), want) {
+		t.Errorf("expected %q in:\n%s", want, body.String())
+	}
+}
+
+func TestWindowOverlapValidation(t *testing.T) {
+	config := CreateConfig()
+	config.WindowOverlap = "parallel"
+	if err := config.Validate(); err == nil {
+		t.Error("expected an error for an unknown window overlap policy")
+	}
+}
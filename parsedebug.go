@@ -0,0 +1,80 @@
+package traefik_cloud_saver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// ParsedScrape is what the last scrape of a metrics endpoint parsed into, to diagnose request
+// counter lines the parser drops, e.g. because of unexpected escaping
+type ParsedScrape struct {
+	Endpoint     string             `json:"endpoint"`
+	Time         time.Time          `json:"time"`
+	BodyBytes    int                `json:"bodyBytes"`    // length of the scraped text, after decompression
+	RequestLines int                `json:"requestLines"` // lines of the request counter family, whether or not they were counted
+	Counts       map[string]float64 `json:"counts"`       // successful requests by service, as fetchServiceRequests returns them
+	ServerErrors map[string]float64 `json:"serverErrors"` // 5xx responses by service
+}
+
+// WithParseDebug keeps what the last scrape of each endpoint parsed into, see ParsedScrapes
+func WithParseDebug() MetricsCollectorOption {
+	return func(mc *MetricsCollector) {
+		mc.parsed = make(map[string]ParsedScrape)
+	}
+}
+
+// recordParse keeps the result of parsing a scrape of an endpoint, if WithParseDebug is set
+func (mc *MetricsCollector) recordParse(endpoint string, bodyBytes, requestLines int, sample metricsSample) {
+	if mc.parsed == nil {
+		return
+	}
+	parsed := ParsedScrape{
+		Endpoint:     endpoint,
+		Time:         sample.time,
+		BodyBytes:    bodyBytes,
+		RequestLines: requestLines,
+		Counts:       make(map[string]float64, len(sample.counts)),
+		ServerErrors: make(map[string]float64, len(sample.serverErrors)),
+	}
+	for service, count := range sample.counts {
+		parsed.Counts[service] = count
+	}
+	for service, count := range sample.serverErrors {
+		parsed.ServerErrors[service] = count
+	}
+
+	mc.parsedMu.Lock()
+	defer mc.parsedMu.Unlock()
+	mc.parsed[endpoint] = parsed
+}
+
+// ParsedScrapes returns what the last scrape of each metrics endpoint parsed into, ordered by
+// endpoint, or nil without WithParseDebug
+func (mc *MetricsCollector) ParsedScrapes() []ParsedScrape {
+	mc.parsedMu.Lock()
+	defer mc.parsedMu.Unlock()
+
+	if mc.parsed == nil {
+		return nil
+	}
+	scrapes := make([]ParsedScrape, 0, len(mc.parsed))
+	for _, parsed := range mc.parsed {
+		scrapes = append(scrapes, parsed)
+	}
+	sort.Slice(scrapes, func(i, j int) bool {
+		return scrapes[i].Endpoint < scrapes[j].Endpoint
+	})
+	return scrapes
+}
+
+// serveParsedScrapes serves the last parsed scrapes as JSON
+func (p *CloudSaver) serveParsedScrapes(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(p.metricsCollector.ParsedScrapes()); err != nil {
+		common.LogProvider("traefik-cloud-saver", "[ERROR]: failed to write parsed scrapes: %v", err)
+	}
+}
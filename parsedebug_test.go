@@ -0,0 +1,68 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParsedScrapes(t *testing.T) {
+	backend := newTestBackend(t)
+	metrics := `# TYPE traefik_service_requests_total counter
+traefik_service_requests_total{service="web@docker",code="200"} 10
+traefik_service_requests_total{service="web@docker",code="503"} 2
+traefik_service_requests_total{code="200",service="api@docker"} 5
+traefik_service_requests_total{service="api\"v2@docker",code="200"} 7
+`
+	backend.setMetrics(metrics, "")
+
+	saver, _ := newTestSaver(t, backend, nil, nil)
+	if scrapes := saver.metricsCollector.ParsedScrapes(); scrapes != nil {
+		t.Errorf("expected no parsed scrapes without debugParsedCounts, got %v", scrapes)
+	}
+
+	saver, _ = newTestSaver(t, backend, nil, func(c *Config) {
+		c.DebugParsedCounts = true
+		c.SelfMetricsAddress = "127.0.0.1:0"
+	})
+	counts, err := saver.metricsCollector.fetchServiceRequests(context.Background())
+	if err != nil {
+		t.Fatalf("fetchServiceRequests() failed: %v", err)
+	}
+
+	scrapes := saver.metricsCollector.ParsedScrapes()
+	if len(scrapes) != 1 {
+		t.Fatalf("expected one parsed scrape, got %v", scrapes)
+	}
+	parsed := scrapes[0]
+	if parsed.Endpoint != saver.metricsCollector.metricsURL || parsed.BodyBytes != len(metrics) || parsed.RequestLines != 4 {
+		t.Errorf("parsed scrape of %s, %d bytes, %d request lines, want %s, %d and 4",
+			parsed.Endpoint, parsed.BodyBytes, parsed.RequestLines, saver.metricsCollector.metricsURL, len(metrics))
+	}
+	if !reflect.DeepEqual(parsed.Counts, counts) {
+		t.Errorf("parsed counts %v, want those returned by fetchServiceRequests %v", parsed.Counts, counts)
+	}
+	if parsed.ServerErrors["web@docker"] != 2 {
+		t.Errorf("parsed server errors %v, want 2 for web@docker", parsed.ServerErrors)
+	}
+
+	// served as JSON alongside the self metrics
+	if err := saver.startSelfMetrics(); err != nil {
+		t.Fatalf("startSelfMetrics() failed: %v", err)
+	}
+	defer saver.selfMetricsServer.Close()
+	resp, err := http.Get("http://" + saver.selfMetricsListener.Addr().String() + "/debug/parsed")
+	if err != nil {
+		t.Fatalf("GET /debug/parsed failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var served []ParsedScrape
+	if err := json.NewDecoder(resp.Body).Decode(&served); err != nil {
+		t.Fatalf("failed to decode parsed scrapes: %v", err)
+	}
+	if len(served) != 1 || !reflect.DeepEqual(served[0].Counts, counts) {
+		t.Errorf("served %+v, want the parsed counts %v", served, counts)
+	}
+}
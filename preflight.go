@@ -0,0 +1,52 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// preflightTimeout bounds the preflight checks of every endpoint together, startup shouldn't wait
+// long on one which is down
+const preflightTimeout = 5 * time.Second
+
+// preflight checks every metrics endpoint and the Traefik API answer with a 2xx, so a mistyped URL
+// fails startup rather than showing up as no traffic at all.  Every endpoint which doesn't is
+// reported.
+func (p *CloudSaver) preflight() error {
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+
+	var errs []error
+	mc := p.metricsCollector
+	for _, endpoint := range append([]metricsEndpoint{{url: mc.metricsURL, auth: mc.auth}}, mc.replicas...) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.url, nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("preflight check of metrics endpoint %s failed: %w", endpoint.url, err))
+			continue
+		}
+		endpoint.auth.apply(req)
+		if err := checkPreflight(mc.client.Do(req)); err != nil {
+			errs = append(errs, fmt.Errorf("preflight check of metrics endpoint %s failed: %w", endpoint.url, err))
+		}
+	}
+
+	if err := checkPreflight(p.apiGet(ctx, "/http/routers")); err != nil {
+		errs = append(errs, fmt.Errorf("preflight check of the Traefik API at %s failed: %w", p.apiURL, err))
+	}
+	return errors.Join(errs...)
+}
+
+// checkPreflight checks a preflight request got a 2xx response
+func checkPreflight(resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("got %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package traefik_cloud_saver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreflightChecks(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name      string
+		preflight bool
+		metrics   int // status of the metrics endpoint, 200 when zero
+		apiDown   bool
+		wantErr   []string
+	}{
+		{name: "reachable", preflight: true},
+		{name: "metrics error", preflight: true, metrics: http.StatusInternalServerError, wantErr: []string{"metrics endpoint"}},
+		{name: "api down", preflight: true, apiDown: true, wantErr: []string{"Traefik API"}},
+		{name: "both", preflight: true, metrics: http.StatusNotFound, apiDown: true, wantErr: []string{"metrics endpoint", "Traefik API"}},
+		{name: "disabled", apiDown: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			handler := backend.server.Config.Handler
+			backend.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/metrics" && tt.metrics != 0 {
+					w.WriteHeader(tt.metrics)
+					return
+				}
+				handler.ServeHTTP(w, r)
+			})
+
+			saver, _ := newTestSaver(t, backend, nil, func(c *Config) {
+				c.PreflightChecks = tt.preflight
+			})
+			if tt.apiDown {
+				saver.apiURL = closed.URL + "/api"
+			}
+
+			err := saver.Init()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("Init() failed: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Init() = %v, want it to report the %s", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// How request rates are obtained, by scraping Traefik's metrics or by querying a Prometheus server
+// which already scrapes them
+const (
+	metricsTypeScrape = "prometheus-scrape"
+	metricsTypeQuery  = "prometheus-query"
+)
+
+// promQLWindowPlaceholder is replaced with the window size in a PromQL template
+const promQLWindowPlaceholder = "{{window}}"
+
+// defaultPromQL is the successful request rate of each service over a window, summed across
+// every Traefik replica Prometheus scrapes
+const defaultPromQL = `sum(rate(traefik_service_requests_total{code=~"2.."}[` + promQLWindowPlaceholder + `])) by (service)`
+
+// promQueryResponse is the part of a Prometheus HTTP API instant query response the plugin reads
+type promQueryResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Value  []interface{}     `json:"value"` // [ <unix time>, "<value>" ]
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// WithPromQL queries a Prometheus server at the metrics URL instead of scraping Traefik.  The
+// query must return per second rates by the service (or router) label, and {{window}} in it is
+// replaced with the window size.
+func WithPromQL(template string, window time.Duration) MetricsCollectorOption {
+	return func(mc *MetricsCollector) {
+		if template == "" {
+			template = defaultPromQL
+		}
+		mc.promQL = strings.ReplaceAll(template, promQLWindowPlaceholder, fmt.Sprintf("%ds", int64(window.Seconds())))
+	}
+}
+
+// queryServiceRates runs the PromQL query and maps the instant vector it returns to service
+// rates.  Prometheus has already computed the rates, so there's no counter baseline to keep.
+func (mc *MetricsCollector) queryServiceRates(ctx context.Context) (map[string]*ServiceRate, error) {
+	now := mc.clock.Now()
+	duration := now.Sub(mc.lastTime)
+
+	result, err := mc.runQuery(ctx)
+	if err != nil {
+		mc.countScrapeError()
+		return nil, fmt.Errorf("failed to query service rates: %w", err)
+	}
+
+	rates := make(map[string]*ServiceRate)
+	for service, perSecond := range result {
+		if perSecond > 0 || mc.lastRequest[service].IsZero() {
+			mc.lastRequest[service] = now
+		}
+		rates[service] = &ServiceRate{
+			ServiceName: service,
+			PerMin:      perSecond * 60,
+			Duration:    duration,
+			LastRequest: mc.lastRequest[service],
+			Samples:     1,
+		}
+	}
+
+	// like a scrape, a service which drops out of the result is reported with no traffic, unless
+	// the result is empty altogether
+	if len(result) > 0 {
+		for service, lastRequest := range mc.lastRequest {
+			if _, ok := rates[service]; ok {
+				continue
+			}
+			common.DebugLog("traefik-cloud-saver", "service %s is missing from the query result, reporting no traffic", service)
+			rates[service] = &ServiceRate{ServiceName: service, Duration: duration, LastRequest: lastRequest}
+		}
+	}
+
+	mc.lastTime = now
+	return rates, nil
+}
+
+// runQuery runs the PromQL query against the Prometheus HTTP API, returning the value of each
+// series keyed by its service (or router) label
+func (mc *MetricsCollector) runQuery(ctx context.Context) (map[string]float64, error) {
+	queryURL := strings.TrimSuffix(mc.metricsURL, "/") + "/api/v1/query?" + url.Values{"query": {mc.promQL}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, queryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create query request: %w", err)
+	}
+	mc.auth.apply(req)
+
+	resp, err := mc.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run query: %w", err)
+	}
+	defer func() {
+		closeErr := resp.Body.Close()
+		if closeErr != nil {
+			common.LogProvider("traefik-cloud-saver", "[Error] closing response body: %v", closeErr)
+		}
+	}()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("prometheus %s rejected the request (%s), check the metrics auth", mc.metricsURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read query response: %w", err)
+	}
+
+	// Prometheus answers a bad query with a 400 and an error in the usual body
+	var response promQueryResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("%w: query response from %s isn't JSON (%s)", errUnexpectedMetricsContent, mc.metricsURL, resp.Status)
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("query failed (%s): %s", response.ErrorType, response.Error)
+	}
+	if response.Data.ResultType != "vector" {
+		return nil, fmt.Errorf("query must return an instant vector, got %s", response.Data.ResultType)
+	}
+
+	values := make(map[string]float64, len(response.Data.Result))
+	for _, series := range response.Data.Result {
+		name := series.Metric[mc.keyLabel]
+		if name == "" {
+			return nil, fmt.Errorf("query result series %v has no %s label, aggregate the query by (%s)", series.Metric, mc.keyLabel, mc.keyLabel)
+		}
+		value, err := promSampleValue(series.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		values[name] += value
+	}
+	return values, nil
+}
+
+// promSampleValue parses the value of a [ <unix time>, "<value>" ] sample.  NaN, from a rate
+// over a window with no samples, counts as no traffic.
+func promSampleValue(sample []interface{}) (float64, error) {
+	if len(sample) != 2 {
+		return 0, fmt.Errorf("expected a [time, value] pair, got %v", sample)
+	}
+	text, ok := sample[1].(string)
+	if !ok {
+		return 0, errors.New("sample value isn't a string")
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(value) {
+		return 0, nil
+	}
+	return value, nil
+}
+
+// validateMetricsType checks the metrics type, and that options only meaningful for a scrape
+// aren't set with a query.  The query itself decides which codes and labels are counted.
+func validateMetricsType(config *Config) error {
+	switch config.MetricsType {
+	case "", metricsTypeScrape:
+		if config.PromQL != "" {
+			return fmt.Errorf("promQL requires metricsType %s", metricsTypeQuery)
+		}
+		return nil
+	case metricsTypeQuery:
+	default:
+		return fmt.Errorf("invalid metrics type %q, expected %s or %s", config.MetricsType, metricsTypeScrape, metricsTypeQuery)
+	}
+
+	switch {
+	case strings.Contains(config.MetricsURL, ","):
+		return fmt.Errorf("metricsType %s takes a single Prometheus URL", metricsTypeQuery)
+	case config.ScrapeInterval != "":
+		return fmt.Errorf("scrapeInterval can't be used with metricsType %s", metricsTypeQuery)
+	case config.SampleWindow != 0:
+		return fmt.Errorf("sampleWindow can't be used with metricsType %s, set the range in the query", metricsTypeQuery)
+	case len(config.MetricLabels) > 0 || len(config.SuccessCodes) > 0:
+		return fmt.Errorf("metricLabels and successCodes can't be used with metricsType %s, filter in the query", metricsTypeQuery)
+	case len(config.ActivityMetrics) > 0:
+		return fmt.Errorf("activityMetrics can't be used with metricsType %s", metricsTypeQuery)
+	case len(config.Protocols) > 1 || (len(config.Protocols) == 1 && config.Protocols[0] != protocolHTTP):
+		return fmt.Errorf("tcp routers can't be monitored with metricsType %s", metricsTypeQuery)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// promServer fakes the instant query endpoint of the Prometheus HTTP API
+type promServer struct {
+	mu       sync.Mutex
+	response string
+	queries  []string
+	server   *httptest.Server
+}
+
+func newPromServer(t *testing.T) *promServer {
+	t.Helper()
+
+	p := &promServer{}
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+		p.queries = append(p.queries, r.URL.Query().Get("query"))
+		fmt.Fprint(w, p.response)
+	}))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *promServer) setResult(result string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.response = `{"status":"success","data":{"resultType":"vector","result":[` + result + `]}}`
+}
+
+func TestPromQLServiceRates(t *testing.T) {
+	prom := newPromServer(t)
+	prom.setResult(`{"metric":{"service":"busy@docker"},"value":[1700000000.1,"2.5"]},
+		{"metric":{"service":"idle@docker"},"value":[1700000000.1,"0"]},
+		{"metric":{"service":"new@docker"},"value":[1700000000.1,"NaN"]}`)
+
+	mc := NewMetricsCollector(prom.server.URL, WithPromQL("", 5*time.Minute))
+	rates, err := mc.GetServiceRates(context.Background())
+	if err != nil {
+		t.Fatalf("GetServiceRates() failed: %v", err)
+	}
+
+	want := map[string]float64{"busy@docker": 150, "idle@docker": 0, "new@docker": 0}
+	if len(rates) != len(want) {
+		t.Fatalf("expected %d rates, got %v", len(want), rates)
+	}
+	for service, perMin := range want {
+		if rate, ok := rates[service]; !ok || rate.PerMin != perMin {
+			t.Errorf("expected %s at %v req/min, got %+v", service, perMin, rate)
+		}
+	}
+
+	wantQuery := `sum(rate(traefik_service_requests_total{code=~"2.."}[300s])) by (service)`
+	if len(prom.queries) != 1 || prom.queries[0] != wantQuery {
+		t.Errorf("expected query %q, got %v", wantQuery, prom.queries)
+	}
+
+	// a service dropping out of the result has no traffic
+	prom.setResult(`{"metric":{"service":"busy@docker"},"value":[1700000060.1,"1"]}`)
+	rates, err = mc.GetServiceRates(context.Background())
+	if err != nil {
+		t.Fatalf("GetServiceRates() failed: %v", err)
+	}
+	if rate, ok := rates["idle@docker"]; !ok || rate.PerMin != 0 {
+		t.Errorf("expected idle@docker reported with no traffic, got %+v", rate)
+	}
+}
+
+func TestPromQLErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+	}{
+		{name: "bad query", response: `{"status":"error","errorType":"bad_data","error":"parse error"}`},
+		{name: "range vector", response: `{"status":"success","data":{"resultType":"matrix","result":[]}}`},
+		{name: "missing label", response: `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1,"1"]}]}}`},
+		{name: "not json", response: `<html>login</html>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prom := newPromServer(t)
+			prom.response = tt.response
+
+			mc := NewMetricsCollector(prom.server.URL, WithPromQL("sum(rate(x[{{window}}])) by (service)", 5*time.Minute))
+			if _, err := mc.GetServiceRates(context.Background()); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestPromQLScaleDown(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	prom := newPromServer(t)
+	prom.setResult(`{"metric":{"service":"idle@docker"},"value":[1700000000.1,"0"]}`)
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"idle": 1}, func(c *Config) {
+		c.MetricsType = metricsTypeQuery
+	})
+	saver.metricsCollector.metricsURL = prom.server.URL
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, svc, "idle"); scale != 0 {
+		t.Errorf("expected idle to be scaled down on the queried rate, got scale %d", scale)
+	}
+}
+
+func TestMetricsTypeValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*Config)
+	}{
+		{name: "unknown type", configure: func(c *Config) { c.MetricsType = "statsd" }},
+		{name: "query without type", configure: func(c *Config) { c.PromQL = "up" }},
+		{name: "scrape interval", configure: func(c *Config) {
+			c.MetricsType = metricsTypeQuery
+			c.ScrapeInterval = "100ms"
+		}},
+		{name: "success codes", configure: func(c *Config) {
+			c.MetricsType = metricsTypeQuery
+			c.SuccessCodes = []string{"3xx"}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.WindowSize = "1s"
+			config.testMode = true
+			tt.configure(config)
+			if _, err := New(context.Background(), config, "test"); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
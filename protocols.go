@@ -0,0 +1,106 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Router protocols whose services can be monitored, each listed by its own part of the Traefik API
+const (
+	protocolHTTP = "http"
+	protocolTCP  = "tcp"
+
+	// TCP services have no request counter, a gauge of their open connections stands in for it
+	defaultTCPConnectionsMetric = "traefik_service_open_connections"
+)
+
+// parseProtocols checks the router protocols to monitor, http alone by default
+func parseProtocols(protocols []string) ([]string, error) {
+	if len(protocols) == 0 {
+		return []string{protocolHTTP}, nil
+	}
+	seen := make(map[string]bool, len(protocols))
+	parsed := make([]string, 0, len(protocols))
+	for _, protocol := range protocols {
+		switch protocol {
+		case protocolHTTP, protocolTCP:
+		default:
+			return nil, fmt.Errorf("unknown router protocol %q, expected %s or %s", protocol, protocolHTTP, protocolTCP)
+		}
+		if !seen[protocol] {
+			seen[protocol] = true
+			parsed = append(parsed, protocol)
+		}
+	}
+	// http first, so a service known to both is looked up the same way whatever the order
+	sort.Strings(parsed)
+	return parsed, nil
+}
+
+// hasProtocol reports whether the routers of a protocol are monitored
+func hasProtocol(protocols []string, protocol string) bool {
+	for _, p := range protocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// trackTCPConnections makes the collector track the open connections gauge of TCP services,
+// alongside the activity metrics
+func (mc *MetricsCollector) trackTCPConnections(metric string) {
+	if mc.activityMetrics == nil {
+		mc.activityMetrics = make(map[string]bool)
+	}
+	mc.activityMetrics[metric] = true
+}
+
+// tcpConnections returns a description of the first TCP service sharing a cloud service with a
+// connection open, or an empty string if there's none.  A connection keeps a TCP service up
+// whatever its weight, there's no rate to weigh.
+func (p *CloudSaver) tcpConnections(members []*instanceMember) string {
+	for _, member := range members {
+		if member.protocol != protocolTCP {
+			continue
+		}
+		if open := member.rate.Activity[p.tcpMetric]; open >= 1 {
+			return fmt.Sprintf("%s has %.0f open tcp connections", member.serviceName, open)
+		}
+	}
+	return ""
+}
+
+// getServiceRouters returns the routers using a traefik service, from the part of the API for a
+// protocol, or errServiceNotFound if it's not a service of that protocol
+func (p *CloudSaver) getServiceRouters(ctx context.Context, protocol, serviceName string) ([]string, error) {
+	resp, err := p.apiGet(ctx, "/"+protocol+"/services/"+serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch information for service %s, err: %w", serviceName, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", errServiceNotFound, serviceName)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch information for service %s: API returned %s", serviceName, resp.Status)
+	}
+	return decodeUsedBy(resp, serviceName)
+}
+
+// getRoutersForService returns every router using a traefik service, in order, e.g. one per host
+// it's served on, and the protocol of those routers.  Each monitored protocol is tried in turn.
+func (p *CloudSaver) getRoutersForService(ctx context.Context, serviceName string) ([]string, string, error) {
+	for _, protocol := range p.protocols {
+		routerNames, err := p.getServiceRouters(ctx, protocol, serviceName)
+		if errors.Is(err, errServiceNotFound) {
+			continue
+		}
+		return routerNames, protocol, err
+	}
+	return nil, "", fmt.Errorf("%w: %s", errServiceNotFound, serviceName)
+}
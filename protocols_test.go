@@ -0,0 +1,110 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTCPService(t *testing.T) {
+	tests := []struct {
+		name      string
+		protocols []string
+		open      string
+		wantScale int32
+	}{
+		{name: "open connection keeps it up", protocols: []string{protocolTCP, protocolHTTP}, open: "2", wantScale: 1},
+		{name: "no connections scale it down", protocols: []string{protocolHTTP, protocolTCP}, open: "0", wantScale: 0},
+		{name: "invisible unless tcp is monitored", protocols: nil, open: "0", wantScale: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			backend.addService("web@docker", "web@docker")
+			backend.addTCPService("db@docker", "db@docker")
+			backend.setMetrics(`traefik_service_requests_total{service="web@docker"} 0
+traefik_service_open_connections{service="db@docker",protocol="TCP"} `+tt.open, "")
+
+			saver, svc := newTestSaver(t, backend, map[string]int32{"web": 1, "db": 1}, func(c *Config) {
+				c.WindowSize = "1m"
+				c.Protocols = tt.protocols
+			})
+
+			payload, err := saver.generateConfiguration(context.Background())
+			if err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+			if scale := currentScale(t, svc, "db"); scale != tt.wantScale {
+				t.Errorf("expected db at scale %d, got %d", tt.wantScale, scale)
+			}
+			if scale := currentScale(t, svc, "web"); scale != 0 {
+				t.Errorf("expected web to be scaled down, got scale %d", scale)
+			}
+
+			// only the http router can be shadowed
+			routers := payload.Configuration.HTTP.Routers
+			if _, ok := routers[configPrefix+"web"]; !ok {
+				t.Errorf("expected the web router to be shadowed, got %v", routers)
+			}
+			if _, ok := routers[configPrefix+"db"]; ok {
+				t.Errorf("expected the tcp router not to be shadowed, got %v", routers)
+			}
+		})
+	}
+}
+
+func TestGetRoutersFromAPIProtocols(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("web@docker", "web@docker")
+	backend.addTCPService("db@docker", "db@docker")
+	saver, _ := newTestSaver(t, backend, nil, func(c *Config) {
+		c.Protocols = []string{protocolHTTP, protocolTCP}
+	})
+
+	routers, err := saver.getRoutersFromAPI(context.Background())
+	if err != nil {
+		t.Fatalf("getRoutersFromAPI() failed: %v", err)
+	}
+	for routerName, want := range map[string]string{"web@docker": protocolHTTP, "db@docker": protocolTCP} {
+		if router, ok := routers[routerName]; !ok || router.Protocol != want {
+			t.Errorf("expected %s router %s, got %+v", want, routerName, router)
+		}
+	}
+
+	serviceRouters, protocol, err := saver.getRoutersForService(context.Background(), "db@docker")
+	if err != nil {
+		t.Fatalf("getRoutersForService() failed: %v", err)
+	}
+	if len(serviceRouters) != 1 || serviceRouters[0] != "db@docker" || protocol != protocolTCP {
+		t.Errorf("getRoutersForService() = %v, %s, want the tcp router", serviceRouters, protocol)
+	}
+}
+
+func TestProtocolsValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(c *Config)
+	}{
+		{name: "unknown protocol", configure: func(c *Config) { c.Protocols = []string{"udp"} }},
+		{name: "tcp with router metrics", configure: func(c *Config) {
+			c.Protocols = []string{protocolTCP}
+			c.MetricSource = metricSourceRouter
+		}},
+		{name: "tcp metric counted as a counter", configure: func(c *Config) {
+			c.Protocols = []string{protocolTCP}
+			c.ActivityMetrics = map[string][]ActivityMetric{"app": {{Name: defaultTCPConnectionsMetric}}}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.WindowSize = "1s"
+			config.testMode = true
+			tt.configure(config)
+			if _, err := New(context.Background(), config, "test"); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+const (
+	// defaultReadinessTimeout is how long a scaled up service may take to pass its probe
+	defaultReadinessTimeout = 5 * time.Minute
+
+	// readinessProbeTimeout bounds a single probe attempt
+	readinessProbeTimeout = 2 * time.Second
+)
+
+// ReadinessProbe configures how to tell a scaled up service is actually ready.  Cloud providers
+// report an instance as running well before the application on it can serve, so until the probe
+// passes the service isn't re-evaluated for scale down.
+type ReadinessProbe struct {
+	Targets map[string]string `json:"targets,omitempty"` // cloud service name -> http(s) URL, or host:port for a TCP probe
+	Timeout string            `json:"timeout,omitempty"` // stop waiting for a service after this long, default 5m
+}
+
+// warmingService is a service which has been scaled up but hasn't passed its readiness probe yet
+type warmingService struct {
+	target    string
+	startedAt time.Time
+}
+
+// startWarming holds a freshly scaled up service back from re-evaluation until its probe passes
+func (p *CloudSaver) startWarming(cloudServiceName string) {
+	if p.readinessProbe == nil {
+		return
+	}
+	target, ok := p.readinessProbe.Targets[cloudServiceName]
+	if !ok {
+		return
+	}
+	p.warming[cloudServiceName] = &warmingService{target: target, startedAt: p.clock.Now()}
+}
+
+// checkReadiness probes every warming service once, releasing those which are ready or have
+// exceeded the readiness timeout
+func (p *CloudSaver) checkReadiness(ctx context.Context) {
+	for cloudServiceName, svc := range p.warming {
+		err := probe(ctx, svc.target)
+		if err == nil {
+			common.LogProvider("traefik-cloud-saver", "Service %s is ready after %v", cloudServiceName, since(p.clock, svc.startedAt).Round(time.Second))
+			delete(p.warming, cloudServiceName)
+			continue
+		}
+
+		if since(p.clock, svc.startedAt) >= p.readinessTimeout {
+			common.LogProvider("traefik-cloud-saver", "[WARNING] service %s did not become ready within %v (%v), no longer waiting", cloudServiceName, p.readinessTimeout, err)
+			delete(p.warming, cloudServiceName)
+			continue
+		}
+		common.DebugLog("traefik-cloud-saver", "service %s is not ready yet: %v", cloudServiceName, err)
+	}
+}
+
+// isWarming reports whether a cloud service is still waiting on its readiness probe
+func (p *CloudSaver) isWarming(cloudServiceName string) bool {
+	_, ok := p.warming[cloudServiceName]
+	return ok
+}
+
+// probe checks a readiness target.  URLs must answer with a 2xx or 3xx, anything else is treated
+// as a host:port which must accept a TCP connection.
+func probe(ctx context.Context, target string) error {
+	ctx, cancel := context.WithTimeout(ctx, readinessProbeTimeout)
+	defer cancel()
+
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+		if err != nil {
+			return fmt.Errorf("invalid readiness probe %s: %w", target, err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return fmt.Errorf("probe %s returned %d", target, resp.StatusCode)
+		}
+		return nil
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,136 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadinessProbeGatesReevaluation(t *testing.T) {
+	var ready atomic.Bool
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer app.Close()
+
+	backend := newTestBackend(t)
+	backend.addService("svc1@docker", "r1@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="svc1@docker"} 0`, "")
+
+	saver, cloud := newTestSaver(t, backend, map[string]int32{"svc1": 0}, func(c *Config) {
+		c.ReadinessProbe = &ReadinessProbe{Targets: map[string]string{"svc1": app.URL + "/healthz"}}
+	})
+
+	if err := saver.scaleUp(context.Background(), "svc1"); err != nil {
+		t.Fatalf("scaleUp() failed: %v", err)
+	}
+	if !saver.isWarming("svc1") {
+		t.Fatal("expected svc1 to wait on its readiness probe after scale up")
+	}
+
+	// the instance is running but the app isn't ready, so it's not re-evaluated yet
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, cloud, "svc1"); scale != 1 {
+		t.Errorf("svc1 should not be scaled down while warming, got scale %d", scale)
+	}
+	if got := saver.decisions.count("svc1@docker", actionKeep, reasonWarmup); got != 1 {
+		t.Errorf("expected 1 warmup decision, got %d", got)
+	}
+
+	// once the probe passes the service is evaluated as usual
+	ready.Store(true)
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if saver.isWarming("svc1") {
+		t.Error("svc1 should be ready")
+	}
+	if scale := currentScale(t, cloud, "svc1"); scale != 0 {
+		t.Errorf("expected svc1 to be scaled down once ready, got scale %d", scale)
+	}
+}
+
+func TestReadinessProbeTimeout(t *testing.T) {
+	saver, _ := newTestSaver(t, newTestBackend(t), map[string]int32{"svc1": 0}, func(c *Config) {
+		c.ReadinessProbe = &ReadinessProbe{
+			Targets: map[string]string{"svc1": closedAddress(t)},
+			Timeout: "1ms",
+		}
+	})
+
+	saver.startWarming("svc1")
+	time.Sleep(5 * time.Millisecond)
+	saver.checkReadiness(context.Background())
+
+	if saver.isWarming("svc1") {
+		t.Error("svc1 should no longer be waited on after the readiness timeout")
+	}
+}
+
+func TestReadinessProbeOnlyConfiguredTargets(t *testing.T) {
+	saver, _ := newTestSaver(t, newTestBackend(t), map[string]int32{"svc1": 0}, func(c *Config) {
+		c.ReadinessProbe = &ReadinessProbe{Targets: map[string]string{"other": "localhost:1"}}
+	})
+
+	saver.startWarming("svc1")
+	if saver.isWarming("svc1") {
+		t.Error("services without a probe target should be considered ready right away")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+
+	tests := []struct {
+		name    string
+		target  string
+		wantErr bool
+	}{
+		{name: "tcp open", target: listener.Addr().String()},
+		{name: "tcp closed", target: closedAddress(t), wantErr: true},
+		{name: "http ok", target: healthy.URL},
+		{name: "http server error", target: failing.URL, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := probe(context.Background(), tt.target); (err != nil) != tt.wantErr {
+				t.Errorf("probe(%s) error = %v, wantErr %v", tt.target, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// closedAddress returns a local address nothing is listening on
+func closedAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return addr
+}
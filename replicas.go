@@ -0,0 +1,127 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// metricsEndpoint is the metrics endpoint of one Traefik replica
+type metricsEndpoint struct {
+	url  string
+	auth *MetricsAuth
+}
+
+// WithReplicas adds the metrics endpoints of other Traefik replicas, so the counters of every
+// replica behind a load balancer are summed rather than seeing a fraction of the traffic
+func WithReplicas(replicas []metricsEndpoint) MetricsCollectorOption {
+	return func(mc *MetricsCollector) {
+		mc.replicas = replicas
+	}
+}
+
+// parseMetricsEndpoints splits a comma separated list of metrics URLs, one per Traefik replica.
+// Credentials embedded in a URL are used for that replica only, auth for every other replica.
+func parseMetricsEndpoints(rawURLs string, auth *MetricsAuth) ([]metricsEndpoint, error) {
+	if auth != nil {
+		if err := auth.validate(); err != nil {
+			return nil, fmt.Errorf("metrics %w", err)
+		}
+	}
+
+	var endpoints []metricsEndpoint
+	for _, rawURL := range strings.Split(rawURLs, ",") {
+		rawURL = strings.TrimSpace(rawURL)
+		if rawURL == "" {
+			continue
+		}
+		metricsURL, embedded, err := splitMetricsURL(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		endpoint := metricsEndpoint{url: metricsURL, auth: auth}
+		if embedded != nil {
+			if auth != nil {
+				return nil, errors.New("metrics credentials are set in both metricsURL and metricsAuth")
+			}
+			endpoint.auth = embedded
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	if len(endpoints) == 0 {
+		return nil, errors.New("metrics URL is required")
+	}
+	return endpoints, nil
+}
+
+// fetchReplicas scrapes every replica and sums their counters into one sample.  A replica which
+// can't be scraped is logged and stands in with its last sample, so its counters don't vanish
+// from the sum and come back as a counter reset.  Only when every replica fails is the scrape
+// an error.
+func (mc *MetricsCollector) fetchReplicas(ctx context.Context) (metricsSample, error) {
+	mc.replicasMu.Lock()
+	defer mc.replicasMu.Unlock()
+	if mc.replicaSamples == nil {
+		mc.replicaSamples = make(map[string]metricsSample)
+	}
+
+	sample := metricsSample{
+		time:         mc.clock.Now(),
+		counts:       make(map[string]float64),
+		serverErrors: make(map[string]float64),
+		activity:     make(map[string]map[string]float64),
+		inFlight:     make(map[string]float64),
+	}
+
+	endpoints := append([]metricsEndpoint{{url: mc.metricsURL, auth: mc.auth}}, mc.replicas...)
+	var failures []string
+	for _, endpoint := range endpoints {
+		replicaSample, err := mc.scrapeEndpoint(ctx, endpoint.url, endpoint.auth)
+		if err != nil {
+			if ctx.Err() != nil {
+				// stopping, not a replica failure
+				return sample, err
+			}
+			failures = append(failures, err.Error())
+			previous, ok := mc.replicaSamples[endpoint.url]
+			if !ok {
+				common.LogProvider("traefik-cloud-saver", "[WARNING] failed to scrape replica %s, leaving it out: %v", endpoint.url, err)
+				continue
+			}
+			common.LogProvider("traefik-cloud-saver", "[WARNING] failed to scrape replica %s, reusing its last counters: %v", endpoint.url, err)
+			replicaSample = previous
+		}
+		mc.replicaSamples[endpoint.url] = replicaSample
+		addSample(&sample, replicaSample)
+	}
+
+	if len(failures) == len(endpoints) {
+		return sample, fmt.Errorf("failed to scrape all %d replicas: %s", len(endpoints), strings.Join(failures, "; "))
+	}
+	return sample, nil
+}
+
+// addSample adds the counters, activity and requests in progress of one replica's sample to the total
+func addSample(total *metricsSample, sample metricsSample) {
+	for service, count := range sample.counts {
+		total.counts[service] += count
+	}
+	for service, count := range sample.serverErrors {
+		total.serverErrors[service] += count
+	}
+	for family, values := range sample.activity {
+		if total.activity[family] == nil {
+			total.activity[family] = make(map[string]float64)
+		}
+		for service, value := range values {
+			total.activity[family][service] += value
+		}
+	}
+	for service, inFlight := range sample.inFlight {
+		total.inFlight[service] += inFlight
+	}
+}
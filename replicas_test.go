@@ -0,0 +1,123 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// replicaServer serves one Traefik replica's metrics, or a 500 while down
+func replicaServer(t *testing.T, count *atomic.Int64, down *atomic.Bool) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			// a closed connection, like a replica being restarted
+			hijacker, _ := w.(http.Hijacker)
+			conn, _, _ := hijacker.Hijack()
+			_ = conn.Close()
+			return
+		}
+		fmt.Fprintf(w, `traefik_service_requests_total{service="svc@docker",code="200"} %d`, count.Load())
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestReplicaMetrics(t *testing.T) {
+	var counts [3]atomic.Int64
+	var down [3]atomic.Bool
+	urls := make([]string, len(counts))
+	for i := range counts {
+		counts[i].Store(100)
+		urls[i] = replicaServer(t, &counts[i], &down[i])
+	}
+
+	config := CreateConfig()
+	config.WindowSize = "1s"
+	config.testMode = true
+	config.MetricsURL = strings.Join(urls, ", ")
+	clock := &stepClock{now: time.Now()}
+
+	saver, err := New(context.Background(), config, "test", WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mc := saver.metricsCollector
+
+	sample, err := mc.fetchSample(context.Background())
+	if err != nil {
+		t.Fatalf("fetchSample() failed: %v", err)
+	}
+	if got := sample.counts["svc@docker"]; got != 300 {
+		t.Errorf("expected the counts of all replicas summed to 300, got %v", got)
+	}
+
+	// a replica going down doesn't abort the scrape, nor look like a counter reset
+	if _, err := mc.GetServiceRates(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i := range counts {
+		counts[i].Add(60)
+	}
+	down[1].Store(true)
+	clock.now = clock.now.Add(time.Minute)
+
+	rates, err := mc.GetServiceRates(context.Background())
+	if err != nil {
+		t.Fatalf("GetServiceRates() with a replica down failed: %v", err)
+	}
+	if got := rates["svc@docker"].PerMin; got != 120 {
+		t.Errorf("expected 120 req/min from the replicas still up, got %v", got)
+	}
+
+	for i := range down {
+		down[i].Store(true)
+	}
+	if _, err := mc.fetchSample(context.Background()); err == nil {
+		t.Error("expected an error with every replica down")
+	}
+}
+
+func TestParseMetricsEndpoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		urls     string
+		auth     *MetricsAuth
+		want     int
+		wantAuth []string // username of each endpoint's basic auth, "" for none
+		wantErr  bool
+	}{
+		{name: "single", urls: "http://a/metrics", want: 1, wantAuth: []string{""}},
+		{name: "list", urls: "http://a/metrics, http://b/metrics,", want: 2, wantAuth: []string{"", ""}},
+		{name: "shared auth", urls: "http://a/metrics,http://b/metrics", auth: &MetricsAuth{Username: "prom"}, want: 2, wantAuth: []string{"prom", "prom"}},
+		{name: "embedded auth", urls: "http://a/metrics,http://x:y@b/metrics", want: 2, wantAuth: []string{"", "x"}},
+		{name: "both auths", urls: "http://a/metrics,http://x:y@b/metrics", auth: &MetricsAuth{Username: "prom"}, wantErr: true},
+		{name: "empty", urls: " , ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoints, err := parseMetricsEndpoints(tt.urls, tt.auth)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseMetricsEndpoints() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(endpoints) != tt.want {
+				t.Fatalf("expected %d endpoints, got %+v", tt.want, endpoints)
+			}
+			for i, endpoint := range endpoints {
+				username := ""
+				if endpoint.auth != nil {
+					username = endpoint.auth.Username
+				}
+				if username != tt.wantAuth[i] {
+					t.Errorf("endpoint %s: expected auth %q, got %q", endpoint.url, tt.wantAuth[i], username)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// defaultRouterCacheTTL is how long a router listing is reused, routers rarely change
+const defaultRouterCacheTTL = time.Minute
+
+// routerCache keeps the last router listing from the Traefik API for a while
+type routerCache struct {
+	mu        sync.Mutex
+	ttl       time.Duration // 0 lists the routers every time
+	routers   map[string]*TraefikRouter
+	fetchedAt time.Time
+}
+
+// parseRouterCacheTTL returns how long router listings are reused, defaultRouterCacheTTL when unset
+func parseRouterCacheTTL(value string) (time.Duration, error) {
+	if value == "" {
+		return defaultRouterCacheTTL, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("router cache TTL must be a non-negative duration, got %q", value)
+	}
+	return ttl, nil
+}
+
+// listRouters returns the cached routers while they're fresh, otherwise lists them from the API
+// and caches them
+func (p *CloudSaver) listRouters(ctx context.Context) (map[string]*TraefikRouter, error) {
+	c := &p.routerCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := p.clock.Now()
+	if c.routers != nil && now.Sub(c.fetchedAt) < c.ttl {
+		return c.routers, nil
+	}
+	routers, err := p.getRoutersFromAPI(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.routers = routers
+	c.fetchedAt = now
+	return routers, nil
+}
+
+// invalidateRouters drops the cached routers, e.g. when a router or service turns out to be
+// missing from them, so the next listing comes from the API
+func (p *CloudSaver) invalidateRouters(reason string) {
+	c := &p.routerCache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.routers != nil {
+		common.DebugLog("traefik-cloud-saver", "dropping the cached routers: %s", reason)
+		c.routers = nil
+	}
+}
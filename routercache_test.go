@@ -0,0 +1,100 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countListings counts the router listings the test backend serves
+func countListings(backend *testBackend) *atomic.Int32 {
+	var listings atomic.Int32
+	handler := backend.server.Config.Handler
+	backend.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/http/routers" {
+			listings.Add(1)
+		}
+		handler.ServeHTTP(w, r)
+	})
+	return &listings
+}
+
+func TestRouterCache(t *testing.T) {
+	tests := []struct {
+		name         string
+		ttl          string
+		wantListings []int32 // after each window, 30s apart
+	}{
+		{name: "default TTL", ttl: "", wantListings: []int32{1, 1, 2, 2}},
+		{name: "no cache", ttl: "0s", wantListings: []int32{1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			backend.addService("busy@docker", "busy@docker")
+			listings := countListings(backend)
+
+			clock := &stepClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+			saver, _ := newTestSaver(t, backend, map[string]int32{"busy": 1}, func(c *Config) {
+				c.RouterCacheTTL = tt.ttl
+			}, WithClock(clock))
+
+			for i, want := range tt.wantListings {
+				backend.setMetrics(fmt.Sprintf(`traefik_service_requests_total{service="busy@docker"} %d`, (i+1)*1000), "")
+				if _, err := saver.generateConfiguration(context.Background()); err != nil {
+					t.Fatalf("generateConfiguration() failed: %v", err)
+				}
+				if got := listings.Load(); got != want {
+					t.Errorf("window %d: got %d router listings, want %d", i, got, want)
+				}
+				clock.now = clock.now.Add(30 * time.Second)
+			}
+		})
+	}
+}
+
+func TestRouterCacheMiss(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("busy@docker", "busy@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="busy@docker"} 1000`, "")
+	listings := countListings(backend)
+
+	clock := &stepClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	saver, cloud := newTestSaver(t, backend, map[string]int32{"busy": 1, "new": 1}, nil, WithClock(clock))
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	// a service deployed since the routers were listed is looked up, and drops the cached listing
+	backend.addService("new@docker", "new@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="busy@docker"} 2000
+traefik_service_requests_total{service="new@docker"} 0`, "")
+	clock.now = clock.now.Add(time.Second)
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, cloud, "new"); scale != 0 {
+		t.Errorf("expected the new service to be evaluated and scaled down, got scale %d", scale)
+	}
+	// putting it to sleep needed its router, which the fresh listing has
+	if got := listings.Load(); got != 2 {
+		t.Errorf("got %d router listings, want 2", got)
+	}
+	if _, ok := saver.sleeping["new@docker"]; !ok {
+		t.Error("expected the new service to be sleeping")
+	}
+}
+
+func TestRouterCacheValidation(t *testing.T) {
+	config := CreateConfig()
+	config.WindowSize = "1s"
+	config.testMode = true
+	config.RouterCacheTTL = "-1m"
+	if _, err := New(context.Background(), config, "test"); err == nil {
+		t.Error("expected an error for a negative router cache TTL")
+	}
+}
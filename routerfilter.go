@@ -0,0 +1,207 @@
+package traefik_cloud_saver
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// Precedence between entries of RouterFilter.Routers matching the same router
+const (
+	thresholdPrecedenceSpecific = "mostSpecific" // an exact name over a pattern, a longer pattern over a shorter one
+	thresholdPrecedenceFirst    = "firstMatch"   // the first matching entry in the configured order
+)
+
+// RouterConfig selects routers for monitoring by their exact name, like RouterFilter.Names, or a
+// pattern, like RouterFilter.Patterns, and optionally sets the traffic threshold of the services
+// behind them
+type RouterConfig struct {
+	Name      string  `json:"name,omitempty"`
+	Pattern   string  `json:"pattern,omitempty"`   // regular expression matching whole router names, instead of a name
+	Threshold float64 `json:"threshold,omitempty"` // req/min below which the service is scaled down, default trafficThreshold
+}
+
+// compileRouterFilter builds a single matcher for the router filter, or nil when every router is
+// monitored.  Names, including those of routers with their own threshold, are escaped so they only
+// ever match literally, e.g. the "." in "api.v1@docker" isn't a wildcard.  Patterns, including
+// those of routers entries, are regular expressions which must match the whole router name.
+func compileRouterFilter(filter *RouterFilter) (*regexp.Regexp, error) {
+	if filter == nil || (len(filter.Names) == 0 && len(filter.Patterns) == 0 && len(filter.Routers) == 0) {
+		return nil, nil
+	}
+
+	names := filter.Names
+	patterns := filter.Patterns
+	for _, router := range filter.Routers {
+		if router.Pattern != "" {
+			patterns = append(patterns[:len(patterns):len(patterns)], router.Pattern)
+			continue
+		}
+		names = append(names[:len(names):len(names)], router.Name)
+	}
+	return compileRouterNames(names, patterns, "router filter pattern")
+}
+
+// compileRouterExclusion builds a single matcher for the routers excluded from monitoring, or nil
+// when none are, the same way as compileRouterFilter
+func compileRouterExclusion(filter *RouterFilter) (*regexp.Regexp, error) {
+	if filter == nil || (len(filter.Exclude) == 0 && len(filter.ExcludePatterns) == 0) {
+		return nil, nil
+	}
+	return compileRouterNames(filter.Exclude, filter.ExcludePatterns, "router filter exclude pattern")
+}
+
+// compileRouterNames builds a matcher of whole router names out of literal names and patterns
+func compileRouterNames(names, patterns []string, what string) (*regexp.Regexp, error) {
+	alternatives := make([]string, 0, len(names)+len(patterns))
+	for _, name := range names {
+		alternatives = append(alternatives, regexp.QuoteMeta(name))
+	}
+	for _, pattern := range patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", what, pattern, err)
+		}
+		alternatives = append(alternatives, "(?:"+pattern+")")
+	}
+
+	return regexp.Compile("^(?:" + strings.Join(alternatives, "|") + ")$")
+}
+
+// ignoredRouter returns why a router is left alone whatever the filter, or an empty string.  A
+// disabled router serves nothing, and an internal one, e.g. api@internal, has no cloud backend
+// unless monitorInternal says otherwise.  A router the API didn't list is nil and not ignored.
+func (p *CloudSaver) ignoredRouter(router *TraefikRouter) string {
+	switch {
+	case router == nil:
+		return ""
+	case router.Status != "enabled":
+		return fmt.Sprintf("status is %s", router.Status)
+	case !p.monitorInternal && (router.Provider == "internal" || strings.HasSuffix(router.Name, "@internal")):
+		return "internal router"
+	}
+	return ""
+}
+
+// thresholdRule is an entry of RouterFilter.Routers which sets a threshold
+type thresholdRule struct {
+	name      string         // the router name or pattern as configured
+	pattern   *regexp.Regexp // compiled pattern matching whole router names, nil for a name
+	threshold float64
+}
+
+func (r thresholdRule) String() string {
+	return r.name
+}
+
+func (r thresholdRule) matches(routerName string) bool {
+	if r.pattern != nil {
+		return r.pattern.MatchString(routerName)
+	}
+	return r.name == routerName
+}
+
+// moreSpecific reports whether rule r is more specific than other: an exact name beats any pattern,
+// and a longer pattern beats a shorter one
+func (r thresholdRule) moreSpecific(other thresholdRule) bool {
+	if (r.pattern == nil) != (other.pattern == nil) {
+		return r.pattern == nil
+	}
+	return r.pattern != nil && len(r.name) > len(other.name)
+}
+
+// parseThresholdRules returns the router filter entries which set a threshold, in their configured
+// order, and checks the precedence between overlapping ones
+func parseThresholdRules(filter *RouterFilter) ([]thresholdRule, error) {
+	if filter == nil {
+		return nil, nil
+	}
+
+	switch filter.ThresholdPrecedence {
+	case "", thresholdPrecedenceSpecific, thresholdPrecedenceFirst:
+	default:
+		return nil, fmt.Errorf("invalid threshold precedence %q, expected %s or %s", filter.ThresholdPrecedence, thresholdPrecedenceSpecific, thresholdPrecedenceFirst)
+	}
+
+	var rules []thresholdRule
+	for _, router := range filter.Routers {
+		if (router.Name == "") == (router.Pattern == "") {
+			return nil, errors.New("router filter routers must have either a name or a pattern")
+		}
+		rule := thresholdRule{name: router.Name, threshold: router.Threshold}
+		if router.Pattern != "" {
+			rule.name = router.Pattern
+			pattern, err := regexp.Compile("^(?:" + router.Pattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid router filter pattern %q: %w", router.Pattern, err)
+			}
+			rule.pattern = pattern
+		}
+		if router.Threshold < 0 {
+			return nil, fmt.Errorf("threshold for router %s must be non-negative, got %v", rule, router.Threshold)
+		}
+		if router.Threshold > 0 {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// routerThreshold returns the threshold set for a router, if any.  When several entries match, the
+// threshold precedence picks one: the most specific (the default), or the first in the configured
+// order.  Overlaps are logged once per router.
+func (p *CloudSaver) routerThreshold(routerName string) (float64, bool) {
+	var matched []thresholdRule
+	for _, rule := range p.thresholdRules {
+		if rule.matches(routerName) {
+			matched = append(matched, rule)
+		}
+	}
+	if len(matched) == 0 {
+		return 0, false
+	}
+
+	chosen := matched[0]
+	if p.thresholdPrecedence != thresholdPrecedenceFirst {
+		for _, rule := range matched[1:] {
+			if rule.moreSpecific(chosen) {
+				chosen = rule
+			}
+		}
+	}
+
+	if len(matched) > 1 && !p.overlapLogged[routerName] {
+		p.overlapLogged[routerName] = true
+		names := make([]string, 0, len(matched))
+		for _, rule := range matched {
+			names = append(names, fmt.Sprintf("%s (%.2f)", rule, rule.threshold))
+		}
+		common.LogProvider("traefik-cloud-saver", "Router %s matches several thresholds: %s, using %s (%.2f) by %s precedence",
+			routerName, strings.Join(names, ", "), chosen, chosen.threshold, p.thresholdPrecedence)
+	}
+	return chosen.threshold, true
+}
+
+// thresholdFor returns the traffic threshold of a cloud service: the lowest threshold of the routers
+// of the traefik services sharing it, those without their own using the base threshold.  The lowest
+// keeps the service up for whichever of them is most sensitive to being scaled down.
+func (p *CloudSaver) thresholdFor(members []*instanceMember) float64 {
+	threshold := -1.0
+	for _, member := range members {
+		for _, routerName := range member.routerNames {
+			routerThreshold, ok := p.routerThreshold(routerName)
+			if !ok {
+				routerThreshold = p.baseThreshold()
+			}
+			if threshold < 0 || routerThreshold < threshold {
+				threshold = routerThreshold
+			}
+		}
+	}
+	if threshold < 0 {
+		return p.baseThreshold()
+	}
+	return threshold
+}
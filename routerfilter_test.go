@@ -0,0 +1,359 @@
+package traefik_cloud_saver
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRouterFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  *RouterFilter
+		router  string
+		monitor bool
+	}{
+		{name: "no filter monitors everything", filter: nil, router: "anything@docker", monitor: true},
+		{name: "empty filter monitors everything", filter: &RouterFilter{}, router: "anything@docker", monitor: true},
+		{name: "exact name", filter: &RouterFilter{Names: []string{"web@docker"}}, router: "web@docker", monitor: true},
+		{name: "names must match whole router", filter: &RouterFilter{Names: []string{"web@docker"}}, router: "web@docker-2", monitor: false},
+		{name: "literal dot", filter: &RouterFilter{Names: []string{"api.v1@docker"}}, router: "api.v1@docker", monitor: true},
+		{name: "literal dot is not a wildcard", filter: &RouterFilter{Names: []string{"api.v1@docker"}}, router: "apixv1@docker", monitor: false},
+		{name: "literal star", filter: &RouterFilter{Names: []string{"web*@docker"}}, router: "webbbb@docker", monitor: false},
+		{name: "literal plus and parens", filter: &RouterFilter{Names: []string{"a+(b)@file"}}, router: "a+(b)@file", monitor: true},
+		{name: "literal brackets", filter: &RouterFilter{Names: []string{"svc[1]@file"}}, router: "svc1@file", monitor: false},
+		{name: "literal alternation", filter: &RouterFilter{Names: []string{"a|b"}}, router: "a", monitor: false},
+		{name: "pattern", filter: &RouterFilter{Patterns: []string{"api-.*@docker"}}, router: "api-orders@docker", monitor: true},
+		{name: "patterns must match whole router", filter: &RouterFilter{Patterns: []string{"api"}}, router: "api-orders@docker", monitor: false},
+		{name: "names and patterns combined", filter: &RouterFilter{Names: []string{"web.site"}, Patterns: []string{"api-.*"}}, router: "web.site", monitor: true},
+		{name: "router with threshold", filter: &RouterFilter{Routers: []RouterConfig{{Name: "api.v1@docker", Threshold: 5}}}, router: "api.v1@docker", monitor: true},
+		{name: "router with threshold is literal", filter: &RouterFilter{Routers: []RouterConfig{{Name: "api.v1@docker"}}}, router: "apixv1@docker", monitor: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher, err := compileRouterFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("compileRouterFilter() error = %v", err)
+			}
+			saver := &CloudSaver{routerMatcher: matcher}
+			if got := saver.shouldMonitorRouter(tt.router); got != tt.monitor {
+				t.Errorf("shouldMonitorRouter(%q) = %v, want %v", tt.router, got, tt.monitor)
+			}
+		})
+	}
+}
+
+func TestRouterFilterInvalidPattern(t *testing.T) {
+	if _, err := compileRouterFilter(&RouterFilter{Patterns: []string{"api-(.*"}}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+
+	config := CreateConfig()
+	config.testMode = true
+	config.RouterFilter = &RouterFilter{Patterns: []string{"api-(.*"}}
+	if _, err := New(context.Background(), config, "test"); err == nil {
+		t.Error("expected New to fail on an invalid pattern")
+	}
+}
+
+func TestRouterFilterExclusion(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  *RouterFilter
+		router  string
+		monitor bool
+	}{
+		{name: "all except excluded name", filter: &RouterFilter{Exclude: []string{"api@internal"}}, router: "api@internal", monitor: false},
+		{name: "all except others", filter: &RouterFilter{Exclude: []string{"api@internal"}}, router: "web@docker", monitor: true},
+		{name: "excluded name is literal", filter: &RouterFilter{Exclude: []string{"api.v1@docker"}}, router: "apixv1@docker", monitor: true},
+		{name: "all except excluded pattern", filter: &RouterFilter{ExcludePatterns: []string{"dashboard-.*"}}, router: "dashboard-grafana@docker", monitor: false},
+		{
+			name:    "exclusion wins over names",
+			filter:  &RouterFilter{Names: []string{"web@docker", "admin@docker"}, Exclude: []string{"admin@docker"}},
+			router:  "admin@docker",
+			monitor: false,
+		},
+		{
+			name:    "listed and not excluded",
+			filter:  &RouterFilter{Names: []string{"web@docker", "admin@docker"}, Exclude: []string{"admin@docker"}},
+			router:  "web@docker",
+			monitor: true,
+		},
+		{
+			name:    "exclusion wins over patterns and routers entries",
+			filter:  &RouterFilter{Patterns: []string{".*@docker"}, Routers: []RouterConfig{{Name: "api@docker", Threshold: 5}}, ExcludePatterns: []string{"api@.*"}},
+			router:  "api@docker",
+			monitor: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher, err := compileRouterFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("compileRouterFilter() error = %v", err)
+			}
+			exclusion, err := compileRouterExclusion(tt.filter)
+			if err != nil {
+				t.Fatalf("compileRouterExclusion() error = %v", err)
+			}
+			saver := &CloudSaver{routerMatcher: matcher, routerExclusion: exclusion}
+			if got := saver.shouldMonitorRouter(tt.router); got != tt.monitor {
+				t.Errorf("shouldMonitorRouter(%q) = %v, want %v", tt.router, got, tt.monitor)
+			}
+		})
+	}
+
+	if _, err := compileRouterExclusion(&RouterFilter{ExcludePatterns: []string{"api-(.*"}}); err == nil {
+		t.Error("expected an error for an invalid exclude pattern")
+	}
+}
+
+func TestRouterThresholds(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("chatty@docker", "chatty@docker")
+	backend.addService("quiet@docker", "quiet@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="chatty@docker"} 3
+traefik_service_requests_total{service="quiet@docker"} 3
+`, "")
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"chatty": 1, "quiet": 1}, func(c *Config) {
+		c.TrafficThreshold = 1
+		c.RouterFilter = &RouterFilter{
+			Names:   []string{"quiet@docker"},
+			Routers: []RouterConfig{{Name: "chatty@docker", Threshold: 5}},
+		}
+	})
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	// 3 req/min is quiet for chatty, but not for the global threshold
+	if scale := currentScale(t, svc, "chatty"); scale != 0 {
+		t.Errorf("expected chatty to be scaled down below its own threshold, got scale %d", scale)
+	}
+	if scale := currentScale(t, svc, "quiet"); scale != 1 {
+		t.Errorf("expected quiet to stay up above the global threshold, got scale %d", scale)
+	}
+}
+
+func TestRouterThresholdsShared(t *testing.T) {
+	saver := &CloudSaver{
+		trafficThreshold: 1,
+		thresholdRules:   []thresholdRule{{name: "a@docker", threshold: 5}, {name: "b@docker", threshold: 3}},
+	}
+
+	tests := []struct {
+		name    string
+		routers []string
+		want    float64
+	}{
+		{name: "override", routers: []string{"a@docker"}, want: 5},
+		{name: "lowest override", routers: []string{"a@docker", "b@docker"}, want: 3},
+		{name: "global is lower", routers: []string{"a@docker", "c@docker"}, want: 1},
+		{name: "no override", routers: []string{"c@docker"}, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var members []*instanceMember
+			for _, router := range tt.routers {
+				members = append(members, &instanceMember{serviceName: router, routerNames: []string{router}})
+			}
+			if got := saver.thresholdFor(members); got != tt.want {
+				t.Errorf("thresholdFor(%v) = %v, want %v", tt.routers, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterThresholdsInvalid(t *testing.T) {
+	invalid := []RouterConfig{
+		{Threshold: 5},
+		{Name: "api@docker", Pattern: "api-.*", Threshold: 5},
+		{Name: "api@docker", Threshold: -1},
+		{Pattern: "api-(.*", Threshold: 5},
+	}
+	for _, router := range invalid {
+		if _, err := parseThresholdRules(&RouterFilter{Routers: []RouterConfig{router}}); err == nil {
+			t.Errorf("expected an error for router %+v", router)
+		}
+	}
+	if _, err := parseThresholdRules(&RouterFilter{ThresholdPrecedence: "lastMatch"}); err == nil {
+		t.Error("expected an error for an unknown threshold precedence")
+	}
+}
+
+func TestRouterThresholdPrecedence(t *testing.T) {
+	routers := []RouterConfig{
+		{Pattern: ".*@docker", Threshold: 1},
+		{Pattern: "api-.*@docker", Threshold: 2},
+		{Name: "api-orders@docker", Threshold: 3},
+		{Pattern: "web-.*", Threshold: 4},
+		{Pattern: "web-.*@docker", Threshold: 5},
+	}
+
+	tests := []struct {
+		name       string
+		precedence string
+		router     string
+		want       float64
+		wantOK     bool
+	}{
+		{name: "exact name beats patterns", router: "api-orders@docker", want: 3, wantOK: true},
+		{name: "longer pattern beats shorter", router: "api-users@docker", want: 2, wantOK: true},
+		{name: "longest of several patterns", router: "web-shop@docker", want: 5, wantOK: true},
+		{name: "single match", router: "web-shop@file", want: 4, wantOK: true},
+		{name: "no match", router: "admin@file"},
+		{name: "first match", precedence: thresholdPrecedenceFirst, router: "api-orders@docker", want: 1, wantOK: true},
+		{name: "first match without overlap", precedence: thresholdPrecedenceFirst, router: "web-shop@file", want: 4, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			saver, _ := newTestSaver(t, backend, nil, func(c *Config) {
+				c.RouterFilter = &RouterFilter{Routers: routers, ThresholdPrecedence: tt.precedence}
+			})
+			got, ok := saver.routerThreshold(tt.router)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("routerThreshold(%q) = %v, %v, want %v, %v", tt.router, got, ok, tt.want, tt.wantOK)
+			}
+			if !saver.shouldMonitorRouter(tt.router) && tt.wantOK {
+				t.Errorf("expected %s to be monitored", tt.router)
+			}
+		})
+	}
+}
+
+func TestRouterThresholdOverlapLogged(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	backend := newTestBackend(t)
+	saver, _ := newTestSaver(t, backend, nil, func(c *Config) {
+		c.RouterFilter = &RouterFilter{Routers: []RouterConfig{
+			{Pattern: "api-.*", Threshold: 2},
+			{Name: "api-orders@docker", Threshold: 3},
+		}}
+	})
+
+	for i := 0; i < 3; i++ {
+		saver.routerThreshold("api-orders@docker")
+	}
+	want := "Router api-orders@docker matches several thresholds: api-.* (2.00), api-orders@docker (3.00), using api-orders@docker (3.00) by mostSpecific precedence"
+	if got := strings.Count(logs.String(), want); got != 1 {
+		t.Errorf("expected the overlap to be logged once, got %d times in:\n%s", got, logs.String())
+	}
+}
+
+func TestServiceWithSeveralRouters(t *testing.T) {
+	tests := []struct {
+		name        string
+		filter      *RouterFilter
+		wantScale   int32
+		wantRouters []string // shadowing the service while it sleeps
+	}{
+		{name: "no filter", wantScale: 0, wantRouters: []string{"site-a", "site-b"}},
+		{name: "one router monitored", filter: &RouterFilter{Names: []string{"site-b@docker"}}, wantScale: 0, wantRouters: []string{"site-b"}},
+		{name: "no router monitored", filter: &RouterFilter{Names: []string{"other@docker"}}, wantScale: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			backend.addService("site@docker", "site-b@docker", "site-a@docker")
+			backend.setMetrics(`traefik_service_requests_total{service="site@docker"} 0`, "")
+
+			saver, svc := newTestSaver(t, backend, map[string]int32{"site": 1}, func(c *Config) {
+				c.RouterFilter = tt.filter
+			})
+			payload, err := saver.generateConfiguration(context.Background())
+			if err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+
+			if scale := currentScale(t, svc, "site"); scale != tt.wantScale {
+				t.Errorf("expected site at scale %d, got %d", tt.wantScale, scale)
+			}
+			if filtered := saver.decisions.count("site@docker", actionSkip, reasonFiltered) == 1; filtered != (tt.wantScale == 1) {
+				t.Errorf("filtered = %v, want %v", filtered, tt.wantScale == 1)
+			}
+			routers := payload.Configuration.HTTP.Routers
+			if len(routers) != len(tt.wantRouters) {
+				t.Errorf("expected %d sleeping routers, got %v", len(tt.wantRouters), routers)
+			}
+			for _, routerName := range tt.wantRouters {
+				if _, ok := routers[configPrefix+routerName]; !ok {
+					t.Errorf("expected router %s to be shadowed, got %v", routerName, routers)
+				}
+			}
+		})
+	}
+}
+
+func TestGetRoutersForService(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("site@docker", "site-b@docker", "site-a@docker")
+	saver, _ := newTestSaver(t, backend, nil, nil)
+
+	routers, protocol, err := saver.getRoutersForService(context.Background(), "site@docker")
+	if err != nil {
+		t.Fatalf("getRoutersForService() failed: %v", err)
+	}
+	if strings.Join(routers, ",") != "site-a@docker,site-b@docker" || protocol != protocolHTTP {
+		t.Errorf("getRoutersForService() = %v, %s, want both http routers in order", routers, protocol)
+	}
+	if _, _, err := saver.getRoutersForService(context.Background(), "missing@docker"); err == nil {
+		t.Error("expected an error for an unknown service")
+	}
+}
+
+func TestIgnoredRouters(t *testing.T) {
+	tests := []struct {
+		name            string
+		provider        string
+		status          string
+		monitorInternal bool
+		wantScale       int32
+	}{
+		{name: "enabled router is evaluated", provider: "docker", status: "enabled", wantScale: 0},
+		{name: "internal router is skipped", provider: "internal", status: "enabled", wantScale: 1},
+		{name: "internal router on request", provider: "internal", status: "enabled", monitorInternal: true, wantScale: 0},
+		{name: "disabled router is skipped", provider: "docker", status: "disabled", wantScale: 1},
+		{name: "disabled internal router on request", provider: "internal", status: "disabled", monitorInternal: true, wantScale: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceName := "api@" + tt.provider
+			backend := newTestBackend(t)
+			backend.addService(serviceName, serviceName)
+			backend.mu.Lock()
+			backend.routers[0].Provider = tt.provider
+			backend.routers[0].Status = tt.status
+			backend.mu.Unlock()
+			backend.setMetrics(`traefik_service_requests_total{service="`+serviceName+`"} 0`, "")
+
+			saver, cloud := newTestSaver(t, backend, map[string]int32{"api": 1}, func(c *Config) {
+				c.MonitorInternal = tt.monitorInternal
+			})
+			if _, err := saver.generateConfiguration(context.Background()); err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+			if scale := currentScale(t, cloud, "api"); scale != tt.wantScale {
+				t.Errorf("expected api at scale %d, got %d", tt.wantScale, scale)
+			}
+			if tt.wantScale == 1 && saver.decisions.count(serviceName, actionSkip, reasonFiltered) != 1 {
+				t.Errorf("expected %s to be skipped", serviceName)
+			}
+		})
+	}
+}
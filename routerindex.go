@@ -0,0 +1,82 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// apiLookupWorkers bounds the per service lookups in the Traefik API running at once
+const apiLookupWorkers = 8
+
+// serviceRouters is what a traefik service is routed from, its routers in order and their protocol,
+// or why that couldn't be found out
+type serviceRouters struct {
+	routerNames []string
+	protocol    string
+	err         error
+}
+
+// indexRouters returns the routers sending traffic to each traefik service, in order, keyed the way
+// the metrics name services.  It answers what the usedBy of each service would, without a request
+// per service.
+func indexRouters(routers map[string]*TraefikRouter) map[string][]string {
+	index := make(map[string][]string)
+	for routerName, router := range routers {
+		serviceName := qualifiedServiceName(router)
+		index[serviceName] = append(index[serviceName], routerName)
+	}
+	for _, routerNames := range index {
+		sort.Strings(routerNames)
+	}
+	return index
+}
+
+// lookupRouters finds the routers of each traefik service in routersFor.  A service missing from it
+// is looked up in the API when lookup is set, up to apiLookupWorkers at once, e.g. to tell a service
+// Traefik no longer knows about from one no router uses.  Otherwise it's not found.
+func (p *CloudSaver) lookupRouters(ctx context.Context, serviceNames []string, routers map[string]*TraefikRouter, routersFor map[string][]string, lookup bool) map[string]serviceRouters {
+	found := make(map[string]serviceRouters, len(serviceNames))
+	var missing []string
+	for _, serviceName := range serviceNames {
+		routerNames, ok := routersFor[serviceName]
+		switch {
+		case ok:
+			found[serviceName] = serviceRouters{routerNames: routerNames, protocol: routers[routerNames[0]].Protocol}
+		case lookup:
+			missing = append(missing, serviceName)
+		default:
+			found[serviceName] = serviceRouters{err: fmt.Errorf("%w: %s", errServiceNotFound, serviceName)}
+		}
+	}
+	if len(missing) == 0 {
+		return found
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for i := 0; i < apiLookupWorkers && i < len(missing); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for serviceName := range queue {
+				routerNames, protocol, err := p.getRoutersForService(ctx, serviceName)
+				if err == nil {
+					// a router uses it after all, the listing is out of date
+					p.invalidateRouters("service " + serviceName + " not found")
+				}
+				mu.Lock()
+				found[serviceName] = serviceRouters{routerNames: routerNames, protocol: protocol, err: err}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, serviceName := range missing {
+		queue <- serviceName
+	}
+	close(queue)
+	wg.Wait()
+	return found
+}
@@ -0,0 +1,143 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRouterIndex(t *testing.T) {
+	backend := newTestBackend(t)
+	var metrics strings.Builder
+	initialScale := make(map[string]int32)
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("svc%d", i)
+		backend.addService(name+"@docker", name+"@docker")
+		fmt.Fprintf(&metrics, "traefik_service_requests_total{service=%q} 100\n", name+"@docker")
+		initialScale[name] = 1
+	}
+	// Traefik doesn't know these anymore, only a lookup can tell
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&metrics, "traefik_service_requests_total{service=\"gone%d@docker\"} 100\n", i)
+	}
+	backend.setMetrics(metrics.String(), "")
+
+	var mu sync.Mutex
+	listings, lookups := 0, 0
+	handler := backend.server.Config.Handler
+	backend.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		switch {
+		case r.URL.Path == "/api/http/routers":
+			listings++
+		case strings.HasPrefix(r.URL.Path, "/api/http/services/"):
+			lookups++
+		}
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	})
+
+	saver, _ := newTestSaver(t, backend, initialScale, nil)
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if listings != 1 {
+		t.Errorf("expected the routers to be listed once, got %d listings", listings)
+	}
+	if lookups != 20 {
+		t.Errorf("expected a lookup for each of the 20 services without a router only, got %d", lookups)
+	}
+	saver.mu.RLock()
+	defer saver.mu.RUnlock()
+	if len(saver.orphans) != 20 {
+		t.Errorf("expected 20 orphans, got %d", len(saver.orphans))
+	}
+	if len(saver.managedServices) != 50 {
+		t.Errorf("expected 50 managed services, got %d", len(saver.managedServices))
+	}
+}
+
+func TestIndexRouters(t *testing.T) {
+	index := indexRouters(map[string]*TraefikRouter{
+		"site-b@docker": {Name: "site-b@docker", Service: "site", Provider: "docker"},
+		"site-a@docker": {Name: "site-a@docker", Service: "site", Provider: "docker"},
+		"shared@file":   {Name: "shared@file", Service: "site@docker", Provider: "file"},
+		"api@internal":  {Name: "api@internal", Service: "api@internal", Provider: "internal"},
+	})
+
+	if got := strings.Join(index["site@docker"], ","); got != "shared@file,site-a@docker,site-b@docker" {
+		t.Errorf("routers of site@docker = %s, want all three in order", got)
+	}
+	if got := strings.Join(index["api@internal"], ","); got != "api@internal" {
+		t.Errorf("routers of api@internal = %s", got)
+	}
+	if len(index) != 2 {
+		t.Errorf("expected 2 services, got %v", index)
+	}
+}
+
+// BenchmarkGenerateConfiguration times a decision over 50 busy services behind a Traefik API taking
+// 20ms per request, against looking up each service's routers on its own.  The readme quotes it.
+func BenchmarkGenerateConfiguration(b *testing.B) {
+	const services = 50
+	backend := newTestBackend(b)
+	initialScale := make(map[string]int32)
+	for i := 0; i < services; i++ {
+		name := fmt.Sprintf("svc%d", i)
+		backend.addService(name+"@docker", name+"@docker")
+		initialScale[name] = 1
+	}
+	handler := backend.server.Config.Handler
+	backend.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			time.Sleep(20 * time.Millisecond)
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	// every service's counter grows, so none is put to sleep
+	count := 0
+	advance := func() {
+		count += 100
+		var metrics strings.Builder
+		for i := 0; i < services; i++ {
+			fmt.Fprintf(&metrics, "traefik_service_requests_total{service=\"svc%d@docker\"} %d\n", i, count)
+		}
+		backend.setMetrics(metrics.String(), "")
+	}
+	advance()
+
+	// the routers are listed every window, as they would be without the cache
+	saver, _ := newTestSaver(b, backend, initialScale, func(c *Config) {
+		c.RouterCacheTTL = "0s"
+	})
+	ctx := context.Background()
+	if _, err := saver.generateConfiguration(ctx); err != nil {
+		b.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	b.Run("router index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			advance()
+			if _, err := saver.generateConfiguration(ctx); err != nil {
+				b.Fatalf("generateConfiguration() failed: %v", err)
+			}
+		}
+	})
+	b.Run("lookup per service", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := 0; j < services; j++ {
+				if _, _, err := saver.getRoutersForService(ctx, fmt.Sprintf("svc%d@docker", j)); err != nil {
+					b.Fatalf("getRoutersForService() failed: %v", err)
+				}
+			}
+		}
+	})
+}
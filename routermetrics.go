@@ -0,0 +1,80 @@
+package traefik_cloud_saver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// Where request rates come from, Traefik's per service or per router request counters
+const (
+	metricSourceService = "service"
+	metricSourceRouter  = "router"
+
+	serviceRequestsMetric = "traefik_service_requests_total"
+	routerRequestsMetric  = "traefik_router_requests_total"
+)
+
+// ratesByService turns rates keyed by router into rates keyed by the traefik service each router
+// sends its traffic to, and returns the routers of each service, in order, so they don't have to be
+// looked up.  Routers sharing a service have their rates added up.  Routers unknown to the API are
+// dropped.
+func (p *CloudSaver) ratesByService(rates map[string]*ServiceRate, routers map[string]*TraefikRouter) (map[string]*ServiceRate, map[string][]string) {
+	byService := make(map[string]*ServiceRate)
+	routersFor := make(map[string][]string)
+	for routerName, rate := range rates {
+		router, ok := routers[routerName]
+		if !ok {
+			common.DebugLog("traefik-cloud-saver", "router %s is in the metrics but not the API, ignoring it", routerName)
+			p.invalidateRouters("router " + routerName + " not found")
+			continue
+		}
+
+		serviceName := qualifiedServiceName(router)
+		routersFor[serviceName] = append(routersFor[serviceName], routerName)
+
+		total, ok := byService[serviceName]
+		if !ok {
+			total = &ServiceRate{ServiceName: serviceName}
+			byService[serviceName] = total
+		}
+		addRate(total, rate)
+	}
+	for _, routerNames := range routersFor {
+		sort.Strings(routerNames)
+	}
+	return byService, routersFor
+}
+
+// qualifiedServiceName returns a router's service with its provider, the way the service metrics
+// name it.  The API leaves the provider off a service defined by the router's own provider.
+func qualifiedServiceName(router *TraefikRouter) string {
+	if strings.Contains(router.Service, "@") || router.Provider == "" {
+		return router.Service
+	}
+	return fmt.Sprintf("%s@%s", router.Service, router.Provider)
+}
+
+// addRate adds the traffic of one router to the total of its service
+func addRate(total, rate *ServiceRate) {
+	total.Total += rate.Total
+	total.PerMin += rate.PerMin
+	total.ServerErrors += rate.ServerErrors
+	if rate.Duration > total.Duration {
+		total.Duration = rate.Duration
+	}
+	if rate.LastRequest.After(total.LastRequest) {
+		total.LastRequest = rate.LastRequest
+	}
+	if rate.Samples > total.Samples {
+		total.Samples = rate.Samples
+	}
+	for family, value := range rate.Activity {
+		if total.Activity == nil {
+			total.Activity = make(map[string]float64)
+		}
+		total.Activity[family] += value
+	}
+}
@@ -0,0 +1,70 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRouterMetricSource(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("web@docker", "web-http@docker", "web-https@docker")
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`
+traefik_router_requests_total{router="web-http@docker",service="",code="200"} 0
+traefik_router_requests_total{router="web-https@docker",service="",code="200"} 100
+traefik_router_requests_total{router="idle@docker",service="",code="200"} 0
+traefik_router_requests_total{router="ghost@docker",service="",code="200"} 0
+traefik_service_requests_total{service="web@docker",code="200"} 0
+`, "")
+
+	// the routers carry everything needed, the services API isn't consulted
+	backend.mu.Lock()
+	backend.usedBy = make(map[string][]string)
+	backend.mu.Unlock()
+
+	saver, cloud := newTestSaver(t, backend, map[string]int32{"web": 1, "idle": 1, "ghost": 1}, func(c *Config) {
+		c.MetricSource = metricSourceRouter
+	})
+
+	payload, err := saver.generateConfiguration(context.Background())
+	if err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	if scale := currentScale(t, cloud, "web"); scale != 1 {
+		t.Errorf("expected web to be kept up by its https router, got %d", scale)
+	}
+	if scale := currentScale(t, cloud, "idle"); scale != 0 {
+		t.Errorf("expected idle to be scaled down, got %d", scale)
+	}
+	if scale := currentScale(t, cloud, "ghost"); scale != 1 {
+		t.Errorf("expected a router unknown to the API to be ignored, got %d", scale)
+	}
+
+	routers := payload.Configuration.HTTP.Routers
+	if len(routers) != 1 {
+		t.Fatalf("expected 1 sleeping router, got %v", routers)
+	}
+	if _, ok := routers[configPrefix+"idle"]; !ok {
+		t.Errorf("expected idle's router to be shadowed, got %v", routers)
+	}
+	if svc, ok := saver.sleeping["idle@docker"]; !ok || len(svc.routerNames) != 1 || svc.routerNames[0] != "idle@docker" {
+		t.Errorf("expected idle@docker to be sleeping behind its router, got %v", saver.sleeping)
+	}
+}
+
+func TestQualifiedServiceName(t *testing.T) {
+	tests := []struct {
+		router *TraefikRouter
+		want   string
+	}{
+		{router: &TraefikRouter{Service: "api", Provider: "file"}, want: "api@file"},
+		{router: &TraefikRouter{Service: "api@docker", Provider: "file"}, want: "api@docker"},
+		{router: &TraefikRouter{Service: "api"}, want: "api"},
+	}
+	for _, tt := range tests {
+		if got := qualifiedServiceName(tt.router); got != tt.want {
+			t.Errorf("qualifiedServiceName(%+v) = %s, want %s", tt.router, got, tt.want)
+		}
+	}
+}
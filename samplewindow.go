@@ -0,0 +1,93 @@
+package traefik_cloud_saver
+
+import (
+	"time"
+)
+
+// WithSampleWindow averages each service's rate over its last n samples, instead of over the
+// increase since the previous GetServiceRates call, so a single quiet poll can't trigger a scale
+// down on its own.  A service has no rate until it has at least two samples.  Values below 2
+// keep the default two point rate.
+func WithSampleWindow(n int) MetricsCollectorOption {
+	return func(mc *MetricsCollector) {
+		if n >= 2 {
+			mc.sampleWindow = n
+			mc.history = make(map[string][]ratePoint)
+		}
+	}
+}
+
+// WithRateWindow averages each service's rate over the samples of the last window, for decisions
+// made more often than the window size.  The oldest sample kept is the last one at or before the
+// start of the window, so the rate spans all of it once there's enough history.  As with a sample
+// window, a service has no rate until it has at least two samples.
+func WithRateWindow(window time.Duration) MetricsCollectorOption {
+	return func(mc *MetricsCollector) {
+		if window > 0 {
+			mc.rateWindow = window
+			if mc.history == nil {
+				mc.history = make(map[string][]ratePoint)
+			}
+		}
+	}
+}
+
+// ratePoint is one sample of a service's request counter
+type ratePoint struct {
+	time  time.Time
+	count float64
+}
+
+// windowed reports whether rates are averaged over a history of samples rather than computed from
+// the increase since the previous GetServiceRates call
+func (mc *MetricsCollector) windowed() bool {
+	return mc.history != nil
+}
+
+// recordHistory adds the samples to each service's history, keeping at most sampleWindow points
+// and only as far back as the rate window
+func (mc *MetricsCollector) recordHistory(samples []metricsSample) {
+	for _, sample := range samples {
+		for service, count := range sample.counts {
+			points := append(mc.history[service], ratePoint{time: sample.time, count: count})
+			if mc.sampleWindow > 0 && len(points) > mc.sampleWindow {
+				points = points[len(points)-mc.sampleWindow:]
+			}
+			if mc.rateWindow > 0 {
+				points = trimToWindow(points, sample.time.Add(-mc.rateWindow))
+			}
+			mc.history[service] = points
+		}
+	}
+}
+
+// trimToWindow drops the points before the last one at or before start
+func trimToWindow(points []ratePoint, start time.Time) []ratePoint {
+	first := 0
+	for i, point := range points {
+		if point.time.After(start) {
+			break
+		}
+		first = i
+	}
+	return points[first:]
+}
+
+// windowRate returns a service's per minute rate averaged over its history, and how many samples
+// back it.  ok is false until there are at least two samples.
+func (mc *MetricsCollector) windowRate(service string) (perMin float64, samples int, ok bool) {
+	points := mc.history[service]
+	if len(points) < 2 {
+		return 0, len(points), false
+	}
+
+	increase := 0.0
+	for i := 1; i < len(points); i++ {
+		increase += counterIncrease(points[i-1].count, points[i].count)
+	}
+	elapsed := points[len(points)-1].time.Sub(points[0].time)
+	if elapsed <= 0 {
+		return 0, len(points), true
+	}
+	return (increase / elapsed.Seconds()) * 60, len(points), true
+}
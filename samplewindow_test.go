@@ -0,0 +1,142 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stepClock is a clock which only moves when the test advances it
+type stepClock struct {
+	realClock
+	now time.Time
+}
+
+func (c *stepClock) Now() time.Time {
+	return c.now
+}
+
+func TestSampleWindow(t *testing.T) {
+	var mu sync.Mutex
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "traefik_service_requests_total{service=\"service1\"} %d\n", count)
+	}))
+	defer server.Close()
+
+	clock := &stepClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	mc := NewMetricsCollector(server.URL, WithSampleWindow(3))
+	mc.clock = clock
+	mc.lastTime = clock.Now()
+
+	steps := []struct {
+		count       int
+		wantRate    bool
+		wantPerMin  float64
+		wantSamples int
+	}{
+		{count: 0, wantRate: false},                                 // a single sample isn't a rate
+		{count: 60, wantRate: true, wantPerMin: 60, wantSamples: 2}, // 60 requests in a minute
+		{count: 60, wantRate: true, wantPerMin: 30, wantSamples: 3}, // a quiet poll only halves the average
+		{count: 60, wantRate: true, wantPerMin: 0, wantSamples: 3},  // the busy minute has left the window
+	}
+
+	for i, step := range steps {
+		mu.Lock()
+		count = step.count
+		mu.Unlock()
+		if i > 0 {
+			clock.now = clock.now.Add(time.Minute)
+		}
+
+		rates, err := mc.GetServiceRates(context.Background())
+		if err != nil {
+			t.Fatalf("step %d: GetServiceRates() failed: %v", i, err)
+		}
+		rate, ok := rates["service1"]
+		if ok != step.wantRate {
+			t.Fatalf("step %d: rate reported = %v, want %v", i, ok, step.wantRate)
+		}
+		if !ok {
+			continue
+		}
+		if rate.PerMin != step.wantPerMin {
+			t.Errorf("step %d: PerMin = %v, want %v", i, rate.PerMin, step.wantPerMin)
+		}
+		if rate.Samples != step.wantSamples {
+			t.Errorf("step %d: Samples = %d, want %d", i, rate.Samples, step.wantSamples)
+		}
+	}
+}
+
+func TestRateWindow(t *testing.T) {
+	var mu sync.Mutex
+	count := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, "traefik_service_requests_total{service=\"service1\"} %d\n", count)
+	}))
+	defer server.Close()
+
+	clock := &stepClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	mc := NewMetricsCollector(server.URL, WithRateWindow(3*time.Minute))
+	mc.clock = clock
+	mc.lastTime = clock.Now()
+
+	// polled every minute, 30 requests a minute for 3 minutes then none
+	steps := []struct {
+		count       int
+		wantRate    bool
+		wantPerMin  float64
+		wantSamples int
+	}{
+		{count: 0, wantRate: false},
+		{count: 30, wantRate: true, wantPerMin: 30, wantSamples: 2},
+		{count: 60, wantRate: true, wantPerMin: 30, wantSamples: 3},
+		{count: 90, wantRate: true, wantPerMin: 30, wantSamples: 4}, // the window is full
+		{count: 90, wantRate: true, wantPerMin: 20, wantSamples: 4}, // a quiet poll only lowers the average
+		{count: 90, wantRate: true, wantPerMin: 10, wantSamples: 4},
+		{count: 90, wantRate: true, wantPerMin: 0, wantSamples: 4}, // the busy minutes have left the window
+	}
+
+	for i, step := range steps {
+		mu.Lock()
+		count = step.count
+		mu.Unlock()
+		if i > 0 {
+			clock.now = clock.now.Add(time.Minute)
+		}
+
+		rates, err := mc.GetServiceRates(context.Background())
+		if err != nil {
+			t.Fatalf("step %d: GetServiceRates() failed: %v", i, err)
+		}
+		rate, ok := rates["service1"]
+		if ok != step.wantRate {
+			t.Fatalf("step %d: rate reported = %v, want %v", i, ok, step.wantRate)
+		}
+		if !ok {
+			continue
+		}
+		if rate.PerMin != step.wantPerMin {
+			t.Errorf("step %d: PerMin = %v, want %v", i, rate.PerMin, step.wantPerMin)
+		}
+		if rate.Samples != step.wantSamples {
+			t.Errorf("step %d: Samples = %d, want %d", i, rate.Samples, step.wantSamples)
+		}
+	}
+}
+
+func TestWithSampleWindowIgnoresSmallWindows(t *testing.T) {
+	mc := NewMetricsCollector("http://localhost", WithSampleWindow(1))
+	if mc.sampleWindow != 0 {
+		t.Errorf("expected the default two point rate, got a window of %d", mc.sampleWindow)
+	}
+}
@@ -0,0 +1,267 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud"
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// defaultScaleUpTarget is how many instances a service is brought back to when no target is configured
+const defaultScaleUpTarget int32 = 1
+
+// scaleUpTarget returns the configured scale-up target for a cloud service
+func (p *CloudSaver) scaleUpTarget(cloudServiceName string) int32 {
+	if target, ok := p.scaleUpTargets[cloudServiceName]; ok {
+		return target
+	}
+	return defaultScaleUpTarget
+}
+
+// scaleUp brings a cloud service up to its scale-up target in one decision.  Providers that can
+// scale straight to a count do so in a single call, otherwise ScaleUp is repeated until the target
+// is reached.
+func (p *CloudSaver) scaleUp(ctx context.Context, cloudServiceName string) error {
+	err := p.withScaleLock(ctx, cloudServiceName, func() error {
+		return p.scaleUpToTarget(ctx, cloudServiceName)
+	})
+	p.trackQuarantine(cloudServiceName, err)
+	if err != nil {
+		return err
+	}
+	p.recordScaleUp(cloudServiceName)
+	return nil
+}
+
+// recordScaleUp records a scale up of a cloud service which took effect
+func (p *CloudSaver) recordScaleUp(cloudServiceName string) {
+	p.recordAction(cloudServiceName)
+	p.actions.scaledUp(cloudServiceName)
+	p.scaledUpAt[cloudServiceName] = p.clock.Now()
+	p.startWarming(cloudServiceName)
+	p.expectScaleUp(cloudServiceName)
+}
+
+// scaleDown scales a cloud service down, recording the action for verification if enabled
+func (p *CloudSaver) scaleDown(ctx context.Context, cloudServiceName string) error {
+	before := int32(-1)
+	if p.scaleVerifyDelay > 0 {
+		if scale, err := p.cloudService.GetCurrentScale(ctx, cloudServiceName); err == nil {
+			before = scale
+		}
+	}
+
+	err := p.withScaleLock(ctx, cloudServiceName, func() error {
+		return p.cloudService.ScaleDown(ctx, cloudServiceName)
+	})
+	p.trackQuarantine(cloudServiceName, err)
+	if err != nil {
+		return err
+	}
+	if !p.isSleeping(cloudServiceName) {
+		p.recordAction(cloudServiceName)
+		p.actions.scaledDown(cloudServiceName)
+		p.latch(cloudServiceName)
+	}
+	p.expectScaleDown(cloudServiceName, before)
+	return nil
+}
+
+// trackQuarantine records whether the provider has quarantined a cloud service, from the outcome
+// of a scale action on it.  A service stays quarantined until an action on it goes through.
+func (p *CloudSaver) trackQuarantine(cloudServiceName string, err error) {
+	switch {
+	case errors.Is(err, common.ErrQuarantined):
+		if !p.quarantined[cloudServiceName] {
+			common.LogProvider("traefik-cloud-saver", "[WARNING] service %s is quarantined by the cloud provider, leaving it alone: %v", cloudServiceName, err)
+		}
+		p.quarantined[cloudServiceName] = true
+	case err == nil:
+		delete(p.quarantined, cloudServiceName)
+	}
+}
+
+// scaleUnsupported reports whether err means the provider can't report the scale of a service at
+// all.  The plugin then falls back to issuing scale actions without checking the scale first, and
+// relies on the provider being idempotent: a scaled down service is assumed to stay at zero until
+// the plugin wakes it up again.
+func (p *CloudSaver) scaleUnsupported(err error) bool {
+	if !errors.Is(err, common.ErrUnsupported) {
+		return false
+	}
+	if !p.stateless {
+		common.LogProvider("traefik-cloud-saver", "[WARNING] cloud provider can't report the current scale, scale actions won't be checked")
+		p.stateless = true
+	}
+	return true
+}
+
+// scaleUpToTarget issues the provider calls needed to reach the scale-up target
+func (p *CloudSaver) scaleUpToTarget(ctx context.Context, cloudServiceName string) error {
+	target := p.scaleUpTarget(cloudServiceName)
+
+	if scaler, ok := p.cloudService.(cloud.TargetScaler); ok {
+		if err := scaler.ScaleTo(ctx, cloudServiceName, target); err != nil {
+			return fmt.Errorf("failed to scale %s to %d: %w", cloudServiceName, target, err)
+		}
+		return nil
+	}
+
+	current, err := p.cloudService.GetCurrentScale(ctx, cloudServiceName)
+	if err != nil {
+		// we can't tell how far we are from the target, a single scale up is the best we can do
+		common.DebugLog("traefik-cloud-saver", "unable to get current scale for %s, scaling up once: %v", cloudServiceName, err)
+		return p.cloudService.ScaleUp(ctx, cloudServiceName)
+	}
+
+	for ; current < target; current++ {
+		if err := p.cloudService.ScaleUp(ctx, cloudServiceName); err != nil {
+			return fmt.Errorf("failed to scale up %s (at %d of %d): %w", cloudServiceName, current, target, err)
+		}
+	}
+	return nil
+}
+
+// wakeOnErrors scales up sleeping services which are answering with 5xx.  Requests hitting a
+// stopped backend (or our sleeping router) mean someone wants the service, so it's started right
+// away rather than waiting for the traffic threshold.  Woken services are marked in awake.
+func (p *CloudSaver) wakeOnErrors(ctx context.Context, rates map[string]*ServiceRate, awake map[string]bool) {
+	for name, svc := range p.sleeping {
+		serverErrors := 0.0
+		if rate, ok := rates[name]; ok {
+			serverErrors += rate.ServerErrors
+		}
+		// requests answered by the sleeping router count too, whichever provider suffix it got
+		for serviceName, rate := range rates {
+			if stripProvider(serviceName) == sleepingServiceName(svc.cloudName) {
+				serverErrors += rate.ServerErrors
+			}
+		}
+
+		if serverErrors == 0 || p.waking[svc.cloudName] {
+			continue
+		}
+
+		if p.inCooldown(svc.cloudName, actionScaleUp) {
+			p.decide(name, actionKeep, reasonCooldown)
+			continue
+		}
+		if unhealthy := p.unhealthyDependency(ctx, svc.cloudName); unhealthy != "" {
+			common.LogProvider("traefik-cloud-saver", "Not scaling up service %s (%s): %s", svc.cloudName, name, unhealthy)
+			p.decide(name, actionKeep, reasonDependency)
+			continue
+		}
+		if p.skipDryRun(actionScaleUp, svc.cloudName, "(%s saw %.0f 5xx responses)", name, serverErrors) {
+			p.decide(name, actionKeep, reasonDryRun)
+			continue
+		}
+		common.LogProvider("traefik-cloud-saver", "Service %s is sleeping but saw %.0f 5xx responses, scaling up %s", name, serverErrors, svc.cloudName)
+		if err := p.scaleUp(ctx, svc.cloudName); err != nil {
+			if errors.Is(err, common.ErrNotEligible) {
+				common.LogProvider("traefik-cloud-saver", "Not scaling up service %s: %v", svc.cloudName, err)
+				p.decide(name, actionKeep, reasonInstancePolicy)
+				continue
+			}
+			if errors.Is(err, common.ErrQuarantined) {
+				p.decide(name, actionKeep, reasonQuarantined)
+				continue
+			}
+			common.LogProvider("traefik-cloud-saver", "[ERROR]: failed to scale up service %s, err: %s", svc.cloudName, err)
+			p.decide(name, actionScaleUp, reasonError)
+			continue
+		}
+		p.decide(name, actionScaleUp, reasonServerErrors)
+		p.notify(svc.cloudName, actionScaleUp, reasonServerErrors, 0, 0)
+		p.demandSeen(svc.cloudName)
+		awake[name] = true
+	}
+}
+
+// sleepingDemand returns, per sleeping cloud service, the requests per minute its sleeping router
+// answered whatever their code.  The sleeping service answers them itself, with a 503 or the
+// sleeping page, so they're never counted as traffic to the traefik services they're meant for.
+func (p *CloudSaver) sleepingDemand(rates map[string]*ServiceRate) map[string]float64 {
+	demand := make(map[string]float64)
+	for _, svc := range p.sleeping {
+		if _, ok := demand[svc.cloudName]; ok {
+			continue
+		}
+		for serviceName, rate := range rates {
+			if stripProvider(serviceName) != sleepingServiceName(svc.cloudName) {
+				continue
+			}
+			demand[svc.cloudName] += rate.PerMin
+			if rate.Duration > 0 {
+				demand[svc.cloudName] += rate.ServerErrors / rate.Duration.Minutes()
+			}
+		}
+	}
+	return demand
+}
+
+// atZero reports whether a cloud service is currently scaled down to zero.  When the provider
+// can't report the scale, a service the plugin put to sleep is assumed to still be at zero.
+func (p *CloudSaver) atZero(ctx context.Context, cloudServiceName string) bool {
+	scale, err := p.cloudService.GetCurrentScale(ctx, cloudServiceName)
+	if p.scaleUnsupported(err) {
+		return p.isSleeping(cloudServiceName)
+	}
+	return err == nil && scale == 0
+}
+
+// wakeOnTraffic scales a cloud service at zero back up once traffic to it resumes, i.e. its rate
+// climbs above the threshold (or the scale up threshold, when there is one).  Woken services are
+// marked in awake.
+func (p *CloudSaver) wakeOnTraffic(ctx context.Context, cloudServiceName string, members []*instanceMember, rate *ServiceRate, threshold float64, awake map[string]bool) {
+	upThreshold := p.scaleUpThresholdFor(threshold)
+	if p.inCooldown(cloudServiceName, actionScaleUp) {
+		for _, member := range members {
+			p.decide(member.serviceName, actionKeep, reasonCooldown)
+		}
+		return
+	}
+	if unhealthy := p.unhealthyDependency(ctx, cloudServiceName); unhealthy != "" {
+		common.LogProvider("traefik-cloud-saver", "Not scaling up service %s (%s): %s", cloudServiceName, memberNames(members), unhealthy)
+		for _, member := range members {
+			p.decide(member.serviceName, actionKeep, reasonDependency)
+		}
+		return
+	}
+	if p.skipDryRun(actionScaleUp, cloudServiceName, "(%s), rate %.2f > %.2f", memberNames(members), rate.PerMin, upThreshold) {
+		for _, member := range members {
+			p.decide(member.serviceName, actionKeep, reasonDryRun)
+		}
+		return
+	}
+
+	common.LogProvider("traefik-cloud-saver", "Service %s (%s) is scaled down but its traffic resumed (rate %.2f, threshold %.2f), scaling it up",
+		cloudServiceName, memberNames(members), rate.PerMin, upThreshold)
+	if err := p.scaleUp(ctx, cloudServiceName); err != nil {
+		if errors.Is(err, common.ErrNotEligible) {
+			common.LogProvider("traefik-cloud-saver", "Not scaling up service %s (%s): %v", cloudServiceName, memberNames(members), err)
+			for _, member := range members {
+				p.decide(member.serviceName, actionKeep, reasonInstancePolicy)
+			}
+			return
+		}
+		if errors.Is(err, common.ErrQuarantined) {
+			for _, member := range members {
+				p.decide(member.serviceName, actionKeep, reasonQuarantined)
+			}
+			return
+		}
+		common.LogProvider("traefik-cloud-saver", "[ERROR]: failed to scale up service %s, err: %s", cloudServiceName, err)
+		for _, member := range members {
+			p.decide(member.serviceName, actionScaleUp, reasonError)
+		}
+		return
+	}
+	p.demandSeen(cloudServiceName)
+	for _, member := range members {
+		awake[member.serviceName] = true
+		p.decide(member.serviceName, actionScaleUp, reasonAboveThreshold)
+	}
+	p.notify(cloudServiceName, actionScaleUp, reasonAboveThreshold, rate.PerMin, upThreshold)
+}
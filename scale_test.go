@@ -0,0 +1,299 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud"
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// incrementalService hides the mock's ScaleTo so only one-at-a-time ScaleUp is available
+type incrementalService struct {
+	cloud.Service
+	scaleUps int
+}
+
+func (s *incrementalService) ScaleUp(ctx context.Context, serviceName string) error {
+	s.scaleUps++
+	return s.Service.ScaleUp(ctx, serviceName)
+}
+
+func TestScaleUpTargets(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("scales straight to the target", func(t *testing.T) {
+		backend := newTestBackend(t)
+		saver, mockService := newTestSaver(t, backend, map[string]int32{"web": 0, "api": 0}, func(c *Config) {
+			c.ScaleUpTargets = map[string]int32{"web": 3}
+		})
+
+		if err := saver.scaleUp(ctx, "web"); err != nil {
+			t.Fatalf("scaleUp() failed: %v", err)
+		}
+		if err := saver.scaleUp(ctx, "api"); err != nil {
+			t.Fatalf("scaleUp() failed: %v", err)
+		}
+
+		if scale := currentScale(t, mockService, "web"); scale != 3 {
+			t.Errorf("expected web to be scaled to its target of 3, got %d", scale)
+		}
+		if scale := currentScale(t, mockService, "api"); scale != 1 {
+			t.Errorf("expected api to use the default target of 1, got %d", scale)
+		}
+	})
+
+	t.Run("providers without ScaleTo are scaled up incrementally", func(t *testing.T) {
+		backend := newTestBackend(t)
+		saver, mockService := newTestSaver(t, backend, map[string]int32{"web": 1}, func(c *Config) {
+			c.ScaleUpTargets = map[string]int32{"web": 4}
+		})
+		incremental := &incrementalService{Service: mockService}
+		saver.cloudService = incremental
+
+		if err := saver.scaleUp(ctx, "web"); err != nil {
+			t.Fatalf("scaleUp() failed: %v", err)
+		}
+
+		if scale := currentScale(t, mockService, "web"); scale != 4 {
+			t.Errorf("expected web to reach 4, got %d", scale)
+		}
+		if incremental.scaleUps != 3 {
+			t.Errorf("expected 3 ScaleUp calls, got %d", incremental.scaleUps)
+		}
+	})
+
+	t.Run("targets below 1 are rejected", func(t *testing.T) {
+		for _, target := range []int32{0, -1} {
+			config := CreateConfig()
+			config.ScaleUpTargets = map[string]int32{"web": target}
+			if err := config.Validate(); err == nil {
+				t.Errorf("expected Validate() to reject a scale up target of %d", target)
+			}
+		}
+	})
+}
+
+func TestWakeOnServerErrors(t *testing.T) {
+	baseline := `
+traefik_service_requests_total{code="200",method="GET",protocol="http",service="svc1@docker"} 0
+traefik_service_requests_total{code="502",method="GET",protocol="http",service="svc1@docker"} 5
+`
+	tests := []struct {
+		name      string
+		enabled   bool
+		metrics   string
+		wantScale int32
+	}{
+		{
+			name:    "5xx on the scaled down service",
+			enabled: true,
+			metrics: `
+traefik_service_requests_total{code="200",method="GET",protocol="http",service="svc1@docker"} 0
+traefik_service_requests_total{code="502",method="GET",protocol="http",service="svc1@docker"} 8
+`,
+			wantScale: 1,
+		},
+		{
+			name:    "5xx on the sleeping router",
+			enabled: true,
+			metrics: `
+traefik_service_requests_total{code="200",method="GET",protocol="http",service="svc1@docker"} 0
+traefik_service_requests_total{code="502",method="GET",protocol="http",service="svc1@docker"} 5
+traefik_service_requests_total{code="503",method="GET",protocol="http",service="cloud-saver-sleeping-svc1@plugin-traefik_cloud_saver"} 2
+`,
+			wantScale: 1,
+		},
+		{
+			name:      "no new 5xx",
+			enabled:   true,
+			metrics:   baseline,
+			wantScale: 0,
+		},
+		{
+			name:    "disabled",
+			enabled: false,
+			metrics: `
+traefik_service_requests_total{code="200",method="GET",protocol="http",service="svc1@docker"} 0
+traefik_service_requests_total{code="502",method="GET",protocol="http",service="svc1@docker"} 8
+`,
+			wantScale: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			backend.addService("svc1@docker", "r1@docker")
+			backend.setMetrics(baseline, "")
+
+			saver, cloud := newTestSaver(t, backend, map[string]int32{"svc1": 1}, func(c *Config) {
+				c.WakeOnServerErrors = tt.enabled
+			})
+
+			// no successful traffic, svc1 is scaled down and starts sleeping
+			if _, err := saver.generateConfiguration(context.Background()); err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+			if scale := currentScale(t, cloud, "svc1"); scale != 0 {
+				t.Fatalf("expected svc1 to be scaled down, got %d", scale)
+			}
+
+			backend.setMetrics(tt.metrics, "")
+			payload, err := saver.generateConfiguration(context.Background())
+			if err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+
+			if scale := currentScale(t, cloud, "svc1"); scale != tt.wantScale {
+				t.Errorf("expected svc1 scale %d, got %d", tt.wantScale, scale)
+			}
+			_, stillSleeping := saver.sleeping["svc1@docker"]
+			if stillSleeping != (tt.wantScale == 0) {
+				t.Errorf("svc1 sleeping = %v, want %v", stillSleeping, tt.wantScale == 0)
+			}
+			if len(payload.Configuration.HTTP.Routers) != len(saver.sleeping) {
+				t.Errorf("expected %d routers, got %d", len(saver.sleeping), len(payload.Configuration.HTTP.Routers))
+			}
+		})
+	}
+}
+
+// startingService refuses to scale down while starting is set, like an instance still booting
+type startingService struct {
+	cloud.Service
+	starting bool
+}
+
+func (s *startingService) ScaleDown(ctx context.Context, serviceName string) error {
+	if s.starting {
+		return fmt.Errorf("%s is provisioning: %w", serviceName, common.ErrTransitioning)
+	}
+	return s.Service.ScaleDown(ctx, serviceName)
+}
+
+func TestScaleUpOnTrafficResumption(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("api@docker", "api@docker")
+	requests := 0
+	clock := &stepClock{now: time.Now()}
+	saver, svc := newTestSaver(t, backend, map[string]int32{"api": 1}, nil, WithClock(clock))
+	// each window is a minute, so the requests added are the rate
+	window := func(perMin int) {
+		t.Helper()
+		requests += perMin
+		backend.setMetrics(fmt.Sprintf(`traefik_service_requests_total{service="api@docker"} %d`, requests), "")
+		clock.now = clock.now.Add(time.Minute)
+		if _, err := saver.generateConfiguration(context.Background()); err != nil {
+			t.Fatalf("generateConfiguration() failed: %v", err)
+		}
+	}
+
+	window(0)
+	if scale := currentScale(t, svc, "api"); scale != 0 {
+		t.Fatalf("expected api to be scaled down, got scale %d", scale)
+	}
+
+	// a queued request gets through, e.g. from a client retrying
+	window(5)
+	if scale := currentScale(t, svc, "api"); scale != 1 {
+		t.Fatalf("expected api to be scaled up once traffic resumed, got scale %d", scale)
+	}
+	if _, ok := saver.sleeping["api@docker"]; ok {
+		t.Error("expected api to no longer be sleeping")
+	}
+	if got := saver.decisions.count("api@docker", actionScaleUp, reasonAboveThreshold); got != 1 {
+		t.Errorf("expected 1 scale up on traffic, got %d", got)
+	}
+
+	// already up, nothing more to do
+	window(5)
+	if got := saver.decisions.count("api@docker", actionScaleUp, reasonAboveThreshold); got != 1 {
+		t.Errorf("expected no further scale up while running, got %d", got)
+	}
+
+	// the traffic released the latch, so it's scaled down again once quiet
+	window(0)
+	if scale := currentScale(t, svc, "api"); scale != 0 {
+		t.Errorf("expected api to be scaled down again, got scale %d", scale)
+	}
+}
+
+func TestScaleUpOnSleepingRouterTraffic(t *testing.T) {
+	tests := []struct {
+		name        string
+		idleTimeout string
+	}{
+		{name: "rate"},
+		{name: "idle timeout", idleTimeout: "2m"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			backend.addService("api@docker", "api@docker")
+			clock := &stepClock{now: time.Now()}
+			saver, svc := newTestSaver(t, backend, map[string]int32{"api": 1}, func(c *Config) {
+				c.IdleTimeout = tt.idleTimeout
+			}, WithClock(clock))
+			// with the default behavior the sleeping router answers every request with a 503, and
+			// the service itself sees none
+			window := func(answered int) {
+				t.Helper()
+				backend.setMetrics(fmt.Sprintf(`traefik_service_requests_total{service="api@docker"} 0
+traefik_service_requests_total{code="503",service="cloud-saver-sleeping-api@plugin-traefik_cloud_saver"} %d`, answered), "")
+				clock.now = clock.now.Add(time.Minute)
+				if _, err := saver.generateConfiguration(context.Background()); err != nil {
+					t.Fatalf("generateConfiguration() failed: %v", err)
+				}
+			}
+
+			for i := 0; i < 4 && currentScale(t, svc, "api") != 0; i++ {
+				window(0)
+			}
+			if scale := currentScale(t, svc, "api"); scale != 0 {
+				t.Fatalf("expected api to be scaled down, got scale %d", scale)
+			}
+			// the sleeping router's counter starts out at 0 the window it appears
+			window(0)
+			window(500)
+			if scale := currentScale(t, svc, "api"); scale != 1 {
+				t.Fatalf("expected api to be scaled up by the requests to its sleeping router, got scale %d", scale)
+			}
+			if got := saver.decisions.count("api@docker", actionScaleUp, reasonAboveThreshold); got != 1 {
+				t.Errorf("expected 1 scale up on traffic, got %d", got)
+			}
+		})
+	}
+}
+
+func TestScaleDownDeferredWhileTransitioning(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+	saver, mockService := newTestSaver(t, backend, map[string]int32{"idle": 1}, nil)
+	starting := &startingService{Service: mockService, starting: true}
+	saver.cloudService = starting
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if got := saver.decisions.count("idle@docker", actionKeep, reasonTransitioning); got != 1 {
+		t.Errorf("expected the scale down to be deferred, got %d transitioning decisions", got)
+	}
+	if got := saver.decisions.count("idle@docker", actionScaleDown, reasonError); got != 0 {
+		t.Errorf("expected a deferred scale down not to count as an error, got %d", got)
+	}
+
+	// once the instance has settled, the next window scales it down
+	starting.starting = false
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, mockService, "idle"); scale != 0 {
+		t.Errorf("expected idle to be scaled down once settled, got scale %d", scale)
+	}
+}
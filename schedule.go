@@ -0,0 +1,165 @@
+package traefik_cloud_saver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// Schedule adjusts the traffic threshold, window size or cooldown period during a time of day range,
+// e.g. a higher threshold during business hours than overnight.  Unset fields keep the base value.
+type Schedule struct {
+	Name             string   `json:"name,omitempty"`             // shown in the logs, default the time range
+	Start            string   `json:"start"`                      // 24h time the schedule starts at, e.g. "22:00"
+	End              string   `json:"end"`                        // 24h time the schedule ends at, before start to span midnight, e.g. "06:00"
+	Timezone         string   `json:"timezone,omitempty"`         // IANA time zone of start and end, default the plugin's local time
+	TrafficThreshold *float64 `json:"trafficThreshold,omitempty"` // replaces trafficThreshold, routers with their own threshold keep it
+	WindowSize       string   `json:"windowSize,omitempty"`       // replaces windowSize, from the next window on
+	CooldownPeriod   string   `json:"cooldownPeriod,omitempty"`   // replaces cooldownPeriod, cooldown overrides still apply
+}
+
+// schedule is a parsed Schedule
+type schedule struct {
+	name           string
+	start, end     time.Duration // since midnight
+	location       *time.Location
+	threshold      *float64
+	windowSize     time.Duration // zero keeps the base window size
+	cooldownPeriod *time.Duration
+}
+
+func (s *schedule) String() string {
+	return s.name
+}
+
+// active reports whether now falls within the schedule's time of day range, start inclusive
+func (s *schedule) active(now time.Time) bool {
+	if s.location != nil {
+		now = now.In(s.location)
+	}
+	hour, minute, second := now.Clock()
+	offset := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(second)*time.Second
+	if s.start < s.end {
+		return offset >= s.start && offset < s.end
+	}
+	return offset >= s.start || offset < s.end
+}
+
+// parseTimeOfDay parses a 24h "15:04" time into the time since midnight
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parseSchedules parses the schedules, checking a scheduled window size is valid wherever the base
+// one is
+func parseSchedules(config *Config) ([]*schedule, error) {
+	var schedules []*schedule
+	for _, configured := range config.Schedules {
+		s := &schedule{name: configured.Name, threshold: configured.TrafficThreshold}
+		if s.name == "" {
+			s.name = configured.Start + "-" + configured.End
+		}
+
+		var err error
+		if s.start, err = parseTimeOfDay(configured.Start); err != nil {
+			return nil, fmt.Errorf("invalid start of schedule %s: %w", s, err)
+		}
+		if s.end, err = parseTimeOfDay(configured.End); err != nil {
+			return nil, fmt.Errorf("invalid end of schedule %s: %w", s, err)
+		}
+		if s.start == s.end {
+			return nil, fmt.Errorf("schedule %s must end at a different time than it starts", s)
+		}
+		if configured.Timezone != "" {
+			if s.location, err = time.LoadLocation(configured.Timezone); err != nil {
+				return nil, fmt.Errorf("invalid time zone of schedule %s: %w", s, err)
+			}
+		}
+
+		if s.threshold != nil && *s.threshold < 0 {
+			return nil, fmt.Errorf("traffic threshold of schedule %s must be non-negative, got %v", s, *s.threshold)
+		}
+		if configured.WindowSize != "" {
+			if config.MetricsType == metricsTypeQuery {
+				return nil, fmt.Errorf("schedule %s can't change the window size with metricsType %s", s, metricsTypeQuery)
+			}
+			if s.windowSize, err = time.ParseDuration(configured.WindowSize); err != nil {
+				return nil, fmt.Errorf("invalid window size of schedule %s: %w", s, err)
+			}
+			if s.windowSize < time.Minute && !config.testMode {
+				return nil, fmt.Errorf("window size of schedule %s must be at least 1 minute, got %v", s, s.windowSize)
+			}
+			if s.windowSize <= 0 {
+				return nil, fmt.Errorf("window size of schedule %s must be positive, got %v", s, s.windowSize)
+			}
+		}
+		if configured.CooldownPeriod != "" {
+			period, err := time.ParseDuration(configured.CooldownPeriod)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cooldown period of schedule %s: %w", s, err)
+			}
+			if period < 0 {
+				return nil, fmt.Errorf("cooldown period of schedule %s must be non-negative, got %v", s, period)
+			}
+			s.cooldownPeriod = &period
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, nil
+}
+
+// scheduleAt returns the schedule in effect at now, the first configured one whose range includes
+// it, or nil for none
+func (p *CloudSaver) scheduleAt(now time.Time) *schedule {
+	for _, s := range p.schedules {
+		if s.active(now) {
+			return s
+		}
+	}
+	return nil
+}
+
+// applySchedule picks the schedule in effect for a window, logging when it changes
+func (p *CloudSaver) applySchedule() {
+	current := p.scheduleAt(p.clock.Now())
+	if current == p.schedule {
+		return
+	}
+	if current == nil {
+		common.LogProvider("traefik-cloud-saver", "Schedule %s ended, back to the base configuration", p.schedule)
+	} else {
+		common.LogProvider("traefik-cloud-saver", "Schedule %s started", current)
+	}
+	p.schedule = current
+}
+
+// baseThreshold returns the traffic threshold of routers without their own, the schedule's if it
+// sets one
+func (p *CloudSaver) baseThreshold() float64 {
+	if p.schedule != nil && p.schedule.threshold != nil {
+		return *p.schedule.threshold
+	}
+	return p.trafficThreshold
+}
+
+// pollPeriod returns how long until the decision after the one made at now, the poll interval
+// when set, otherwise the window size
+func (p *CloudSaver) pollPeriod(now time.Time) time.Duration {
+	if p.pollInterval > 0 {
+		return p.pollInterval
+	}
+	return p.scheduledWindowSize(now)
+}
+
+// scheduledWindowSize returns the length of the window starting at now
+func (p *CloudSaver) scheduledWindowSize(now time.Time) time.Duration {
+	if s := p.scheduleAt(now); s != nil && s.windowSize > 0 {
+		return s.windowSize
+	}
+	return p.windowSize
+}
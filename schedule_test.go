@@ -0,0 +1,161 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScheduleThresholds(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("web@docker", "web@docker")
+	backend.addService("api@docker", "api@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="web@docker"} 5
+traefik_service_requests_total{service="api@docker"} 5
+`, "")
+
+	businessHours := 10.0
+	clock := &stepClock{now: time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)}
+	saver, svc := newTestSaver(t, backend, map[string]int32{"web": 1, "api": 1}, func(c *Config) {
+		c.RouterFilter = &RouterFilter{Routers: []RouterConfig{{Pattern: ".*"}, {Name: "api@docker", Threshold: 2}}}
+		c.Schedules = []Schedule{{Name: "business hours", Start: "09:00", End: "18:00", Timezone: "UTC", TrafficThreshold: &businessHours}}
+	}, WithClock(clock))
+
+	// overnight both services are above the base threshold of 1 req/min
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	for _, name := range []string{"web", "api"} {
+		if scale := currentScale(t, svc, name); scale != 1 {
+			t.Errorf("expected %s to stay up overnight, got scale %d", name, scale)
+		}
+	}
+	if schedule := saver.EffectiveConfig().Schedule; schedule != "" {
+		t.Errorf("expected no schedule in effect overnight, got %s", schedule)
+	}
+
+	// the same 5 req/min at noon is below the business hours threshold, but api keeps its own
+	clock.now = clock.now.Add(9 * time.Hour)
+	backend.setMetrics(`
+traefik_service_requests_total{service="web@docker"} 2705
+traefik_service_requests_total{service="api@docker"} 2705
+`, "")
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, svc, "web"); scale != 0 {
+		t.Errorf("expected web to be scaled down on the business hours threshold, got scale %d", scale)
+	}
+	if scale := currentScale(t, svc, "api"); scale != 1 {
+		t.Errorf("expected api to keep its router threshold, got scale %d", scale)
+	}
+	if schedule := saver.EffectiveConfig().Schedule; schedule != "business hours" {
+		t.Errorf("expected business hours in effect at noon, got %q", schedule)
+	}
+}
+
+func TestScheduleActive(t *testing.T) {
+	day := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.UTC)
+	}
+	daytime := &schedule{start: 9 * time.Hour, end: 18 * time.Hour}
+	overnight := &schedule{start: 22 * time.Hour, end: 6 * time.Hour}
+	shifted := &schedule{start: 9 * time.Hour, end: 18 * time.Hour, location: time.FixedZone("UTC+2", 2*60*60)}
+
+	tests := []struct {
+		name     string
+		schedule *schedule
+		now      time.Time
+		want     bool
+	}{
+		{name: "within", schedule: daytime, now: day(12, 0), want: true},
+		{name: "start is inclusive", schedule: daytime, now: day(9, 0), want: true},
+		{name: "end is exclusive", schedule: daytime, now: day(18, 0), want: false},
+		{name: "before", schedule: daytime, now: day(8, 59), want: false},
+		{name: "overnight before midnight", schedule: overnight, now: day(23, 30), want: true},
+		{name: "overnight after midnight", schedule: overnight, now: day(5, 59), want: true},
+		{name: "overnight during the day", schedule: overnight, now: day(12, 0), want: false},
+		{name: "time zone", schedule: shifted, now: day(7, 30), want: true},
+		{name: "time zone end", schedule: shifted, now: day(16, 0), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.active(tt.now); got != tt.want {
+				t.Errorf("active(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleWindowAndCooldown(t *testing.T) {
+	backend := newTestBackend(t)
+	clock := &stepClock{now: time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)}
+	saver, _ := newTestSaver(t, backend, nil, func(c *Config) {
+		c.CooldownPeriod = "10m"
+		c.CooldownOverrides = map[string]string{"heavy": "1h"}
+		c.Schedules = []Schedule{
+			{Name: "night", Start: "22:00", End: "06:00", WindowSize: "5s", CooldownPeriod: "0s"},
+			{Name: "late evening", Start: "20:00", End: "23:59", WindowSize: "10s"},
+		}
+	}, WithClock(clock))
+
+	// the first matching schedule applies where they overlap
+	saver.applySchedule()
+	if window := saver.scheduledWindowSize(clock.Now()); window != 5*time.Second {
+		t.Errorf("expected the night window of 5s, got %v", window)
+	}
+	if cooldown := saver.cooldownFor("light"); cooldown != 0 {
+		t.Errorf("expected the night cooldown of 0s, got %v", cooldown)
+	}
+	if cooldown := saver.cooldownFor("heavy"); cooldown != time.Hour {
+		t.Errorf("expected the cooldown override to apply over the schedule, got %v", cooldown)
+	}
+
+	// during the day the base values apply again
+	clock.now = clock.now.Add(13 * time.Hour)
+	saver.applySchedule()
+	if window := saver.scheduledWindowSize(clock.Now()); window != time.Second {
+		t.Errorf("expected the base window of 1s, got %v", window)
+	}
+	if cooldown := saver.cooldownFor("light"); cooldown != 10*time.Minute {
+		t.Errorf("expected the base cooldown of 10m, got %v", cooldown)
+	}
+}
+
+func TestSchedulesValidation(t *testing.T) {
+	negative := -1.0
+	tests := []struct {
+		name      string
+		schedule  Schedule
+		configure func(*Config)
+	}{
+		{name: "invalid start", schedule: Schedule{Start: "9am", End: "18:00"}},
+		{name: "missing end", schedule: Schedule{Start: "09:00"}},
+		{name: "empty range", schedule: Schedule{Start: "09:00", End: "09:00"}},
+		{name: "invalid time zone", schedule: Schedule{Start: "09:00", End: "18:00", Timezone: "Mars/Olympus"}},
+		{name: "negative threshold", schedule: Schedule{Start: "09:00", End: "18:00", TrafficThreshold: &negative}},
+		{name: "invalid window size", schedule: Schedule{Start: "09:00", End: "18:00", WindowSize: "long"}},
+		{name: "negative cooldown", schedule: Schedule{Start: "09:00", End: "18:00", CooldownPeriod: "-1m"}},
+		{name: "window shorter than the scrape interval", schedule: Schedule{Start: "09:00", End: "18:00", WindowSize: "2s"},
+			configure: func(c *Config) { c.WindowSize = "10s"; c.ScrapeInterval = "5s" }},
+		{name: "window size with prometheus-query", schedule: Schedule{Start: "09:00", End: "18:00", WindowSize: "10s"},
+			configure: func(c *Config) { c.MetricsType = metricsTypeQuery; c.PromQL = "sum by (service) (rate(x[{{window}}]))" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.WindowSize = "1s"
+			config.testMode = true
+			config.Schedules = []Schedule{tt.schedule}
+			if tt.configure != nil {
+				tt.configure(config)
+			}
+			if _, err := New(context.Background(), config, "test"); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
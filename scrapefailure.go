@@ -0,0 +1,47 @@
+package traefik_cloud_saver
+
+import (
+	"fmt"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// what to do with a window when the metrics can't be scraped
+const (
+	scrapeFailureSkip     = "skip"     // skip the window, no decisions are made
+	scrapeFailureReuse    = "reuse"    // decide on the last known rates, for up to maxStaleWindows windows
+	scrapeFailureFailOpen = "failOpen" // scale up every managed service
+)
+
+// defaultMaxStaleWindows is how many windows in a row may reuse the last known rates by default
+const defaultMaxStaleWindows = 3
+
+// rememberRates keeps a window's rates around, in case the next scrapes fail
+func (p *CloudSaver) rememberRates(rates map[string]*ServiceRate) {
+	p.lastRates = rates
+	p.staleWindows = 0
+}
+
+// staleRates returns the last known rates in place of a failed scrape.  They're only reused for
+// maxStaleWindows windows in a row, after that the scrape error is returned.
+func (p *CloudSaver) staleRates(scrapeErr error) (map[string]*ServiceRate, error) {
+	if p.lastRates == nil {
+		return nil, fmt.Errorf("%w (no previous rates to reuse)", scrapeErr)
+	}
+	if p.staleWindows >= p.maxStaleWindows {
+		return nil, fmt.Errorf("%w (last rates already reused for %d windows)", scrapeErr, p.staleWindows)
+	}
+	p.staleWindows++
+
+	common.LogProvider("traefik-cloud-saver", "[WARNING] metrics scrape failed (%v), reusing the last known rates (stale for %d of %d windows)",
+		scrapeErr, p.staleWindows, p.maxStaleWindows)
+
+	rates := make(map[string]*ServiceRate, len(p.lastRates))
+	for serviceName, rate := range p.lastRates {
+		stale := *rate
+		// the 5xx already triggered whatever they were going to, don't count them again
+		stale.ServerErrors = 0
+		rates[serviceName] = &stale
+	}
+	return rates, nil
+}
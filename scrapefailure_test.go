@@ -0,0 +1,132 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+// brokenMetricsURL returns the URL of a metrics endpoint which refuses connections
+func brokenMetricsURL(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(nil)
+	server.Close()
+	return server.URL + "/metrics"
+}
+
+func TestScrapeFailurePolicy(t *testing.T) {
+	metrics := `
+traefik_service_requests_total{service="busy@docker"} 100
+traefik_service_requests_total{service="idle@docker"} 0
+`
+	tests := []struct {
+		name         string
+		policy       string
+		wantErr      bool
+		wantIdleUp   bool
+		wantSleeping int
+	}{
+		{name: "skip is the default", policy: "", wantErr: true, wantSleeping: 1},
+		{name: "skip", policy: scrapeFailureSkip, wantErr: true, wantSleeping: 1},
+		{name: "reuse the last rates", policy: scrapeFailureReuse, wantSleeping: 1},
+		{name: "fail open", policy: scrapeFailureFailOpen, wantIdleUp: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			backend.addService("busy@docker", "busy@docker")
+			backend.addService("idle@docker", "idle@docker")
+			backend.setMetrics(metrics, "")
+
+			saver, cloud := newTestSaver(t, backend, map[string]int32{"busy": 1, "idle": 1}, func(c *Config) {
+				c.ScrapeFailurePolicy = tt.policy
+			})
+
+			if _, err := saver.generateConfiguration(context.Background()); err != nil {
+				t.Fatalf("first generateConfiguration() failed: %v", err)
+			}
+			if scale := currentScale(t, cloud, "idle"); scale != 0 {
+				t.Fatalf("expected idle to be scaled down in the first window, got %d", scale)
+			}
+
+			saver.metricsCollector.metricsURL = brokenMetricsURL(t)
+			_, err := saver.generateConfiguration(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("generateConfiguration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if scale := currentScale(t, cloud, "busy"); scale != 1 {
+				t.Errorf("expected busy to stay up, got %d", scale)
+			}
+			if scale := currentScale(t, cloud, "idle"); (scale > 0) != tt.wantIdleUp {
+				t.Errorf("idle scale = %d, want scaled up %v", scale, tt.wantIdleUp)
+			}
+			if len(saver.sleeping) != tt.wantSleeping {
+				t.Errorf("expected %d sleeping services, got %v", tt.wantSleeping, saver.sleeping)
+			}
+		})
+	}
+}
+
+func TestScrapeFailureReuseIsBounded(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("busy@docker", "busy@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="busy@docker"} 100`, "")
+
+	saver, cloud := newTestSaver(t, backend, map[string]int32{"busy": 1}, func(c *Config) {
+		c.ScrapeFailurePolicy = scrapeFailureReuse
+		c.MaxStaleWindows = 2
+	})
+
+	// nothing to reuse before the first successful scrape
+	metricsURL := saver.metricsCollector.metricsURL
+	saver.metricsCollector.metricsURL = brokenMetricsURL(t)
+	if _, err := saver.generateConfiguration(context.Background()); err == nil {
+		t.Fatal("expected an error without previous rates")
+	}
+
+	saver.metricsCollector.metricsURL = metricsURL
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	saver.metricsCollector.metricsURL = brokenMetricsURL(t)
+	for window := 1; window <= 2; window++ {
+		if _, err := saver.generateConfiguration(context.Background()); err != nil {
+			t.Fatalf("stale window %d: generateConfiguration() failed: %v", window, err)
+		}
+		if saver.staleWindows != window {
+			t.Errorf("stale window %d: staleWindows = %d", window, saver.staleWindows)
+		}
+	}
+	if _, err := saver.generateConfiguration(context.Background()); err == nil {
+		t.Error("expected an error once the last rates are too stale")
+	}
+	if scale := currentScale(t, cloud, "busy"); scale != 1 {
+		t.Errorf("expected busy to stay up on stale rates, got %d", scale)
+	}
+
+	// a successful scrape resets the staleness
+	saver.metricsCollector.metricsURL = metricsURL
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if saver.staleWindows != 0 {
+		t.Errorf("expected staleWindows to be reset, got %d", saver.staleWindows)
+	}
+}
+
+func TestScrapeFailurePolicyValidation(t *testing.T) {
+	config := CreateConfig()
+	config.ScrapeFailurePolicy = "retry"
+	if err := config.Validate(); err == nil {
+		t.Error("expected Validate() to reject an unknown scrape failure policy")
+	}
+
+	config = CreateConfig()
+	config.MaxStaleWindows = -1
+	if err := config.Validate(); err == nil {
+		t.Error("expected Validate() to reject a negative maxStaleWindows")
+	}
+}
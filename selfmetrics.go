@@ -0,0 +1,141 @@
+package traefik_cloud_saver
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// names of the plugin's own metrics, served alongside the decision counters
+const (
+	scaleDownMetric    = "cloudsaver_scale_down_total"
+	scaleUpMetric      = "cloudsaver_scale_up_total"
+	scrapeErrorsMetric = "cloudsaver_scrape_errors_total"
+	serviceRateMetric  = "cloudsaver_service_rate"
+	skippedMetric      = "cloudsaver_windows_skipped_total"
+	shadowMetric       = "cloudsaver_shadow_divergence_total"
+)
+
+// actionMetrics counts the scale actions taken on each cloud service, and holds the rate of each
+// traefik service as of the last window, to alert on runaway scaling
+type actionMetrics struct {
+	mu         sync.Mutex
+	scaleDowns map[string]uint64
+	scaleUps   map[string]uint64
+	divergent  map[string]uint64 // decisions the shadow engine would have made differently
+	rates      map[string]float64
+	skipped    uint64 // windows skipped because the one before overran
+}
+
+func newActionMetrics() *actionMetrics {
+	return &actionMetrics{
+		scaleDowns: make(map[string]uint64),
+		scaleUps:   make(map[string]uint64),
+		divergent:  make(map[string]uint64),
+		rates:      make(map[string]float64),
+	}
+}
+
+// scaledDown counts a scale down of a cloud service
+func (m *actionMetrics) scaledDown(cloudServiceName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scaleDowns[cloudServiceName]++
+}
+
+// scaledUp counts a scale up of a cloud service
+func (m *actionMetrics) scaledUp(cloudServiceName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scaleUps[cloudServiceName]++
+}
+
+// shadowDiverged counts a decision on a traefik service the shadow engine disagreed with
+func (m *actionMetrics) shadowDiverged(serviceName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.divergent[serviceName]++
+}
+
+// windowSkipped counts a window skipped by the skip overlap policy
+func (m *actionMetrics) windowSkipped() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.skipped++
+}
+
+// updateRates replaces the rate gauges with the window's rates, so services which are gone drop out
+func (m *actionMetrics) updateRates(rates map[string]*ServiceRate) {
+	perMin := make(map[string]float64, len(rates))
+	for serviceName, rate := range rates {
+		if !isGeneratedService(serviceName) {
+			perMin[serviceName] = rate.PerMin
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rates = perMin
+}
+
+// writeTo writes the counters and gauges in the Prometheus text format, along with the scrape
+// errors counted by the metrics collector
+func (m *actionMetrics) writeTo(w io.Writer, scrapeErrors uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeServiceCounter(w, scaleDownMetric, "Cloud services scaled down by cloud saver.", m.scaleDowns)
+	writeServiceCounter(w, scaleUpMetric, "Cloud services scaled up by cloud saver.", m.scaleUps)
+	writeServiceCounter(w, shadowMetric, "Decisions the shadow engine would have made differently.", m.divergent)
+
+	fmt.Fprintf(w, "# HELP %s Failed attempts to fetch the traffic metrics.\n", scrapeErrorsMetric)
+	fmt.Fprintf(w, "# TYPE %s counter\n", scrapeErrorsMetric)
+	fmt.Fprintf(w, "%s %d\n", scrapeErrorsMetric, scrapeErrors)
+
+	fmt.Fprintf(w, "# HELP %s Windows skipped because the previous one was still running.\n", skippedMetric)
+	fmt.Fprintf(w, "# TYPE %s counter\n", skippedMetric)
+	fmt.Fprintf(w, "%s %d\n", skippedMetric, m.skipped)
+
+	fmt.Fprintf(w, "# HELP %s Requests per minute of each service, as of the last window.\n", serviceRateMetric)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", serviceRateMetric)
+	for _, serviceName := range sortedKeys(m.rates) {
+		fmt.Fprintf(w, "%s{service=\"%s\"} %g\n", serviceRateMetric, escapeLabelValue(serviceName), m.rates[serviceName])
+	}
+}
+
+// writeServiceCounter writes a counter with a sample per service
+func writeServiceCounter(w io.Writer, name, help string, counts map[string]uint64) {
+	services := make([]string, 0, len(counts))
+	for serviceName := range counts {
+		services = append(services, serviceName)
+	}
+	sort.Strings(services)
+
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	for _, serviceName := range services {
+		fmt.Fprintf(w, "%s{service=\"%s\"} %d\n", name, escapeLabelValue(serviceName), counts[serviceName])
+	}
+}
+
+// sortedKeys returns the keys of a map of gauges in order
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// countScrapeError counts a failed attempt to fetch the metrics
+func (mc *MetricsCollector) countScrapeError() {
+	atomic.AddUint64(&mc.scrapeErrors, 1)
+}
+
+// ScrapeErrors returns how many attempts to fetch the metrics have failed
+func (mc *MetricsCollector) ScrapeErrors() uint64 {
+	return atomic.LoadUint64(&mc.scrapeErrors)
+}
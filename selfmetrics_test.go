@@ -0,0 +1,65 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestActionMetrics(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("busy@docker", "busy@docker")
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="busy@docker"} 100
+traefik_service_requests_total{service="idle@docker"} 0
+`, "")
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"busy": 1, "idle": 1}, func(c *Config) {
+		c.SelfMetricsAddress = "127.0.0.1:0"
+	})
+	if err := saver.startSelfMetrics(); err != nil {
+		t.Fatalf("startSelfMetrics() failed: %v", err)
+	}
+	defer saver.selfMetricsServer.Close()
+	metricsURL := "http://" + saver.selfMetricsListener.Addr().String() + "/metrics"
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	// idle is scaled up by the plugin, then a scrape fails
+	backend.setMetrics(`
+traefik_service_requests_total{service="busy@docker"} 200
+traefik_service_requests_total{service="idle@docker"} 0
+`, "")
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, svc, "idle"); scale != 0 {
+		t.Fatalf("expected idle to be scaled down, got scale %d", scale)
+	}
+	if err := saver.scaleUp(context.Background(), "idle"); err != nil {
+		t.Fatalf("scaleUp() failed: %v", err)
+	}
+	saver.metricsCollector.metricsURL = backend.server.URL + "/missing"
+	if _, err := saver.generateConfiguration(context.Background()); err == nil {
+		t.Fatal("expected the scrape to fail")
+	}
+
+	body := scrapeDecisions(t, metricsURL)
+	for _, want := range []string{
+		`cloudsaver_scale_down_total{service="idle"} 1`,
+		`cloudsaver_scale_up_total{service="idle"} 1`,
+		`cloudsaver_scrape_errors_total 1`,
+		`cloudsaver_service_rate{service="busy@docker"} `,
+		`cloudsaver_service_rate{service="idle@docker"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in scrape:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `cloudsaver_scale_down_total{service="busy"}`) {
+		t.Errorf("expected no scale down of busy in scrape:\n%s", body)
+	}
+}
@@ -0,0 +1,33 @@
+package traefik_cloud_saver
+
+import (
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// ShadowConfig configures an alternate decision engine which runs alongside the active one.
+// Its decisions are only logged, never acted upon, so new parameters can be tried against live
+// traffic before switching over.  It scales on the rate, so it's only compared while the active
+// engine does too, rather than on an idle timeout or concurrency.
+type ShadowConfig struct {
+	TrafficThreshold float64 `json:"trafficThreshold,omitempty"`
+}
+
+// compareShadow evaluates the shadow engine for a service, and logs and counts the decision if it
+// would have decided differently from the active engine, which decided in the given mode against
+// the given threshold.  It never changes the active decision.  Activity metrics apply to both
+// engines, so a service they keep up never diverges.
+func (p *CloudSaver) compareShadow(serviceName, mode string, rate *ServiceRate, threshold float64, activeScaleDown, keptByActivity bool) {
+	if p.shadow == nil || mode != scaleOnRate {
+		return
+	}
+
+	shadowScaleDown := rate.PerMin < p.shadow.TrafficThreshold && !keptByActivity
+	if shadowScaleDown == activeScaleDown {
+		return
+	}
+
+	common.LogProvider("traefik-cloud-saver", "[SHADOW] service %s: active engine scale down=%v (threshold %.2f), shadow engine scale down=%v (threshold %.2f), rate %.2f req/min",
+		serviceName, activeScaleDown, threshold, shadowScaleDown, p.shadow.TrafficThreshold, rate.PerMin)
+
+	p.actions.shadowDiverged(serviceName)
+}
@@ -0,0 +1,136 @@
+package traefik_cloud_saver
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestShadowMode(t *testing.T) {
+	tests := []struct {
+		name            string
+		threshold       float64
+		shadowThreshold float64
+		wantDivergence  bool
+		wantScale       int32
+	}{
+		{
+			name:            "shadow would scale down, active does not",
+			threshold:       0.1,
+			shadowThreshold: 1,
+			wantDivergence:  true,
+			wantScale:       1,
+		},
+		{
+			name:            "active scales down, shadow would not",
+			threshold:       1,
+			shadowThreshold: 0.1,
+			wantDivergence:  true,
+			wantScale:       0,
+		},
+		{
+			name:            "engines agree",
+			threshold:       1,
+			shadowThreshold: 2,
+			wantDivergence:  false,
+			wantScale:       0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+			backend := newTestBackend(t)
+			backend.addService("svc1@docker", "r1@docker")
+			backend.setMetrics(`traefik_service_requests_total{service="svc1@docker"} 0.5`, "")
+
+			saver, cloud := newTestSaver(t, backend, map[string]int32{"svc1": 1}, func(c *Config) {
+				c.TrafficThreshold = tt.threshold
+				c.Shadow = &ShadowConfig{TrafficThreshold: tt.shadowThreshold}
+			})
+
+			if _, err := saver.generateConfiguration(context.Background()); err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+
+			// only the active engine's decision is ever acted upon
+			if scale := currentScale(t, cloud, "svc1"); scale != tt.wantScale {
+				t.Errorf("expected scale %d, got %d", tt.wantScale, scale)
+			}
+
+			loggedShadow := strings.Contains(logs.String(), "[SHADOW]")
+			if loggedShadow != tt.wantDivergence {
+				t.Errorf("shadow divergence logged = %v, want %v, logs: %s", loggedShadow, tt.wantDivergence, logs.String())
+			}
+			var body strings.Builder
+			saver.actions.writeTo(&body, 0)
+			counted := strings.Contains(body.String(), `cloudsaver_shadow_divergence_total{service="svc1@docker"} 1`)
+			if counted != tt.wantDivergence {
+				t.Errorf("expected divergence counted = %v, got metrics:\n%s", tt.wantDivergence, body.String())
+			}
+		})
+	}
+}
+
+func TestShadowModeResolvedThreshold(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	backend := newTestBackend(t)
+	backend.addService("svc1@docker", "r1@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="svc1@docker"} 0.5`, "")
+
+	// the router's own threshold applies, not trafficThreshold
+	saver, cloud := newTestSaver(t, backend, map[string]int32{"svc1": 1}, func(c *Config) {
+		c.TrafficThreshold = 0.1
+		c.RouterFilter = &RouterFilter{Routers: []RouterConfig{{Name: "r1@docker", Threshold: 2}}}
+		c.Shadow = &ShadowConfig{TrafficThreshold: 0.1}
+	})
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, cloud, "svc1"); scale != 0 {
+		t.Fatalf("expected svc1 to be scaled down on its router's threshold, got scale %d", scale)
+	}
+	if want := "active engine scale down=true (threshold 2.00)"; !strings.Contains(logs.String(), want) {
+		t.Errorf("expected %q in the logs: %s", want, logs.String())
+	}
+}
+
+func TestShadowModeOnlyComparesRates(t *testing.T) {
+	for name, configure := range map[string]func(*Config){
+		"idle timeout": func(c *Config) { c.IdleTimeout = "1h" },
+		"concurrency":  func(c *Config) { c.ScaleOn = scaleOnConcurrency },
+	} {
+		t.Run(name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+			backend := newTestBackend(t)
+			backend.addService("svc1@docker", "r1@docker")
+			backend.setMetrics(`traefik_service_requests_total{service="svc1@docker"} 0.5
+traefik_service_requests_in_progress{service="svc1@docker"} 1
+`, "")
+
+			// the shadow engine would scale down on the rate, the active one doesn't look at it
+			saver, _ := newTestSaver(t, backend, map[string]int32{"svc1": 1}, func(c *Config) {
+				configure(c)
+				c.Shadow = &ShadowConfig{TrafficThreshold: 100}
+			})
+			if _, err := saver.generateConfiguration(context.Background()); err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+			if strings.Contains(logs.String(), "[SHADOW]") {
+				t.Errorf("expected no divergence logged, logs: %s", logs.String())
+			}
+		})
+	}
+}
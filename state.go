@@ -0,0 +1,55 @@
+package traefik_cloud_saver
+
+import (
+	"sort"
+	"time"
+)
+
+// State is a copy of the plugin's per-service state, taken between windows.  It's safe to read
+// while the window loop carries on, e.g. from an embedder or an HTTP endpoint.
+type State struct {
+	Window      int                  // number of the last completed (or current) window
+	Managed     []string             // cloud services the plugin has made decisions for, or discovered
+	Sleeping    []string             // traefik services whose backend is scaled down
+	Warming     []string             // cloud services waiting on their readiness probe
+	Orphans     []string             // traefik services in the metrics but missing from the API
+	Quarantined []string             // cloud services the provider refuses to scale until they recover
+	ScaledUpAt  map[string]time.Time // when the plugin last scaled up each cloud service
+}
+
+// State returns a copy of the plugin's current per-service state.  It waits for a window in
+// progress to finish, so the copy is always consistent.
+func (p *CloudSaver) State() State {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	state := State{
+		Window:     p.summary.window,
+		ScaledUpAt: make(map[string]time.Time, len(p.scaledUpAt)),
+	}
+	for name := range p.managedServices {
+		state.Managed = append(state.Managed, name)
+	}
+	for name := range p.sleeping {
+		state.Sleeping = append(state.Sleeping, name)
+	}
+	for name := range p.warming {
+		state.Warming = append(state.Warming, name)
+	}
+	for name := range p.orphans {
+		state.Orphans = append(state.Orphans, name)
+	}
+	for name := range p.quarantined {
+		state.Quarantined = append(state.Quarantined, name)
+	}
+	for name, at := range p.scaledUpAt {
+		state.ScaledUpAt[name] = at
+	}
+
+	sort.Strings(state.Managed)
+	sort.Strings(state.Sleeping)
+	sort.Strings(state.Warming)
+	sort.Strings(state.Orphans)
+	sort.Strings(state.Quarantined)
+	return state
+}
@@ -0,0 +1,122 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+	"github.com/danbiagini/traefik-cloud-saver/cloud/mock"
+)
+
+func TestStateConcurrentAccess(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("busy@docker", "busy@docker")
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="busy@docker"} 100
+traefik_service_requests_total{service="idle@docker"} 0
+`, "")
+
+	saver, _ := newTestSaver(t, backend, map[string]int32{"busy": 1, "idle": 1}, nil)
+
+	// read the state continuously while windows run, -race flags any unguarded access
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					_ = saver.State()
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := saver.generateConfiguration(context.Background()); err != nil {
+			t.Errorf("generateConfiguration() failed: %v", err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	state := saver.State()
+	if state.Window != 5 {
+		t.Errorf("expected window 5, got %d", state.Window)
+	}
+	// busy's counter never moves after the first window, so it ends up asleep as well
+	if len(state.Sleeping) != 2 || state.Sleeping[1] != "idle@docker" {
+		t.Errorf("expected both services to be sleeping, got %v", state.Sleeping)
+	}
+	if len(state.Managed) != 2 {
+		t.Errorf("expected 2 managed services, got %v", state.Managed)
+	}
+
+	// the copy is the caller's own
+	state.ScaledUpAt["busy"] = state.ScaledUpAt["idle"]
+	state.Sleeping[0] = "changed"
+	if saver.State().Sleeping[0] != "busy@docker" {
+		t.Error("expected changes to a state copy not to affect the plugin")
+	}
+}
+
+// quarantiningService refuses to scale a quarantined service, like GCP with an instance stuck stopping
+type quarantiningService struct {
+	*mock.Service
+	quarantined string
+}
+
+func (s *quarantiningService) ScaleDown(ctx context.Context, serviceName string) error {
+	if serviceName == s.quarantined {
+		return fmt.Errorf("instance %s is stuck STOPPING: %w", serviceName, common.ErrQuarantined)
+	}
+	return s.Service.ScaleDown(ctx, serviceName)
+}
+
+func TestStateQuarantined(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"idle": 1}, nil)
+	quarantining := &quarantiningService{Service: svc, quarantined: "idle"}
+	saver.cloudService = quarantining
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if got := saver.decisions.count("idle@docker", actionKeep, reasonQuarantined); got != 1 {
+		t.Errorf("expected 1 quarantined decision, got %d", got)
+	}
+	if got := saver.decisions.count("idle@docker", actionScaleDown, reasonError); got != 0 {
+		t.Errorf("expected the quarantine not to count as an error, got %d error decisions", got)
+	}
+	if state := saver.State(); len(state.Quarantined) != 1 || state.Quarantined[0] != "idle" {
+		t.Errorf("expected idle to be reported quarantined, got %v", state.Quarantined)
+	}
+	if snapshot := saver.health.current(); len(snapshot.Quarantined) != 1 || snapshot.Quarantined[0] != "idle" {
+		t.Errorf("expected the health snapshot to report idle quarantined, got %+v", snapshot)
+	}
+
+	// the provider releases it, the next scale down goes through
+	quarantining.quarantined = ""
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, svc, "idle"); scale != 0 {
+		t.Errorf("expected idle to be scaled down once released, got %d", scale)
+	}
+	if state := saver.State(); len(state.Quarantined) != 0 {
+		t.Errorf("expected no quarantined services, got %v", state.Quarantined)
+	}
+	if snapshot := saver.health.current(); len(snapshot.Quarantined) != 0 {
+		t.Errorf("expected the health snapshot to clear the quarantine, got %+v", snapshot)
+	}
+}
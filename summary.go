@@ -0,0 +1,68 @@
+package traefik_cloud_saver
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// windowSummary aggregates the outcome of one window, logged as a single line at its end
+type windowSummary struct {
+	window         int
+	services       int
+	belowThreshold int
+	scaledDown     int
+	scaledUp       int
+	errors         int
+	reverted       int // scale actions undone by the time they were verified
+}
+
+func (s windowSummary) String() string {
+	summary := fmt.Sprintf("window %d: %d services, %d below threshold, %d scaled down, %d scaled up, %d errors",
+		s.window, s.services, s.belowThreshold, s.scaledDown, s.scaledUp, s.errors)
+	if s.reverted > 0 {
+		summary += fmt.Sprintf(", %d reverted", s.reverted)
+	}
+	return summary
+}
+
+// decide records a decision in the decision counters and the current window's summary
+func (p *CloudSaver) decide(serviceName, action, reason string) {
+	p.decisions.record(serviceName, action, reason)
+	if p.decisionSink != nil {
+		p.decisionSink.enqueue(decisionEvent{
+			Time:    p.clock.Now(),
+			Window:  p.summary.window,
+			Service: serviceName,
+			Action:  action,
+			Reason:  reason,
+		})
+	}
+
+	switch {
+	case reason == reasonError:
+		p.summary.errors++
+	case action == actionScaleDown:
+		p.summary.scaledDown++
+	case action == actionScaleUp:
+		p.summary.scaledUp++
+	}
+}
+
+// startWindow resets the summary for a new window
+func (p *CloudSaver) startWindow() {
+	p.summary = windowSummary{window: p.summary.window + 1}
+	p.scaleChecks = nil
+}
+
+// logSummary logs the summary of the current window, and publishes it on the health endpoint
+func (p *CloudSaver) logSummary() {
+	common.LogProvider("traefik-cloud-saver", "%s", p.summary)
+	var quarantined []string
+	for name := range p.quarantined {
+		quarantined = append(quarantined, name)
+	}
+	sort.Strings(quarantined)
+	p.health.windowDone(p.summary, len(p.sleeping), quarantined, p.clock.Now())
+}
@@ -0,0 +1,112 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestWindowSummary(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.addService("kept@docker", "kept@docker")
+	backend.addService("busy@docker", "busy@docker")
+	backend.addService("sleeper@docker", "sleeper@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="idle@docker"} 0
+traefik_service_requests_total{service="kept@docker"} 0
+traefik_service_requests_total{service="busy@docker"} 100
+traefik_service_requests_total{service="sleeper@docker"} 0
+traefik_service_requests_total{service="unknown@docker"} 0
+`, "")
+
+	saver, cloud := newTestSaver(t, backend, map[string]int32{"idle": 1, "kept": 1, "busy": 1, "sleeper": 1}, func(c *Config) {
+		c.WakeOnServerErrors = true
+	})
+	cloud.SetLabels("kept", map[string]string{labelExclude: "true"})
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	want := windowSummary{window: 1, services: 5, belowThreshold: 3, scaledDown: 2}
+	if saver.summary != want {
+		t.Errorf("summary = %q, want %q", saver.summary, want)
+	}
+
+	// the sleeper gets requests which fail, it's woken up while the idle service stays down
+	backend.setMetrics(`
+traefik_service_requests_total{service="idle@docker"} 0
+traefik_service_requests_total{service="kept@docker"} 0
+traefik_service_requests_total{service="busy@docker"} 200
+traefik_service_requests_total{service="sleeper@docker"} 0
+traefik_service_requests_total{service="sleeper@docker",code="502"} 5
+`, "")
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	// unknown has dropped out of the metrics, but is still reported with no traffic.  The idle
+	// service is already asleep, staying down isn't scaling it down again.
+	want = windowSummary{window: 2, services: 5, belowThreshold: 2, scaledDown: 0, scaledUp: 1}
+	if saver.summary != want {
+		t.Errorf("summary = %q, want %q", saver.summary, want)
+	}
+
+	// later on busy and the sleeper keep serving while idle stays asleep, nothing is scaled
+	for window := 3; window <= 5; window++ {
+		backend.setMetrics(fmt.Sprintf(`
+traefik_service_requests_total{service="idle@docker"} 0
+traefik_service_requests_total{service="kept@docker"} 0
+traefik_service_requests_total{service="busy@docker"} %[1]d
+traefik_service_requests_total{service="sleeper@docker"} %[1]d
+traefik_service_requests_total{service="sleeper@docker",code="502"} 5
+`, window*100), "")
+		if _, err := saver.generateConfiguration(context.Background()); err != nil {
+			t.Fatalf("generateConfiguration() failed: %v", err)
+		}
+		want = windowSummary{window: window, services: 5, belowThreshold: 2}
+		if saver.summary != want {
+			t.Errorf("summary = %q, want %q", saver.summary, want)
+		}
+	}
+	if count := saver.decisions.count("idle@docker", actionScaleDown, reasonBelowThreshold); count != 1 {
+		t.Errorf("expected idle to be scaled down once, got %d", count)
+	}
+	if count := saver.decisions.count("idle@docker", actionKeep, reasonAsleep); count != 4 {
+		t.Errorf("expected idle to be kept asleep 4 times, got %d", count)
+	}
+}
+
+func TestWindowSummaryErrors(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("svc1@docker", "r1@docker")
+	backend.addService("svc2@docker", "r2@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="svc1@docker"} 0
+traefik_service_requests_total{service="svc2@docker"} 0
+`, "")
+
+	// the second scale down fails
+	saver, _ := newTestSaver(t, backend, map[string]int32{"svc1": 1, "svc2": 1}, func(c *Config) {
+		c.CloudConfig.FailAfter = 1
+	})
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	want := windowSummary{window: 1, services: 2, belowThreshold: 2, scaledDown: 1, errors: 1}
+	if saver.summary != want {
+		t.Errorf("summary = %q, want %q", saver.summary, want)
+	}
+}
+
+func TestWindowSummaryString(t *testing.T) {
+	summary := windowSummary{window: 3, services: 4, belowThreshold: 2, scaledDown: 1, scaledUp: 1, errors: 0}
+	want := "window 3: 4 services, 2 below threshold, 1 scaled down, 1 scaled up, 0 errors"
+	if summary.String() != want {
+		t.Errorf("String() = %q, want %q", summary.String(), want)
+	}
+}
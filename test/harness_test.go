@@ -0,0 +1,287 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	cloudsaver "github.com/danbiagini/traefik-cloud-saver"
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+	"github.com/danbiagini/traefik-cloud-saver/cloud/mock"
+	"github.com/traefik/genconf/dynamic"
+)
+
+// windowTimeout bounds how long a driven window may take to produce its configuration
+const windowTimeout = 5 * time.Second
+
+// fakeClock is a cloudsaver.Clock which only moves when the test advances it
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+type fakeTicker struct {
+	c      chan time.Time
+	period time.Duration
+	next   time.Time
+	clock  *fakeClock
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) cloudsaver.Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ticker := &fakeTicker{c: make(chan time.Time, 1), period: d, next: c.now.Add(d), clock: c}
+	c.tickers = append(c.tickers, ticker)
+	return ticker
+}
+
+// Advance moves the clock forward, firing the tickers which come due.  Like a time.Ticker, ticks
+// a slow reader hasn't picked up are dropped.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, ticker := range c.tickers {
+		for !ticker.next.After(c.now) {
+			select {
+			case ticker.c <- ticker.next:
+			default:
+			}
+			ticker.next = ticker.next.Add(ticker.period)
+		}
+	}
+}
+
+// waitForTickers blocks until n tickers have been created, so no tick is missed by a goroutine
+// which hasn't started its ticker yet
+func (c *fakeClock) waitForTickers(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(windowTimeout)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		count := len(c.tickers)
+		c.mu.Unlock()
+		if count >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d tickers", n)
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, ticker := range t.clock.tickers {
+		if ticker == t {
+			t.clock.tickers = append(t.clock.tickers[:i], t.clock.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+// harness runs a CloudSaver end to end, New -> Init -> Provide, against the mock cloud, a fake
+// Traefik API and metrics endpoint the test controls, and a fake clock.  Each window is driven
+// explicitly with runWindow.
+type harness struct {
+	t       *testing.T
+	clock   *fakeClock
+	saver   *cloudsaver.CloudSaver
+	cloud   *mock.Service
+	configs chan json.Marshaler
+	window  time.Duration
+
+	mu           sync.Mutex
+	routers      map[string]string  // service name -> router name
+	requests     map[string]float64 // service name -> successful requests counter
+	serverErrors map[string]float64 // service name -> 5xx counter
+}
+
+// newHarness starts a plugin on a 5m window with the given mock instances.  configure may adjust
+// the configuration before the plugin is created.
+func newHarness(t *testing.T, initialScale map[string]int32, configure func(*cloudsaver.Config)) *harness {
+	t.Helper()
+
+	h := &harness{
+		t:            t,
+		clock:        newFakeClock(),
+		configs:      make(chan json.Marshaler),
+		routers:      make(map[string]string),
+		requests:     make(map[string]float64),
+		serverErrors: make(map[string]float64),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(h.serveHTTP))
+	t.Cleanup(server.Close)
+
+	config := cloudsaver.CreateConfig()
+	config.WindowSize = "5m"
+	config.MetricsURL = server.URL + "/metrics"
+	config.APIURL = server.URL + "/api"
+	config.CloudConfig = &common.CloudServiceConfig{
+		Type:         "mock",
+		InitialScale: initialScale,
+	}
+	if configure != nil {
+		configure(config)
+	}
+
+	window, err := time.ParseDuration(config.WindowSize)
+	if err != nil {
+		t.Fatalf("invalid window size: %v", err)
+	}
+	h.window = window
+
+	h.saver, err = cloudsaver.New(context.Background(), config, "cloud-saver", cloudsaver.WithClock(h.clock))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if err := h.saver.Init(); err != nil {
+		t.Fatalf("Init() failed: %v", err)
+	}
+
+	var ok bool
+	h.cloud, ok = h.saver.CloudService().(*mock.Service)
+	if !ok {
+		t.Fatalf("expected the mock cloud service, got %T", h.saver.CloudService())
+	}
+
+	if err := h.saver.Provide(h.configs); err != nil {
+		t.Fatalf("Provide() failed: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := h.saver.Stop(); err != nil {
+			t.Errorf("Stop() failed: %v", err)
+		}
+	})
+	h.clock.waitForTickers(t, 1)
+
+	return h
+}
+
+// serveHTTP fakes the Traefik API and its Prometheus metrics
+func (h *harness) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/metrics":
+		for _, service := range sortedKeys(h.requests) {
+			fmt.Fprintf(w, "traefik_service_requests_total{service=%q,code=\"200\"} %v\n", service, h.requests[service])
+		}
+		for _, service := range sortedKeys(h.serverErrors) {
+			fmt.Fprintf(w, "traefik_service_requests_total{service=%q,code=\"503\"} %v\n", service, h.serverErrors[service])
+		}
+	case r.URL.Path == "/api/http/routers":
+		routers := make([]cloudsaver.TraefikRouter, 0, len(h.routers))
+		for _, service := range sortedKeys(h.routers) {
+			routers = append(routers, cloudsaver.TraefikRouter{
+				Name:        h.routers[service],
+				Service:     service,
+				Rule:        "Host(`" + strings.Split(service, "@")[0] + ".localhost`)",
+				Provider:    "docker",
+				Status:      "enabled",
+				EntryPoints: []string{"web"},
+			})
+		}
+		_ = json.NewEncoder(w).Encode(routers)
+	case strings.HasPrefix(r.URL.Path, "/api/http/services/"):
+		service := strings.TrimPrefix(r.URL.Path, "/api/http/services/")
+		router, ok := h.routers[service]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": service, "usedBy": []string{router}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// addService registers a Traefik service, and the router in front of it, with the fake API
+func (h *harness) addService(service, router string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.routers[service] = router
+	if _, ok := h.requests[service]; !ok {
+		h.requests[service] = 0
+	}
+}
+
+// addRequests adds successful requests to a service's counter
+func (h *harness) addRequests(service string, n float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.requests[service] += n
+}
+
+// addServerErrors adds 5xx responses to a service's counter
+func (h *harness) addServerErrors(service string, n float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.serverErrors[service] += n
+}
+
+// runWindow advances the clock by one window and returns the configuration the plugin produced
+func (h *harness) runWindow() *dynamic.Configuration {
+	h.t.Helper()
+	h.clock.Advance(h.window)
+
+	select {
+	case configuration := <-h.configs:
+		payload, ok := configuration.(*dynamic.JSONPayload)
+		if !ok {
+			h.t.Fatalf("unexpected configuration type %T", configuration)
+		}
+		return payload.Configuration
+	case <-time.After(windowTimeout):
+		h.t.Fatalf("no configuration produced for the window ending %v", h.clock.Now())
+		return nil
+	}
+}
+
+// scale returns the current scale of a mock instance
+func (h *harness) scale(instance string) int32 {
+	h.t.Helper()
+	scale, err := h.cloud.GetCurrentScale(context.Background(), instance)
+	if err != nil {
+		h.t.Fatalf("GetCurrentScale(%s) failed: %v", instance, err)
+	}
+	return scale
+}
+
+// sleepingRouters lists the routers the plugin generated for sleeping services
+func sleepingRouters(configuration *dynamic.Configuration) []string {
+	return sortedKeys(configuration.HTTP.Routers)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
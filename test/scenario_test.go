@@ -0,0 +1,61 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+
+	cloudsaver "github.com/danbiagini/traefik-cloud-saver"
+)
+
+func TestScenarioSleepWakeAndMinUptime(t *testing.T) {
+	h := newHarness(t, map[string]int32{"app": 1}, func(c *cloudsaver.Config) {
+		c.WakeOnServerErrors = true
+		c.CloudConfig.Labels = map[string]map[string]string{"app": {"cloudsaver-min-uptime": "30m"}}
+	})
+	h.addService("app@docker", "app@docker")
+
+	// busy: the first window has no baseline, the whole counter is this window's traffic
+	h.addRequests("app@docker", 100)
+	configuration := h.runWindow()
+	if scale := h.scale("app"); scale != 1 {
+		t.Fatalf("window 1: expected app to stay up, got scale %d", scale)
+	}
+	if routers := sleepingRouters(configuration); len(routers) != 0 {
+		t.Errorf("window 1: expected no sleeping routers, got %v", routers)
+	}
+
+	// idle: scaled down, and a sleeping router answers in its place
+	configuration = h.runWindow()
+	if scale := h.scale("app"); scale != 0 {
+		t.Fatalf("window 2: expected app to be scaled down, got scale %d", scale)
+	}
+	if routers := sleepingRouters(configuration); !reflect.DeepEqual(routers, []string{"cloud-saver-app"}) {
+		t.Errorf("window 2: expected the sleeping router, got %v", routers)
+	}
+
+	// someone hits the sleeping router: woken up right away
+	h.addServerErrors("cloud-saver-sleeping-app@plugin-cloud-saver", 3)
+	configuration = h.runWindow()
+	if scale := h.scale("app"); scale != 1 {
+		t.Fatalf("window 3: expected app to be woken up, got scale %d", scale)
+	}
+	if routers := sleepingRouters(configuration); len(routers) != 0 {
+		t.Errorf("window 3: expected the sleeping router to be removed, got %v", routers)
+	}
+
+	// idle again, but the instance's min uptime holds it up for 30m after the scale up
+	for window := 4; window < 9; window++ {
+		h.runWindow()
+		if scale := h.scale("app"); scale != 1 {
+			t.Fatalf("window %d: expected min uptime to keep app up, got scale %d", window, scale)
+		}
+	}
+
+	configuration = h.runWindow()
+	if scale := h.scale("app"); scale != 0 {
+		t.Fatalf("window 9: expected app to be scaled down once min uptime passed, got scale %d", scale)
+	}
+	if routers := sleepingRouters(configuration); !reflect.DeepEqual(routers, []string{"cloud-saver-app"}) {
+		t.Errorf("window 9: expected the sleeping router, got %v", routers)
+	}
+}
@@ -0,0 +1,171 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+	"github.com/danbiagini/traefik-cloud-saver/cloud/mock"
+)
+
+// testBackend fakes both the Traefik API and the Prometheus metrics endpoint
+type testBackend struct {
+	mu          sync.Mutex
+	metrics     string
+	contentType string
+	usedBy      map[string][]string // service name -> routers using it
+	routers     []*TraefikRouter
+	tcpUsedBy   map[string][]string // the same for tcp services and routers
+	tcpRouters  []*TraefikRouter
+	server      *httptest.Server
+}
+
+func newTestBackend(t testing.TB) *testBackend {
+	t.Helper()
+
+	b := &testBackend{
+		usedBy:    make(map[string][]string),
+		tcpUsedBy: make(map[string][]string),
+	}
+
+	b.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/metrics":
+			if b.contentType != "" {
+				w.Header().Set("Content-Type", b.contentType)
+			}
+			_, _ = w.Write([]byte(b.metrics))
+		case r.URL.Path == "/api/http/routers":
+			_ = json.NewEncoder(w).Encode(b.routers)
+		case r.URL.Path == "/api/tcp/routers":
+			_ = json.NewEncoder(w).Encode(b.tcpRouters)
+		case strings.HasPrefix(r.URL.Path, "/api/http/services/"):
+			b.serveService(w, r, b.usedBy[strings.TrimPrefix(r.URL.Path, "/api/http/services/")])
+		case strings.HasPrefix(r.URL.Path, "/api/tcp/services/"):
+			b.serveService(w, r, b.tcpUsedBy[strings.TrimPrefix(r.URL.Path, "/api/tcp/services/")])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(b.server.Close)
+
+	return b
+}
+
+// serveService answers a service lookup with the routers using it, or not found when there's none
+func (b *testBackend) serveService(w http.ResponseWriter, r *http.Request, routers []string) {
+	if routers == nil {
+		http.NotFound(w, r)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":   r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:],
+		"usedBy": routers,
+	})
+}
+
+// setMetrics replaces the body (and optionally the content type) served from /metrics
+func (b *testBackend) setMetrics(body, contentType string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.metrics = body
+	b.contentType = contentType
+}
+
+// addService registers a service, and an enabled router for each of the given router names,
+// with the fake Traefik API
+func (b *testBackend) addService(serviceName string, routers ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.usedBy[serviceName] = routers
+	for _, routerName := range routers {
+		b.routers = append(b.routers, &TraefikRouter{
+			Name:        routerName,
+			Service:     serviceName,
+			Rule:        "Host(`" + stripProvider(routerName) + ".localhost`)",
+			Provider:    "docker",
+			Status:      "enabled",
+			EntryPoints: []string{"web"},
+		})
+	}
+}
+
+// addTCPService registers a tcp service, and an enabled tcp router for each of the given router
+// names, with the fake Traefik API
+func (b *testBackend) addTCPService(serviceName string, routers ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tcpUsedBy[serviceName] = routers
+	for _, routerName := range routers {
+		b.tcpRouters = append(b.tcpRouters, &TraefikRouter{
+			Name:        routerName,
+			Service:     serviceName,
+			Rule:        "HostSNI(`*`)",
+			Provider:    "docker",
+			Status:      "enabled",
+			EntryPoints: []string{"postgres"},
+		})
+	}
+}
+
+// removeService makes the fake Traefik API forget about a service and its routers
+func (b *testBackend) removeService(serviceName string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.usedBy, serviceName)
+
+	routers := b.routers[:0]
+	for _, router := range b.routers {
+		if router.Service != serviceName {
+			routers = append(routers, router)
+		}
+	}
+	b.routers = routers
+}
+
+// newTestSaver creates a CloudSaver wired to the test backend and a mock cloud service
+func newTestSaver(t testing.TB, b *testBackend, initialScale map[string]int32, configure func(*Config), options ...CloudSaverOption) (*CloudSaver, *mock.Service) {
+	t.Helper()
+
+	config := CreateConfig()
+	config.WindowSize = "1s"
+	config.testMode = true
+	config.CloudConfig = &common.CloudServiceConfig{
+		Type:         "mock",
+		InitialScale: initialScale,
+	}
+	if configure != nil {
+		configure(config)
+	}
+
+	options = append([]CloudSaverOption{WithAPIURL(b.server.URL + "/api"), WithMetricsURL(b.server.URL + "/metrics")}, options...)
+	saver, err := New(context.Background(), config, "test", options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockService, ok := saver.cloudService.(*mock.Service)
+	if !ok {
+		t.Fatalf("expected mock cloud service, got %T", saver.cloudService)
+	}
+
+	return saver, mockService
+}
+
+// currentScale returns the mock scale of a service, failing the test on error
+func currentScale(t *testing.T, svc *mock.Service, serviceName string) int32 {
+	t.Helper()
+	scale, err := svc.GetCurrentScale(context.Background(), serviceName)
+	if err != nil {
+		t.Fatalf("GetCurrentScale(%s) failed: %v", serviceName, err)
+	}
+	return scale
+}
@@ -0,0 +1,81 @@
+package traefik_cloud_saver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+const (
+	// sleepingTransport is the servers transport of the generated services answering for sleeping ones
+	sleepingTransport = configPrefix + "sleeping-transport"
+
+	// sleepingRetryMiddleware retries the requests for a sleeping service
+	sleepingRetryMiddleware = configPrefix + "sleeping-retry"
+)
+
+// ScaledDownTransport tunes how Traefik forwards the requests for a scaled down service, so they
+// wait on a backend which is cold starting rather than failing fast
+type ScaledDownTransport struct {
+	DialTimeout           string `json:"dialTimeout,omitempty"`           // e.g. 30s, how long to wait on a connection
+	ResponseHeaderTimeout string `json:"responseHeaderTimeout,omitempty"` // e.g. 60s, how long to wait on a response once connected
+	RetryAttempts         int    `json:"retryAttempts,omitempty"`         // retry a request this many times when the backend can't be reached
+	RetryInterval         string `json:"retryInterval,omitempty"`         // initial wait between retries, e.g. 1s
+}
+
+// validate checks the durations parse and the retries make sense
+func (t *ScaledDownTransport) validate() error {
+	for name, value := range map[string]string{
+		"dial timeout":            t.DialTimeout,
+		"response header timeout": t.ResponseHeaderTimeout,
+		"retry interval":          t.RetryInterval,
+	} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("scaled down transport %s must be a positive duration, got %q", name, value)
+		}
+	}
+	if t.RetryAttempts < 0 {
+		return fmt.Errorf("scaled down transport retry attempts must be non-negative, got %d", t.RetryAttempts)
+	}
+	if t.RetryInterval != "" && t.RetryAttempts == 0 {
+		return fmt.Errorf("scaled down transport retry interval needs retry attempts")
+	}
+	return nil
+}
+
+// addTransport attaches the scaled down transport to the generated services answering for sleeping
+// ones, and puts the retries in front of the middlewares of their routers
+func (p *CloudSaver) addTransport(httpConfig *dynamic.HTTPConfiguration) {
+	t := p.scaledDownTransport
+	if t == nil || len(httpConfig.Routers) == 0 {
+		return
+	}
+
+	if t.DialTimeout != "" || t.ResponseHeaderTimeout != "" {
+		httpConfig.ServersTransports[sleepingTransport] = &dynamic.ServersTransport{
+			ForwardingTimeouts: &dynamic.ForwardingTimeouts{
+				DialTimeout:           t.DialTimeout,
+				ResponseHeaderTimeout: t.ResponseHeaderTimeout,
+			},
+		}
+		for _, service := range httpConfig.Services {
+			service.LoadBalancer.ServersTransport = sleepingTransport
+		}
+	}
+
+	if t.RetryAttempts > 0 {
+		httpConfig.Middlewares[sleepingRetryMiddleware] = &dynamic.Middleware{
+			Retry: &dynamic.Retry{
+				Attempts:        t.RetryAttempts,
+				InitialInterval: t.RetryInterval,
+			},
+		}
+		for _, router := range httpConfig.Routers {
+			router.Middlewares = append([]string{sleepingRetryMiddleware}, router.Middlewares...)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScaledDownTransport(t *testing.T) {
+	tests := []struct {
+		name            string
+		transport       *ScaledDownTransport
+		wantTransport   bool
+		wantMiddlewares []string
+	}{
+		{name: "none", wantMiddlewares: []string{sleepingHeadersMiddleware}},
+		{
+			name:            "timeouts",
+			transport:       &ScaledDownTransport{DialTimeout: "30s", ResponseHeaderTimeout: "1m"},
+			wantTransport:   true,
+			wantMiddlewares: []string{sleepingHeadersMiddleware},
+		},
+		{
+			name:            "timeouts and retries",
+			transport:       &ScaledDownTransport{DialTimeout: "30s", RetryAttempts: 3, RetryInterval: "1s"},
+			wantTransport:   true,
+			wantMiddlewares: []string{sleepingRetryMiddleware, sleepingHeadersMiddleware},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			backend.addService("idle@docker", "idle@docker")
+			backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+			saver, _ := newTestSaver(t, backend, map[string]int32{"idle": 1}, func(c *Config) {
+				c.ScaledDownTransport = tt.transport
+			})
+			if err := saver.Init(); err != nil {
+				t.Fatalf("Init() failed: %v", err)
+			}
+
+			payload, err := saver.generateConfiguration(context.Background())
+			if err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+			httpConfig := payload.Configuration.HTTP
+			router, ok := httpConfig.Routers[configPrefix+"idle"]
+			if !ok {
+				t.Fatalf("expected idle to be shadowed, got %v", httpConfig.Routers)
+			}
+
+			service := httpConfig.Services[router.Service]
+			transport, ok := httpConfig.ServersTransports[sleepingTransport]
+			switch {
+			case ok != tt.wantTransport:
+				t.Errorf("got transports %v, want one: %v", httpConfig.ServersTransports, tt.wantTransport)
+			case tt.wantTransport && service.LoadBalancer.ServersTransport != sleepingTransport:
+				t.Errorf("service %s uses transport %q, want %s", router.Service, service.LoadBalancer.ServersTransport, sleepingTransport)
+			case tt.wantTransport && transport.ForwardingTimeouts.DialTimeout != tt.transport.DialTimeout:
+				t.Errorf("dial timeout = %q, want %q", transport.ForwardingTimeouts.DialTimeout, tt.transport.DialTimeout)
+			}
+
+			if len(router.Middlewares) != len(tt.wantMiddlewares) {
+				t.Fatalf("middlewares = %v, want %v", router.Middlewares, tt.wantMiddlewares)
+			}
+			for i, name := range tt.wantMiddlewares {
+				if router.Middlewares[i] != name {
+					t.Errorf("middlewares = %v, want %v", router.Middlewares, tt.wantMiddlewares)
+				}
+				if _, ok := httpConfig.Middlewares[name]; !ok {
+					t.Errorf("middleware %s isn't defined", name)
+				}
+			}
+		})
+	}
+}
+
+func TestScaledDownTransportValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		behavior  string
+		transport *ScaledDownTransport
+	}{
+		{name: "bad timeout", transport: &ScaledDownTransport{DialTimeout: "soon"}},
+		{name: "negative attempts", transport: &ScaledDownTransport{RetryAttempts: -1}},
+		{name: "interval without attempts", transport: &ScaledDownTransport{RetryInterval: "1s"}},
+		{name: "nothing rendered", behavior: scaledDownLeave, transport: &ScaledDownTransport{DialTimeout: "30s"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.ScaledDownBehavior = tt.behavior
+			config.ScaledDownTransport = tt.transport
+			if err := config.Validate(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+	"github.com/danbiagini/traefik-cloud-saver/cloud/mock"
+)
+
+// blindService is a provider which can scale, but can't report the current scale
+type blindService struct {
+	*mock.Service
+}
+
+func (s *blindService) GetCurrentScale(_ context.Context, _ string) (int32, error) {
+	return 0, common.ErrUnsupported
+}
+
+func TestGetCurrentScaleUnsupported(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.addService("busy@docker", "busy@docker")
+	backend.setMetrics(`
+traefik_service_requests_total{service="idle@docker"} 0
+traefik_service_requests_total{service="busy@docker"} 100
+`, "")
+
+	saver, svc := newTestSaver(t, backend, map[string]int32{"idle": 1, "busy": 1}, func(c *Config) {
+		c.WakeOnServerErrors = true
+		c.ScaleVerifyDelay = "1ms"
+	})
+	saver.cloudService = &blindService{Service: svc}
+
+	// the scale down can't be confirmed, the service is assumed to be asleep
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("first generateConfiguration() failed: %v", err)
+	}
+	if !saver.stateless {
+		t.Error("expected the plugin to fall back to stateless scaling")
+	}
+	if scale := currentScale(t, svc, "idle"); scale != 0 {
+		t.Errorf("expected idle to be scaled down, got %d", scale)
+	}
+	if _, ok := saver.sleeping["idle@docker"]; !ok {
+		t.Errorf("expected idle@docker to be sleeping, got %v", saver.sleeping)
+	}
+	if saver.summary.reverted != 0 {
+		t.Errorf("expected no reverted actions without a scale to check, got %d", saver.summary.reverted)
+	}
+
+	// it stays asleep until it's woken, here by requests failing against it
+	backend.setMetrics(`
+traefik_service_requests_total{service="idle@docker"} 0
+traefik_service_requests_total{service="idle@docker",code="503"} 3
+traefik_service_requests_total{service="busy@docker"} 200
+`, "")
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("second generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, svc, "idle"); scale != 1 {
+		t.Errorf("expected idle to be scaled up, got %d", scale)
+	}
+	if _, ok := saver.sleeping["idle@docker"]; ok {
+		t.Errorf("expected idle@docker to be awake, got %v", saver.sleeping)
+	}
+}
+
+func TestGetCurrentScaleUnsupportedTrafficWake(t *testing.T) {
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+	clock := &stepClock{now: time.Now()}
+	saver, svc := newTestSaver(t, backend, map[string]int32{"idle": 1}, nil, WithClock(clock))
+	saver.cloudService = &blindService{Service: svc}
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("first generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, svc, "idle"); scale != 0 {
+		t.Fatalf("expected idle to be scaled down, got %d", scale)
+	}
+
+	// requests get through again, with no scale to check the sleeping service is scaled up anyway
+	clock.now = clock.now.Add(time.Minute)
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 10`, "")
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("second generateConfiguration() failed: %v", err)
+	}
+	if scale := currentScale(t, svc, "idle"); scale != 1 {
+		t.Errorf("expected idle to be scaled up, got %d", scale)
+	}
+	if count := saver.decisions.count("idle@docker", actionScaleUp, reasonAboveThreshold); count != 1 {
+		t.Errorf("expected 1 scale up on traffic, got %d", count)
+	}
+	if _, ok := saver.sleeping["idle@docker"]; ok {
+		t.Errorf("expected idle@docker to be awake, got %v", saver.sleeping)
+	}
+}
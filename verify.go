@@ -0,0 +1,76 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// scaleCheck is a scale action taken this window, to be verified once scaleVerifyDelay has passed
+type scaleCheck struct {
+	cloudName string
+	action    string
+	before    int32 // scale before a scale down
+	target    int32 // scale expected after a scale up
+}
+
+// expectScaleDown records a scale down to verify at the end of the window.  before is the scale
+// the service had beforehand, or -1 if it couldn't be read.
+func (p *CloudSaver) expectScaleDown(cloudServiceName string, before int32) {
+	if p.scaleVerifyDelay <= 0 || before < 0 {
+		return
+	}
+	p.scaleChecks = append(p.scaleChecks, scaleCheck{cloudName: cloudServiceName, action: actionScaleDown, before: before})
+}
+
+// expectScaleUp records a scale up to verify at the end of the window
+func (p *CloudSaver) expectScaleUp(cloudServiceName string) {
+	if p.scaleVerifyDelay <= 0 {
+		return
+	}
+	p.scaleChecks = append(p.scaleChecks, scaleCheck{cloudName: cloudServiceName, action: actionScaleUp, target: p.scaleUpTarget(cloudServiceName)})
+}
+
+// verifyScaleActions waits scaleVerifyDelay, then checks the scale actions of this window actually
+// took effect.  Cloud APIs can be eventually consistent, and an external autoscaler may undo what
+// we did straight away, so a reverted action is alerted on and counted in the window summary.
+func (p *CloudSaver) verifyScaleActions(ctx context.Context) {
+	checks := p.scaleChecks
+	p.scaleChecks = nil
+	if len(checks) == 0 {
+		return
+	}
+
+	timer := time.NewTimer(p.scaleVerifyDelay)
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+		return
+	case <-timer.C:
+	}
+
+	for _, check := range checks {
+		scale, err := p.cloudService.GetCurrentScale(ctx, check.cloudName)
+		if p.scaleUnsupported(err) {
+			continue
+		}
+		if err != nil {
+			common.LogProvider("traefik-cloud-saver", "[WARNING] unable to verify %s of service %s: %v", check.action, check.cloudName, err)
+			continue
+		}
+
+		switch {
+		case check.action == actionScaleDown && scale >= check.before:
+			common.LogProvider("traefik-cloud-saver", "[ALERT]: scale down of service %s was reverted, scale is %d again %v later (something else may be scaling it up)",
+				check.cloudName, scale, p.scaleVerifyDelay)
+		case check.action == actionScaleUp && scale < check.target:
+			common.LogProvider("traefik-cloud-saver", "[ALERT]: scale up of service %s was reverted, scale is %d instead of %d %v later (something else may be scaling it down)",
+				check.cloudName, scale, check.target, p.scaleVerifyDelay)
+		default:
+			common.DebugLog("traefik-cloud-saver", "verified %s of service %s, scale is %d", check.action, check.cloudName, scale)
+			continue
+		}
+		p.summary.reverted++
+	}
+}
@@ -0,0 +1,71 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud"
+	"github.com/danbiagini/traefik-cloud-saver/cloud/mock"
+)
+
+// revertingService undoes every scale down straight away, like a competing autoscaler would
+type revertingService struct {
+	cloud.Service
+	mock *mock.Service
+}
+
+func (s *revertingService) ScaleDown(ctx context.Context, serviceName string) error {
+	if err := s.mock.ScaleDown(ctx, serviceName); err != nil {
+		return err
+	}
+	s.mock.SetScale(serviceName, 1)
+	return nil
+}
+
+func TestScaleVerification(t *testing.T) {
+	tests := []struct {
+		name         string
+		revert       bool
+		wantReverted int
+	}{
+		{name: "scale down sticks", revert: false, wantReverted: 0},
+		{name: "scale down reverted", revert: true, wantReverted: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			backend.addService("idle@docker", "idle@docker")
+			backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+			saver, svc := newTestSaver(t, backend, map[string]int32{"idle": 1}, func(c *Config) {
+				c.ScaleVerifyDelay = "10ms"
+			})
+			if tt.revert {
+				saver.cloudService = &revertingService{Service: svc, mock: svc}
+			}
+
+			if _, err := saver.generateConfiguration(context.Background()); err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+			if saver.summary.reverted != tt.wantReverted {
+				t.Errorf("expected %d reverted actions, got %d", tt.wantReverted, saver.summary.reverted)
+			}
+			if len(saver.scaleChecks) != 0 {
+				t.Errorf("expected scale checks to be consumed, got %v", saver.scaleChecks)
+			}
+		})
+	}
+}
+
+func TestScaleVerifyDelayValidation(t *testing.T) {
+	for _, delay := range []string{"soon", "-1s", "1s"} {
+		config := CreateConfig()
+		config.WindowSize = "1s"
+		config.testMode = true
+		config.ScaleVerifyDelay = delay
+		if _, err := New(context.Background(), config, "test"); err == nil {
+			t.Errorf("expected error for scale verify delay %q", delay)
+		}
+	}
+}
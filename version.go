@@ -0,0 +1,84 @@
+package traefik_cloud_saver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/danbiagini/traefik-cloud-saver/cloud/common"
+)
+
+// Version and Commit identify the build, set with e.g.
+// -ldflags "-X github.com/danbiagini/traefik-cloud-saver.Version=v0.2.0 -X github.com/danbiagini/traefik-cloud-saver.Commit=abc123"
+var (
+	Version = "dev"
+	Commit  = "unknown"
+)
+
+// buildInfoMetric is the name of the gauge exposing the build, always 1
+const buildInfoMetric = "cloudsaver_build_info"
+
+// healthSnapshot is the state served on the health endpoint
+type healthSnapshot struct {
+	Version     string    `json:"version"`
+	Commit      string    `json:"commit"`
+	GoVersion   string    `json:"goVersion"`
+	StartedAt   time.Time `json:"startedAt"`
+	Window      int       `json:"window"`                // number of the last completed window, 0 before the first
+	WindowEnd   time.Time `json:"windowEnd,omitempty"`   // when the last window completed
+	Sleeping    int       `json:"sleeping"`              // services currently scaled down
+	LastErrors  int       `json:"lastErrors,omitempty"`  // errors in the last window
+	Quarantined []string  `json:"quarantined,omitempty"` // cloud services the provider refuses to scale
+}
+
+// healthState is the part of the health snapshot updated by the window loop
+type healthState struct {
+	mu       sync.Mutex
+	snapshot healthSnapshot
+}
+
+func newHealthState(startedAt time.Time) *healthState {
+	return &healthState{snapshot: healthSnapshot{
+		Version:   Version,
+		Commit:    Commit,
+		GoVersion: runtime.Version(),
+		StartedAt: startedAt,
+	}}
+}
+
+// windowDone records the outcome of a completed window
+func (h *healthState) windowDone(summary windowSummary, sleeping int, quarantined []string, end time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.snapshot.Window = summary.window
+	h.snapshot.WindowEnd = end
+	h.snapshot.Sleeping = sleeping
+	h.snapshot.LastErrors = summary.errors
+	h.snapshot.Quarantined = quarantined
+}
+
+// current returns a copy of the snapshot
+func (h *healthState) current() healthSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.snapshot
+}
+
+func (h *healthState) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.current()); err != nil {
+		common.LogProvider("traefik-cloud-saver", "[ERROR]: failed to write health snapshot: %v", err)
+	}
+}
+
+// writeBuildInfo writes the build info gauge in the Prometheus text format
+func writeBuildInfo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s Build of cloud saver, always 1.\n", buildInfoMetric)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", buildInfoMetric)
+	fmt.Fprintf(w, "%s{version=\"%s\",commit=\"%s\",goversion=\"%s\"} 1\n",
+		buildInfoMetric, escapeLabelValue(Version), escapeLabelValue(Commit), runtime.Version())
+}
@@ -0,0 +1,54 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHealthSnapshotVersion(t *testing.T) {
+	version, commit := Version, Commit
+	Version, Commit = "v1.2.3", "abc123"
+	t.Cleanup(func() { Version, Commit = version, commit })
+
+	backend := newTestBackend(t)
+	backend.addService("idle@docker", "idle@docker")
+	backend.setMetrics(`traefik_service_requests_total{service="idle@docker"} 0`, "")
+
+	saver, _ := newTestSaver(t, backend, map[string]int32{"idle": 1}, func(c *Config) {
+		c.SelfMetricsAddress = "127.0.0.1:0"
+	})
+	if err := saver.startSelfMetrics(); err != nil {
+		t.Fatalf("startSelfMetrics() failed: %v", err)
+	}
+	defer saver.selfMetricsServer.Close()
+
+	if _, err := saver.generateConfiguration(context.Background()); err != nil {
+		t.Fatalf("generateConfiguration() failed: %v", err)
+	}
+
+	baseURL := "http://" + saver.selfMetricsListener.Addr().String()
+	resp, err := http.Get(baseURL + "/health")
+	if err != nil {
+		t.Fatalf("GET /health failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var snapshot healthSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		t.Fatalf("failed to decode health snapshot: %v", err)
+	}
+	if snapshot.Version != "v1.2.3" || snapshot.Commit != "abc123" {
+		t.Errorf("health snapshot version = %s (%s), want v1.2.3 (abc123)", snapshot.Version, snapshot.Commit)
+	}
+	if snapshot.Window != 1 || snapshot.Sleeping != 1 {
+		t.Errorf("health snapshot = %+v, want window 1 with 1 sleeping service", snapshot)
+	}
+
+	body := scrapeDecisions(t, baseURL+"/metrics")
+	if want := `cloudsaver_build_info{version="v1.2.3",commit="abc123"`; !strings.Contains(body, want) {
+		t.Errorf("expected %q in scrape:\n%s", want, body)
+	}
+}
@@ -0,0 +1,49 @@
+package traefik_cloud_saver
+
+import (
+	"strings"
+)
+
+// defaultServiceWeight is how much a service's traffic counts when no weight is configured
+const defaultServiceWeight = 1.0
+
+// instanceMember is a traefik service backed by a cloud service, along with its rate this window
+type instanceMember struct {
+	serviceName string
+	routerNames []string // the monitored routers in front of it
+	protocol    string   // of the routers, http or tcp
+	rate        *ServiceRate
+}
+
+// serviceWeight returns the configured weight of a traefik service
+func (p *CloudSaver) serviceWeight(serviceName string) float64 {
+	if weight, ok := p.serviceWeights[stripProvider(serviceName)]; ok {
+		return weight
+	}
+	return defaultServiceWeight
+}
+
+// effectiveRate is the weighted sum of the rates of the traefik services sharing a cloud service.
+// A low weight keeps a low-priority service's traffic from holding the instance up on its own.
+func (p *CloudSaver) effectiveRate(members []*instanceMember) *ServiceRate {
+	effective := &ServiceRate{}
+	for _, member := range members {
+		weight := p.serviceWeight(member.serviceName)
+		effective.Total += member.rate.Total * weight
+		effective.PerMin += member.rate.PerMin * weight
+		effective.ServerErrors += member.rate.ServerErrors
+		if member.rate.Duration > effective.Duration {
+			effective.Duration = member.rate.Duration
+		}
+	}
+	return effective
+}
+
+// memberNames lists the traefik services sharing a cloud service, for logging
+func memberNames(members []*instanceMember) string {
+	names := make([]string, 0, len(members))
+	for _, member := range members {
+		names = append(names, member.serviceName)
+	}
+	return strings.Join(names, ", ")
+}
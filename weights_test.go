@@ -0,0 +1,84 @@
+package traefik_cloud_saver
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWeightedSharedInstance(t *testing.T) {
+	tests := []struct {
+		name      string
+		weights   map[string]float64
+		metrics   string
+		wantScale int32
+	}{
+		{
+			name:    "unweighted traffic to any service keeps the instance up",
+			weights: nil,
+			metrics: `
+traefik_service_requests_total{service="app@docker"} 0
+traefik_service_requests_total{service="crawler@docker"} 5
+`,
+			wantScale: 1,
+		},
+		{
+			name:    "idle important service outweighs a busy low priority one",
+			weights: map[string]float64{"crawler": 0.1},
+			metrics: `
+traefik_service_requests_total{service="app@docker"} 0
+traefik_service_requests_total{service="crawler@docker"} 5
+`,
+			wantScale: 0,
+		},
+		{
+			name:    "heavily weighted service with a trickle of traffic keeps the instance up",
+			weights: map[string]float64{"app": 10, "crawler": 0},
+			metrics: `
+traefik_service_requests_total{service="app@docker"} 0.5
+traefik_service_requests_total{service="crawler@docker"} 50
+`,
+			wantScale: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t)
+			backend.addService("app@docker", "app@docker")
+			backend.addService("crawler@docker", "crawler@docker")
+			backend.setMetrics(tt.metrics, "")
+
+			saver, cloud := newTestSaver(t, backend, map[string]int32{"vm1": 1}, func(c *Config) {
+				c.WindowSize = "1m"
+				c.ServiceInstances = map[string]string{"app": "vm1", "crawler": "vm1"}
+				c.ServiceWeights = tt.weights
+			})
+
+			if _, err := saver.generateConfiguration(context.Background()); err != nil {
+				t.Fatalf("generateConfiguration() failed: %v", err)
+			}
+
+			if scale := currentScale(t, cloud, "vm1"); scale != tt.wantScale {
+				t.Errorf("expected vm1 scale %d, got %d", tt.wantScale, scale)
+			}
+
+			// both services are shadowed together when the instance goes down
+			if tt.wantScale == 0 && len(saver.sleeping) != 2 {
+				t.Errorf("expected both services to be sleeping, got %v", saver.sleeping)
+			}
+		})
+	}
+}
+
+func TestEffectiveRate(t *testing.T) {
+	saver := &CloudSaver{serviceWeights: map[string]float64{"low": 0.25, "high": 4}}
+	members := []*instanceMember{
+		{serviceName: "low@docker", rate: &ServiceRate{PerMin: 8}},
+		{serviceName: "high@docker", rate: &ServiceRate{PerMin: 1}},
+		{serviceName: "default@docker", rate: &ServiceRate{PerMin: 3}},
+	}
+
+	if got := saver.effectiveRate(members).PerMin; got != 9 {
+		t.Errorf("effectiveRate() = %v, want 9", got)
+	}
+}